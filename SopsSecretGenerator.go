@@ -5,334 +5,485 @@
 package main
 
 import (
-	"bufio"
 	"bytes"
-	"encoding/base64"
+	"context"
 	"encoding/json"
+	"flag"
 	"fmt"
 	"io/ioutil"
 	"os"
-	"path"
+	"path/filepath"
+	"strconv"
 	"strings"
-	"unicode"
-	"unicode/utf8"
+	"time"
 
+	"github.com/goabout/kustomize-sopssecretgenerator/generator"
 	"github.com/pkg/errors"
 	"go.mozilla.org/sops"
-	sopscommon "go.mozilla.org/sops/cmd/sops/common"
-	sopsdecrypt "go.mozilla.org/sops/decrypt"
 	"gopkg.in/yaml.v2"
 )
 
-const apiVersion = "goabout.com/v1beta1"
-const kind = "SopsSecretGenerator"
-const oldKind = "SopsSecret"
+// Environment variables with the spec and its directory, which kustomize
+// sets when it runs exec plugins
+const (
+	pluginConfigStringEnv = "KUSTOMIZE_PLUGIN_CONFIG_STRING"
+	pluginConfigRootEnv   = "KUSTOMIZE_PLUGIN_CONFIG_ROOT"
+)
 
-var utf8bom = []byte{0xEF, 0xBB, 0xBF}
+// Commands that check or update the spec files that follow them instead of
+// generating Secrets
+const (
+	validateCommand   = "validate"
+	verifyCommand     = "verify"
+	updateKeysCommand = "updatekeys"
+)
 
-type kvMap map[string]string
+// ignoreMACEnv enables --ignore-mac when kustomize runs the generator, which
+// does not pass options
+const ignoreMACEnv = "SOPSSECRETGENERATOR_IGNORE_MAC"
+
+// policyEnv sets the default of --policy, so that an organization can enforce
+// a policy when kustomize runs the generator
+const policyEnv = "SOPSSECRETGENERATOR_POLICY"
+
+// Exit codes, which tell scripts what kind of failure occurred
+const (
+	exitUsage  = 1
+	exitError  = 2
+	exitSpec   = 3
+	exitSource = 4
+	exitIO     = 5
+)
 
-// TypeMeta defines the resource type
-type TypeMeta struct {
-	APIVersion string `json:"apiVersion" yaml:"apiVersion"`
-	Kind       string `json:"kind" yaml:"kind"`
-}
+func main() {
+	opts := generator.Options{Warnings: os.Stderr}
+	var commonLabelsFile string
+	var policyFile string
+	var printExample bool
+	var splitDir string
+	var transformFile string
+	var keysOnly bool
+	var summaryFile string
+	var summaryIncludeKeys bool
+	var timeout time.Duration
+	flag.StringVar(&opts.Namespace, "namespace", "", "override the namespace of the generated Secret")
+	flag.StringVar(&commonLabelsFile, "common-labels-file", "", "add the labels from a YAML `FILE` to the generated Secret")
+	flag.StringVar(&opts.ManagedBy, "managed-by", "", "set the app.kubernetes.io/managed-by label to `VALUE`, unless the spec sets it")
+	flag.BoolVar(&opts.ForceManagedBy, "force-managed-by", false, "let --managed-by override the label from the spec")
+	flag.BoolVar(&opts.Strict, "strict", false, "reject unknown fields in the spec")
+	flag.BoolVar(&opts.AllowEmpty, "allow-empty", false, "warn about empty sources instead of failing")
+	flag.BoolVar(&opts.UndefinedVarsError, "undefined-vars-error", false, "fail on undefined variables in sources with expandVars")
+	flag.IntVar(&opts.MaxSize, "max-size", 1024*1024, "fail if the Secret is larger than `BYTES`, or 0 for no maximum")
+	flag.StringVar(&opts.HeaderComment, "header-comment", "", "write `TEXT` as a comment before the Secret, such as \"Generated by SopsSecretGenerator; do not edit\"")
+	flag.IntVar(&opts.WrapWidth, "wrap-width", 0, "wrap the data values of the Secret at `N` columns")
+	flag.BoolVar(&opts.AnnotateProvenance, "annotate-provenance", false, "annotate the Secret with the source paths and the generation time")
+	flag.BoolVar(&opts.RotationAnnotations, "rotation-annotations", false, "annotate the Secret with the sops lastmodified time of every source")
+	flag.BoolVar(&opts.AllErrors, "all-errors", false, "report the errors of all sources instead of stopping at the first")
+	flag.BoolVar(&opts.PreserveOrder, "preserve-order", false, "keep the keys in the order of the sources instead of sorting them")
+	flag.BoolVar(&opts.SanitizeKeys, "sanitize-keys", false, "replace characters that are not allowed in keys with underscores")
+	flag.BoolVar(&printExample, "print-example", false, "print an example spec with all fields and exit")
+	flag.Var(optionalBool{&opts.DisableNameSuffixHash}, "disable-name-suffix-hash", "override the disableNameSuffixHash field of the spec (true or false)")
+	flag.BoolVar(&opts.AppendNameHash, "emit-hash", false, "append the content hash to the name, like kustomize does")
+	flag.StringVar(&splitDir, "split-dir", "", "write every key to a file in `DIR` instead of printing a Secret")
+	flag.StringVar(&transformFile, "transform", "", "replace the values of the existing Secret in `FILE` instead of generating one")
+	flag.IntVar(&opts.Retries, "retries", 0, "retry decryptions that fail with a transient error `N` times")
+	flag.DurationVar(&opts.RetryBackoff, "retry-backoff", time.Second, "wait `DURATION` before the first retry, doubling for every retry")
+	flag.StringVar(&summaryFile, "summary-json", "", "write a JSON summary of the generated Secret, without values, to `FILE`")
+	flag.BoolVar(&summaryIncludeKeys, "summary-include-keys", false, "include the key names in the --summary-json summary")
+	flag.BoolVar(&keysOnly, "keys-only", false, "print the keys of the Secret instead of the Secret, without values")
+	flag.Int64Var(&opts.MaxSourceSize, "max-source-size", 0, "fail if a source file is larger than `BYTES`")
+	flag.DurationVar(&opts.ReadTimeout, "read-timeout", 0, "abort reading a source file, such as a named pipe, after `DURATION`")
+	flag.DurationVar(&opts.FetchTimeout, "fetch-timeout", 30*time.Second, "abort downloading an https://, git::, s3:// or gs:// source after `DURATION`")
+	flag.StringVar(&opts.ValueFilter, "value-filter", "", "pipe every decrypted value through the shell command `CMD`, replacing it by the output")
+	flag.DurationVar(&opts.ValueFilterTimeout, "value-filter-timeout", 10*time.Second, "abort --value-filter after `DURATION` per value")
+	flag.Var(stringList{&opts.KeyServices}, "keyservice", "also ask the sops keyservice at `URI`, such as unix:///run/sops.sock or tcp://localhost:5000, for data keys; repeatable")
+	flag.BoolVar(&opts.DisableLocalKeyService, "disable-local-keyservice", false, "only use the keyservices from --keyservice and the spec, not local keys")
+	flag.BoolVar(&opts.IgnoreMAC, "ignore-mac", false, "EMERGENCY ONLY: decrypt sources whose MAC does not match, without verifying their integrity (or set "+ignoreMACEnv+"=true)")
+	flag.StringVar(&policyFile, "policy", os.Getenv(policyEnv), "enforce the policy in the YAML `FILE` on the sources of all specs (or set "+policyEnv+")")
+	flag.BoolVar(&opts.RotateDataKey, "rotate-data-key", false, "make updatekeys replace the data key of the sources too, like sops --rotate")
+	flag.StringVar(&opts.MaxAge, "max-age", "", "fail if a sops source was last modified more than `AGE` ago, such as 90d, unless the spec sets a smaller maxAge")
+	flag.BoolVar(&opts.WarnMaxAge, "warn-max-age", false, "warn about sources older than the maximum age instead of failing")
+	flag.StringVar(&opts.GnuPGHome, "gnupg-home", "", "use the GnuPG home `DIR` for PGP, unless the spec sets sops.pgp")
+	flag.DurationVar(&timeout, "timeout", 0, "abort decryption after `DURATION`, such as 30s")
+	flag.Usage = func() {
+		_, _ = fmt.Fprintln(os.Stderr, "usage: SopsSecretGenerator [OPTIONS] FILE...")
+		_, _ = fmt.Fprintln(os.Stderr, "       SopsSecretGenerator [OPTIONS] < RESOURCELIST")
+		_, _ = fmt.Fprintln(os.Stderr, "       SopsSecretGenerator [OPTIONS] validate FILE...")
+		_, _ = fmt.Fprintln(os.Stderr, "       SopsSecretGenerator [OPTIONS] verify FILE...")
+		_, _ = fmt.Fprintln(os.Stderr, "       SopsSecretGenerator [OPTIONS] updatekeys FILE...")
+		flag.PrintDefaults()
+	}
+	// Invalid options are usage errors, rather than exiting with 2 like the
+	// flag package does
+	flag.CommandLine.Init(os.Args[0], flag.ContinueOnError)
+	err := flag.CommandLine.Parse(os.Args[1:])
+	command := flag.Arg(0)
+	check := command == validateCommand || command == verifyCommand || command == updateKeysCommand
+	if err == nil && check {
+		// Options may follow the command too
+		err = flag.CommandLine.Parse(flag.Args()[1:])
+	}
+	if err == flag.ErrHelp {
+		os.Exit(0)
+	} else if err != nil {
+		os.Exit(exitUsage)
+	}
+	if printExample {
+		example, err := generator.Example()
+		if err != nil {
+			_, _ = fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			os.Exit(exitError)
+		}
+		fmt.Print(string(example))
+		return
+	}
+	// Without files, the spec is taken from the environment, or is the
+	// function config of a KRM ResourceList
+	configString := os.Getenv(pluginConfigStringEnv)
+	envConfig := flag.NArg() == 0 && configString != "" && !check
+	krm := flag.NArg() == 0 && !envConfig && !check && !isTerminal(os.Stdin)
+	var resourceList []byte
+	if krm {
+		// An empty standard input, as in CI or with </dev/null, is not a
+		// ResourceList, but a call without arguments
+		resourceList, err = ioutil.ReadAll(os.Stdin)
+		if err != nil {
+			_, _ = fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			os.Exit(exitIO)
+		}
+		krm = len(bytes.TrimSpace(resourceList)) > 0
+	}
+	if (flag.NArg() < 1 && !krm && !envConfig) || !exclusive(splitDir != "", transformFile != "", keysOnly, krm, check) {
+		flag.Usage()
+		os.Exit(exitUsage)
+	}
 
-// ObjectMeta contains Kubernetes resource metadata such as the name
-type ObjectMeta struct {
-	Name        string `json:"name" yaml:"name"`
-	Namespace   string `json:"namespace,omitempty" yaml:"namespace,omitempty"`
-	Labels      kvMap  `json:"labels,omitempty" yaml:"labels,omitempty"`
-	Annotations kvMap  `json:"annotations,omitempty" yaml:"annotations,omitempty"`
-}
+	if value, ok := os.LookupEnv(ignoreMACEnv); ok && value != "" {
+		ignoreMAC, err := strconv.ParseBool(value)
+		if err != nil {
+			_, _ = fmt.Fprintf(os.Stderr, "Error: %v must be true or false\n", ignoreMACEnv)
+			os.Exit(exitUsage)
+		}
+		opts.IgnoreMAC = opts.IgnoreMAC || ignoreMAC
+	}
 
-// SopsSecretGenerator is a generator for Secrets
-type SopsSecretGenerator struct {
-	TypeMeta              `json:",inline" yaml:",inline"`
-	ObjectMeta            `json:"metadata" yaml:"metadata"`
-	EnvSources            []string `json:"envs" yaml:"envs"`
-	FileSources           []string `json:"files" yaml:"files"`
-	Behavior              string   `json:"behavior,omitempty" yaml:"behavior,omitempty"`
-	DisableNameSuffixHash bool     `json:"disableNameSuffixHash,omitempty" yaml:"disableNameSuffixHash,omitempty"`
-	Type                  string   `json:"type,omitempty" yaml:"type,omitempty"`
-}
+	if policyFile != "" {
+		p, err := readPolicy(policyFile)
+		if err != nil {
+			_, _ = fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			os.Exit(exitCode(err))
+		}
+		err = applyPolicy(p, &opts)
+		if err != nil {
+			_, _ = fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			os.Exit(exitCode(err))
+		}
+	}
 
-// Secret is a Kubernetes Secret
-type Secret struct {
-	TypeMeta   `json:",inline" yaml:",inline"`
-	ObjectMeta `json:"metadata" yaml:"metadata"`
-	Data       kvMap  `json:"data" yaml:"data"`
-	Type       string `json:"type,omitempty" yaml:"type,omitempty"`
-}
+	if commonLabelsFile != "" {
+		labels, err := readCommonLabels(commonLabelsFile)
+		if err != nil {
+			_, _ = fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			os.Exit(exitCode(err))
+		}
+		opts.CommonLabels = labels
+	}
 
-func main() {
-	if len(os.Args) != 2 {
-		_, _ = fmt.Fprintln(os.Stderr, "usage: SopsSecretGenerator FILE")
-		os.Exit(1)
+	ctx := context.Background()
+	if timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, timeout)
+		defer cancel()
+	}
+
+	switch command {
+	case validateCommand:
+		os.Exit(checkSpecs(ctx, flag.Args(), generator.ValidateContext, "valid", opts))
+	case verifyCommand:
+		os.Exit(checkSpecs(ctx, flag.Args(), generator.VerifyContext, "verified", opts))
+	case updateKeysCommand:
+		os.Exit(checkSpecs(ctx, flag.Args(), generator.UpdateKeysContext, "keys updated", opts))
+	}
+
+	var summary generator.Summary
+	if summaryFile != "" {
+		opts.Summary = &summary
 	}
 
-	output, err := processSopsSecretGenerator(os.Args[1])
+	var output string
+	var spec []byte
+	if krm {
+		spec = resourceList
+	} else if envConfig {
+		spec = []byte(configString)
+		if root := os.Getenv(pluginConfigRootEnv); root != "" {
+			err = enterConfigRoot(root, &splitDir, &transformFile, &summaryFile)
+		}
+	} else {
+		spec, err = readSpecs(flag.Args(), opts.Strict)
+	}
+	if err == nil {
+		if krm {
+			output, err = processResourceList(ctx, spec, opts)
+			if err == nil && summaryFile != "" {
+				err = writeSummary(summaryFile, summary, summaryIncludeKeys)
+			}
+		} else if splitDir != "" {
+			err = generator.WriteFilesContext(ctx, spec, splitDir, opts)
+		} else if transformFile != "" {
+			output, err = transformSecret(ctx, spec, transformFile, opts)
+		} else if keysOnly {
+			output, err = listKeys(ctx, spec, opts)
+		} else {
+			output, err = processSopsSecretGenerator(ctx, spec, opts)
+			if err == nil && summaryFile != "" {
+				err = writeSummary(summaryFile, summary, summaryIncludeKeys)
+			}
+		}
+	}
 	if err != nil {
 		if sopsErr, ok := errors.Cause(err).(sops.UserError); ok {
 			_, _ = fmt.Fprintf(os.Stderr, "Error: %v\n%s\n", err, sopsErr.UserError())
 		} else {
 			_, _ = fmt.Fprintf(os.Stderr, "Error: %v\n", err)
 		}
-		os.Exit(2)
+		os.Exit(exitCode(err))
 	}
 	fmt.Print(output)
 }
 
-func processSopsSecretGenerator(fn string) (string, error) {
-	input, err := readInput(fn)
-	if err != nil {
-		return "", err
-	}
-	secret, err := generateSecret(input)
-	if err != nil {
-		return "", err
+// exitCode returns the exit code for the class of an error.
+func exitCode(err error) int {
+	switch generator.Classify(err) {
+	case generator.ClassSpec:
+		return exitSpec
+	case generator.ClassSource:
+		return exitSource
+	case generator.ClassIO:
+		return exitIO
+	default:
+		return exitError
 	}
-	output, err := yaml.Marshal(secret)
-	if err != nil {
-		return "", err
+}
+
+// optionalBool is a boolean flag that stays nil unless it is given.
+type optionalBool struct {
+	value **bool
+}
+
+func (b optionalBool) String() string {
+	if b.value == nil || *b.value == nil {
+		return ""
 	}
-	return string(output), nil
+	return strconv.FormatBool(**b.value)
 }
 
-func generateSecret(sopsSecret SopsSecretGenerator) (Secret, error) {
-	data, err := parseInput(sopsSecret)
+func (b optionalBool) Set(s string) error {
+	v, err := strconv.ParseBool(s)
 	if err != nil {
-		return Secret{}, err
+		return err
 	}
+	*b.value = &v
+	return nil
+}
 
-	annotations := make(kvMap)
-	for k, v := range sopsSecret.Annotations {
-		annotations[k] = v
-	}
-	if !sopsSecret.DisableNameSuffixHash {
-		annotations["kustomize.config.k8s.io/needs-hash"] = "true"
-	}
-	if sopsSecret.Behavior != "" {
-		annotations["kustomize.config.k8s.io/behavior"] = sopsSecret.Behavior
-	}
+func (b optionalBool) IsBoolFlag() bool {
+	return true
+}
 
-	secret := Secret{
-		TypeMeta: TypeMeta{
-			APIVersion: "v1",
-			Kind:       "Secret",
-		},
-		ObjectMeta: ObjectMeta{
-			Name:        sopsSecret.Name,
-			Namespace:   sopsSecret.Namespace,
-			Labels:      sopsSecret.Labels,
-			Annotations: annotations,
-		},
-		Data: data,
-		Type: sopsSecret.Type,
-	}
-	return secret, nil
+// stringList is a flag that can be given several times, collecting its
+// values.
+type stringList struct {
+	values *[]string
 }
 
-func readInput(fn string) (SopsSecretGenerator, error) {
-	content, err := ioutil.ReadFile(fn)
-	if err != nil {
-		return SopsSecretGenerator{}, err
+func (l stringList) String() string {
+	if l.values == nil {
+		return ""
 	}
+	return strings.Join(*l.values, ",")
+}
 
-	input := SopsSecretGenerator{
-		TypeMeta: TypeMeta{},
-		ObjectMeta: ObjectMeta{
-			Annotations: make(kvMap),
-		},
-	}
-	err = yaml.Unmarshal(content, &input)
-	if err != nil {
-		return SopsSecretGenerator{}, err
-	}
+func (l stringList) Set(s string) error {
+	*l.values = append(*l.values, s)
+	return nil
+}
 
-	if input.APIVersion != apiVersion || (input.Kind != kind && input.Kind != oldKind) {
-		return SopsSecretGenerator{}, errors.Errorf("input must be apiVersion %s, kind %s", apiVersion, kind)
-	}
-	if input.Name == "" {
-		return SopsSecretGenerator{}, errors.New("input must contain metadata.name value")
-	}
-	// In the next major version, remove old kind compatibility
-	if input.Kind == oldKind {
-		input.Kind = kind
+// exclusive returns whether at most one of the options is set.
+func exclusive(options ...bool) bool {
+	set := 0
+	for _, option := range options {
+		if option {
+			set++
+		}
 	}
-	return input, nil
+	return set <= 1
 }
 
-func parseInput(input SopsSecretGenerator) (kvMap, error) {
-	data := make(kvMap)
-	err := parseEnvSources(input.EnvSources, data)
-	if err != nil {
-		return nil, err
-	}
-	err = parseFileSources(input.FileSources, data)
-	if err != nil {
-		return nil, err
-	}
-	return data, nil
+// isTerminal returns whether f is a terminal rather than a pipe or a file.
+func isTerminal(f *os.File) bool {
+	info, err := f.Stat()
+	return err == nil && info.Mode()&os.ModeCharDevice != 0
 }
 
-func parseEnvSources(sources []string, data kvMap) error {
-	for _, source := range sources {
-		err := parseEnvSource(source, data)
+// enterConfigRoot changes to the directory that the source paths of the spec
+// are relative to. The paths of options are made absolute first, so that
+// they keep referring to the same files.
+func enterConfigRoot(root string, paths ...*string) error {
+	for _, path := range paths {
+		if *path == "" {
+			continue
+		}
+		abs, err := filepath.Abs(*path)
 		if err != nil {
-			return errors.Wrapf(err, "env source %v", source)
+			return err
 		}
+		*path = abs
 	}
-	return nil
+	return errors.Wrap(os.Chdir(root), "plugin config root")
 }
 
-func parseEnvSource(source string, data kvMap) error {
-	content, err := ioutil.ReadFile(source)
-	if err != nil {
-		return err
+// readSpecs reads the spec files, merging them if there is more than one.
+func readSpecs(fns []string, strict bool) ([]byte, error) {
+	specs := make([][]byte, len(fns))
+	for i, fn := range fns {
+		spec, err := ioutil.ReadFile(fn)
+		if err != nil {
+			return nil, err
+		}
+		specs[i] = spec
 	}
-
-	format := formatForPath(source)
-	decrypted, err := sopsdecrypt.Data(content, format)
-	if err != nil {
-		return err
+	if len(specs) == 1 {
+		return specs[0], nil
 	}
-
-	switch format {
-	case "dotenv":
-		err = parseDotEnvContent(decrypted, data)
-	case "yaml":
-		err = parseYAMLContent(decrypted, data)
-	case "json":
-		err = parseJSONContent(decrypted, data)
-	default:
-		err = errors.New("unknown file format, use dotenv, yaml or json")
+	if strict {
+		return generator.MergeSpecsStrict(specs...)
 	}
+	return generator.MergeSpecs(specs...)
+}
+
+func processSopsSecretGenerator(ctx context.Context, spec []byte, opts generator.Options) (string, error) {
+	output, err := generator.GenerateContext(ctx, spec, opts)
 	if err != nil {
-		return err
+		return "", err
 	}
-
-	return nil
+	return string(output), nil
 }
 
-func parseDotEnvContent(content []byte, data kvMap) error {
-	scanner := bufio.NewScanner(bytes.NewReader(content))
-	lineNum := 0
-	for scanner.Scan() {
-		line := scanner.Bytes()
-		// Strip UTF-8 byte order mark from first line
-		if lineNum == 0 {
-			line = bytes.TrimPrefix(line, utf8bom)
+// checkSpecs checks every spec file on its own and reports the result,
+// without printing values. It returns the exit code of the first failure.
+func checkSpecs(ctx context.Context, fns []string, checkSpec func(context.Context, []byte, generator.Options) error, result string, opts generator.Options) int {
+	code := 0
+	for _, fn := range fns {
+		spec, err := ioutil.ReadFile(fn)
+		if err == nil {
+			err = checkSpec(ctx, spec, opts)
 		}
-		err := parseDotEnvLine(line, data)
 		if err != nil {
-			return errors.Wrapf(err, "line %d", lineNum)
+			_, _ = fmt.Fprintf(os.Stderr, "Error: %v: %v\n", fn, err)
+			if code == 0 {
+				code = exitCode(err)
+			}
+			continue
 		}
-		lineNum++
+		fmt.Printf("%v: %v\n", fn, result)
 	}
-	return scanner.Err()
+	return code
 }
 
-func parseDotEnvLine(line []byte, data kvMap) error {
-	if !utf8.Valid(line) {
-		return fmt.Errorf("invalid UTF-8 bytes: %v", string(line))
+// writeSummary writes the summary as JSON. Key names are only included if
+// includeKeys is set.
+func writeSummary(fn string, summary generator.Summary, includeKeys bool) error {
+	if !includeKeys {
+		summary = summary.WithoutKeys()
 	}
-
-	line = bytes.TrimLeftFunc(line, unicode.IsSpace)
-
-	if len(line) == 0 || line[0] == '#' {
-		return nil
-	}
-
-	pair := strings.SplitN(string(line), "=", 2)
-	if len(pair) != 2 {
-		return fmt.Errorf("requires value: %v", string(line))
-	}
-
-	data[pair[0]] = base64.StdEncoding.EncodeToString([]byte(pair[1]))
-	return nil
-}
-
-func parseYAMLContent(content []byte, data kvMap) error {
-	d := make(kvMap)
-	err := yaml.Unmarshal(content, &d)
+	content, err := json.MarshalIndent(summary, "", "  ")
 	if err != nil {
 		return err
 	}
-	for k, v := range d {
-		data[k] = base64.StdEncoding.EncodeToString([]byte(v))
-	}
-	return nil
+	return errors.Wrap(ioutil.WriteFile(fn, append(content, '\n'), 0644), "writing summary")
 }
 
-func parseJSONContent(content []byte, data kvMap) error {
-	d := make(kvMap)
-	err := json.Unmarshal(content, &d)
+func processResourceList(ctx context.Context, input []byte, opts generator.Options) (string, error) {
+	output, err := generator.GenerateResourceListContext(ctx, input, opts)
 	if err != nil {
-		return err
-	}
-	for k, v := range d {
-		data[k] = base64.StdEncoding.EncodeToString([]byte(v))
+		return "", err
 	}
-	return nil
+	return string(output), nil
 }
 
-func parseFileSources(sources []string, data kvMap) error {
-	for _, source := range sources {
-		err := parseFileSource(source, data)
-		if err != nil {
-			return errors.Wrapf(err, "file source %v", source)
-		}
+func transformSecret(ctx context.Context, spec []byte, existingFn string, opts generator.Options) (string, error) {
+	existing, err := ioutil.ReadFile(existingFn)
+	if err != nil {
+		return "", err
 	}
-	return nil
+	output, err := generator.TransformContext(ctx, spec, existing, opts)
+	if err != nil {
+		return "", err
+	}
+	return string(output), nil
 }
 
-func parseFileSource(source string, data kvMap) error {
-	key, fn, err := parseFileName(source)
+func listKeys(ctx context.Context, spec []byte, opts generator.Options) (string, error) {
+	keys, err := generator.KeysContext(ctx, spec, opts)
 	if err != nil {
-		return err
+		return "", err
 	}
+	var output strings.Builder
+	for _, k := range keys {
+		output.WriteString(k + "\n")
+	}
+	return output.String(), nil
+}
 
+func readCommonLabels(fn string) (map[string]string, error) {
 	content, err := ioutil.ReadFile(fn)
 	if err != nil {
-		return err
+		return nil, err
 	}
-
-	decrypted, err := sopsdecrypt.Data(content, formatForPath(source))
+	labels := make(map[string]string)
+	err = yaml.Unmarshal(content, &labels)
 	if err != nil {
-		return err
+		return nil, errors.Wrapf(err, "common labels file %v", fn)
 	}
+	return labels, nil
+}
 
-	data[key] = base64.StdEncoding.EncodeToString(decrypted)
-	return nil
+// policy constrains the sources of all specs, for organizations that do not
+// want to rely on every spec doing so.
+type policy struct {
+	// RequiredRecipients are recipients that every sops source must be
+	// encrypted to
+	RequiredRecipients []string `yaml:"requiredRecipients"`
+	// AllowedRecipients are patterns for the only recipients that sops
+	// sources may be encrypted to, such as arn:aws:kms:*:123456789012:key/*
+	AllowedRecipients []string `yaml:"allowedRecipients"`
+	// MaxAge is the maximum time since sops sources were last modified
+	MaxAge string `yaml:"maxAge"`
 }
 
-func parseFileName(source string) (key string, fn string, err error) {
-	components := strings.Split(source, "=")
-
-	switch len(components) {
-	case 1:
-		return path.Base(source), source, nil
-	case 2:
-		key, fn = components[0], components[1]
-		if key == "" {
-			return "", "", fmt.Errorf("key name for file path %v missing", fn)
-		} else if fn == "" {
-			return "", "", fmt.Errorf("file path for key name %v missing", key)
-		}
-		return key, fn, nil
-	default:
-		return "", "", errors.New("key names or file paths cannot contain '='")
+func readPolicy(fn string) (policy, error) {
+	content, err := ioutil.ReadFile(fn)
+	if err != nil {
+		return policy{}, err
+	}
+	var p policy
+	err = yaml.UnmarshalStrict(content, &p)
+	if err != nil {
+		return policy{}, errors.Wrapf(err, "policy file %v", fn)
 	}
+	return p, nil
 }
 
-func formatForPath(path string) string {
-	if sopscommon.IsYAMLFile(path) {
-		return "yaml"
-	} else if sopscommon.IsJSONFile(path) {
-		return "json"
-	} else if sopscommon.IsEnvFile(path) {
-		return "dotenv"
+// applyPolicy sets the recipients of a policy in opts. The maximum age of
+// the policy does not loosen a smaller one given with --max-age.
+func applyPolicy(p policy, opts *generator.Options) error {
+	maxAge, err := generator.StricterMaxAge(opts.MaxAge, p.MaxAge)
+	if err != nil {
+		return err
 	}
-	return "binary"
+	opts.RequiredRecipients = p.RequiredRecipients
+	opts.AllowedRecipients = p.AllowedRecipients
+	opts.MaxAge = maxAge
+	return nil
 }
@@ -4,568 +4,395 @@
 package main
 
 import (
-	"encoding/base64"
+	"bytes"
+	"context"
+	"flag"
 	"fmt"
+	"io/ioutil"
 	"os"
+	"os/exec"
+	"path/filepath"
 	"reflect"
 	"strings"
 	"testing"
 
-	"github.com/lithammer/dedent"
+	"github.com/goabout/kustomize-sopssecretgenerator/generator"
 	"github.com/pkg/errors"
-	"go.mozilla.org/sops/pgp"
 )
 
-const testkeyFingerprint = "2D2483DF73A3A0FAEE3C2A695BDC395360CE8FF4"
-const testkeyCrypttext = `
------BEGIN PGP MESSAGE-----
-
-hQEMA6z+tHR/duVIAQf/VO9SoP3PcDg7iZzm5CUQ1jgF6BGrJqL5azjF/D74I83t
-UalWAsewjd+xcKLBSnzr+uf90NcfIGpWx9u3IIyOZgIDkshp89jxz+mzj1MHsXM4
-/gMBzRwFoynYKtdFs6u5MnB/e4tw0tMkxgqp8tPog1FEEyWmGSV6WOpL0SOzc2mV
-PUA167We9+DLR8Yj9ABBEPpFDDq2bucOV9d3bkQS6+hWBbTPZMGcHvcupdDtALjv
-7FMKftz9FAoPNDSR4RXkXQSkD1jdNfx5d+SYxNyxR2IWk1pigkBzKPlL9BHFCHQD
-KCRtg392tGQ7WRY0s1J5GHHvnaDd+p0m3LWbUG28JtI7AZZSOue8gect+bw+Z5bO
-sDRQLEMprueQOkhMr/JzgWRCV8JYxRFOqXjl7PRBjmgNPMu2GzRIB8D/+SU=
-=7dAF
------END PGP MESSAGE-----
-`
+// runMainEnv makes the test binary run main with its arguments instead of
+// the tests, so that exit codes can be checked.
+const runMainEnv = "SOPSSECRETGENERATOR_TEST_RUN_MAIN"
 
 // Test suite setup
 
 func TestMain(m *testing.M) {
-	err := setupGnuPG()
-	if err != nil {
-		_, _ = fmt.Fprintln(os.Stderr, err)
-		os.Exit(1)
+	if os.Getenv(runMainEnv) != "" {
+		main()
+		os.Exit(0)
 	}
 	os.Exit(m.Run())
 }
 
-func setupGnuPG() error {
-	err := os.Setenv("GNUPGHOME", "testdata")
-	if err != nil {
-		return err
-	}
-	// Check whether the test key was loaded correctly
-	key := pgp.NewMasterKeyFromFingerprint(testkeyFingerprint)
-	key.EncryptedKey = testkeyCrypttext
-	_, err = key.Decrypt()
+// runMain runs main in a subprocess in the generator directory, so that the
+// testdata specs and the test PGP key are found. It returns the standard
+// output and the exit code.
+func runMain(t *testing.T, stdin string, env []string, args ...string) (string, int) {
+	executable, err := os.Executable()
 	if err != nil {
-		return errors.Wrap(err, "PGP decryption check failed")
-	}
-	return nil
+		t.Fatal(err)
+	}
+	cmd := exec.Command(executable, args...)
+	cmd.Dir = "generator"
+	cmd.Env = append(os.Environ(), runMainEnv+"=1", "GNUPGHOME=testdata")
+	cmd.Env = append(cmd.Env, env...)
+	if stdin != "" {
+		cmd.Stdin = strings.NewReader(stdin)
+	}
+	var stdout bytes.Buffer
+	cmd.Stdout = &stdout
+	err = cmd.Run()
+	if exitErr, ok := err.(*exec.ExitError); ok {
+		return stdout.String(), exitErr.ExitCode()
+	} else if err != nil {
+		t.Fatal(err)
+	}
+	return stdout.String(), 0
 }
 
 // Tests
 
-func Test_ProcessSopsSecretGenerator(t *testing.T) {
-	type args struct {
-		fn string
+func Test_main(t *testing.T) {
+	resourceList, err := ioutil.ReadFile("generator/testdata/resourcelist.yaml")
+	if err != nil {
+		t.Fatal(err)
+	}
+	spec, err := ioutil.ReadFile("generator/testdata/generator.yaml")
+	if err != nil {
+		t.Fatal(err)
 	}
 	tests := []struct {
-		name    string
-		args    args
-		want    string
-		wantErr bool
+		name       string
+		stdin      string
+		env        []string
+		args       []string
+		wantOutput string
+		wantCode   int
 	}{
-		{
-			"SopsSecretGenerator",
-			args{"testdata/generator.yaml"},
-			strings.TrimLeft(dedent.Dedent(`
-				apiVersion: v1
-				kind: Secret
-				metadata:
-				  name: secret
-				data:
-				  file.txt: c2VjcmV0Cg==
-			`), "\n"),
-			false,
-		},
-		{"InvalidEnvs", args{"testdata/generator-invalidenv.yaml"}, "", true},
-		{"MissingFile", args{"testdata/missing.yaml"}, "", true},
+		{"Generate", "", nil, []string{"testdata/generator.yaml"}, "kind: Secret", 0},
+		{"Merge", "", nil, []string{"testdata/generator-fragment1.yaml", "testdata/generator-fragment2.yaml"}, "kind: Secret", 0},
+		{"KeysOnly", "", nil, []string{"--keys-only", "testdata/generator.yaml"}, "file.txt\n", 0},
+		{"KRM", string(resourceList), nil, nil, "kind: ResourceList", 0},
+		{"ConfigString", "", []string{pluginConfigStringEnv + "=" + string(spec)}, nil, "kind: Secret", 0},
+		{"Validate", "", nil, []string{"validate", "testdata/generator.yaml"}, "testdata/generator.yaml: valid", 0},
+		{"ValidateOptionAfterCommand", "", nil, []string{"validate", "--strict", "testdata/generator.yaml"}, "testdata/generator.yaml: valid", 0},
+		{"NoFiles", "", nil, nil, "", exitUsage},
+		{"BlankStdin", "\n", nil, nil, "", exitUsage},
+		{"Help", "", nil, []string{"--help"}, "", 0},
+		{"UnknownOption", "", nil, []string{"--no-such-option", "testdata/generator.yaml"}, "", exitUsage},
+		{"UnknownOptionAfterCommand", "", nil, []string{"validate", "--no-such-option", "testdata/generator.yaml"}, "", exitUsage},
+		{"NotExclusive", "", nil, []string{"--keys-only", "--split-dir", "out", "testdata/generator.yaml"}, "", exitUsage},
+		{"InvalidIgnoreMAC", "", []string{ignoreMACEnv + "=maybe"}, []string{"testdata/generator.yaml"}, "", exitUsage},
+		{"InvalidDisableNameSuffixHash", "", nil, []string{"--disable-name-suffix-hash=maybe", "testdata/generator.yaml"}, "", exitUsage},
+		{"WrongKind", "", nil, []string{"testdata/generator-wrongkind.yaml"}, "", exitSpec},
+		{"InvalidMaxAge", "", nil, []string{"--max-age", "ninety days", "testdata/generator.yaml"}, "", exitSpec},
+		{"MissingSource", "", nil, []string{"testdata/generator-invalidenv.yaml"}, "", exitIO},
+		{"BadMAC", "", []string{pluginConfigStringEnv + "=" + strings.Replace(string(spec), "file.txt", "file-badmac.txt", 1)}, nil, "", exitSource},
+		{"MissingFile", "", nil, []string{"testdata/missing.yaml"}, "", exitIO},
+		{"ValidateFailure", "", nil, []string{"validate", "testdata/generator.yaml", "testdata/generator-wrongkind.yaml"}, "testdata/generator.yaml: valid", exitSpec},
+		{"MissingPolicy", "", []string{policyEnv + "=testdata/missing-policy.yaml"}, []string{"testdata/generator.yaml"}, "", exitIO},
 	}
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			got, err := processSopsSecretGenerator(tt.args.fn)
-			if (err != nil) != tt.wantErr {
-				t.Errorf("processSopsSecretGenerator() error = %v, wantErr %v", err, tt.wantErr)
-				return
+			output, code := runMain(t, tt.stdin, tt.env, tt.args...)
+			if code != tt.wantCode {
+				t.Errorf("main() exit code = %v, want %v", code, tt.wantCode)
 			}
-			if got != tt.want {
-				t.Errorf("processSopsSecretGenerator() got = %v, want %v", got, tt.want)
+			if !strings.Contains(output, tt.wantOutput) {
+				t.Errorf("main() output = %q, want it to contain %q", output, tt.wantOutput)
 			}
 		})
 	}
 }
 
-func Test_generateSecret(t *testing.T) {
-	type args struct {
-		sopsSecret SopsSecretGenerator
-	}
+func Test_exitCode(t *testing.T) {
+	_, specErr := generator.Generate([]byte("kind: PlainText\n"), generator.Options{})
+	_, ioErr := ioutil.ReadFile("testdata/missing.txt")
 	tests := []struct {
-		name    string
-		args    args
-		want    Secret
-		wantErr bool
+		name string
+		err  error
+		want int
 	}{
-		{
-			"Normal",
-			args{
-				SopsSecretGenerator{
-					TypeMeta: TypeMeta{
-						APIVersion: "goabout/v1beta1",
-						Kind:       "SopsSecretGenerator",
-					},
-					ObjectMeta: ObjectMeta{
-						Name:        "secret",
-						Namespace:   "default",
-						Labels:      kvMap{"label": "value"},
-						Annotations: kvMap{"annotation": "value"},
-					},
-					Behavior:    "merge",
-					EnvSources:  []string{"testdata/vars.env"},
-					FileSources: []string{"testdata/file.txt"},
-					Type:        "Oblique",
-				},
-			},
-			Secret{
-				TypeMeta: TypeMeta{
-					APIVersion: "v1",
-					Kind:       "Secret",
-				},
-				ObjectMeta: ObjectMeta{
-					Name:      "secret",
-					Namespace: "default",
-					Labels:    kvMap{"label": "value"},
-					Annotations: kvMap{
-						"annotation":                         "value",
-						"kustomize.config.k8s.io/needs-hash": "true",
-						"kustomize.config.k8s.io/behavior":   "merge",
-					},
-				},
-				Data: kvMap{"VAR_ENV": b64("val_env"), "file.txt": b64("secret\n")},
-				Type: "Oblique",
-			},
-			false,
-		},
-		{
-			"InvalidSources",
-			args{
-				SopsSecretGenerator{
-					TypeMeta: TypeMeta{
-						APIVersion: "goabout/v1beta1",
-						Kind:       "SopsSecretGenerator",
-					},
-					ObjectMeta: ObjectMeta{
-						Name: "secret",
-					},
-					FileSources: []string{"testdata/missing.txt"},
-				},
-			},
-			Secret{},
-			true,
-		},
+		{"Spec", specErr, exitSpec},
+		{"IO", errors.Wrap(ioErr, "reading"), exitIO},
+		{"Unknown", errors.New("unknown"), exitError},
 	}
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			t.Run(tt.name, func(t *testing.T) {
-				got, err := generateSecret(tt.args.sopsSecret)
-				if (err != nil) != tt.wantErr {
-					t.Errorf("generateSecret() error = %v, wantErr %v", err, tt.wantErr)
-					return
-				}
-				if !reflect.DeepEqual(got, tt.want) {
-					t.Errorf("generateSecret() got = %v, want %v", got, tt.want)
-				}
-			})
+			if got := exitCode(tt.err); got != tt.want {
+				t.Errorf("exitCode() = %v, want %v", got, tt.want)
+			}
 		})
 	}
 }
 
-func Test_readInput(t *testing.T) {
-	type args struct {
-		fn string
-	}
+func Test_optionalBool(t *testing.T) {
 	tests := []struct {
 		name    string
-		args    args
-		want    SopsSecretGenerator
+		args    []string
+		want    *bool
 		wantErr bool
 	}{
-		{"SopsSecretGenerator", args{"testdata/generator.yaml"}, ssg(nil, []string{"testdata/file.txt"}), false},
-		{"SopsSecret", args{"testdata/generator-oldkind.yaml"}, ssg(nil, []string{"testdata/file.txt"}), false},
-		{"Missing", args{"testdata/missing.yaml"}, SopsSecretGenerator{}, true},
-		{"NotYaml", args{"testdata/notyaml.txt"}, SopsSecretGenerator{}, true},
-		{"WrongVersion", args{"testdata/generator-wrongversion.yaml"}, SopsSecretGenerator{}, true},
-		{"WrongKind", args{"testdata/generator-wrongkind.yaml"}, SopsSecretGenerator{}, true},
-		{"NoName", args{"testdata/generator-noname.yaml"}, SopsSecretGenerator{}, true},
+		{"Unset", nil, nil, false},
+		{"Set", []string{"-flag"}, boolPtr(true), false},
+		{"True", []string{"-flag=true"}, boolPtr(true), false},
+		{"False", []string{"-flag=false"}, boolPtr(false), false},
+		{"Invalid", []string{"-flag=maybe"}, nil, true},
 	}
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			got, err := readInput(tt.args.fn)
+			var got *bool
+			flags := flag.NewFlagSet("test", flag.ContinueOnError)
+			flags.SetOutput(ioutil.Discard)
+			flags.Var(optionalBool{&got}, "flag", "")
+			err := flags.Parse(tt.args)
 			if (err != nil) != tt.wantErr {
-				t.Errorf("readInput() error = %v, wantErr %v", err, tt.wantErr)
+				t.Errorf("Parse() error = %v, wantErr %v", err, tt.wantErr)
 				return
 			}
 			if !reflect.DeepEqual(got, tt.want) {
-				t.Errorf("readInput() got = %v, want %v", got, tt.want)
+				t.Errorf("optionalBool = %v, want %v", got, tt.want)
 			}
 		})
 	}
 }
 
-func Test_parseInput(t *testing.T) {
-	type args struct {
-		input SopsSecretGenerator
-	}
-	tests := []struct {
-		name    string
-		args    args
-		want    kvMap
-		wantErr bool
-	}{
-		{"Input", args{ssg([]string{"testdata/vars.env"}, []string{"testdata/file.txt"})}, kvMap{"VAR_ENV": b64("val_env"), "file.txt": b64("secret\n")}, false},
-		{"EnvsError", args{ssg([]string{"testdata/file.txt"}, []string{"testdata/file.txt"})}, nil, true},
-		{"FilesError", args{ssg([]string{"testdata/vars.env"}, []string{"testdata/missing.txt"})}, nil, true},
-	}
-	for _, tt := range tests {
-		t.Run(tt.name, func(t *testing.T) {
-			got, err := parseInput(tt.args.input)
-			if (err != nil) != tt.wantErr {
-				t.Errorf("parseInput() error = %v, wantErr %v", err, tt.wantErr)
-				return
-			}
-			if !reflect.DeepEqual(got, tt.want) {
-				t.Errorf("parseInput() got = %v, want %v", got, tt.want)
-			}
-		})
-	}
+func boolPtr(b bool) *bool {
+	return &b
 }
 
-func Test_parseEnvSources(t *testing.T) {
-	type args struct {
-		sources []string
+func Test_stringList(t *testing.T) {
+	var got []string
+	flags := flag.NewFlagSet("test", flag.ContinueOnError)
+	flags.Var(stringList{&got}, "flag", "")
+	err := flags.Parse([]string{"-flag", "a", "-flag", "b"})
+	if err != nil {
+		t.Fatal(err)
 	}
-	tests := []struct {
-		name    string
-		args    args
-		want    kvMap
-		wantErr bool
-	}{
-		{"Envs", args{[]string{"testdata/vars.env", "testdata/vars.yaml"}}, kvMap{"VAR_ENV": b64("val_env"), "VAR_YAML": b64("val_yaml")}, false},
-		{"NoEnvs", args{[]string{}}, kvMap{}, false},
-		{"Error", args{[]string{"testdata/missing.env"}}, kvMap{}, true},
-	}
-	for _, tt := range tests {
-		t.Run(tt.name, func(t *testing.T) {
-			got := make(kvMap)
-			err := parseEnvSources(tt.args.sources, got)
-			if (err != nil) != tt.wantErr {
-				t.Errorf("parseEnvSources() error = %v, wantErr %v", err, tt.wantErr)
-				return
-			}
-			if !reflect.DeepEqual(got, tt.want) {
-				t.Errorf("parseEnvSources() got = %v, want %v", got, tt.want)
-			}
-		})
+	if want := []string{"a", "b"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("stringList = %v, want %v", got, want)
 	}
 }
 
-func Test_parseEnvSource(t *testing.T) {
-	type args struct {
-		source string
-	}
+func Test_exclusive(t *testing.T) {
 	tests := []struct {
 		name    string
-		args    args
-		want    kvMap
-		wantErr bool
+		options []bool
+		want    bool
 	}{
-		{"DotEnv", args{"testdata/vars.env"}, kvMap{"VAR_ENV": b64("val_env")}, false},
-		{"YAML", args{"testdata/vars.yaml"}, kvMap{"VAR_YAML": b64("val_yaml")}, false},
-		{"JSON", args{"testdata/vars.json"}, kvMap{"VAR_JSON": b64("val_json")}, false},
-		{"Binary", args{"testdata/file.txt"}, kvMap{}, true},
-		{"Missing", args{"testdata/missing.txt"}, kvMap{}, true},
-		{"NotSops", args{"testdata/empty.txt"}, kvMap{}, true},
+		{"None", nil, true},
+		{"Unset", []bool{false, false, false}, true},
+		{"One", []bool{false, true, false}, true},
+		{"Two", []bool{true, false, true}, false},
 	}
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			got := make(kvMap)
-			err := parseEnvSource(tt.args.source, got)
-			if (err != nil) != tt.wantErr {
-				t.Errorf("parseEnvSource() error = %v, wantErr %v", err, tt.wantErr)
-				return
-			}
-			if !reflect.DeepEqual(got, tt.want) {
-				t.Errorf("parseEnvSource() got = %v, want %v", got, tt.want)
+			if got := exclusive(tt.options...); got != tt.want {
+				t.Errorf("exclusive() = %v, want %v", got, tt.want)
 			}
 		})
 	}
 }
 
-func Test_parseDotEnvContent(t *testing.T) {
-	type args struct {
-		content []byte
+func Test_enterConfigRoot(t *testing.T) {
+	wd, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
 	}
-	tests := []struct {
-		name    string
-		args    args
-		want    kvMap
-		wantErr bool
-	}{
-		{"Variables", args{b("VAR1=val1\nVAR2=val2")}, kvMap{"VAR1": b64("val1"), "VAR2": b64("val2")}, false},
-		{"StringBOM", args{append(utf8bom, b("VAR=val")...)}, kvMap{"VAR": b64("val")}, false},
-		{"Empty", args{b("")}, kvMap{}, false},
-		{"InvalidLine", args{b("VAR")}, kvMap{}, true},
+	defer func() { _ = os.Chdir(wd) }()
+
+	splitDir := "out"
+	transformFile := ""
+	err = enterConfigRoot("generator/testdata", &splitDir, &transformFile)
+	if err != nil {
+		t.Fatalf("enterConfigRoot() error = %v", err)
 	}
-	for _, tt := range tests {
-		t.Run(tt.name, func(t *testing.T) {
-			got := make(kvMap)
-			err := parseDotEnvContent(tt.args.content, got)
-			if (err != nil) != tt.wantErr {
-				t.Errorf("parseDotEnvContent() error = %v, wantErr %v", err, tt.wantErr)
-				return
-			}
-			if !reflect.DeepEqual(got, tt.want) {
-				t.Errorf("parseDotEnvContent() got = %v, want %v", got, tt.want)
-			}
-		})
+	if want := filepath.Join(wd, "out"); splitDir != want {
+		t.Errorf("enterConfigRoot() path = %v, want %v", splitDir, want)
 	}
-}
-
-func Test_parseDotEnvLine(t *testing.T) {
-	type args struct {
-		line []byte
+	if transformFile != "" {
+		t.Errorf("enterConfigRoot() empty path = %v, want it to stay empty", transformFile)
 	}
-	tests := []struct {
-		name    string
-		args    args
-		want    kvMap
-		wantErr bool
-	}{
-		{"Variable", args{b("VAR=value")}, kvMap{"VAR": b64("value")}, false},
-		{"TrimLeft", args{b(" VAR=value")}, kvMap{"VAR": b64("value")}, false},
-		{"EmptyLine", args{b("")}, kvMap{}, false},
-		{"Comment", args{b("# Comment")}, kvMap{}, false},
-		{"NoValue", args{b("VAR")}, kvMap{}, true},
-		{"InvalidUTF8", args{[]byte{0xff, 0xfe, 0xfd}}, kvMap{}, true},
+	if _, err := os.Stat("generator.yaml"); err != nil {
+		t.Errorf("enterConfigRoot() did not change to the root: %v", err)
 	}
-	for _, tt := range tests {
-		t.Run(tt.name, func(t *testing.T) {
-			got := make(kvMap)
-			err := parseDotEnvLine(tt.args.line, got)
-			if (err != nil) != tt.wantErr {
-				t.Errorf("parseDotEnvLine() error = %v, wantErr %v", err, tt.wantErr)
-				return
-			}
-			if !reflect.DeepEqual(got, tt.want) {
-				t.Errorf("parseDotEnvLine() got = %v, want %v", got, tt.want)
-			}
-		})
+
+	err = enterConfigRoot(filepath.Join(wd, "missing"))
+	if err == nil {
+		t.Errorf("enterConfigRoot() error = %v, wantErr %v", err, true)
 	}
 }
 
-func Test_parseYAMLContent(t *testing.T) {
+func Test_readSpecs(t *testing.T) {
 	type args struct {
-		content []byte
+		fns    []string
+		strict bool
 	}
 	tests := []struct {
-		name    string
-		args    args
-		want    kvMap
-		wantErr bool
+		name     string
+		args     args
+		wantKind string
+		wantErr  bool
 	}{
-		{"Variables", args{b("VAR1: val1\nVAR2: val2")}, kvMap{"VAR1": b64("val1"), "VAR2": b64("val2")}, false},
-		{"Empty", args{b("")}, kvMap{}, false},
-		{"InvalidSyntax", args{b("VAR:val")}, kvMap{}, true},
-		{"InvalidType", args{b("VAR: [1, 2]")}, kvMap{}, true},
+		{"Single", args{[]string{"generator/testdata/generator.yaml"}, false}, "SopsSecretGenerator", false},
+		{"Merge", args{[]string{"generator/testdata/generator-fragment1.yaml", "generator/testdata/generator-fragment2.yaml"}, false}, "SopsSecretGenerator", false},
+		{"MergeStrict", args{[]string{"generator/testdata/generator-fragment1.yaml", "generator/testdata/generator-unknownfield.yaml"}, true}, "", true},
+		{"MergeNames", args{[]string{"generator/testdata/generator-fragment1.yaml", "generator/testdata/generator-fragment-othername.yaml"}, false}, "", true},
+		{"Missing", args{[]string{"generator/testdata/generator.yaml", "generator/testdata/missing.yaml"}, false}, "", true},
 	}
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			got := make(kvMap)
-			err := parseYAMLContent(tt.args.content, got)
+			got, err := readSpecs(tt.args.fns, tt.args.strict)
 			if (err != nil) != tt.wantErr {
-				t.Errorf("parseYAMLContent() error = %v, wantErr %v", err, tt.wantErr)
+				t.Errorf("readSpecs() error = %v, wantErr %v", err, tt.wantErr)
 				return
 			}
-			if !reflect.DeepEqual(got, tt.want) {
-				t.Errorf("parseYAMLContent() got = %v, want %v", got, tt.want)
+			if err == nil && !strings.Contains(string(got), "kind: "+tt.wantKind) {
+				t.Errorf("readSpecs() got = %q, want kind %v", got, tt.wantKind)
 			}
 		})
 	}
 }
 
-func Test_parseJsonContent(t *testing.T) {
-	type args struct {
-		content []byte
-	}
-	tests := []struct {
-		name    string
-		args    args
-		want    kvMap
-		wantErr bool
-	}{
-		{"Variables", args{b(`{"VAR1": "val1", "VAR2": "val2"}`)}, kvMap{"VAR1": b64("val1"), "VAR2": b64("val2")}, false},
-		{"Empty", args{b(`{}`)}, kvMap{}, false},
-		{"InvalidSyntax", args{b(`{"VAR"}`)}, kvMap{}, true},
-		{"InvalidType", args{b(`{"VAR": ["val"]}`)}, kvMap{}, true},
+func Test_checkSpecs(t *testing.T) {
+	wd, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
 	}
-	for _, tt := range tests {
-		t.Run(tt.name, func(t *testing.T) {
-			got := make(kvMap)
-			err := parseJSONContent(tt.args.content, got)
-			if (err != nil) != tt.wantErr {
-				t.Errorf("parseJSONContent() error = %v, wantErr %v", err, tt.wantErr)
-				return
-			}
-			if !reflect.DeepEqual(got, tt.want) {
-				t.Errorf("parseJSONContent() got = %v, want %v", got, tt.want)
-			}
-		})
+	defer func() { _ = os.Chdir(wd) }()
+	err = os.Chdir("generator")
+	if err != nil {
+		t.Fatal(err)
+	}
+	gnupgHome, ok := os.LookupEnv("GNUPGHOME")
+	defer func() {
+		if ok {
+			_ = os.Setenv("GNUPGHOME", gnupgHome)
+		} else {
+			_ = os.Unsetenv("GNUPGHOME")
+		}
+	}()
+	err = os.Setenv("GNUPGHOME", "testdata")
+	if err != nil {
+		t.Fatal(err)
 	}
-}
 
-func Test_parseFileSources(t *testing.T) {
-	type args struct {
-		sources []string
-	}
 	tests := []struct {
-		name    string
-		args    args
-		want    kvMap
-		wantErr bool
+		name string
+		fns  []string
+		want int
 	}{
-		{"Files", args{[]string{"testdata/file.txt", "testdata/file2.txt"}}, kvMap{"file.txt": b64("secret\n"), "file2.txt": b64("secret2\n")}, false},
-		{"NoFiles", args{[]string{}}, kvMap{}, false},
-		{"Error", args{[]string{"testdata/missing.txt"}}, kvMap{}, true},
+		{"None", nil, 0},
+		{"Valid", []string{"testdata/generator.yaml", "testdata/generator-multidoc.yaml"}, 0},
+		{"FirstFailure", []string{"testdata/generator.yaml", "testdata/generator-wrongkind.yaml", "testdata/missing.yaml"}, exitSpec},
+		{"Missing", []string{"testdata/missing.yaml", "testdata/generator-wrongkind.yaml"}, exitIO},
+		{"MissingSource", []string{"testdata/generator-invalidenv.yaml"}, exitIO},
 	}
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			got := make(kvMap)
-			err := parseFileSources(tt.args.sources, got)
-			if (err != nil) != tt.wantErr {
-				t.Errorf("parseFileSources() error = %v, wantErr %v", err, tt.wantErr)
-				return
-			}
-			if !reflect.DeepEqual(got, tt.want) {
-				t.Errorf("parseFileSources() got = %v, want %v", got, tt.want)
+			if got := checkSpecs(context.Background(), tt.fns, generator.ValidateContext, "valid", generator.Options{}); got != tt.want {
+				t.Errorf("checkSpecs() = %v, want %v", got, tt.want)
 			}
 		})
 	}
 }
 
-func Test_parseFileSource(t *testing.T) {
-	type args struct {
-		source string
+func Test_readPolicy(t *testing.T) {
+	dir, err := ioutil.TempDir("", "sopssecretgenerator-policy-test-")
+	if err != nil {
+		t.Fatal(err)
 	}
+	defer os.RemoveAll(dir)
+
 	tests := []struct {
 		name    string
-		args    args
-		want    kvMap
+		content string
+		want    policy
 		wantErr bool
 	}{
-		{"File", args{"testdata/file.txt"}, kvMap{"file.txt": b64("secret\n")}, false},
-		{"MissingFile", args{"testdata/missing.txt"}, kvMap{}, true},
-		{"InvalidName", args{"=testdata/file.txt"}, kvMap{}, true},
-		{"NotSopsFile", args{"testdata/empty.txt"}, kvMap{}, true},
+		{
+			"Policy",
+			"requiredRecipients:\n  - 2D2483DF73A3A0FAEE3C2A695BDC395360CE8FF4\nallowedRecipients:\n  - arn:aws:kms:*\nmaxAge: 90d\n",
+			policy{
+				RequiredRecipients: []string{"2D2483DF73A3A0FAEE3C2A695BDC395360CE8FF4"},
+				AllowedRecipients:  []string{"arn:aws:kms:*"},
+				MaxAge:             "90d",
+			},
+			false,
+		},
+		{"Empty", "", policy{}, false},
+		{"UnknownField", "requiredRecipient: 2D2483DF73A3A0FAEE3C2A695BDC395360CE8FF4\n", policy{}, true},
+		{"NotYAML", "[", policy{}, true},
 	}
-	for _, tt := range tests {
+	for i, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			got := make(kvMap)
-			err := parseFileSource(tt.args.source, got)
+			fn := filepath.Join(dir, fmt.Sprintf("policy%d.yaml", i))
+			err := ioutil.WriteFile(fn, []byte(tt.content), 0644)
+			if err != nil {
+				t.Fatal(err)
+			}
+			got, err := readPolicy(fn)
 			if (err != nil) != tt.wantErr {
-				t.Errorf("parseFileSource() error = %v, wantErr %v", err, tt.wantErr)
+				t.Errorf("readPolicy() error = %v, wantErr %v", err, tt.wantErr)
 				return
 			}
 			if !reflect.DeepEqual(got, tt.want) {
-				t.Errorf("parseFileSource() got = %v, want %v", got, tt.want)
+				t.Errorf("readPolicy() got = %+v, want %+v", got, tt.want)
 			}
 		})
 	}
-}
 
-func Test_parseFileName(t *testing.T) {
-	type args struct {
-		source string
+	_, err = readPolicy(filepath.Join(dir, "missing.yaml"))
+	if exitCode(err) != exitIO {
+		t.Errorf("readPolicy() error = %v, want an I/O error", err)
 	}
+}
+
+func Test_applyPolicy(t *testing.T) {
 	tests := []struct {
-		name     string
-		args     args
-		wantKey  string
-		wantFile string
-		wantErr  bool
+		name    string
+		p       policy
+		maxAge  string
+		want    generator.Options
+		wantErr bool
 	}{
-		{"WithoutDirectory", args{"filename"}, "filename", "filename", false},
-		{"WithDirectory", args{"directory/filename"}, "filename", "directory/filename", false},
-		{"ExplicitKey", args{"key=filename"}, "key", "filename", false},
-		{"MissingKey", args{"=filename"}, "", "", true},
-		{"MissingFilename", args{"key="}, "", "", true},
-		{"TooManyEqualSigns", args{"key=filename=extra"}, "", "", true},
+		{
+			"Recipients",
+			policy{RequiredRecipients: []string{"FBC7B9E2A4F9289AC0C1D4843D16CEE4A27381B4"}, AllowedRecipients: []string{"arn:aws:kms:*"}},
+			"",
+			generator.Options{RequiredRecipients: []string{"FBC7B9E2A4F9289AC0C1D4843D16CEE4A27381B4"}, AllowedRecipients: []string{"arn:aws:kms:*"}},
+			false,
+		},
+		{"MaxAge", policy{MaxAge: "90d"}, "", generator.Options{MaxAge: "90d"}, false},
+		{"FlagMaxAge", policy{}, "30d", generator.Options{MaxAge: "30d"}, false},
+		{"StricterFlag", policy{MaxAge: "90d"}, "30d", generator.Options{MaxAge: "30d"}, false},
+		{"StricterPolicy", policy{MaxAge: "30d"}, "2160h", generator.Options{MaxAge: "30d"}, false},
+		{"InvalidMaxAge", policy{MaxAge: "ninety days"}, "30d", generator.Options{MaxAge: "30d"}, true},
 	}
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			got, got1, err := parseFileName(tt.args.source)
+			opts := generator.Options{MaxAge: tt.maxAge}
+			err := applyPolicy(tt.p, &opts)
 			if (err != nil) != tt.wantErr {
-				t.Errorf("parseFileName() error = %v, wantErr %v", err, tt.wantErr)
+				t.Errorf("applyPolicy() error = %v, wantErr %v", err, tt.wantErr)
 				return
 			}
-			if got != tt.wantKey {
-				t.Errorf("parseFileName() got = %v, wantKey %v", got, tt.wantKey)
-			}
-			if got1 != tt.wantFile {
-				t.Errorf("parseFileName() got1 = %v, wantFile %v", got1, tt.wantFile)
+			if err != nil && exitCode(err) != exitSpec {
+				t.Errorf("applyPolicy() exit code = %v, want %v", exitCode(err), exitSpec)
 			}
-		})
-	}
-}
-
-func Test_formatForPath(t *testing.T) {
-	type args struct {
-		path string
-	}
-	tests := []struct {
-		name string
-		args args
-		want string
-	}{
-		{"YAMLLong", args{"dir/file.yaml"}, "yaml"},
-		{"YAMLShort", args{"dir/file.yml"}, "yaml"},
-		{"JSON", args{"dir/file.json"}, "json"},
-		{"DotEnv", args{"dir/file.env"}, "dotenv"},
-		{"Other", args{"dir/file.txt"}, "binary"},
-	}
-	for _, tt := range tests {
-		t.Run(tt.name, func(t *testing.T) {
-			if got := formatForPath(tt.args.path); got != tt.want {
-				t.Errorf("formatForPath() = %v, want %v", got, tt.want)
+			if !reflect.DeepEqual(opts, tt.want) {
+				t.Errorf("applyPolicy() opts = %+v, want %+v", opts, tt.want)
 			}
 		})
 	}
 }
-
-// Test util functions
-
-func b64(s string) string {
-	return base64.StdEncoding.EncodeToString([]byte(s))
-}
-
-func b(s string) []byte {
-	return []byte(s)
-}
-
-func ssg(envSources []string, fileSources []string) SopsSecretGenerator {
-	return SopsSecretGenerator{
-		TypeMeta: TypeMeta{
-			APIVersion: apiVersion,
-			Kind:       kind,
-		},
-		ObjectMeta: ObjectMeta{
-			Name:        "secret",
-			Annotations: kvMap{},
-		},
-		DisableNameSuffixHash: true,
-		EnvSources:            envSources,
-		FileSources:           fileSources,
-	}
-}
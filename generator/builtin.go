@@ -0,0 +1,100 @@
+// Copyright 2019 Go About B.V. and contributors
+// Licensed under the Apache License, Version 2.0.
+
+package generator
+
+import (
+	"github.com/pkg/errors"
+	"gopkg.in/yaml.v2"
+)
+
+// The kustomize builtin SecretGenerator, whose arguments are accepted as a
+// spec to ease migrating to sops-encrypted sources.
+const builtinAPIVersion = "builtin"
+const builtinKind = "SecretGenerator"
+
+// builtinSecretGenerator contains the arguments of the kustomize builtin
+// SecretGenerator.
+type builtinSecretGenerator struct {
+	TypeMeta    `yaml:",inline"`
+	ObjectMeta  `yaml:"metadata"`
+	Behavior    string                  `yaml:"behavior,omitempty"`
+	EnvSources  []Source                `yaml:"envs,omitempty"`
+	FileSources []Source                `yaml:"files,omitempty"`
+	Literals    []string                `yaml:"literals,omitempty"`
+	Type        string                  `yaml:"type,omitempty"`
+	Options     builtinGeneratorOptions `yaml:"options,omitempty"`
+}
+
+type builtinGeneratorOptions struct {
+	Labels                kvMap `yaml:"labels,omitempty"`
+	Annotations           kvMap `yaml:"annotations,omitempty"`
+	DisableNameSuffixHash bool  `yaml:"disableNameSuffixHash,omitempty"`
+	Immutable             bool  `yaml:"immutable,omitempty"`
+}
+
+// readBuiltinSpec reads the arguments of the kustomize builtin
+// SecretGenerator as a spec, whose sources are decrypted with sops. Fields
+// that the generator does not support are warned about, or are an error with
+// opts.Strict.
+func readBuiltinSpec(content []byte, opts Options) (SopsSecretGenerator, error) {
+	var builtin builtinSecretGenerator
+	err := yaml.UnmarshalStrict(content, &builtin)
+	if err != nil {
+		if opts.Strict {
+			return SopsSecretGenerator{}, withClass(ClassSpec, err)
+		}
+		warnf(opts, "ignoring unknown fields of %v: %v", builtinKind, err)
+		builtin = builtinSecretGenerator{}
+		err = yaml.Unmarshal(content, &builtin)
+		if err != nil {
+			return SopsSecretGenerator{}, withClass(ClassSpec, err)
+		}
+	}
+
+	// Literals would be plaintext secrets next to the encrypted sources
+	if len(builtin.Literals) > 0 {
+		return SopsSecretGenerator{}, withClass(ClassSpec, errors.New("literals are not encrypted, move them to an encrypted env source"))
+	}
+	if builtin.Options.Immutable {
+		if opts.Strict {
+			return SopsSecretGenerator{}, withClass(ClassSpec, errors.New("options.immutable is not supported"))
+		}
+		warnf(opts, "ignoring options.immutable, which is not supported")
+	}
+
+	input := SopsSecretGenerator{
+		TypeMeta: TypeMeta{
+			APIVersion: apiVersion,
+			Kind:       kind,
+		},
+		ObjectMeta: ObjectMeta{
+			Name:         builtin.Name,
+			GenerateName: builtin.GenerateName,
+			Namespace:    builtin.Namespace,
+			Annotations:  make(kvMap),
+
+			OwnerReferences: builtin.OwnerReferences,
+		},
+		Behavior:              builtin.Behavior,
+		EnvSources:            builtin.EnvSources,
+		FileSources:           builtin.FileSources,
+		Type:                  builtin.Type,
+		DisableNameSuffixHash: builtin.Options.DisableNameSuffixHash,
+	}
+	// Kustomize applies the labels and annotations of the options
+	for _, labels := range []kvMap{builtin.Labels, builtin.Options.Labels} {
+		for k, v := range labels {
+			if input.Labels == nil {
+				input.Labels = make(kvMap)
+			}
+			input.Labels[k] = v
+		}
+	}
+	for _, annotations := range []kvMap{builtin.Annotations, builtin.Options.Annotations} {
+		for k, v := range annotations {
+			input.Annotations[k] = v
+		}
+	}
+	return input, nil
+}
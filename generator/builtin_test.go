@@ -0,0 +1,79 @@
+// Copyright 2019 Go About B.V. and contributors
+// Licensed under the Apache License, Version 2.0.
+
+package generator
+
+import (
+	"bytes"
+	"io/ioutil"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func Test_readBuiltinSpec(t *testing.T) {
+	type args struct {
+		fn     string
+		strict bool
+	}
+	tests := []struct {
+		name         string
+		args         args
+		want         SopsSecretGenerator
+		wantWarnings []string
+		wantErr      bool
+	}{
+		{
+			"SecretGenerator",
+			args{"testdata/builtin-generator.yaml", true},
+			SopsSecretGenerator{
+				TypeMeta: TypeMeta{APIVersion: apiVersion, Kind: kind},
+				ObjectMeta: ObjectMeta{
+					Name:        "secret",
+					Namespace:   "default",
+					Labels:      kvMap{"app": "my-app"},
+					Annotations: kvMap{"created-by": "me"},
+				},
+				Behavior:              "merge",
+				EnvSources:            sources("testdata/vars.env"),
+				FileSources:           sources("secret=testdata/file.txt"),
+				Type:                  "Opaque",
+				DisableNameSuffixHash: true,
+			},
+			nil,
+			false,
+		},
+		{
+			"Unsupported",
+			args{"testdata/builtin-generator-unsupported.yaml", false},
+			SopsSecretGenerator{
+				TypeMeta:    TypeMeta{APIVersion: apiVersion, Kind: kind},
+				ObjectMeta:  ObjectMeta{Name: "secret", Annotations: kvMap{}},
+				FileSources: sources("testdata/file.txt"),
+			},
+			[]string{"unknownOption", "options.immutable"},
+			false,
+		},
+		{"UnsupportedStrict", args{"testdata/builtin-generator-unsupported.yaml", true}, SopsSecretGenerator{}, nil, true},
+		{"Literals", args{"testdata/builtin-generator-literals.yaml", false}, SopsSecretGenerator{}, nil, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			content, _ := ioutil.ReadFile(tt.args.fn)
+			var warnings bytes.Buffer
+			got, err := readInput(content, Options{Strict: tt.args.strict, Warnings: &warnings})
+			if (err != nil) != tt.wantErr {
+				t.Errorf("readInput() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("readInput() got = %v, want %v", got, tt.want)
+			}
+			for _, w := range tt.wantWarnings {
+				if !strings.Contains(warnings.String(), w) {
+					t.Errorf("readInput() warnings = %q, want %v", warnings.String(), w)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,142 @@
+// Copyright 2019 Go About B.V. and contributors
+// Parts adapted from kustomize, Copyright 2019 The Kubernetes Authors.
+// Licensed under the Apache License, Version 2.0.
+
+package generator
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/json"
+	"fmt"
+	"sort"
+
+	"github.com/pkg/errors"
+	"gopkg.in/yaml.v2"
+)
+
+// ConfigMap is a Kubernetes ConfigMap, generated next to the Secret for the
+// keys that are not sensitive
+type ConfigMap struct {
+	TypeMeta   `json:",inline" yaml:",inline"`
+	ObjectMeta `json:"metadata" yaml:"metadata"`
+	Data       kvMap `json:"data" yaml:"data"`
+}
+
+// ConfigMapHash returns the hash that kustomize appends to the name of a
+// generated ConfigMap, computed over its kind, name and data.
+func ConfigMapHash(configMap ConfigMap) (string, error) {
+	encoded, err := json.Marshal(map[string]interface{}{
+		"kind": "ConfigMap",
+		"name": configMap.Name,
+		"data": configMap.Data,
+	})
+	if err != nil {
+		return "", err
+	}
+	return encodeHash(fmt.Sprintf("%x", sha256.Sum256(encoded))), nil
+}
+
+// generateConfigMap generates the ConfigMap of a SopsConfigMap spec. It is
+// generated as the companion of a Secret without keys, so that it gets the
+// same metadata.
+func generateConfigMap(ctx context.Context, input SopsSecretGenerator, opts Options) (ConfigMap, error) {
+	switch {
+	case input.Type != "":
+		return ConfigMap{}, withClass(ClassSpec, errors.Errorf("type cannot be used with kind %v", configMapKind))
+	case len(input.HashKeys) > 0:
+		return ConfigMap{}, withClass(ClassSpec, errors.Errorf("hashKeys cannot be used with kind %v", configMapKind))
+	case len(input.ConfigMapKeys) > 0:
+		return ConfigMap{}, withClass(ClassSpec, errors.Errorf("configMapKeys cannot be used with kind %v", configMapKind))
+	}
+	secret, err := generateSecret(ctx, input, opts)
+	if err != nil {
+		return ConfigMap{}, err
+	}
+	configMap := *secret.configMap
+	// Sizes are counted as if the values were encoded, as for a Secret
+	sized := Secret{ObjectMeta: configMap.ObjectMeta, StringData: configMap.Data}
+	err = validateSize(sized, opts.MaxSize)
+	if err != nil {
+		return ConfigMap{}, withClass(ClassSource, err)
+	}
+	opts.Summary.setSecret(sized)
+	return configMap, nil
+}
+
+// marshalConfigMap returns the ConfigMap as YAML, preceded by the header
+// comment.
+func marshalConfigMap(configMap ConfigMap, opts Options) ([]byte, error) {
+	output, err := yaml.Marshal(configMap)
+	if err != nil {
+		return nil, err
+	}
+	return append(commentLines(opts.HeaderComment), output...), nil
+}
+
+// dataKeys returns the keys of data, sorted.
+func dataKeys(data kvMap) []string {
+	keys := make([]string, 0, len(data))
+	for k := range data {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// splitConfigMapData removes the values of the ConfigMap keys from the data
+// and stringData of the secret, and returns them. ConfigMap data is
+// plaintext, so the values must be valid UTF-8.
+func splitConfigMapData(data kvMap, stringData kvMap, keys []string) (kvMap, error) {
+	if len(keys) == 0 {
+		return nil, nil
+	}
+	configMapData := make(kvMap)
+	for _, k := range keys {
+		v, ok := data[k]
+		if ok {
+			delete(data, k)
+		} else if v, ok = stringData[k]; ok {
+			delete(stringData, k)
+		} else {
+			return nil, fmt.Errorf("config map key %v is not in the sources", k)
+		}
+		if err := validateUTF8([]byte(v)); err != nil {
+			return nil, errors.Wrapf(err, "value for config map key %v", k)
+		}
+		configMapData[k] = v
+	}
+	return configMapData, nil
+}
+
+// companionConfigMap returns the ConfigMap for data with the metadata of the
+// secret, before kustomize or the generator hashed its name. The ConfigMap
+// is hashed on its own: appendHash appends its hash to the name, otherwise
+// needsHash asks kustomize to.
+func companionConfigMap(secret Secret, data kvMap, needsHash bool, appendHash bool) (*ConfigMap, error) {
+	annotations := make(kvMap)
+	for k, v := range secret.Annotations {
+		if k != needsHashAnnotation {
+			annotations[k] = v
+		}
+	}
+	configMap := ConfigMap{
+		TypeMeta: TypeMeta{
+			APIVersion: "v1",
+			Kind:       "ConfigMap",
+		},
+		ObjectMeta: secret.ObjectMeta,
+		Data:       data,
+	}
+	configMap.Annotations = annotations
+	if needsHash && appendHash {
+		hash, err := ConfigMapHash(configMap)
+		if err != nil {
+			return nil, err
+		}
+		configMap.Name += "-" + hash
+	} else if needsHash {
+		annotations[needsHashAnnotation] = "true"
+	}
+	return &configMap, nil
+}
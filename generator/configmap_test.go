@@ -0,0 +1,122 @@
+// Copyright 2019 Go About B.V. and contributors
+// Licensed under the Apache License, Version 2.0.
+
+package generator
+
+import (
+	"context"
+	"reflect"
+	"testing"
+)
+
+func Test_splitConfigMapData(t *testing.T) {
+	tests := []struct {
+		name           string
+		keys           []string
+		want           kvMap
+		wantData       kvMap
+		wantStringData kvMap
+		wantErr        bool
+	}{
+		{"None", nil, nil, kvMap{"A": "a", "B": "b"}, kvMap{"C": "c"}, false},
+		{"Data", []string{"A"}, kvMap{"A": "a"}, kvMap{"B": "b"}, kvMap{"C": "c"}, false},
+		{"StringData", []string{"B", "C"}, kvMap{"B": "b", "C": "c"}, kvMap{"A": "a"}, kvMap{}, false},
+		{"Missing", []string{"D"}, nil, nil, nil, true},
+		{"Binary", []string{"X"}, nil, nil, nil, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			data := kvMap{"A": "a", "B": "b", "X": "\xff"}
+			stringData := kvMap{"C": "c"}
+			got, err := splitConfigMapData(data, stringData, tt.keys)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("splitConfigMapData() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if tt.wantErr {
+				return
+			}
+			delete(data, "X")
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("splitConfigMapData() got = %v, want %v", got, tt.want)
+			}
+			if !reflect.DeepEqual(data, tt.wantData) || !reflect.DeepEqual(stringData, tt.wantStringData) {
+				t.Errorf("splitConfigMapData() left data = %v, stringData = %v", data, stringData)
+			}
+		})
+	}
+}
+
+func Test_companionConfigMap(t *testing.T) {
+	secret := Secret{
+		ObjectMeta: ObjectMeta{
+			Name: "secret",
+			Annotations: kvMap{
+				"annotation":                         "value",
+				"kustomize.config.k8s.io/needs-hash": "true",
+			},
+		},
+	}
+	data := kvMap{"LOG_LEVEL": "debug"}
+	hash, err := ConfigMapHash(ConfigMap{ObjectMeta: ObjectMeta{Name: "secret"}, Data: data})
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		name            string
+		needsHash       bool
+		appendHash      bool
+		wantName        string
+		wantAnnotations kvMap
+	}{
+		{"NeedsHash", true, false, "secret", kvMap{"annotation": "value", "kustomize.config.k8s.io/needs-hash": "true"}},
+		{"AppendHash", true, true, "secret-" + hash, kvMap{"annotation": "value"}},
+		{"NoHash", false, true, "secret", kvMap{"annotation": "value"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := companionConfigMap(secret, data, tt.needsHash, tt.appendHash)
+			if err != nil {
+				t.Errorf("companionConfigMap() error = %v", err)
+				return
+			}
+			if got.Kind != "ConfigMap" || got.Name != tt.wantName || !reflect.DeepEqual(got.Annotations, tt.wantAnnotations) {
+				t.Errorf("companionConfigMap() got = %+v, want name %v and annotations %v", got, tt.wantName, tt.wantAnnotations)
+			}
+		})
+	}
+	if _, ok := secret.Annotations["kustomize.config.k8s.io/needs-hash"]; !ok {
+		t.Errorf("companionConfigMap() modified the annotations of the secret")
+	}
+}
+
+func Test_generateConfigMap(t *testing.T) {
+	tests := []struct {
+		name    string
+		input   SopsSecretGenerator
+		wantErr bool
+	}{
+		{"Sources", SopsSecretGenerator{FileSources: sources("testdata/file.txt")}, false},
+		{"Type", SopsSecretGenerator{FileSources: sources("testdata/file.txt"), Type: "Opaque"}, true},
+		{"HashKeys", SopsSecretGenerator{FileSources: sources("testdata/file.txt"), HashKeys: []string{"file.txt"}}, true},
+		{"Binary", SopsSecretGenerator{FileSources: sources("testdata/file-binary.bin")}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.input.TypeMeta = TypeMeta{APIVersion: apiVersion, Kind: configMapKind}
+			tt.input.Name = "config"
+			got, err := generateConfigMap(context.Background(), tt.input, Options{})
+			if (err != nil) != tt.wantErr {
+				t.Errorf("generateConfigMap() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if tt.wantErr {
+				return
+			}
+			want := kvMap{"file.txt": "secret\n"}
+			if got.Kind != "ConfigMap" || got.Name != "config" || !reflect.DeepEqual(got.Data, want) {
+				t.Errorf("generateConfigMap() got = %+v, want data %v", got, want)
+			}
+		})
+	}
+}
@@ -0,0 +1,182 @@
+// Copyright 2019 Go About B.V. and contributors
+// Licensed under the Apache License, Version 2.0.
+
+package generator
+
+import (
+	"context"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+	sopsdecrypt "go.mozilla.org/sops/decrypt"
+	"gopkg.in/yaml.v2"
+)
+
+// DecryptFunc decrypts sops content in a sops format: yaml, json, dotenv or
+// binary.
+type DecryptFunc func(content []byte, format string) ([]byte, error)
+
+// transientErrorMessages are parts of error messages of key management
+// services and networks that indicate that a retry may succeed.
+var transientErrorMessages = []string{
+	"throttl",
+	"rate exceeded",
+	"too many requests",
+	"timeout",
+	"timed out",
+	"temporarily unavailable",
+	"service unavailable",
+	"internal server error",
+	"bad gateway",
+	"connection reset",
+	"status code: 5",
+}
+
+// permanentErrorMessages are parts of error messages that a retry will not
+// fix, even when the error also looks transient.
+var permanentErrorMessages = []string{
+	"mac mismatch",
+	"access denied",
+	"accessdenied",
+	"unauthorized",
+	"forbidden",
+	"permission denied",
+}
+
+// decrypt decrypts sops content, retrying transient errors as configured by
+// opts. Because sops does not support cancellation, a decryption that is
+// still running when ctx is done is abandoned.
+func decrypt(ctx context.Context, content []byte, format string, opts Options) ([]byte, error) {
+	if opts.Decrypt == nil && ageOnly(content, format) {
+		return nil, errors.New("encrypted only to age recipients, which the built-in sops does not support; " +
+			"add a KMS, PGP, GCP KMS or Azure Key Vault recipient")
+	}
+	if len(opts.RequiredRecipients) > 0 || len(opts.AllowedRecipients) > 0 {
+		err := checkRecipients(content, format, opts.RequiredRecipients, opts.AllowedRecipients)
+		if err != nil {
+			return nil, err
+		}
+	}
+	decryptData := opts.Decrypt
+	if decryptData == nil && (len(opts.KeyServices) > 0 || opts.DisableLocalKeyService || len(opts.KeyGroups) > 0 || opts.IgnoreMAC || opts.AWSProfile != "") {
+		var closeKeyServices func()
+		var err error
+		decryptData, closeKeyServices, err = keyServiceDecrypt(opts)
+		if err != nil {
+			return nil, err
+		}
+		defer closeKeyServices()
+	}
+	if decryptData == nil {
+		decryptData = sopsdecrypt.Data
+	}
+	backoff := opts.RetryBackoff
+	for attempt := 0; ; attempt++ {
+		cleartext, err := decryptOnce(ctx, decryptData, content, format)
+		if err == nil || attempt >= opts.Retries || ctx.Err() != nil || !isTransient(err) {
+			return cleartext, err
+		}
+		select {
+		case <-time.After(backoff):
+		case <-ctx.Done():
+			return nil, errors.Wrap(ctx.Err(), "decryption aborted")
+		}
+		backoff *= 2
+	}
+}
+
+func decryptOnce(ctx context.Context, decryptData DecryptFunc, content []byte, format string) ([]byte, error) {
+	if ctx.Err() != nil {
+		return nil, errors.Wrap(ctx.Err(), "decryption aborted")
+	}
+	type result struct {
+		cleartext []byte
+		err       error
+	}
+	results := make(chan result, 1)
+	go func() {
+		cleartext, err := decryptData(content, format)
+		results <- result{cleartext, err}
+	}()
+	select {
+	case r := <-results:
+		return r.cleartext, r.err
+	case <-ctx.Done():
+		return nil, errors.Wrap(ctx.Err(), "decryption aborted")
+	}
+}
+
+// ageOnly returns whether sops content is encrypted to age recipients, but
+// to no keys that the built-in sops supports. That sops predates age, and
+// reports such content as having no keys.
+func ageOnly(content []byte, format string) bool {
+	if !hasAgeRecipients(content, format) {
+		return false
+	}
+	tree, err := newSopsStore(format).LoadEncryptedFile(content)
+	if err != nil {
+		return true
+	}
+	for _, group := range tree.Metadata.KeyGroups {
+		if len(group) > 0 {
+			return false
+		}
+	}
+	return true
+}
+
+// hasAgeRecipients returns whether the sops metadata of content has age
+// recipients, at the top level or in a key group.
+func hasAgeRecipients(content []byte, format string) bool {
+	if sopsFormat(format) == "dotenv" {
+		for _, line := range strings.Split(string(content), "\n") {
+			if strings.HasPrefix(line, "sops_age__") || (strings.HasPrefix(line, "sops_key_groups__") && strings.Contains(line, "__age__")) {
+				return true
+			}
+		}
+		return false
+	}
+	// The binary format is JSON, which YAML reads too
+	var doc struct {
+		Sops struct {
+			Age       []interface{} `yaml:"age"`
+			KeyGroups []struct {
+				Age []interface{} `yaml:"age"`
+			} `yaml:"key_groups"`
+		} `yaml:"sops"`
+	}
+	if yaml.Unmarshal(content, &doc) != nil {
+		return false
+	}
+	if len(doc.Sops.Age) > 0 {
+		return true
+	}
+	for _, group := range doc.Sops.KeyGroups {
+		if len(group.Age) > 0 {
+			return true
+		}
+	}
+	return false
+}
+
+// isTransient returns whether a decryption error is likely to go away when
+// retrying. Sops reports errors of key management services as text, so they
+// are classified by their messages.
+func isTransient(err error) bool {
+	if e, ok := errors.Cause(err).(interface{ Timeout() bool }); ok && e.Timeout() {
+		return true
+	}
+	message := strings.ToLower(err.Error())
+	for _, m := range permanentErrorMessages {
+		if strings.Contains(message, m) {
+			return false
+		}
+	}
+	for _, m := range transientErrorMessages {
+		if strings.Contains(message, m) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,146 @@
+// Copyright 2019 Go About B.V. and contributors
+// Licensed under the Apache License, Version 2.0.
+
+package generator
+
+import (
+	"context"
+	"io/ioutil"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// failingDecrypt returns a DecryptFunc that fails n times with err, and then
+// returns the content. It counts the calls in calls.
+func failingDecrypt(n int, err error, calls *int) DecryptFunc {
+	return func(content []byte, format string) ([]byte, error) {
+		*calls++
+		if *calls <= n {
+			return nil, err
+		}
+		return content, nil
+	}
+}
+
+func Test_decryptRetries(t *testing.T) {
+	throttled := errors.New("ThrottlingException: Rate exceeded")
+	denied := errors.New("AccessDeniedException: not authorized")
+	type args struct {
+		failures int
+		err      error
+		retries  int
+	}
+	tests := []struct {
+		name      string
+		args      args
+		wantCalls int
+		wantErr   bool
+	}{
+		{"Success", args{0, nil, 2}, 1, false},
+		{"RetrySucceeds", args{2, throttled, 2}, 3, false},
+		{"RetriesExhausted", args{3, throttled, 2}, 3, true},
+		{"NoRetries", args{1, throttled, 0}, 1, true},
+		{"Permanent", args{1, denied, 2}, 1, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			calls := 0
+			opts := Options{
+				Decrypt:      failingDecrypt(tt.args.failures, tt.args.err, &calls),
+				Retries:      tt.args.retries,
+				RetryBackoff: time.Millisecond,
+			}
+			got, err := decrypt(context.Background(), []byte("secret"), "binary", opts)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("decrypt() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if !tt.wantErr && string(got) != "secret" {
+				t.Errorf("decrypt() got = %v, want secret", string(got))
+			}
+			if calls != tt.wantCalls {
+				t.Errorf("decrypt() calls = %v, want %v", calls, tt.wantCalls)
+			}
+		})
+	}
+}
+
+func Test_decryptRetryCanceled(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	calls := 0
+	opts := Options{
+		Decrypt:      failingDecrypt(1, errors.New("connection timed out"), &calls),
+		Retries:      1,
+		RetryBackoff: time.Hour,
+	}
+	_, err := decrypt(ctx, []byte("secret"), "binary", opts)
+	if err == nil {
+		t.Errorf("decrypt() error = nil, want error")
+	}
+}
+
+type timeoutError struct{}
+
+func (timeoutError) Error() string { return "i/o" }
+func (timeoutError) Timeout() bool { return true }
+
+func Test_isTransient(t *testing.T) {
+	tests := []struct {
+		name string
+		err  error
+		want bool
+	}{
+		{"Throttling", errors.New("ThrottlingException: Rate exceeded"), true},
+		{"ServerError", errors.New("KMS: status code: 503, request id: x"), true},
+		{"Timeout", errors.Wrap(timeoutError{}, "dial"), true},
+		{"AccessDenied", errors.New("AccessDeniedException: status code: 400"), false},
+		{"MacMismatch", errors.New("MAC mismatch. File has 1, computed 2"), false},
+		{"Other", errors.New("Error unmarshalling input yaml"), false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := isTransient(tt.err); got != tt.want {
+				t.Errorf("isTransient() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func Test_ageOnly(t *testing.T) {
+	ageMetadata := strings.Join([]string{
+		"sops:",
+		"    age:",
+		"    -   recipient: age1ql3z7hjy54pw3hyww5ayyfg7zqgvc7w3j2elw8zmrj2kg5sfn9aqmcac8p",
+		"        enc: |",
+		"            -----BEGIN AGE ENCRYPTED FILE-----",
+		"            -----END AGE ENCRYPTED FILE-----",
+		"    lastmodified: '2021-06-01T12:00:00Z'",
+		"    mac: ENC[AES256_GCM,data:AAAA,iv:AAAA,tag:AAAA,type:str]",
+		"    version: 3.7.1",
+	}, "\n")
+	vars, _ := ioutil.ReadFile("testdata/vars.yaml")
+	tests := []struct {
+		name    string
+		content string
+		format  string
+		want    bool
+	}{
+		{"YAML", "KEY: ENC[AES256_GCM,data:AAAA,iv:AAAA,tag:AAAA,type:str]\n" + ageMetadata + "\n", "yaml", true},
+		{"JSON", `{"KEY": "x", "sops": {"age": [{"recipient": "age1x", "enc": "x"}], "lastmodified": "2021-06-01T12:00:00Z"}}`, "binary", true},
+		{"KeyGroups", "sops:\n    key_groups:\n    -   age:\n        -   recipient: age1x\n            enc: x\n", "yaml", true},
+		{"Dotenv", "KEY=ENC[AES256_GCM,data:AAAA,iv:AAAA,tag:AAAA,type:str]\nsops_age__list_0__map_recipient=age1x\n", "dotenv", true},
+		{"PGP", string(vars), "yaml", false},
+		{"NotSops", "KEY: value\n", "yaml", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := ageOnly([]byte(tt.content), tt.format); got != tt.want {
+				t.Errorf("ageOnly() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,120 @@
+// Copyright 2019 Go About B.V. and contributors
+// Licensed under the Apache License, Version 2.0.
+
+package generator
+
+import (
+	"os"
+	"strings"
+)
+
+// ErrorClass tells what kind of failure an error of the generator is.
+type ErrorClass int
+
+const (
+	// ClassUnknown is the class of errors that are not classified.
+	ClassUnknown ErrorClass = iota
+	// ClassSpec is the class of invalid specs, such as unknown kinds, missing
+	// names or invalid fields.
+	ClassSpec
+	// ClassSource is the class of errors decrypting or parsing the sources,
+	// including errors of the key service.
+	ClassSource
+	// ClassIO is the class of errors reading or writing files.
+	ClassIO
+)
+
+func (c ErrorClass) String() string {
+	switch c {
+	case ClassSpec:
+		return "spec"
+	case ClassSource:
+		return "source"
+	case ClassIO:
+		return "io"
+	default:
+		return "unknown"
+	}
+}
+
+// classifiedError is an error with its class.
+type classifiedError struct {
+	class ErrorClass
+	err   error
+}
+
+func (e classifiedError) Error() string {
+	return e.err.Error()
+}
+
+// Cause returns the underlying error, for errors.Cause.
+func (e classifiedError) Cause() error {
+	return e.err
+}
+
+// withClass classifies err, unless it is nil or already classified.
+func withClass(class ErrorClass, err error) error {
+	if err == nil || Classify(err) != ClassUnknown {
+		return err
+	}
+	return classifiedError{class, err}
+}
+
+// Classify returns the class of an error returned by the generator. Errors
+// caused by reading or writing a file are I/O errors, whichever operation
+// failed. Combined errors have the class of the first error.
+func Classify(err error) ErrorClass {
+	class := ClassUnknown
+	for err != nil {
+		switch e := err.(type) {
+		case *os.PathError, *os.LinkError:
+			return ClassIO
+		case multiError:
+			return Classify(e[0])
+		case classifiedError:
+			if class == ClassUnknown {
+				class = e.class
+			}
+		}
+		cause, ok := err.(interface{ Cause() error })
+		if !ok {
+			break
+		}
+		err = cause.Cause()
+	}
+	return class
+}
+
+// multiError is a list of errors, reported together.
+type multiError []error
+
+func (m multiError) Error() string {
+	messages := make([]string, len(m))
+	for i, err := range m {
+		messages[i] = err.Error()
+	}
+	return strings.Join(messages, "\n")
+}
+
+// combineErrors returns the errors that are not nil as a single error, or nil
+// if there are none. Combined errors are flattened.
+func combineErrors(errs ...error) error {
+	var combined multiError
+	for _, err := range errs {
+		switch e := err.(type) {
+		case nil:
+		case multiError:
+			combined = append(combined, e...)
+		default:
+			combined = append(combined, e)
+		}
+	}
+	switch len(combined) {
+	case 0:
+		return nil
+	case 1:
+		return combined[0]
+	default:
+		return combined
+	}
+}
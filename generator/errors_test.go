@@ -0,0 +1,86 @@
+// Copyright 2019 Go About B.V. and contributors
+// Licensed under the Apache License, Version 2.0.
+
+package generator
+
+import (
+	"os"
+	"testing"
+
+	"github.com/pkg/errors"
+)
+
+func Test_combineErrors(t *testing.T) {
+	e1 := errors.New("env source a.env: error 1")
+	e2 := errors.New("file source b.txt: error 2")
+	e3 := errors.New("file source c.txt: error 3")
+	tests := []struct {
+		name string
+		errs []error
+		want string
+	}{
+		{"None", []error{nil, nil}, ""},
+		{"One", []error{nil, e1}, "env source a.env: error 1"},
+		{"Several", []error{e1, nil, e2}, "env source a.env: error 1\nfile source b.txt: error 2"},
+		{"Flattened", []error{multiError{e1, e2}, e3}, "env source a.env: error 1\nfile source b.txt: error 2\nfile source c.txt: error 3"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := combineErrors(tt.errs...)
+			if tt.want == "" {
+				if err != nil {
+					t.Errorf("combineErrors() = %v, want nil", err)
+				}
+				return
+			}
+			if err == nil || err.Error() != tt.want {
+				t.Errorf("combineErrors() = %v, want %v", err, tt.want)
+			}
+		})
+	}
+}
+
+func TestClassify(t *testing.T) {
+	pathErr := &os.PathError{Op: "open", Path: "a.env", Err: os.ErrNotExist}
+	tests := []struct {
+		name string
+		err  error
+		want ErrorClass
+	}{
+		{"Nil", nil, ClassUnknown},
+		{"Unclassified", errors.New("error"), ClassUnknown},
+		{"Spec", withClass(ClassSpec, errors.New("error")), ClassSpec},
+		{"Wrapped", errors.Wrap(withClass(ClassSource, errors.New("error")), "env source a.env"), ClassSource},
+		{"Outermost", withClass(ClassSpec, classifiedError{ClassSource, errors.New("error")}), ClassSource},
+		{"PathError", withClass(ClassSource, errors.Wrap(pathErr, "env source a.env")), ClassIO},
+		{"Combined", multiError{withClass(ClassSource, errors.New("error")), pathErr}, ClassSource},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := Classify(tt.err); got != tt.want {
+				t.Errorf("Classify() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestClassify_Generate(t *testing.T) {
+	tests := []struct {
+		name string
+		spec string
+		want ErrorClass
+	}{
+		{"WrongKind", "apiVersion: v1\nkind: Secret\n", ClassSpec},
+		{"MissingName", "apiVersion: goabout.com/v1beta1\nkind: SopsSecretGenerator\n", ClassSpec},
+		{"MissingSource", "apiVersion: goabout.com/v1beta1\nkind: SopsSecretGenerator\nmetadata:\n  name: secret\nenvs:\n- testdata/missing.env\n", ClassIO},
+		{"InvalidSource", "apiVersion: goabout.com/v1beta1\nkind: SopsSecretGenerator\nmetadata:\n  name: secret\nenvs:\n- testdata/file.txt\n", ClassSource},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := Generate([]byte(tt.spec), Options{})
+			if got := Classify(err); got != tt.want {
+				t.Errorf("Classify() = %v, want %v (error %v)", got, tt.want, err)
+			}
+		})
+	}
+}
@@ -0,0 +1,366 @@
+// Copyright 2019 Go About B.V. and contributors
+// Licensed under the Apache License, Version 2.0.
+
+package generator
+
+import (
+	"bytes"
+	"fmt"
+	"reflect"
+	"strings"
+)
+
+type exampleField struct {
+	comment string
+	value   string
+}
+
+// exampleFields documents the spec fields by their YAML path. Fields without
+// a value are objects whose fields are documented separately.
+var exampleFields = map[string]exampleField{
+	"apiVersion": {"API version of the generator", apiVersion},
+	"kind": {
+		"Kind of the generator; SopsConfigMap generates a ConfigMap instead of a Secret",
+		kind,
+	},
+	"metadata": {"Metadata of the generated Secret", ""},
+	"metadata.name": {
+		"Name of the generated Secret",
+		"my-secret",
+	},
+	"metadata.generateName": {
+		"Prefix of a name that Kubernetes generates, used if name is not set. The\n" +
+			"name suffix hash is then disabled.",
+		"my-secret-",
+	},
+	"metadata.namespace": {
+		"Namespace of the generated Secret",
+		"default",
+	},
+	"metadata.labels": {
+		"Labels of the generated Secret",
+		"\napp: my-app",
+	},
+	"metadata.annotations": {
+		"Annotations of the generated Secret",
+		"\ncreated-by: me",
+	},
+	"metadata.ownerReferences": {
+		"Owners of the generated Secret, which is garbage-collected with its owner",
+		"\n- apiVersion: example.com/v1\n  kind: MyApp\n  name: my-app\n  uid: d9607e19-f88f-11e6-a518-42010a800195\n  controller: true",
+	},
+	"envs": {
+		"Sops-encrypted dotenv, YAML, JSON, XML, INI, TOML or Java properties files\n" +
+			"whose variables become keys.\n" +
+			"override replaces keys of earlier sources.\n" +
+			"expandVars expands references to environment variables.\n" +
+			"unquoteValues unquotes dotenv values such as \"val\" on a single line.\n" +
+			"valueEncoding stores YAML, JSON and TOML lists and maps as JSON or YAML.\n" +
+			"recursiveDecrypt decrypts values that are sops documents.\n" +
+			"index selects an element of a JSON array.\n" +
+			"when decides whether the source is used.\n" +
+			"stringData stores the values in plaintext stringData instead of data.\n" +
+			"Plain sources are not encrypted.\n" +
+			"Optional sources, such as PATH?, are skipped if they do not exist.\n" +
+			"prefix and suffix rename the keys.\n" +
+			"includeKeys and excludeKeys select keys by glob or /regexp/.\n" +
+			"flatten turns nested values into keys such as db.password.\n" +
+			"format sets the format of files without a known extension.\n" +
+			"checksum pins an https:// source to its sha256.\n" +
+			"Besides local paths, sources can be vault://PATH, https:// URLs,\n" +
+			"git::REPO//PATH?ref=REF, s3://BUCKET/KEY or gs://BUCKET/OBJECT.",
+		"\n- secret-vars.env\n- path: secret-overrides.yaml\n  override: true\n- path: secret-paths.env\n  expandVars: true\n" +
+			"- path: secret-config.yaml\n  valueEncoding: json\n" +
+			"- path: secret-wrapped.yaml\n  recursiveDecrypt: true\n" +
+			"- path: secret-credentials.json\n  index: 0\n" +
+			"- vault://secret/data/my-app\n" +
+			"- path: secret-app.env\n  stringData: true\n" +
+			"- path: secret-prod.env\n  when: '{{ eq .Env.ENVIRONMENT \"prod\" }}'\n" +
+			"- path: defaults.env\n  plain: true\n" +
+			"- secret-local.env?\n" +
+			"- path: secret-db.env\n  prefix: DB_\n" +
+			"- path: secret-platform.yaml\n  includeKeys:\n  - SMTP_*\n  excludeKeys:\n  - /_ADMIN_/\n" +
+			"- path: secret-nested.yaml\n  flattenSeparator: _\n  upperCaseKeys: true\n" +
+			"- path: secret-legacy.env.enc\n  format: dotenv\n" +
+			"- path: https://artifacts.example.com/secrets/secret-bundle.env\n" +
+			"  checksum: sha256:9f86d081884c7d659a2feaa0c55ad015a3bf4f1b2b0b822cd15d6c15b0f00a08\n" +
+			"- git::https://git.example.com/platform/secrets.git//secret-shared.yaml?ref=v1.2.3\n" +
+			"- s3://example-terraform-outputs/secret-outputs.json",
+	},
+	"files": {
+		"Sops-encrypted files that become keys, named after the file, KEY=FILE or the\n" +
+			"key of the source. A format can be set for files without a known extension.\n" +
+			"Files containing base64 text can be decoded. A field of a secret in Vault KV\n" +
+			"is read with vault://PATH#FIELD, and a value of a YAML, JSON or TOML file\n" +
+			"with FILE#PATH. Plain files are not encrypted. Glob patterns use all matching\n" +
+			"files, and directories all files in them, up to an optional depth.",
+		"\n- secret-file1.txt\n- secret-file2.txt=secret-file2.sops.txt\n- path: secret-cert.der=secret-cert.b64\n  decodeBase64: true\n" +
+			"- db-password=vault://secret/data/db#password\n" +
+			"- api-key=secret-stripe.yaml#stripe.apiKey\n" +
+			"- path: ca.crt\n  plain: true\n" +
+			"- path: secret-config.sops\n  key: config.json\n  format: json\n" +
+			"- secret-certs/*.pem\n" +
+			"- path: secret-tenants/\n  depth: 2",
+	},
+	"behavior": {
+		"Behavior when a Secret with the same name exists: create, replace or merge",
+		"create",
+	},
+	"disableNameSuffixHash": {
+		"Do not let kustomize add a content hash to the name",
+		"false",
+	},
+	"type": {
+		"Type of the generated Secret",
+		"Opaque",
+	},
+	"encoding": {
+		"Base64 variant of the data values: std, url, rawstd or rawurl",
+		"std",
+	},
+	"hashKeys": {
+		"Keys whose values determine the name suffix hash, which the generator then\n" +
+			"appends instead of kustomize",
+		"\n- secret-file1.txt",
+	},
+	"sourceDir": {
+		"Directory whose files are sources: dotenv, YAML, JSON, XML, INI, TOML and\n" +
+			"properties files are env sources, other files are file sources named after\n" +
+			"the file",
+		"",
+	},
+	"sourceDir.path": {
+		"Path of the directory",
+		"secrets",
+	},
+	"sourceDir.include": {
+		"Only use files matching one of these patterns",
+		"\n- \"*.env\"\n- \"*.txt\"",
+	},
+	"sourceDir.exclude": {
+		"Skip files matching one of these patterns",
+		"\n- \"*.example.*\"",
+	},
+	"configMapKeys": {
+		"Keys that are not sensitive, which go into a ConfigMap with the same name\n" +
+			"and metadata that is generated after the Secret",
+		"\n- LOG_LEVEL",
+	},
+	"literals": {
+		"Keys whose values are in the spec itself, as documents encrypted with sops\n" +
+			"--input-type binary, given as KEY=DOCUMENT or as a key and value",
+		"\n- key: api-token\n  value: |\n    data: ENC[AES256_GCM,data:...,type:str]\n    sops:\n      version: 3.4.0",
+	},
+	"secrets": {
+		"Secrets to generate instead of a single Secret, each with its own name,\n" +
+			"type, behavior and sources, and the metadata and other fields of the spec",
+		"\n- name: db-credentials\n  type: kubernetes.io/basic-auth\n  envs:\n    - secret-db.env\n" +
+			"- name: api-keys\n  behavior: merge\n  files:\n    - secret-api-key.txt",
+	},
+	"certFile": {
+		"Sops-encrypted certificate of a kubernetes.io/tls Secret, stored as tls.crt",
+		"secret-tls.crt",
+	},
+	"keyFile": {
+		"Sops-encrypted private key of a kubernetes.io/tls Secret, stored as tls.key",
+		"secret-tls.key",
+	},
+	"sshPrivateKeyFile": {
+		"Sops-encrypted private key of a kubernetes.io/ssh-auth Secret, stored as\n" +
+			"ssh-privatekey",
+		"secret-id_ed25519",
+	},
+	"knownHostsFile": {
+		"Known hosts of a kubernetes.io/ssh-auth Secret, stored as known_hosts",
+		"secret-known_hosts",
+	},
+	"usernameFile": {
+		"Sops-encrypted username of a kubernetes.io/basic-auth Secret",
+		"secret-username.txt",
+	},
+	"passwordFile": {
+		"Sops-encrypted password of a kubernetes.io/basic-auth Secret",
+		"secret-password.txt",
+	},
+	"extensionFormats": {
+		"Formats of sources whose names end with these extensions, for encrypted files\n" +
+			"with extensions that are not known; the longest matching extension wins",
+		"\n.env.enc: dotenv\n.yml.sops: yaml",
+	},
+	"maxAge": {
+		"Maximum time since the sops-encrypted sources were last modified, in days\n" +
+			"or as a duration, to enforce their rotation",
+		"90d",
+	},
+	"stringData": {
+		"Store all values that are valid UTF-8 as plaintext stringData; binary values\n" +
+			"stay in data",
+		"false",
+	},
+	"sops": {"Configuration of sops while decrypting the sources", ""},
+	"sops.awsProfile": {
+		"AWS profile used for KMS",
+		"production",
+	},
+	"sops.awsRegion": {
+		"Default AWS region; KMS requests go to the region of the key",
+		"eu-west-1",
+	},
+	"sops.aws": {"AWS credentials used for KMS", ""},
+	"sops.aws.profile": {
+		"AWS profile used for KMS, instead of awsProfile",
+		"production",
+	},
+	"sops.aws.roleArn": {
+		"AWS role assumed for KMS, with the credentials of the profile",
+		"arn:aws:iam::123456789012:role/sops-decrypt",
+	},
+	"sops.gcp": {"Google Cloud credentials used for KMS", ""},
+	"sops.gcp.credentialsFile": {
+		"Service account key file used for KMS, instead of\n" +
+			"GOOGLE_APPLICATION_CREDENTIALS; environment variables are expanded",
+		"${CI_PROJECT_DIR}/.gcp/production.json",
+	},
+	"sops.azure": {"Azure identity used for Key Vault", ""},
+	"sops.azure.tenantID": {
+		"Azure Active Directory tenant of the client",
+		"72f988bf-86f1-41af-91ab-2d7cd011db47",
+	},
+	"sops.azure.clientID": {
+		"Application ID of the service principal, or client ID of a user-assigned\n" +
+			"managed identity",
+		"6d1f3a52-2c57-4d5b-9a0e-3c1f6e4b8a21",
+	},
+	"sops.azure.useMSI": {
+		"Use the managed identity of the build agent, ignoring client secrets and\n" +
+			"certificates in the environment",
+		"true",
+	},
+	"sops.hcVault": {
+		"HashiCorp Vault server and credentials used for Vault transit keys and\n" +
+			"vault:// sources",
+		"",
+	},
+	"sops.hcVault.address": {
+		"Address of the Vault server, instead of VAULT_ADDR",
+		"https://vault.example.com:8200",
+	},
+	"sops.hcVault.namespace": {
+		"Vault Enterprise namespace, instead of VAULT_NAMESPACE",
+		"team-a",
+	},
+	"sops.hcVault.token": {
+		"Vault token, best given as a reference to an environment variable; one of\n" +
+			"token, tokenFile and roleID",
+		"${VAULT_TOKEN_PRODUCTION}",
+	},
+	"sops.hcVault.tokenFile": {
+		"File with the Vault token; environment variables are expanded",
+		"${CI_PROJECT_DIR}/.vault/production-token",
+	},
+	"sops.hcVault.roleID": {
+		"Role ID to log in to the AppRole auth method with",
+		"${VAULT_ROLE_ID}",
+	},
+	"sops.hcVault.secretID": {
+		"Secret ID to log in to the AppRole auth method with",
+		"${VAULT_SECRET_ID}",
+	},
+	"sops.hcVault.appRolePath": {
+		"Path at which the AppRole auth method is mounted, approle by default",
+		"approle",
+	},
+	"sops.pgp": {"GnuPG keys used for PGP", ""},
+	"sops.pgp.gnupgHome": {
+		"GnuPG home directory, instead of GNUPGHOME or ~/.gnupg; environment\n" +
+			"variables are expanded",
+		"${CI_PROJECT_DIR}/.gnupg",
+	},
+	"sops.pgp.keyringFile": {
+		"Binary secret keyring, instead of gnupgHome; environment variables are\n" +
+			"expanded",
+		"/run/secrets/deploy-secring.gpg",
+	},
+	"sops.configPath": {
+		"Sops configuration file of updatekeys, instead of the .sops.yaml that\n" +
+			"sops finds",
+		"config/sops.yaml",
+	},
+	"sops.keyServices": {
+		"Sops keyservices asked for the data keys, after the local one, as\n" +
+			"tcp://host:port or unix:///path/to/socket",
+		"\n- unix:///run/sops/keyservice.sock",
+	},
+	"sops.requiredRecipients": {
+		"KMS key ARNs, PGP fingerprints, GCP KMS resource IDs or Azure Key Vault\n" +
+			"key URLs that every source must be encrypted to",
+		"\n- arn:aws:kms:eu-west-1:123456789012:key/6b3c0f9e-1d2a-4c8b-9e7f-0a1b2c3d4e5f",
+	},
+	"sops.keyGroups": {
+		"Indexes, from 0, of the key groups used for decryption; files with several\n" +
+			"groups need at least their Shamir threshold",
+		"\n- 1",
+	},
+}
+
+// Example returns an example spec as YAML, with a comment for every field.
+func Example() ([]byte, error) {
+	var buf bytes.Buffer
+	err := writeExample(&buf, reflect.TypeOf(SopsSecretGenerator{}), "", "")
+	if err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+func writeExample(buf *bytes.Buffer, t reflect.Type, prefix string, indent string) error {
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		name, inline := yamlFieldName(field)
+		if inline {
+			err := writeExample(buf, field.Type, prefix, indent)
+			if err != nil {
+				return err
+			}
+			continue
+		}
+
+		path := prefix + name
+		doc, ok := exampleFields[path]
+		if !ok {
+			return fmt.Errorf("no example for field %v", path)
+		}
+		for _, line := range strings.Split(doc.comment, "\n") {
+			buf.WriteString(indent + "# " + line + "\n")
+		}
+		if doc.value == "" {
+			buf.WriteString(indent + name + ":\n")
+			err := writeExample(buf, field.Type, path+".", indent+"  ")
+			if err != nil {
+				return err
+			}
+			continue
+		}
+		buf.WriteString(indent + name + ":")
+		if !strings.HasPrefix(doc.value, "\n") {
+			buf.WriteString(" ")
+		}
+		buf.WriteString(strings.Replace(doc.value, "\n", "\n"+indent+"  ", -1) + "\n")
+	}
+	return nil
+}
+
+// yamlFieldName returns the YAML name of a struct field and whether it is
+// inlined.
+func yamlFieldName(field reflect.StructField) (string, bool) {
+	tag := strings.Split(field.Tag.Get("yaml"), ",")
+	for _, option := range tag[1:] {
+		if option == "inline" {
+			return "", true
+		}
+	}
+	if tag[0] == "" {
+		return strings.ToLower(field.Name), false
+	}
+	return tag[0], false
+}
@@ -0,0 +1,30 @@
+// Copyright 2019 Go About B.V. and contributors
+// Licensed under the Apache License, Version 2.0.
+
+package generator
+
+import (
+	"strings"
+	"testing"
+)
+
+func Test_Example(t *testing.T) {
+	got, err := Example()
+	if err != nil {
+		t.Fatalf("Example() error = %v", err)
+	}
+	input, err := readInput(got, Options{Strict: true})
+	if err != nil {
+		t.Fatalf("Example() is not a valid spec: %v", err)
+	}
+	if len(input.EnvSources) == 0 || len(input.FileSources) == 0 {
+		t.Errorf("Example() has no sources: %v", input)
+	}
+	// Every documented field must still exist
+	for path := range exampleFields {
+		name := path[strings.LastIndex(path, ".")+1:]
+		if !strings.Contains(string(got), name+":") {
+			t.Errorf("Example() does not contain documented field %v", path)
+		}
+	}
+}
@@ -0,0 +1,163 @@
+// Copyright 2019 Go About B.V. and contributors
+// Licensed under the Apache License, Version 2.0.
+
+package generator
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/pkg/errors"
+	"gopkg.in/yaml.v2"
+)
+
+// splitExtractPath splits the path of a file source into the file and the
+// path of the value to extract from it, after '#'. Only YAML, JSON and TOML
+// files have values to extract, so '#' in other file names is kept. The
+// format of the file follows from its name, unless format is set.
+func splitExtractPath(fn string, format string) (file string, extract string) {
+	if isVaultPath(fn) {
+		return fn, ""
+	}
+	i := strings.LastIndex(fn, "#")
+	if i < 0 {
+		return fn, ""
+	}
+	if format == "" {
+		format = formatForPath(fn[:i])
+	}
+	switch format {
+	case "yaml", "json", "toml":
+		return fn[:i], fn[i+1:]
+	}
+	return fn, ""
+}
+
+// parseExtractPath splits the path of a value into its keys. The path is
+// either dotted, as in stripe.apiKey or servers.0.host, or in the syntax of
+// sops --extract, as in ["stripe"]["apiKey"] or ["servers"][0]["host"].
+func parseExtractPath(extract string) ([]string, error) {
+	if extract == "" {
+		return nil, errors.New("empty extract path")
+	}
+	if !strings.HasPrefix(extract, "[") {
+		keys := strings.Split(extract, ".")
+		for _, k := range keys {
+			if k == "" {
+				return nil, fmt.Errorf("invalid extract path %v", extract)
+			}
+		}
+		return keys, nil
+	}
+
+	var keys []string
+	for rest := extract; rest != ""; {
+		end := strings.Index(rest, "]")
+		if !strings.HasPrefix(rest, "[") || end < 0 {
+			return nil, fmt.Errorf("invalid extract path %v", extract)
+		}
+		k := rest[1:end]
+		if strings.HasPrefix(k, `"`) {
+			unquoted, err := strconv.Unquote(k)
+			if err != nil {
+				return nil, fmt.Errorf("invalid extract path %v", extract)
+			}
+			k = unquoted
+		} else if _, err := strconv.Atoi(k); err != nil {
+			return nil, fmt.Errorf("invalid extract path %v, quote the key %v", extract, k)
+		}
+		keys = append(keys, k)
+		rest = rest[end+1:]
+	}
+	return keys, nil
+}
+
+// extractValue returns the value at the extract path of decrypted YAML,
+// JSON or TOML content, like sops --decrypt --extract. Strings and the
+// numbers and booleans of YAML are returned as they are written, those of
+// JSON and TOML as in JSON. Maps and lists are serialized
+// with the value encoding, which defaults to YAML for YAML content and to
+// JSON otherwise.
+func extractValue(content []byte, format string, extract string, valueEncoding string) ([]byte, error) {
+	if valueEncoding != "" && valueEncoding != "json" && valueEncoding != "yaml" {
+		return nil, fmt.Errorf("unknown value encoding %v, use json or yaml", valueEncoding)
+	}
+	keys, err := parseExtractPath(extract)
+	if err != nil {
+		return nil, err
+	}
+
+	var document interface{}
+	switch format {
+	case "yaml":
+		var m yamlMapping
+		err = yaml.Unmarshal(content, &m)
+		document = yaml.MapSlice(m)
+	case "json":
+		err = unmarshalJSON(content, &document)
+	case "toml":
+		document, _, err = decodeTOML(content)
+	default:
+		return nil, fmt.Errorf("cannot extract values from %v content", format)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	value := document
+	for i, k := range keys {
+		var ok bool
+		value, ok = lookupValue(value, k)
+		if !ok {
+			return nil, fmt.Errorf("%v not found", strings.Join(keys[:i+1], "."))
+		}
+	}
+
+	switch v := value.(type) {
+	case nil:
+		return []byte{}, nil
+	case string:
+		return []byte(v), nil
+	case yamlScalar:
+		return []byte(v.text), nil
+	case yaml.MapSlice, map[interface{}]interface{}, map[string]interface{}, []interface{}:
+	default:
+		return marshalJSONValue(v)
+	}
+	if valueEncoding == "" && format == "yaml" {
+		valueEncoding = "yaml"
+	}
+	if valueEncoding == "yaml" {
+		return marshalYAMLValue(value)
+	}
+	return marshalJSONValue(value)
+}
+
+// lookupValue returns the value of key k in a decoded map, or the element at
+// index k of a list.
+func lookupValue(v interface{}, k string) (interface{}, bool) {
+	switch value := v.(type) {
+	case yaml.MapSlice:
+		for _, item := range value {
+			if fmt.Sprint(item.Key) == k {
+				return item.Value, true
+			}
+		}
+	case map[interface{}]interface{}:
+		for key, child := range value {
+			if fmt.Sprint(key) == k {
+				return child, true
+			}
+		}
+	case map[string]interface{}:
+		child, ok := value[k]
+		return child, ok
+	case []interface{}:
+		i, err := strconv.Atoi(k)
+		if err == nil && i >= 0 && i < len(value) {
+			return value[i], true
+		}
+	}
+	return nil, false
+}
@@ -0,0 +1,112 @@
+// Copyright 2019 Go About B.V. and contributors
+// Licensed under the Apache License, Version 2.0.
+
+package generator
+
+import (
+	"reflect"
+	"testing"
+)
+
+func Test_splitExtractPath(t *testing.T) {
+	tests := []struct {
+		name        string
+		fn          string
+		format      string
+		wantFile    string
+		wantExtract string
+	}{
+		{"YAML", "dir/secrets.yaml#stripe.apiKey", "", "dir/secrets.yaml", "stripe.apiKey"},
+		{"TOML", "config.toml#db.password", "", "config.toml", "db.password"},
+		{"NoExtract", "secrets.yaml", "", "secrets.yaml", ""},
+		{"BinaryFile", "notes#1.txt", "", "notes#1.txt", ""},
+		{"Format", "secrets.sops#stripe.apiKey", "json", "secrets.sops", "stripe.apiKey"},
+		{"Vault", "vault://secret/data/app#password", "", "vault://secret/data/app#password", ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			file, extract := splitExtractPath(tt.fn, tt.format)
+			if file != tt.wantFile || extract != tt.wantExtract {
+				t.Errorf("splitExtractPath() = %v, %v, want %v, %v", file, extract, tt.wantFile, tt.wantExtract)
+			}
+		})
+	}
+}
+
+func Test_parseExtractPath(t *testing.T) {
+	tests := []struct {
+		name    string
+		extract string
+		want    []string
+		wantErr bool
+	}{
+		{"Dotted", "servers.0.host", []string{"servers", "0", "host"}, false},
+		{"Sops", `["stripe"]["api.key"][1]`, []string{"stripe", "api.key", "1"}, false},
+		{"Empty", "", nil, true},
+		{"EmptyKey", "stripe..apiKey", nil, true},
+		{"Unquoted", "[stripe]", nil, true},
+		{"Unclosed", `["stripe"`, nil, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := parseExtractPath(tt.extract)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("parseExtractPath() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("parseExtractPath() got = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func Test_extractValue(t *testing.T) {
+	json := b(`{"stripe": {"apiKey": "sk_123", "live": true}, "servers": [{"host": "a", "port": 5432}]}`)
+	yaml := b("stripe:\n  apiKey: sk_123\nservers:\n  - a\n  - b\n")
+	toml := b("[db]\npassword = \"secret\"\nports = [1, 2]\n")
+	type args struct {
+		content       []byte
+		format        string
+		extract       string
+		valueEncoding string
+	}
+	tests := []struct {
+		name    string
+		args    args
+		want    string
+		wantErr bool
+	}{
+		{"JSONString", args{json, "json", "stripe.apiKey", ""}, "sk_123", false},
+		{"JSONBoolean", args{json, "json", "stripe.live", ""}, "true", false},
+		{"JSONListElement", args{json, "json", `["servers"][0]["port"]`, ""}, "5432", false},
+		{"JSONMap", args{json, "json", "servers.0", ""}, `{"host":"a","port":5432}`, false},
+		{"JSONBigNumber", args{b(`{"id": 123456789012345678}`), "json", "id", ""}, "123456789012345678", false},
+		{"JSONMapAsYAML", args{json, "json", "stripe", "yaml"}, "apiKey: sk_123\nlive: true\n", false},
+		{"YAMLString", args{yaml, "yaml", "stripe.apiKey", ""}, "sk_123", false},
+		{"YAMLScalars", args{b("db:\n  port: 05432\n  version: 1.10\n"), "yaml", "db.version", ""}, "1.10", false},
+		{"YAMLOctal", args{b("db:\n  port: 05432\n  version: 1.10\n"), "yaml", "db.port", ""}, "05432", false},
+		{"YAMLBoolKey", args{b("NO:\n  enabled: yes\n"), "yaml", "NO.enabled", ""}, "yes", false},
+		{"YAMLList", args{yaml, "yaml", "servers", ""}, "- a\n- b\n", false},
+		{"YAMLListAsJSON", args{yaml, "yaml", "servers", "json"}, `["a","b"]`, false},
+		{"TOMLString", args{toml, "toml", "db.password", ""}, "secret", false},
+		{"TOMLList", args{toml, "toml", "db.ports", ""}, "[1,2]", false},
+		{"Missing", args{json, "json", "stripe.secret", ""}, "", true},
+		{"IndexOutOfRange", args{json, "json", "servers.1", ""}, "", true},
+		{"NotAList", args{json, "json", "stripe.0", ""}, "", true},
+		{"UnknownEncoding", args{json, "json", "stripe", "xml"}, "", true},
+		{"Binary", args{b("secret"), "binary", "key", ""}, "", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := extractValue(tt.args.content, tt.args.format, tt.args.extract, tt.args.valueEncoding)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("extractValue() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if string(got) != tt.want {
+				t.Errorf("extractValue() got = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
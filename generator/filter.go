@@ -0,0 +1,96 @@
+// Copyright 2019 Go About B.V. and contributors
+// Licensed under the Apache License, Version 2.0.
+
+package generator
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// defaultFilterTimeout is the time a value filter may take per value, if
+// Options.ValueFilterTimeout is not set.
+const defaultFilterTimeout = 10 * time.Second
+
+// filterValues replaces every value in data by the output of command, which
+// is run by the shell with the value as its input. Each run is aborted after
+// timeout.
+func filterValues(ctx context.Context, data kvMap, command string, timeout time.Duration) error {
+	if timeout <= 0 {
+		timeout = defaultFilterTimeout
+	}
+	keys := make([]string, 0, len(data))
+	for k := range data {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		filtered, err := filterValue(ctx, data[k], command, timeout)
+		if err != nil {
+			return errors.Wrapf(err, "value filter for key %v", k)
+		}
+		data[k] = filtered
+	}
+	return nil
+}
+
+// filterValue runs command with value as its input and returns its output.
+// The output is read through pipes of our own, so that a timeout is not
+// delayed by background processes of the command that keep them open.
+func filterValue(ctx context.Context, value string, command string, timeout time.Duration) (string, error) {
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+	stdout, stdoutWriter, err := os.Pipe()
+	if err != nil {
+		return "", err
+	}
+	defer stdout.Close()
+	stderr, stderrWriter, err := os.Pipe()
+	if err != nil {
+		_ = stdoutWriter.Close()
+		return "", err
+	}
+	defer stderr.Close()
+
+	cmd := exec.CommandContext(ctx, "sh", "-c", command)
+	cmd.Stdin = strings.NewReader(value)
+	cmd.Stdout = stdoutWriter
+	cmd.Stderr = stderrWriter
+	err = cmd.Start()
+	_ = stdoutWriter.Close()
+	_ = stderrWriter.Close()
+	if err != nil {
+		return "", err
+	}
+	stderrContent := make(chan []byte, 1)
+	go func() {
+		content, _ := ioutil.ReadAll(stderr)
+		stderrContent <- content
+	}()
+	output, readErr := readStream(ctx, stdout, 0)
+	err = cmd.Wait()
+	if ctx.Err() != nil {
+		return "", ctx.Err()
+	}
+	if readErr != nil {
+		return "", readErr
+	}
+	if err != nil {
+		select {
+		case content := <-stderrContent:
+			if msg := strings.TrimSpace(string(content)); msg != "" {
+				return "", errors.Errorf("%v: %v", err, msg)
+			}
+		case <-ctx.Done():
+		}
+		return "", err
+	}
+	return string(output), nil
+}
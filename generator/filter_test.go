@@ -0,0 +1,46 @@
+// Copyright 2019 Go About B.V. and contributors
+// Licensed under the Apache License, Version 2.0.
+
+package generator
+
+import (
+	"context"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func Test_filterValues(t *testing.T) {
+	tests := []struct {
+		name    string
+		command string
+		timeout time.Duration
+		want    kvMap
+		wantErr string
+	}{
+		{"Filter", "sed 's/^legacy-//'", 0, kvMap{"A": "secret", "B": "other"}, ""},
+		{"Empty", "true", 0, kvMap{"A": "", "B": ""}, ""},
+		{"Failure", "echo broken >&2; exit 1", 0, nil, "value filter for key A: exit status 1: broken"},
+		{"Timeout", "sleep 5", 50 * time.Millisecond, nil, "value filter for key A: context deadline exceeded"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			data := kvMap{"A": "legacy-secret", "B": "other"}
+			err := filterValues(context.Background(), data, tt.command, tt.timeout)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Errorf("filterValues() error = %v, want %v", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Errorf("filterValues() error = %v", err)
+				return
+			}
+			if !reflect.DeepEqual(data, tt.want) {
+				t.Errorf("filterValues() got = %v, want %v", data, tt.want)
+			}
+		})
+	}
+}
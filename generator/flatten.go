@@ -0,0 +1,126 @@
+// Copyright 2019 Go About B.V. and contributors
+// Licensed under the Apache License, Version 2.0.
+
+package generator
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+
+	"gopkg.in/yaml.v2"
+)
+
+// defaultFlattenSeparator joins the keys on the path to a nested value, if
+// the source does not set a separator.
+const defaultFlattenSeparator = "."
+
+// flattenSeparator returns the separator for flattening the nested values of
+// the source, or "" if they are not flattened.
+func (s Source) flattenSeparator() string {
+	if s.FlattenSeparator != "" {
+		return s.FlattenSeparator
+	}
+	if s.Flatten {
+		return defaultFlattenSeparator
+	}
+	return ""
+}
+
+// flattenStructured replaces the maps and lists in a decoded YAML, JSON or
+// TOML document by their values, named after their path with separator
+// between the keys, as in database.password. List elements are indexed, as
+// in servers.0.host. Empty maps and lists have no values. It returns the
+// flattened document and its keys in order, given the order of the
+// top-level keys; without an order the keys are sorted. Values whose paths
+// flatten to the same key, such as a key a.b next to a map a with a key b,
+// are an error.
+func flattenStructured(d map[string]interface{}, keys []string, separator string) (map[string]interface{}, []string, error) {
+	if keys == nil {
+		keys = make([]string, 0, len(d))
+		for k := range d {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+	}
+	flattened := make(map[string]interface{})
+	var order []string
+	for _, k := range keys {
+		var err error
+		order, err = flattenValue(k, d[k], separator, flattened, order)
+		if err != nil {
+			return nil, nil, err
+		}
+	}
+	return flattened, order, nil
+}
+
+func flattenValue(path string, v interface{}, separator string, flattened map[string]interface{}, order []string) ([]string, error) {
+	var err error
+	add := func(k string, child interface{}) {
+		if err == nil {
+			order, err = flattenValue(path+separator+k, child, separator, flattened, order)
+		}
+	}
+	switch value := v.(type) {
+	case yaml.MapSlice:
+		for _, item := range value {
+			add(fmt.Sprint(item.Key), item.Value)
+		}
+	case map[interface{}]interface{}:
+		keys := make([]string, 0, len(value))
+		values := make(map[string]interface{}, len(value))
+		for k, child := range value {
+			keys = append(keys, fmt.Sprint(k))
+			values[fmt.Sprint(k)] = child
+		}
+		sort.Strings(keys)
+		for _, k := range keys {
+			add(k, values[k])
+		}
+	case map[string]interface{}:
+		keys := make([]string, 0, len(value))
+		for k := range value {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		for _, k := range keys {
+			add(k, value[k])
+		}
+	case []interface{}:
+		for i, child := range value {
+			add(strconv.Itoa(i), child)
+		}
+	default:
+		if _, ok := flattened[path]; ok {
+			return nil, fmt.Errorf("key %v is defined more than once after flattening", path)
+		}
+		order = append(order, path)
+		flattened[path] = v
+	}
+	return order, err
+}
+
+// upperCaseKeys returns data and the order of its keys with the keys in upper
+// case. Keys that only differ in case are an error.
+func upperCaseKeys(data kvMap, order []string) (kvMap, []string, error) {
+	upper := make(kvMap, len(data))
+	original := make(map[string]string, len(data))
+	for k, v := range data {
+		u := strings.ToUpper(k)
+		if other, ok := original[u]; ok {
+			if other > k {
+				other, k = k, other
+			}
+			return nil, nil, fmt.Errorf("keys %v and %v are the same in upper case", other, k)
+		}
+		original[u] = k
+		upper[u] = v
+	}
+	var upperOrder []string
+	for _, k := range order {
+		upperOrder = append(upperOrder, strings.ToUpper(k))
+	}
+	return upper, upperOrder, nil
+}
@@ -0,0 +1,206 @@
+// Copyright 2019 Go About B.V. and contributors
+// Licensed under the Apache License, Version 2.0.
+
+package generator
+
+import (
+	"io/ioutil"
+	"reflect"
+	"strings"
+	"testing"
+
+	"gopkg.in/yaml.v2"
+)
+
+func Test_flattenStructured(t *testing.T) {
+	tests := []struct {
+		name      string
+		d         map[string]interface{}
+		keys      []string
+		separator string
+		want      map[string]interface{}
+		wantOrder []string
+		wantErr   bool
+	}{
+		{
+			"Nested",
+			map[string]interface{}{
+				"database": map[string]interface{}{"user": "app", "password": "secret"},
+				"name":     "app",
+			},
+			[]string{"name", "database"},
+			".",
+			map[string]interface{}{"name": "app", "database.password": "secret", "database.user": "app"},
+			[]string{"name", "database.password", "database.user"},
+			false,
+		},
+		{
+			"MapSlice",
+			map[string]interface{}{
+				"db": yaml.MapSlice{{Key: "user", Value: "app"}, {Key: "port", Value: 5432}},
+			},
+			[]string{"db"},
+			"_",
+			map[string]interface{}{"db_user": "app", "db_port": 5432},
+			[]string{"db_user", "db_port"},
+			false,
+		},
+		{
+			"Lists",
+			map[string]interface{}{
+				"servers": []interface{}{map[interface{}]interface{}{"host": "a"}, "b"},
+				"empty":   []interface{}{},
+			},
+			nil,
+			".",
+			map[string]interface{}{"servers.0.host": "a", "servers.1": "b"},
+			[]string{"servers.0.host", "servers.1"},
+			false,
+		},
+		{
+			"Collision",
+			map[string]interface{}{
+				"a.b": "x",
+				"a":   map[string]interface{}{"b": "y"},
+			},
+			nil,
+			".",
+			nil,
+			nil,
+			true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, order, err := flattenStructured(tt.d, tt.keys, tt.separator)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("flattenStructured() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("flattenStructured() got = %v, want %v", got, tt.want)
+			}
+			if !reflect.DeepEqual(order, tt.wantOrder) {
+				t.Errorf("flattenStructured() order = %v, want %v", order, tt.wantOrder)
+			}
+		})
+	}
+}
+
+func Test_parseJSONContent_Flatten(t *testing.T) {
+	got := make(kvMap)
+	err := parseJSONContent(b(`{"database": {"password": "secret", "port": "5432"}, "hosts": ["a", "b"]}`), got, "", nil, "_")
+	if err != nil {
+		t.Fatalf("parseJSONContent() error = %v", err)
+	}
+	want := kvMap{"database_password": "secret", "database_port": "5432", "hosts_0": "a", "hosts_1": "b"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("parseJSONContent() got = %v, want %v", got, want)
+	}
+
+	got = make(kvMap)
+	err = parseJSONContent(b(`{"database": {"port": 5432}}`), got, "", nil, ".")
+	if err != nil {
+		t.Fatalf("parseJSONContent() error = %v", err)
+	}
+	if want := (kvMap{"database.port": "5432"}); !reflect.DeepEqual(got, want) {
+		t.Errorf("parseJSONContent() got = %v, want %v", got, want)
+	}
+
+	err = parseJSONContent(b(`{"a.b": "x", "a": {"b": "y"}}`), make(kvMap), "", nil, ".")
+	if err == nil {
+		t.Errorf("parseJSONContent() error = nil, want error for keys that collide after flattening")
+	}
+}
+
+func Test_parseYAMLContent_Flatten(t *testing.T) {
+	got := make(kvMap)
+	order, err := parseYAMLContent(b("db:\n  port: 05432\n  version: 1.10\n  tls: on\n  timeout: 1e3\n"), got, "", ".")
+	if err != nil {
+		t.Fatalf("parseYAMLContent() error = %v", err)
+	}
+	want := kvMap{"db.port": "05432", "db.version": "1.10", "db.tls": "on", "db.timeout": "1e3"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("parseYAMLContent() got = %v, want %v", got, want)
+	}
+	if wantOrder := []string{"db.port", "db.version", "db.tls", "db.timeout"}; !reflect.DeepEqual(order, wantOrder) {
+		t.Errorf("parseYAMLContent() order = %v, want %v", order, wantOrder)
+	}
+}
+
+func Test_flattenSopsMetadata(t *testing.T) {
+	tests := []struct {
+		name  string
+		fn    string
+		parse func(content []byte, data kvMap) ([]string, error)
+		want  []string
+	}{
+		{"YAML", "testdata/vars.yaml", func(content []byte, data kvMap) ([]string, error) {
+			return parseYAMLContent(content, data, "", ".")
+		}, []string{"VAR_YAML"}},
+		{"JSON", "testdata/vars.json", func(content []byte, data kvMap) ([]string, error) {
+			return nil, parseJSONContent(content, data, "", nil, ".")
+		}, nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// The encrypted file has the sops metadata that must not be
+			// flattened into keys such as sops.mac
+			content, err := ioutil.ReadFile(tt.fn)
+			if err != nil {
+				t.Fatal(err)
+			}
+			got := make(kvMap)
+			order, err := tt.parse(content, got)
+			if err != nil {
+				t.Fatalf("parse error = %v", err)
+			}
+			for k := range got {
+				if k == "sops" || strings.HasPrefix(k, "sops.") {
+					t.Errorf("parse got sops metadata key %v", k)
+				}
+			}
+			if len(got) != 1 {
+				t.Errorf("parse got %d keys, want 1", len(got))
+			}
+			if !reflect.DeepEqual(order, tt.want) {
+				t.Errorf("parse order = %v, want %v", order, tt.want)
+			}
+		})
+	}
+}
+
+func TestSource_flattenSeparator(t *testing.T) {
+	tests := []struct {
+		name   string
+		source Source
+		want   string
+	}{
+		{"None", Source{}, ""},
+		{"Default", Source{Flatten: true}, "."},
+		{"Separator", Source{FlattenSeparator: "_"}, "_"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.source.flattenSeparator(); got != tt.want {
+				t.Errorf("flattenSeparator() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func Test_upperCaseKeys(t *testing.T) {
+	got, order, err := upperCaseKeys(kvMap{"database_password": "p", "Host": "h"}, []string{"Host", "database_password"})
+	if err != nil {
+		t.Fatalf("upperCaseKeys() error = %v", err)
+	}
+	if want := (kvMap{"DATABASE_PASSWORD": "p", "HOST": "h"}); !reflect.DeepEqual(got, want) {
+		t.Errorf("upperCaseKeys() got = %v, want %v", got, want)
+	}
+	if want := []string{"HOST", "DATABASE_PASSWORD"}; !reflect.DeepEqual(order, want) {
+		t.Errorf("upperCaseKeys() order = %v, want %v", order, want)
+	}
+	if _, _, err := upperCaseKeys(kvMap{"host": "a", "HOST": "b"}, nil); err == nil {
+		t.Errorf("upperCaseKeys() error = nil, want collision error")
+	}
+}
@@ -0,0 +1,64 @@
+// Copyright 2019 Go About B.V. and contributors
+// Licensed under the Apache License, Version 2.0.
+
+package generator
+
+import (
+	"fmt"
+	"strings"
+)
+
+// validateExtensionFormats checks that the extension formats of the spec map
+// extensions to known formats.
+func validateExtensionFormats(extensions map[string]string) error {
+	for ext, format := range extensions {
+		if ext == "" {
+			return fmt.Errorf("extensionFormats: empty extension for format %v", format)
+		}
+		if _, err := (Source{Format: format}).format(ext); err != nil {
+			return fmt.Errorf("extensionFormats: extension %v: %v", ext, err)
+		}
+	}
+	return nil
+}
+
+// extensionFormat returns the format of path according to the extension
+// formats of the spec, or "" if no extension matches. The longest extension
+// that matches wins, so that .env.enc can be told apart from .enc.
+func extensionFormat(path string, extensions map[string]string) string {
+	match := ""
+	for ext := range extensions {
+		if strings.HasSuffix(path, ext) && len(ext) > len(match) {
+			match = ext
+		}
+	}
+	return extensions[match]
+}
+
+// applyExtensionFormats sets the format of the sources that do not have one
+// and whose path has an extension of the spec. The path of a file source is
+// taken without its key, and without the path of an extracted value.
+func applyExtensionFormats(sources []Source, extensions map[string]string, fileSources bool) []Source {
+	if len(extensions) == 0 {
+		return sources
+	}
+	applied := make([]Source, len(sources))
+	for i, source := range sources {
+		applied[i] = source
+		if source.Format != "" || isVaultPath(source.Path) {
+			continue
+		}
+		fn := source.Path
+		if fileSources {
+			if _, name, err := source.fileName(); err == nil {
+				fn = name
+			}
+		}
+		format := extensionFormat(formatPath(fn), extensions)
+		if hash := strings.LastIndex(fn, "#"); format == "" && fileSources && hash >= 0 {
+			format = extensionFormat(formatPath(fn[:hash]), extensions)
+		}
+		applied[i].Format = format
+	}
+	return applied
+}
@@ -0,0 +1,85 @@
+// Copyright 2019 Go About B.V. and contributors
+// Licensed under the Apache License, Version 2.0.
+
+package generator
+
+import (
+	"reflect"
+	"testing"
+)
+
+func Test_validateExtensionFormats(t *testing.T) {
+	tests := []struct {
+		name       string
+		extensions map[string]string
+		wantErr    bool
+	}{
+		{"None", nil, false},
+		{"Known", map[string]string{".env.enc": "dotenv", ".yml.sops": "yaml"}, false},
+		{"UnknownFormat", map[string]string{".hcl": "hcl"}, true},
+		{"EmptyExtension", map[string]string{"": "yaml"}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := validateExtensionFormats(tt.extensions); (err != nil) != tt.wantErr {
+				t.Errorf("validateExtensionFormats() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func Test_extensionFormat(t *testing.T) {
+	extensions := map[string]string{".enc": "binary", ".env.enc": "dotenv", ".yml.sops": "yaml"}
+	tests := []struct {
+		path string
+		want string
+	}{
+		{"secrets.env.enc", "dotenv"},
+		{"cert.pem.enc", "binary"},
+		{"config.yml.sops", "yaml"},
+		{"secrets.env", ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.path, func(t *testing.T) {
+			if got := extensionFormat(tt.path, extensions); got != tt.want {
+				t.Errorf("extensionFormat() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func Test_applyExtensionFormats(t *testing.T) {
+	extensions := map[string]string{".env.enc": "dotenv", ".yml.sops": "yaml"}
+	tests := []struct {
+		name        string
+		sources     []Source
+		fileSources bool
+		want        []Source
+	}{
+		{
+			"EnvSources",
+			[]Source{{Path: "secrets.env.enc"}, {Path: "other.env.enc", Format: "binary"}, {Path: "vars.env"}},
+			false,
+			[]Source{{Path: "secrets.env.enc", Format: "dotenv"}, {Path: "other.env.enc", Format: "binary"}, {Path: "vars.env"}},
+		},
+		{
+			"FileSources",
+			[]Source{{Path: "app.env=secrets.env.enc"}, {Path: "config.yml.sops#db.password"}},
+			true,
+			[]Source{{Path: "app.env=secrets.env.enc", Format: "dotenv"}, {Path: "config.yml.sops#db.password", Format: "yaml"}},
+		},
+		{
+			"Remote",
+			[]Source{{Path: "https://example.com/secrets.env.enc?version=2"}, {Path: "vault://secret/data/app.env.enc"}},
+			false,
+			[]Source{{Path: "https://example.com/secrets.env.enc?version=2", Format: "dotenv"}, {Path: "vault://secret/data/app.env.enc"}},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := applyExtensionFormats(tt.sources, extensions, tt.fileSources); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("applyExtensionFormats() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
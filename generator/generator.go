@@ -0,0 +1,1957 @@
+// Copyright 2019 Go About B.V. and contributors
+// Parts adapted from kustomize, Copyright 2019 The Kubernetes Authors.
+// Licensed under the Apache License, Version 2.0.
+
+// Package generator generates Kubernetes Secrets from files encrypted with
+// sops. It contains the logic of the SopsSecretGenerator kustomize plugin, so
+// that it can be embedded in other tools.
+package generator
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/pkg/errors"
+	sopscommon "go.mozilla.org/sops/cmd/sops/common"
+	"gopkg.in/yaml.v2"
+)
+
+const apiVersion = "goabout.com/v1beta1"
+const kind = "SopsSecretGenerator"
+const oldKind = "SopsSecret"
+const configMapKind = "SopsConfigMap"
+
+const bootstrapTokenType = "bootstrap.kubernetes.io/token"
+
+const managedByLabel = "app.kubernetes.io/managed-by"
+
+const needsHashAnnotation = "kustomize.config.k8s.io/needs-hash"
+const behaviorAnnotation = "kustomize.config.k8s.io/behavior"
+const sourcesAnnotation = "sopssecretgenerator.goabout.com/sources"
+const generatedAtAnnotation = "sopssecretgenerator.goabout.com/generated-at"
+
+// now returns the current time, and is replaced in tests
+var now = time.Now
+
+var utf8bom = []byte{0xEF, 0xBB, 0xBF}
+
+var secretKeyPattern = regexp.MustCompile(`^[-._a-zA-Z0-9]+$`)
+
+var illegalKeyCharacters = regexp.MustCompile(`[^-._a-zA-Z0-9]`)
+
+var bootstrapTokenKeys = []struct {
+	key     string
+	pattern *regexp.Regexp
+}{
+	{"token-id", regexp.MustCompile(`^[a-z0-9]{6}$`)},
+	{"token-secret", regexp.MustCompile(`^[a-z0-9]{16}$`)},
+}
+
+type kvMap map[string]string
+
+// TypeMeta defines the resource type
+type TypeMeta struct {
+	APIVersion string `json:"apiVersion" yaml:"apiVersion"`
+	Kind       string `json:"kind" yaml:"kind"`
+}
+
+// ObjectMeta contains Kubernetes resource metadata such as the name
+type ObjectMeta struct {
+	Name string `json:"name,omitempty" yaml:"name,omitempty"`
+	// GenerateName is the prefix of the name that Kubernetes generates, if
+	// the name is not set
+	GenerateName string `json:"generateName,omitempty" yaml:"generateName,omitempty"`
+	Namespace    string `json:"namespace,omitempty" yaml:"namespace,omitempty"`
+	Labels       kvMap  `json:"labels,omitempty" yaml:"labels,omitempty"`
+	Annotations  kvMap  `json:"annotations,omitempty" yaml:"annotations,omitempty"`
+
+	OwnerReferences []OwnerReference `json:"ownerReferences,omitempty" yaml:"ownerReferences,omitempty"`
+}
+
+// OwnerReference identifies an object that owns the resource, so that the
+// resource is garbage-collected when its owner is deleted
+type OwnerReference struct {
+	APIVersion         string `json:"apiVersion" yaml:"apiVersion"`
+	Kind               string `json:"kind" yaml:"kind"`
+	Name               string `json:"name" yaml:"name"`
+	UID                string `json:"uid" yaml:"uid"`
+	Controller         *bool  `json:"controller,omitempty" yaml:"controller,omitempty"`
+	BlockOwnerDeletion *bool  `json:"blockOwnerDeletion,omitempty" yaml:"blockOwnerDeletion,omitempty"`
+}
+
+// SopsSecretGenerator is a generator for Secrets
+type SopsSecretGenerator struct {
+	TypeMeta              `json:",inline" yaml:",inline"`
+	ObjectMeta            `json:"metadata" yaml:"metadata"`
+	EnvSources            []Source   `json:"envs" yaml:"envs"`
+	FileSources           []Source   `json:"files" yaml:"files"`
+	Behavior              string     `json:"behavior,omitempty" yaml:"behavior,omitempty"`
+	DisableNameSuffixHash bool       `json:"disableNameSuffixHash,omitempty" yaml:"disableNameSuffixHash,omitempty"`
+	Type                  string     `json:"type,omitempty" yaml:"type,omitempty"`
+	Encoding              string     `json:"encoding,omitempty" yaml:"encoding,omitempty"`
+	Sops                  SopsConfig `json:"sops,omitempty" yaml:"sops,omitempty"`
+	HashKeys              []string   `json:"hashKeys,omitempty" yaml:"hashKeys,omitempty"`
+	SourceDir             SourceDir  `json:"sourceDir,omitempty" yaml:"sourceDir,omitempty"`
+	ConfigMapKeys         []string   `json:"configMapKeys,omitempty" yaml:"configMapKeys,omitempty"`
+	StringData            bool       `json:"stringData,omitempty" yaml:"stringData,omitempty"`
+	Literals              []Literal  `json:"literals,omitempty" yaml:"literals,omitempty"`
+	// Secrets generates a Secret per entry instead of a single Secret
+	Secrets []SecretSpec `json:"secrets,omitempty" yaml:"secrets,omitempty"`
+	// CertFile and KeyFile are the certificate and private key of a TLS
+	// secret, stored as tls.crt and tls.key
+	CertFile string `json:"certFile,omitempty" yaml:"certFile,omitempty"`
+	KeyFile  string `json:"keyFile,omitempty" yaml:"keyFile,omitempty"`
+	// SSHPrivateKeyFile and KnownHostsFile are the private key and known
+	// hosts of an SSH secret, stored as ssh-privatekey and known_hosts
+	SSHPrivateKeyFile string `json:"sshPrivateKeyFile,omitempty" yaml:"sshPrivateKeyFile,omitempty"`
+	KnownHostsFile    string `json:"knownHostsFile,omitempty" yaml:"knownHostsFile,omitempty"`
+	// UsernameFile and PasswordFile are the credentials of a basic
+	// authentication secret, stored as username and password
+	UsernameFile string `json:"usernameFile,omitempty" yaml:"usernameFile,omitempty"`
+	PasswordFile string `json:"passwordFile,omitempty" yaml:"passwordFile,omitempty"`
+	// ExtensionFormats maps extensions, such as .env.enc, to the format of
+	// sources whose names end with them, for extensions that are not known
+	ExtensionFormats map[string]string `json:"extensionFormats,omitempty" yaml:"extensionFormats,omitempty"`
+	// MaxAge is the maximum time since the sops-encrypted sources were last
+	// modified, such as 90d or 2160h, to enforce their rotation
+	MaxAge string `json:"maxAge,omitempty" yaml:"maxAge,omitempty"`
+}
+
+// Source is an env or file source of a SopsSecretGenerator. In the spec it is
+// either a path or an object with a path and options.
+type Source struct {
+	Path string `json:"path" yaml:"path"`
+	// Key names the key of a file source, instead of KEY=PATH. The path is
+	// then taken as it is, so it may contain '='
+	Key string `json:"key,omitempty" yaml:"key,omitempty"`
+	// Format is the format of the source, one of dotenv, yaml, json, xml,
+	// ini, toml, properties or binary, for files whose extension does not
+	// tell
+	Format string `json:"format,omitempty" yaml:"format,omitempty"`
+	// Override allows the source to replace keys defined by earlier sources
+	Override bool `json:"override,omitempty" yaml:"override,omitempty"`
+	// XMLAttributes includes the attributes of XML env sources as keys
+	XMLAttributes bool `json:"xmlAttributes,omitempty" yaml:"xmlAttributes,omitempty"`
+	// INISeparator joins the section and the name of the keys of INI env
+	// sources, "." by default
+	INISeparator string `json:"iniSeparator,omitempty" yaml:"iniSeparator,omitempty"`
+	// UnquoteValues removes the double quotes around values of dotenv env
+	// sources that are on a single line too, as in VAR="val"
+	UnquoteValues bool `json:"unquoteValues,omitempty" yaml:"unquoteValues,omitempty"`
+	// ValueEncoding selects how YAML, JSON and TOML env sources store lists
+	// and maps: "" rejects them, json serializes them as compact JSON and
+	// yaml as YAML. For values extracted by file sources, "" keeps the
+	// format of the file.
+	ValueEncoding string `json:"valueEncoding,omitempty" yaml:"valueEncoding,omitempty"`
+	// DecodeBase64 decodes file sources that contain base64 text, so that the
+	// Secret contains the decoded bytes
+	DecodeBase64 bool `json:"decodeBase64,omitempty" yaml:"decodeBase64,omitempty"`
+	// When is a template that decides whether the source is used, such as
+	// {{ eq .Env.ENVIRONMENT "prod" }}
+	When string `json:"when,omitempty" yaml:"when,omitempty"`
+	// Index selects an element of a JSON env source that is an array, whose
+	// fields become keys
+	Index *int `json:"index,omitempty" yaml:"index,omitempty"`
+	// StringData stores the values of the source as plaintext in the
+	// stringData of the Secret, instead of base64 in its data
+	StringData bool `json:"stringData,omitempty" yaml:"stringData,omitempty"`
+	// RecursiveDecrypt decrypts values of env sources that are sops
+	// documents themselves
+	RecursiveDecrypt bool `json:"recursiveDecrypt,omitempty" yaml:"recursiveDecrypt,omitempty"`
+	// ExpandVars expands references to environment variables in the values
+	// of env sources
+	ExpandVars bool `json:"expandVars,omitempty" yaml:"expandVars,omitempty"`
+	// Plain reads the source as is, without sops, for values that are not
+	// sensitive, such as public certificates and defaults
+	Plain bool `json:"plain,omitempty" yaml:"plain,omitempty"`
+	// Optional skips the source with a warning if its file does not exist,
+	// for local overrides that are not committed. A path ending with ? is
+	// optional too
+	Optional bool `json:"optional,omitempty" yaml:"optional,omitempty"`
+	// Prefix and Suffix are added to the keys of env sources, so that
+	// sources with the same keys can be combined
+	Prefix string `json:"prefix,omitempty" yaml:"prefix,omitempty"`
+	Suffix string `json:"suffix,omitempty" yaml:"suffix,omitempty"`
+	// IncludeKeys only uses the keys of an env source that match one of these
+	// patterns, if set, and ExcludeKeys skips the keys that match one. A
+	// pattern is a glob, or a regular expression in slashes
+	IncludeKeys []string `json:"includeKeys,omitempty" yaml:"includeKeys,omitempty"`
+	ExcludeKeys []string `json:"excludeKeys,omitempty" yaml:"excludeKeys,omitempty"`
+	// Flatten replaces the maps and lists of YAML, JSON and TOML env sources
+	// by their values, named after their path with FlattenSeparator, "." by
+	// default, between the keys. Setting FlattenSeparator implies Flatten
+	Flatten          bool   `json:"flatten,omitempty" yaml:"flatten,omitempty"`
+	FlattenSeparator string `json:"flattenSeparator,omitempty" yaml:"flattenSeparator,omitempty"`
+	// UpperCaseKeys converts the keys of env sources to upper case, as in
+	// DATABASE_PASSWORD
+	UpperCaseKeys bool `json:"upperCaseKeys,omitempty" yaml:"upperCaseKeys,omitempty"`
+	// Checksum pins the content of the source, as stored and before
+	// decryption, in the form sha256:HEX. It is meant for remote sources,
+	// but applies to files too
+	Checksum string `json:"checksum,omitempty" yaml:"checksum,omitempty"`
+	// Depth limits how many levels of directories a file source that is a
+	// directory includes, 1 for only the files in the directory itself. All
+	// levels are included by default
+	Depth int `json:"depth,omitempty" yaml:"depth,omitempty"`
+}
+
+// UnmarshalYAML accepts both a plain path and a source object. A plain path
+// that ends with ? is optional.
+func (s *Source) UnmarshalYAML(unmarshal func(interface{}) error) error {
+	var path string
+	if err := unmarshal(&path); err == nil {
+		*s = Source{Path: strings.TrimSuffix(path, "?"), Optional: strings.HasSuffix(path, "?")}
+		return nil
+	}
+	type source Source
+	return unmarshal((*source)(s))
+}
+
+// Secret is a Kubernetes Secret
+type Secret struct {
+	TypeMeta   `json:",inline" yaml:",inline"`
+	ObjectMeta `json:"metadata" yaml:"metadata"`
+	Data       kvMap  `json:"data" yaml:"data"`
+	StringData kvMap  `json:"stringData,omitempty" yaml:"stringData,omitempty"`
+	Type       string `json:"type,omitempty" yaml:"type,omitempty"`
+
+	// keys is the order of the data keys in the YAML output, if set
+	keys []string
+	// configMap is written after the secret, if set
+	configMap *ConfigMap
+}
+
+// MarshalYAML writes the data keys in order, if the Secret has an order.
+func (s Secret) MarshalYAML() (interface{}, error) {
+	if s.keys == nil {
+		type secret Secret
+		return secret(s), nil
+	}
+	data := make(yaml.MapSlice, 0, len(s.Data))
+	var stringData yaml.MapSlice
+	for _, k := range s.keys {
+		if v, ok := s.StringData[k]; ok {
+			stringData = append(stringData, yaml.MapItem{Key: k, Value: v})
+		} else {
+			data = append(data, yaml.MapItem{Key: k, Value: s.Data[k]})
+		}
+	}
+	return struct {
+		TypeMeta   `yaml:",inline"`
+		ObjectMeta `yaml:"metadata"`
+		Data       yaml.MapSlice `yaml:"data"`
+		StringData yaml.MapSlice `yaml:"stringData,omitempty"`
+		Type       string        `yaml:"type,omitempty"`
+	}{s.TypeMeta, s.ObjectMeta, data, stringData, s.Type}, nil
+}
+
+// Options controls how secrets are generated.
+type Options struct {
+	// Namespace overrides the namespace from the spec
+	Namespace string
+	// CommonLabels are added to the labels from the spec, which take
+	// precedence
+	CommonLabels map[string]string
+	// ManagedBy sets the app.kubernetes.io/managed-by label, unless the spec
+	// or the common labels set it
+	ManagedBy string
+	// ForceManagedBy makes ManagedBy override the label from the spec and
+	// the common labels
+	ForceManagedBy bool
+	// AllowEmpty turns empty sources into a warning instead of an error
+	AllowEmpty bool
+	// UndefinedVarsError makes references to undefined environment variables
+	// an error when expanding variables, instead of expanding them to ""
+	UndefinedVarsError bool
+	// WrapWidth wraps the data values in the YAML output at this number of
+	// columns, if set
+	WrapWidth int
+	// AnnotateProvenance adds annotations with the source paths and the
+	// generation time
+	AnnotateProvenance bool
+	// MaxSize is the maximum size of the Secret in bytes, counting the
+	// encoded data and the metadata, if set
+	MaxSize int
+	// MaxSourceSize is the maximum size of a source file in bytes, if set
+	MaxSourceSize int64
+	// ReadTimeout aborts reading a source file after this duration, if set.
+	// Named pipes otherwise block until they have a writer.
+	ReadTimeout time.Duration
+	// FetchTimeout aborts downloading a remote, Git or object store source
+	// after this duration, or after 30 seconds if not set
+	FetchTimeout time.Duration
+	// HeaderComment is written as a comment before the YAML output, if set
+	HeaderComment string
+	// Strict rejects unknown fields in the spec
+	Strict bool
+	// RotationAnnotations adds an annotation per source with the time it was
+	// last modified according to its sops metadata
+	RotationAnnotations bool
+	// Decrypt decrypts sops content, if set. By default sops is used.
+	Decrypt DecryptFunc
+	// KeyServices are sops keyservices that are asked for the data keys of
+	// the sources, in addition to those of the spec, as tcp://host:port or
+	// unix:///path/to/socket. They are not used if Decrypt is set.
+	KeyServices []string
+	// RequiredRecipients are recipients that every sops source must be
+	// encrypted to, in addition to those of the spec: KMS key ARNs, PGP
+	// fingerprints, GCP KMS resource IDs or Azure Key Vault key URLs
+	RequiredRecipients []string
+	// AllowedRecipients restricts the recipients that sops sources may be
+	// encrypted to, if set, such as arn:aws:kms:*:123456789012:key/* for the
+	// KMS keys of an account. Sources encrypted to other recipients are not
+	// decrypted. * matches any text.
+	AllowedRecipients []string
+	// MaxAge is the maximum time since the sops-encrypted sources of all
+	// specs were last modified, like the maxAge field. The smaller of it and
+	// the maxAge of a spec is used.
+	MaxAge string
+	// WarnMaxAge warns about sources older than the maximum age instead of
+	// failing.
+	WarnMaxAge bool
+	// RotateDataKey makes UpdateKeys replace the data key of the sources as
+	// well, like sops --rotate.
+	RotateDataKey bool
+	// KeyGroups are the indexes of the sops key groups used for decryption,
+	// if set, as set by the spec
+	KeyGroups []int
+	// AWSProfile is the AWS profile used for KMS keys and S3 sources, if
+	// set, as set by the spec. Sops only reads the credentials of the
+	// profile from the shared credentials file.
+	AWSProfile string
+	// AWSRegion is the default AWS region for S3 sources, if set, as set by
+	// the spec
+	AWSRegion string
+	// IgnoreMAC decrypts sources whose message authentication code does not
+	// match, for emergencies in which a file is damaged but must be
+	// deployed. The integrity of the sources is then not verified.
+	IgnoreMAC bool
+	// GnuPGHome is the GnuPG home directory for PGP, unless the spec sets
+	// sops.pgp
+	GnuPGHome string
+	// DisableLocalKeyService stops sops from decrypting data keys itself, so
+	// that only KeyServices are used
+	DisableLocalKeyService bool
+	// Retries is the number of times a decryption that failed with a
+	// transient error, such as throttling by a key management service, is
+	// retried
+	Retries int
+	// RetryBackoff is the delay before the first retry, which doubles with
+	// every retry
+	RetryBackoff time.Duration
+	// AllErrors reports the errors of all sources, instead of stopping at
+	// the first
+	AllErrors bool
+	// PreserveOrder keeps the keys of the Secret in the order of the sources,
+	// instead of sorting them
+	PreserveOrder bool
+	// SanitizeKeys replaces characters that Kubernetes does not allow in
+	// keys with underscores, instead of failing
+	SanitizeKeys bool
+	// DisableNameSuffixHash overrides the disableNameSuffixHash field of the
+	// spec, if set
+	DisableNameSuffixHash *bool
+	// AppendNameHash appends the content hash to the name, like kustomize
+	// does, for use without kustomize
+	AppendNameHash bool
+	// Warnings receives warnings, if set
+	Warnings io.Writer
+	// ValueFilter is a shell command that every decrypted value is piped
+	// through, replacing the value by its output, if set
+	ValueFilter string
+	// ValueFilterTimeout aborts ValueFilter after this duration per value,
+	// or after 10 seconds if not set
+	ValueFilterTimeout time.Duration
+	// Summary receives a summary of the Secret that Generate returns, if set.
+	// For a spec with several documents, it describes the last Secret.
+	Summary *Summary
+
+	// sources caches the sources read for a secret
+	sources *sourceCache
+}
+
+// Generate reads a SopsSecretGenerator spec and returns the generated Secret
+// as YAML. Source paths in the spec are relative to the working directory.
+func Generate(spec []byte, opts Options) ([]byte, error) {
+	return GenerateContext(context.Background(), spec, opts)
+}
+
+// GenerateContext is like Generate, but aborts decryption when ctx is done.
+// A spec with several YAML documents generates a Secret for every document,
+// which are returned as separate documents.
+func GenerateContext(ctx context.Context, spec []byte, opts Options) ([]byte, error) {
+	docs, err := splitDocuments(spec)
+	if err != nil {
+		return nil, withClass(ClassSpec, err)
+	}
+	if len(docs) <= 1 {
+		return generateDocument(ctx, spec, opts)
+	}
+	output := commentLines(opts.HeaderComment)
+	docOpts := opts
+	docOpts.HeaderComment = ""
+	for i, doc := range docs {
+		generated, err := generateDocument(ctx, doc, docOpts)
+		if err != nil {
+			return nil, errors.Wrapf(err, "document %d", i+1)
+		}
+		if i > 0 {
+			output = append(output, "---\n"...)
+		}
+		output = append(output, generated...)
+	}
+	return output, nil
+}
+
+// generateDocument generates the Secrets or ConfigMaps of a single spec.
+func generateDocument(ctx context.Context, spec []byte, opts Options) ([]byte, error) {
+	input, err := readInput(spec, opts)
+	if err != nil {
+		return nil, err
+	}
+	inputs, err := expandSecrets(input)
+	if err != nil {
+		return nil, withClass(ClassSpec, err)
+	}
+	if len(inputs) == 1 {
+		return generateResource(ctx, inputs[0], opts)
+	}
+	output := commentLines(opts.HeaderComment)
+	opts.HeaderComment = ""
+	for i, input := range inputs {
+		generated, err := generateResource(ctx, input, opts)
+		if err != nil {
+			return nil, errors.Wrapf(err, "secret %v", input.Name)
+		}
+		if i > 0 {
+			output = append(output, "---\n"...)
+		}
+		output = append(output, generated...)
+	}
+	return output, nil
+}
+
+// generateResource generates the Secret or ConfigMap of a spec without
+// secrets.
+func generateResource(ctx context.Context, input SopsSecretGenerator, opts Options) ([]byte, error) {
+	opts.Summary.reset()
+	if input.Kind == configMapKind {
+		configMap, err := generateConfigMap(ctx, input, opts)
+		if err != nil {
+			return nil, err
+		}
+		return marshalConfigMap(configMap, opts)
+	}
+	secret, err := generateSecret(ctx, input, opts)
+	if err != nil {
+		return nil, err
+	}
+	opts.Summary.setSecret(secret)
+	secret.Data = wrapData(secret.Data, opts.WrapWidth)
+	return marshalSecret(secret, opts)
+}
+
+// splitDocuments returns the documents of a YAML stream, skipping empty
+// documents.
+func splitDocuments(content []byte) ([][]byte, error) {
+	var docs [][]byte
+	decoder := yaml.NewDecoder(bytes.NewReader(content))
+	for {
+		var doc yaml.MapSlice
+		err := decoder.Decode(&doc)
+		if err == io.EOF {
+			return docs, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		if len(doc) == 0 {
+			continue
+		}
+		encoded, err := yaml.Marshal(doc)
+		if err != nil {
+			return nil, err
+		}
+		docs = append(docs, encoded)
+	}
+}
+
+// marshalSecret returns the secret as YAML, preceded by the header comment
+// and followed by its ConfigMap, if it has one.
+func marshalSecret(secret Secret, opts Options) ([]byte, error) {
+	output, err := yaml.Marshal(secret)
+	if err != nil {
+		return nil, err
+	}
+	if secret.configMap != nil {
+		configMap, err := yaml.Marshal(secret.configMap)
+		if err != nil {
+			return nil, err
+		}
+		output = append(append(output, "---\n"...), configMap...)
+	}
+	return append(commentLines(opts.HeaderComment), output...), nil
+}
+
+// commentLines turns text into YAML comment lines. Lines that already are
+// comments are kept.
+func commentLines(text string) []byte {
+	if text == "" {
+		return nil
+	}
+	var b strings.Builder
+	for _, line := range strings.Split(strings.TrimRight(text, "\n"), "\n") {
+		switch {
+		case strings.HasPrefix(line, "#"):
+			b.WriteString(line)
+		case line == "":
+			b.WriteString("#")
+		default:
+			b.WriteString("# " + line)
+		}
+		b.WriteString("\n")
+	}
+	return []byte(b.String())
+}
+
+// WriteFiles reads a SopsSecretGenerator spec and writes every key of the
+// secret to its own file in dir, containing the decrypted value. Source
+// paths in the spec are relative to the working directory.
+func WriteFiles(spec []byte, dir string, opts Options) error {
+	return WriteFilesContext(context.Background(), spec, dir, opts)
+}
+
+// WriteFilesContext is like WriteFiles, but aborts decryption when ctx is
+// done.
+func WriteFilesContext(ctx context.Context, spec []byte, dir string, opts Options) error {
+	input, err := readInput(spec, opts)
+	if err != nil {
+		return err
+	}
+	err = requireSingleSecret(input)
+	if err != nil {
+		return err
+	}
+	data, _, err := generateData(ctx, input, nil, opts)
+	if err != nil {
+		return err
+	}
+	return withClass(ClassIO, writeDataFiles(data, dir))
+}
+
+func generateSecret(ctx context.Context, sopsSecret SopsSecretGenerator, opts Options) (Secret, error) {
+	encoding, err := base64Encoding(sopsSecret.Encoding)
+	if err != nil {
+		return Secret{}, withClass(ClassSpec, err)
+	}
+	err = validateBehavior(sopsSecret.Behavior)
+	if err != nil {
+		return Secret{}, withClass(ClassSpec, err)
+	}
+	err = validateOwnerReferences(sopsSecret.OwnerReferences)
+	if err != nil {
+		return Secret{}, withClass(ClassSpec, err)
+	}
+	// The rotation annotations read the same sources as the data
+	opts = opts.withSourceCache()
+	stringKeys := make(map[string]bool)
+	data, keys, err := generateData(ctx, sopsSecret, stringKeys, opts)
+	if err != nil {
+		return Secret{}, err
+	}
+	data, err = validateKeys(data, opts.SanitizeKeys)
+	if err != nil {
+		return Secret{}, withClass(ClassSource, err)
+	}
+	// Binary values stay in data
+	if sopsSecret.StringData {
+		for k, v := range data {
+			if utf8.ValidString(v) {
+				stringKeys[k] = true
+			}
+		}
+	}
+	stringData, err := splitStringData(data, stringKeys)
+	if err != nil {
+		return Secret{}, withClass(ClassSource, err)
+	}
+	configMapKeys := sopsSecret.ConfigMapKeys
+	if sopsSecret.Kind == configMapKind {
+		configMapKeys = append(dataKeys(data), dataKeys(stringData)...)
+	}
+	configMapData, err := splitConfigMapData(data, stringData, configMapKeys)
+	if err != nil {
+		return Secret{}, withClass(ClassSpec, err)
+	}
+	// A SopsConfigMap always has a ConfigMap, even without keys
+	if sopsSecret.Kind == configMapKind && configMapData == nil {
+		configMapData = make(kvMap)
+	}
+
+	annotations := make(kvMap)
+	for k, v := range sopsSecret.Annotations {
+		annotations[k] = v
+	}
+	disableNameSuffixHash := sopsSecret.DisableNameSuffixHash
+	if opts.DisableNameSuffixHash != nil {
+		disableNameSuffixHash = *opts.DisableNameSuffixHash
+	}
+	// Kustomize cannot add a hash to a name that Kubernetes generates
+	generateName := ""
+	if sopsSecret.Name == "" {
+		generateName = sopsSecret.GenerateName
+		disableNameSuffixHash = true
+	}
+	// With hashKeys, the generator appends the hash instead of kustomize, which
+	// then does not update references to the Secret
+	hashKeys := !disableNameSuffixHash && len(sopsSecret.HashKeys) > 0
+	generated := make(kvMap)
+	if !disableNameSuffixHash && !hashKeys {
+		generated[needsHashAnnotation] = "true"
+	}
+	if sopsSecret.Behavior != "" {
+		generated[behaviorAnnotation] = sopsSecret.Behavior
+	}
+	if opts.AnnotateProvenance {
+		// Kustomize does not hash annotations, so these do not change the name
+		generated[sourcesAnnotation] = sourcePaths(sopsSecret)
+		generated[generatedAtAnnotation] = now().UTC().Format(time.RFC3339)
+	}
+	if opts.RotationAnnotations {
+		rotation, err := rotationAnnotations(ctx, sopsSecret, opts)
+		if err != nil {
+			return Secret{}, withClass(ClassSource, err)
+		}
+		for k, v := range rotation {
+			generated[k] = v
+		}
+	}
+	err = addGeneratedAnnotations(annotations, generated)
+	if err != nil {
+		return Secret{}, withClass(ClassSpec, err)
+	}
+
+	namespace := sopsSecret.Namespace
+	if opts.Namespace != "" {
+		namespace = opts.Namespace
+	}
+
+	// Labels are not part of the hash, so they do not change the name
+	labels := mergeLabels(opts.CommonLabels, sopsSecret.Labels)
+	if opts.ManagedBy != "" {
+		managedBy := kvMap{managedByLabel: opts.ManagedBy}
+		if opts.ForceManagedBy {
+			labels = mergeLabels(labels, managedBy)
+		} else {
+			labels = mergeLabels(managedBy, labels)
+		}
+	}
+
+	secret := Secret{
+		TypeMeta: TypeMeta{
+			APIVersion: "v1",
+			Kind:       "Secret",
+		},
+		ObjectMeta: ObjectMeta{
+			Name:         sopsSecret.Name,
+			GenerateName: generateName,
+			Namespace:    namespace,
+			Labels:       labels,
+			Annotations:  annotations,
+
+			OwnerReferences: sopsSecret.OwnerReferences,
+		},
+		Data:       encodeData(data, encoding),
+		StringData: stringData,
+		Type:       sopsSecret.Type,
+	}
+	err = validateSize(secret, opts.MaxSize)
+	if err != nil {
+		return Secret{}, withClass(ClassSource, err)
+	}
+	if configMapData != nil {
+		secret.configMap, err = companionConfigMap(secret, configMapData, !disableNameSuffixHash, opts.AppendNameHash)
+		if err != nil {
+			return Secret{}, err
+		}
+	}
+	if opts.PreserveOrder {
+		secret.keys = make([]string, 0, len(keys))
+		for _, k := range keys {
+			if _, ok := configMapData[secretKey(k)]; !ok {
+				secret.keys = append(secret.keys, secretKey(k))
+			}
+		}
+	}
+	if hashKeys {
+		secret, err = appendNameHash(secret, sopsSecret.HashKeys)
+		return secret, withClass(ClassSpec, err)
+	}
+	if opts.AppendNameHash && generateName == "" {
+		return appendNameHash(secret, nil)
+	}
+	return secret, nil
+}
+
+// appendNameHash appends the content hash to the name of the secret, which
+// then no longer needs kustomize to hash it. If keys is set, only those keys
+// are hashed.
+func appendNameHash(secret Secret, keys []string) (Secret, error) {
+	var hash string
+	var err error
+	if keys == nil {
+		hash, err = SecretHash(secret)
+	} else {
+		hash, err = keysHash(secret, keys)
+	}
+	if err != nil {
+		return Secret{}, err
+	}
+	secret.Name += "-" + hash
+	delete(secret.Annotations, needsHashAnnotation)
+	return secret, nil
+}
+
+// addGeneratedAnnotations adds the annotations that the generator sets to
+// those of the spec. The spec can set them too, but only to the same value.
+func addGeneratedAnnotations(annotations kvMap, generated kvMap) error {
+	keys := make([]string, 0, len(generated))
+	for k := range generated {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		if v, ok := annotations[k]; ok && v != generated[k] {
+			return fmt.Errorf("annotation %v=%v conflicts with the value %v set by the generator", k, v, generated[k])
+		}
+		annotations[k] = generated[k]
+	}
+	return nil
+}
+
+// sourcePaths returns the comma-separated paths of the sources of the
+// secret.
+func sourcePaths(sopsSecret SopsSecretGenerator) string {
+	var paths []string
+	for _, source := range sopsSecret.EnvSources {
+		paths = append(paths, source.Path)
+	}
+	for _, source := range sopsSecret.FileSources {
+		_, fn, err := source.fileName()
+		if err != nil {
+			fn = source.Path
+		}
+		paths = append(paths, fn)
+	}
+	if sopsSecret.SourceDir.Path != "" {
+		paths = append(paths, sopsSecret.SourceDir.Path)
+	}
+	for _, fn := range []string{sopsSecret.CertFile, sopsSecret.KeyFile, sopsSecret.SSHPrivateKeyFile, sopsSecret.KnownHostsFile, sopsSecret.UsernameFile, sopsSecret.PasswordFile} {
+		if fn != "" {
+			paths = append(paths, fn)
+		}
+	}
+	return strings.Join(paths, ",")
+}
+
+// base64Encoding returns the encoding of Secret data values. Kubernetes
+// expects std, the other variants are for specialized consumers.
+func base64Encoding(name string) (*base64.Encoding, error) {
+	switch name {
+	case "", "std":
+		return base64.StdEncoding, nil
+	case "url":
+		return base64.URLEncoding, nil
+	case "rawstd":
+		return base64.RawStdEncoding, nil
+	case "rawurl":
+		return base64.RawURLEncoding, nil
+	default:
+		return nil, fmt.Errorf("unknown encoding %v, use std, url, rawstd or rawurl", name)
+	}
+}
+
+// wrapData breaks the encoded values into lines of width characters, which
+// base64 decoders ignore. Values that span lines are written as YAML literal
+// blocks.
+func wrapData(data kvMap, width int) kvMap {
+	if width <= 0 {
+		return data
+	}
+	wrapped := make(kvMap)
+	for k, v := range data {
+		var lines []string
+		for len(v) > width {
+			lines = append(lines, v[:width])
+			v = v[width:]
+		}
+		wrapped[k] = strings.Join(append(lines, v), "\n")
+	}
+	return wrapped
+}
+
+func encodeData(data kvMap, encoding *base64.Encoding) kvMap {
+	encoded := make(kvMap)
+	for k, v := range data {
+		encoded[k] = encoding.EncodeToString([]byte(v))
+	}
+	return encoded
+}
+
+// generateData returns the decrypted data of the secret, and its keys in
+// the order of the sources. If stringKeys is not nil, the keys from
+// stringData sources are added to it.
+func generateData(ctx context.Context, sopsSecret SopsSecretGenerator, stringKeys map[string]bool, opts Options) (kvMap, []string, error) {
+	opts = opts.withSourceCache()
+	restore, err := sopsSecret.Sops.withDefaults(opts).apply()
+	if err != nil {
+		return nil, nil, err
+	}
+	defer restore()
+	opts = sopsSecret.Sops.decryptOptions(opts)
+	if opts.IgnoreMAC {
+		warnf(opts, "ignoring MAC mismatches; the integrity of the sources of %v is not verified", sopsSecret.Name)
+	}
+	maxAge, err := parseMaxAge(sopsSecret.MaxAge)
+	if err != nil {
+		return nil, nil, withClass(ClassSpec, err)
+	}
+	optsMaxAge, err := parseMaxAge(opts.MaxAge)
+	if err != nil {
+		return nil, nil, withClass(ClassSpec, err)
+	}
+	if optsMaxAge > 0 && (maxAge == 0 || optsMaxAge < maxAge) {
+		maxAge = optsMaxAge
+	}
+	if maxAge > 0 {
+		err = checkMaxAge(ctx, sopsSecret, maxAge, opts)
+		if err != nil {
+			return nil, nil, withClass(ClassSource, err)
+		}
+	}
+
+	data, keys, err := parseInput(ctx, sopsSecret, stringKeys, opts)
+	if err != nil {
+		return nil, nil, withClass(ClassSource, err)
+	}
+	err = validateDecrypted(data)
+	if err != nil {
+		return nil, nil, withClass(ClassSource, err)
+	}
+	if opts.ValueFilter != "" {
+		err = filterValues(ctx, data, opts.ValueFilter, opts.ValueFilterTimeout)
+		if err != nil {
+			return nil, nil, withClass(ClassSource, err)
+		}
+	}
+	err = assembleSecretData(sopsSecret.Type, data)
+	if err != nil {
+		return nil, nil, withClass(ClassSource, err)
+	}
+	keys = reconcileKeys(keys, data)
+	err = validateSecretData(sopsSecret.Type, data)
+	if err != nil {
+		return nil, nil, withClass(ClassSource, err)
+	}
+	return data, keys, nil
+}
+
+// writeDataFiles writes every key to a file with the value as content. Keys
+// that would be written outside dir are rejected.
+func writeDataFiles(data kvMap, dir string) error {
+	for k := range data {
+		if k == "" || k == "." || k == ".." || strings.ContainsAny(k, `/\`) {
+			return fmt.Errorf("key %v cannot be used as a file name", k)
+		}
+	}
+	err := os.MkdirAll(dir, 0700)
+	if err != nil {
+		return err
+	}
+	for k, v := range data {
+		fn := filepath.Join(dir, k)
+		err = ioutil.WriteFile(fn, []byte(v), 0600)
+		if err != nil {
+			return err
+		}
+		// WriteFile keeps the permissions of existing files
+		err = os.Chmod(fn, 0600)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// mergeLabels adds common labels to the labels from the spec. Labels from
+// the spec take precedence.
+func mergeLabels(common map[string]string, labels kvMap) kvMap {
+	if len(common) == 0 {
+		return labels
+	}
+	merged := make(kvMap)
+	for k, v := range common {
+		merged[k] = v
+	}
+	for k, v := range labels {
+		merged[k] = v
+	}
+	return merged
+}
+
+// validateKeys checks that all keys are valid Secret keys. If sanitize is
+// set, illegal characters are replaced by underscores instead.
+func validateKeys(data kvMap, sanitize bool) (kvMap, error) {
+	keys := make([]string, 0, len(data))
+	for k := range data {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	valid := make(kvMap)
+	originals := make(map[string]string)
+	for _, k := range keys {
+		if !secretKeyPattern.MatchString(k) && (!sanitize || k == "") {
+			return nil, fmt.Errorf("key %q must consist of alphanumeric characters, '-', '_' or '.'", k)
+		}
+		key := secretKey(k)
+		if original, ok := originals[key]; ok {
+			return nil, fmt.Errorf("key %q conflicts with key %q after sanitizing", k, original)
+		}
+		originals[key] = k
+		valid[key] = data[k]
+	}
+	return valid, nil
+}
+
+// markStringData records whether the keys of a source are stored as
+// stringData. A source that overrides a key decides for it.
+func markStringData(stringKeys map[string]bool, sourceData kvMap, stringData bool) {
+	if stringKeys == nil {
+		return
+	}
+	for k := range sourceData {
+		if stringData {
+			stringKeys[k] = true
+		} else {
+			delete(stringKeys, k)
+		}
+	}
+}
+
+// splitStringData removes the values of stringData keys from data and
+// returns them. These values are stored as plaintext, so they must be valid
+// UTF-8.
+func splitStringData(data kvMap, stringKeys map[string]bool) (kvMap, error) {
+	keys := make([]string, 0, len(stringKeys))
+	for k := range stringKeys {
+		keys = append(keys, secretKey(k))
+	}
+	sort.Strings(keys)
+	var stringData kvMap
+	for _, k := range keys {
+		v, ok := data[k]
+		if !ok {
+			continue
+		}
+		if err := validateUTF8([]byte(v)); err != nil {
+			return nil, errors.Wrapf(err, "value for stringData key %v", k)
+		}
+		if stringData == nil {
+			stringData = make(kvMap)
+		}
+		stringData[k] = v
+		delete(data, k)
+	}
+	return stringData, nil
+}
+
+// validateSize checks that the encoded data and metadata of the secret are
+// at most max bytes, naming the largest keys if they are not.
+func validateSize(secret Secret, max int) error {
+	if max <= 0 {
+		return nil
+	}
+	size := len(secret.Name) + len(secret.GenerateName) + len(secret.Namespace) + len(secret.Type)
+	for _, m := range []kvMap{secret.Labels, secret.Annotations} {
+		for k, v := range m {
+			size += len(k) + len(v)
+		}
+	}
+	// Kubernetes stores stringData as base64 in data
+	sizes := make(map[string]int)
+	for k, v := range secret.Data {
+		sizes[k] = len(v)
+	}
+	for k, v := range secret.StringData {
+		sizes[k] = base64.StdEncoding.EncodedLen(len(v))
+	}
+	keys := make([]string, 0, len(sizes))
+	for k, n := range sizes {
+		size += len(k) + n
+		keys = append(keys, k)
+	}
+	if size <= max {
+		return nil
+	}
+
+	sort.Slice(keys, func(i, j int) bool {
+		si, sj := sizes[keys[i]], sizes[keys[j]]
+		if si != sj {
+			return si > sj
+		}
+		return keys[i] < keys[j]
+	})
+	if len(keys) > 3 {
+		keys = keys[:3]
+	}
+	largest := make([]string, len(keys))
+	for i, k := range keys {
+		largest[i] = fmt.Sprintf("%v (%d bytes)", k, sizes[k])
+	}
+	return fmt.Errorf("secret is %d bytes, more than the maximum of %d; largest keys: %v", size, max, strings.Join(largest, ", "))
+}
+
+// validateBehavior checks the behavior, which kustomize ignores if it is
+// unknown.
+func validateBehavior(behavior string) error {
+	switch behavior {
+	case "", "create", "replace", "merge":
+		return nil
+	default:
+		return fmt.Errorf("unknown behavior %v, use create, replace or merge", behavior)
+	}
+}
+
+// validateOwnerReferences checks that the owner references have the fields
+// that Kubernetes requires, and that at most one is the controller.
+func validateOwnerReferences(refs []OwnerReference) error {
+	controllers := 0
+	for i, ref := range refs {
+		fields := []struct{ name, value string }{
+			{"apiVersion", ref.APIVersion},
+			{"kind", ref.Kind},
+			{"name", ref.Name},
+			{"uid", ref.UID},
+		}
+		for _, f := range fields {
+			if f.value == "" {
+				return fmt.Errorf("owner reference %d must contain %v value", i+1, f.name)
+			}
+		}
+		if ref.Controller != nil && *ref.Controller {
+			controllers++
+		}
+	}
+	if controllers > 1 {
+		return errors.New("only one owner reference can be the controller")
+	}
+	return nil
+}
+
+// validateDecrypted checks that no value is still sops ciphertext, which
+// happens when a value that was meant to be encrypted was not decrypted.
+func validateDecrypted(data kvMap) error {
+	keys := make([]string, 0, len(data))
+	for k := range data {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		if strings.HasPrefix(data[k], "ENC[") {
+			return fmt.Errorf("value for key %v looks encrypted, check the sops configuration of its source", k)
+		}
+	}
+	return nil
+}
+
+// secretKey replaces the characters of k that are not allowed in Secret keys
+// with underscores.
+func secretKey(k string) string {
+	if secretKeyPattern.MatchString(k) {
+		return k
+	}
+	return illegalKeyCharacters.ReplaceAllString(k, "_")
+}
+
+// validateSecretData checks that data satisfies the contract of the secret
+// type, for those types that have one.
+func validateSecretData(secretType string, data kvMap) error {
+	switch secretType {
+	case bootstrapTokenType:
+		return validateBootstrapToken(data)
+	case tlsType:
+		return validateTLS(data)
+	case sshAuthType:
+		return validateSSHAuth(data)
+	case basicAuthType:
+		return validateBasicAuth(data)
+	case dockerConfigJSONType:
+		if !json.Valid([]byte(data[dockerConfigJSONKey])) {
+			return fmt.Errorf("value for key %v must be valid JSON", dockerConfigJSONKey)
+		}
+	}
+	return nil
+}
+
+func validateBootstrapToken(data kvMap) error {
+	for _, k := range bootstrapTokenKeys {
+		value, ok := data[k.key]
+		if !ok {
+			return fmt.Errorf("secret of type %v requires key %v", bootstrapTokenType, k.key)
+		}
+		if !k.pattern.MatchString(value) {
+			return fmt.Errorf("value for key %v must match %v", k.key, k.pattern)
+		}
+	}
+	return nil
+}
+
+func readInput(content []byte, opts Options) (SopsSecretGenerator, error) {
+	input, err := readSpec(content, opts)
+	if err != nil {
+		return SopsSecretGenerator{}, err
+	}
+	// The entries of secrets have their own names
+	if input.Name == "" && input.GenerateName == "" && len(input.Secrets) == 0 {
+		return SopsSecretGenerator{}, withClass(ClassSpec, errors.New("input must contain metadata.name or metadata.generateName value"))
+	}
+	return input, nil
+}
+
+// readSpec reads a spec without requiring it to be complete, so that it can
+// also read fragments. With opts.Strict, unknown fields are an error. The
+// arguments of the kustomize builtin SecretGenerator are accepted too.
+func readSpec(content []byte, opts Options) (SopsSecretGenerator, error) {
+	var typeMeta TypeMeta
+	if yaml.Unmarshal(content, &typeMeta) == nil && typeMeta.APIVersion == builtinAPIVersion && typeMeta.Kind == builtinKind {
+		return readBuiltinSpec(content, opts)
+	}
+
+	input := SopsSecretGenerator{
+		TypeMeta: TypeMeta{},
+		ObjectMeta: ObjectMeta{
+			Annotations: make(kvMap),
+		},
+	}
+	unmarshal := yaml.Unmarshal
+	if opts.Strict {
+		unmarshal = yaml.UnmarshalStrict
+	}
+	err := unmarshal(content, &input)
+	if err != nil {
+		return SopsSecretGenerator{}, withClass(ClassSpec, err)
+	}
+
+	if input.APIVersion != apiVersion || (input.Kind != kind && input.Kind != oldKind && input.Kind != configMapKind) {
+		return SopsSecretGenerator{}, withClass(ClassSpec, errors.Errorf("input must be apiVersion %s, kind %s or %s", apiVersion, kind, configMapKind))
+	}
+	// In the next major version, remove old kind compatibility
+	if input.Kind == oldKind {
+		input.Kind = kind
+	}
+	return input, nil
+}
+
+// parseInput returns the data of the sources, and its keys in the order in
+// which the sources define them.
+func parseInput(ctx context.Context, input SopsSecretGenerator, stringKeys map[string]bool, opts Options) (kvMap, []string, error) {
+	envSources, fileSources, err := inputSources(input)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	data := make(kvMap)
+	envKeys, envErr := parseEnvSources(ctx, envSources, data, stringKeys, opts)
+	if envErr != nil && !opts.AllErrors {
+		return nil, nil, envErr
+	}
+	fileKeys, fileErr := parseFileSources(ctx, fileSources, data, stringKeys, opts)
+	if fileErr != nil && !opts.AllErrors {
+		return nil, nil, fileErr
+	}
+	literalKeys, literalErr := parseLiterals(ctx, input.Literals, data, opts)
+	err = combineErrors(envErr, fileErr, literalErr)
+	if err != nil {
+		return nil, nil, err
+	}
+	return data, append(append(envKeys, fileKeys...), literalKeys...), nil
+}
+
+// inputSources returns the env and file sources of the input that are used,
+// including those from the source directory, with file patterns expanded and
+// the formats of extensions of the spec applied.
+func inputSources(input SopsSecretGenerator) (envSources []Source, fileSources []Source, err error) {
+	err = validateExtensionFormats(input.ExtensionFormats)
+	if err != nil {
+		return nil, nil, withClass(ClassSpec, err)
+	}
+	dirEnvSources, dirFileSources, err := input.SourceDir.sources(input.ExtensionFormats)
+	if err != nil {
+		return nil, nil, withClass(ClassSpec, err)
+	}
+	envSources, err = includedSources(append(append([]Source{}, input.EnvSources...), dirEnvSources...))
+	if err != nil {
+		return nil, nil, withClass(ClassSpec, err)
+	}
+	typedFileSources, err := typedSources(input)
+	if err != nil {
+		return nil, nil, withClass(ClassSpec, err)
+	}
+	fileSources, err = includedSources(input.FileSources)
+	if err != nil {
+		return nil, nil, withClass(ClassSpec, err)
+	}
+	// Only listed file sources are patterns or directories, not the files in
+	// the source directory
+	fileSources, err = expandFileGlobs(fileSources)
+	if err != nil {
+		return nil, nil, withClass(ClassSource, err)
+	}
+	fileSources, err = expandFileDirectories(fileSources)
+	if err != nil {
+		return nil, nil, withClass(ClassSource, err)
+	}
+	fileSources = append(append(fileSources, dirFileSources...), typedFileSources...)
+	return applyExtensionFormats(envSources, input.ExtensionFormats, false), applyExtensionFormats(fileSources, input.ExtensionFormats, true), nil
+}
+
+func parseEnvSources(ctx context.Context, sources []Source, data kvMap, stringKeys map[string]bool, opts Options) ([]string, error) {
+	merged := copyData(data)
+	var keys []string
+	var errs []error
+	for _, source := range sources {
+		if missingOptionalSource(source, source.Path) {
+			warnf(opts, "ignoring optional env source %v, which does not exist", source.Path)
+			continue
+		}
+		sourceData := make(kvMap)
+		order, err := parseEnvSource(ctx, source, sourceData, opts)
+		if err == nil && (len(source.IncludeKeys) > 0 || len(source.ExcludeKeys) > 0) {
+			sourceData, order, err = filterKeys(sourceData, order, source.IncludeKeys, source.ExcludeKeys)
+		}
+		if err == nil && source.UpperCaseKeys {
+			sourceData, order, err = upperCaseKeys(sourceData, order)
+		}
+		if err == nil && source.RecursiveDecrypt {
+			err = decryptNested(ctx, sourceData, opts)
+		}
+		if err == nil && source.ExpandVars {
+			err = expandVars(sourceData, opts.UndefinedVarsError)
+		}
+		if err == nil && len(sourceData) == 0 {
+			err = emptySource("env", source.Path, opts)
+		}
+		if source.Prefix != "" || source.Suffix != "" {
+			sourceData, order = affixKeys(sourceData, order, source.Prefix, source.Suffix)
+		}
+		var added []string
+		if err == nil {
+			added, err = mergeSourceData(merged, sourceData, order, source.Override)
+		}
+		if err == nil {
+			markStringData(stringKeys, sourceData, source.StringData)
+			opts.Summary.addSource(source.Path, sourceData)
+		}
+		if err != nil {
+			err = errors.Wrapf(err, "env source %v", source.Path)
+			if !opts.AllErrors {
+				return nil, err
+			}
+			errs = append(errs, err)
+			continue
+		}
+		keys = append(keys, added...)
+	}
+	if err := combineErrors(errs...); err != nil {
+		return nil, err
+	}
+	for k, v := range merged {
+		data[k] = v
+	}
+	return keys, nil
+}
+
+// parseEnvSource adds the values of an env source to data. For formats that
+// have one, it returns the order of the keys in the source.
+func parseEnvSource(ctx context.Context, source Source, data kvMap, opts Options) ([]string, error) {
+	if source.ValueEncoding != "" && source.ValueEncoding != "json" && source.ValueEncoding != "yaml" {
+		return nil, fmt.Errorf("unknown value encoding %v, use json or yaml", source.ValueEncoding)
+	}
+
+	// Vault returns plaintext, so it is not decrypted
+	if isVaultPath(source.Path) {
+		if source.Index != nil {
+			return nil, errors.New("index requires a JSON source")
+		}
+		d, err := readVault(ctx, source.Path)
+		if err != nil {
+			return nil, err
+		}
+		if separator := source.flattenSeparator(); separator != "" {
+			d, _, err = flattenStructured(d, nil, separator)
+			if err != nil {
+				return nil, err
+			}
+		}
+		return nil, importStructuredContent(d, data, source.ValueEncoding)
+	}
+
+	format, err := source.format(source.Path)
+	if err != nil {
+		return nil, err
+	}
+	content, err := readSource(ctx, source.Path, opts)
+	if err != nil {
+		return nil, err
+	}
+	err = verifyChecksum(content, source.Checksum)
+	if err != nil {
+		return nil, err
+	}
+
+	if source.Index != nil && format != "json" {
+		return nil, errors.New("index requires a JSON source")
+	}
+	decrypted := content
+	if !source.Plain {
+		decrypted, err = decrypt(ctx, content, sopsFormat(format), opts)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if format != "dotenv" && format != "binary" {
+		err = validateUTF8(decrypted)
+		if err != nil {
+			return nil, errors.Wrapf(err, "decrypted %v content", format)
+		}
+	}
+
+	var order []string
+	switch format {
+	case "dotenv":
+		err = parseDotEnvContent(decrypted, data, source.UnquoteValues)
+	case "yaml":
+		order, err = parseYAMLContent(decrypted, data, source.ValueEncoding, source.flattenSeparator())
+	case "json":
+		err = parseJSONContent(decrypted, data, source.ValueEncoding, source.Index, source.flattenSeparator())
+	case "xml":
+		err = parseXMLContent(decrypted, data, source.XMLAttributes)
+	case "ini":
+		order, err = parseINIContent(decrypted, data, source.INISeparator)
+	case "toml":
+		order, err = parseTOMLContent(decrypted, data, source.ValueEncoding, source.flattenSeparator())
+	case "properties":
+		order, err = parsePropertiesContent(decrypted, data)
+	default:
+		err = errors.New("unknown file format, use dotenv, yaml, json, xml, ini, toml or properties")
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return order, nil
+}
+
+// validateUTF8 checks that content is valid UTF-8, reporting the offset of
+// the first invalid byte.
+func validateUTF8(content []byte) error {
+	for offset := 0; offset < len(content); {
+		r, size := utf8.DecodeRune(content[offset:])
+		if r == utf8.RuneError && size == 1 {
+			return fmt.Errorf("invalid UTF-8 byte 0x%02x at offset %d", content[offset], offset)
+		}
+		offset += size
+	}
+	return nil
+}
+
+// affixKeys returns data and the order of its keys with prefix and suffix
+// added to every key.
+func affixKeys(data kvMap, order []string, prefix string, suffix string) (kvMap, []string) {
+	affixed := make(kvMap, len(data))
+	for k, v := range data {
+		affixed[prefix+k+suffix] = v
+	}
+	var affixedOrder []string
+	for _, k := range order {
+		affixedOrder = append(affixedOrder, prefix+k+suffix)
+	}
+	return affixed, affixedOrder
+}
+
+// expandVars expands ${VAR} and $VAR references to environment variables in
+// the values of data. $$ is a literal $. Undefined variables expand to "",
+// unless undefinedError is set.
+func expandVars(data kvMap, undefinedError bool) error {
+	for k, v := range data {
+		var undefined []string
+		data[k] = os.Expand(v, func(name string) string {
+			if name == "$" {
+				return "$"
+			}
+			value, ok := os.LookupEnv(name)
+			if !ok {
+				undefined = append(undefined, name)
+			}
+			return value
+		})
+		if undefinedError && len(undefined) > 0 {
+			return fmt.Errorf("value for key %v refers to undefined variable %v", k, undefined[0])
+		}
+	}
+	return nil
+}
+
+// parseDotEnvContent adds the variables of a dotenv file to data. Double
+// quoted values that span multiple lines are unquoted, and those on a single
+// line too if unquote is set.
+func parseDotEnvContent(content []byte, data kvMap, unquote bool) error {
+	scanner := bufio.NewScanner(bytes.NewReader(content))
+	lineNum := 0
+	var quoted *quotedValue
+	for scanner.Scan() {
+		line := scanner.Bytes()
+		// Strip UTF-8 byte order mark from first line
+		if lineNum == 0 {
+			line = bytes.TrimPrefix(line, utf8bom)
+		}
+		var err error
+		if quoted != nil {
+			var done bool
+			done, err = quoted.addLine(line)
+			if done {
+				data[quoted.key] = quoted.value()
+				quoted = nil
+			}
+		} else if quoted = startQuotedValue(line, lineNum); quoted == nil {
+			err = parseDotEnvLine(line, data, unquote)
+		}
+		if err != nil {
+			return errors.Wrapf(err, "line %d", lineNum)
+		}
+		lineNum++
+	}
+	if quoted != nil {
+		return fmt.Errorf("line %d: unterminated quoted value for %v", quoted.startLine, quoted.key)
+	}
+	return scanner.Err()
+}
+
+// quotedValue is a double-quoted dotenv value that spans multiple lines.
+type quotedValue struct {
+	key       string
+	startLine int
+	lines     []string
+}
+
+var quotedValueUnescaper = strings.NewReplacer(`\\`, `\`, `\"`, `"`)
+
+// startQuotedValue returns a quotedValue if the line opens a double quote
+// that is not closed on the same line, or nil otherwise.
+func startQuotedValue(line []byte, lineNum int) *quotedValue {
+	if !utf8.Valid(line) {
+		return nil
+	}
+	line = bytes.TrimLeftFunc(line, unicode.IsSpace)
+	if len(line) == 0 || line[0] == '#' {
+		return nil
+	}
+	pair := strings.SplitN(string(line), "=", 2)
+	if len(pair) != 2 || !strings.HasPrefix(pair[1], `"`) || closingQuote(pair[1][1:]) >= 0 {
+		return nil
+	}
+	return &quotedValue{key: pair[0], startLine: lineNum, lines: []string{pair[1][1:]}}
+}
+
+// addLine adds a continuation line and reports whether it closed the value.
+func (q *quotedValue) addLine(line []byte) (bool, error) {
+	if !utf8.Valid(line) {
+		return false, fmt.Errorf("invalid UTF-8 bytes: %v", string(line))
+	}
+	i := closingQuote(string(line))
+	if i < 0 {
+		q.lines = append(q.lines, string(line))
+		return false, nil
+	}
+	if len(bytes.TrimSpace(line[i+1:])) != 0 {
+		return false, fmt.Errorf("unexpected text after closing quote: %v", string(line))
+	}
+	q.lines = append(q.lines, string(line[:i]))
+	return true, nil
+}
+
+func (q *quotedValue) value() string {
+	return quotedValueUnescaper.Replace(strings.Join(q.lines, "\n"))
+}
+
+// closingQuote returns the index of the first double quote that is not
+// escaped with a backslash, or -1.
+func closingQuote(s string) int {
+	for i := 0; i < len(s); i++ {
+		switch s[i] {
+		case '\\':
+			i++
+		case '"':
+			return i
+		}
+	}
+	return -1
+}
+
+func parseDotEnvLine(line []byte, data kvMap, unquote bool) error {
+	if !utf8.Valid(line) {
+		return fmt.Errorf("invalid UTF-8 bytes: %v", string(line))
+	}
+
+	line = bytes.TrimLeftFunc(line, unicode.IsSpace)
+
+	if len(line) == 0 || line[0] == '#' {
+		return nil
+	}
+
+	pair := strings.SplitN(string(line), "=", 2)
+	if len(pair) != 2 {
+		return fmt.Errorf("requires value: %v", string(line))
+	}
+
+	if unquote {
+		data[pair[0]] = unquoteDotEnvValue(pair[1])
+	} else {
+		data[pair[0]] = pair[1]
+	}
+	return nil
+}
+
+// unquoteDotEnvValue removes the double quotes around a value on a single
+// line and unescapes it, like a value that spans multiple lines. Values that
+// are not entirely enclosed in double quotes are returned as they are.
+func unquoteDotEnvValue(value string) string {
+	if !strings.HasPrefix(value, `"`) {
+		return value
+	}
+	i := closingQuote(value[1:])
+	if i < 0 || strings.TrimSpace(value[i+2:]) != "" {
+		return value
+	}
+	return quotedValueUnescaper.Replace(value[1 : i+1])
+}
+
+// parseYAMLContent adds the values of a YAML document to data, and returns
+// the keys in document order. Keys are used as they are written, so NO is
+// NO rather than false. Nested values are flattened if separator is set.
+func parseYAMLContent(content []byte, data kvMap, valueEncoding string, separator string) ([]string, error) {
+	var m yamlMapping
+	err := yaml.Unmarshal(content, &m)
+	if err != nil {
+		return nil, err
+	}
+	d := make(map[string]interface{}, len(m))
+	keys := make([]string, 0, len(m))
+	for _, item := range m {
+		k := item.Key.(string)
+		d[k] = item.Value
+		keys = append(keys, k)
+	}
+	keys = stripSopsMetadata(d, keys)
+	if separator != "" {
+		d, keys, err = flattenStructured(d, keys, separator)
+		if err != nil {
+			return nil, err
+		}
+	}
+	err = importStructuredContent(d, data, valueEncoding)
+	if err != nil {
+		return nil, err
+	}
+	order := make([]string, 0, len(data))
+	for _, k := range keys {
+		if _, ok := data[k]; ok {
+			order = append(order, k)
+		}
+	}
+	return order, nil
+}
+
+// parseJSONContent adds the values of a JSON object to data. If index is set,
+// the content must be an array, and the fields of the object at that index
+// are added. Nested values are flattened if separator is set.
+func parseJSONContent(content []byte, data kvMap, valueEncoding string, index *int, separator string) error {
+	if index == nil {
+		d := make(map[string]interface{})
+		err := unmarshalJSON(content, &d)
+		if err != nil {
+			return err
+		}
+		stripSopsMetadata(d, nil)
+		if separator != "" {
+			d, _, err = flattenStructured(d, nil, separator)
+			if err != nil {
+				return err
+			}
+		}
+		return importStructuredContent(d, data, valueEncoding)
+	}
+
+	var elements []interface{}
+	err := unmarshalJSON(content, &elements)
+	if err != nil {
+		return errors.Wrap(err, "source with index must be an array")
+	}
+	if *index < 0 || *index >= len(elements) {
+		return fmt.Errorf("index %d out of range, array has %d elements", *index, len(elements))
+	}
+	d, ok := elements[*index].(map[string]interface{})
+	if !ok {
+		return fmt.Errorf("element %d must be an object", *index)
+	}
+	stripSopsMetadata(d, nil)
+	if separator != "" {
+		d, _, err = flattenStructured(d, nil, separator)
+		if err != nil {
+			return err
+		}
+	}
+	return importStructuredContent(d, data, valueEncoding)
+}
+
+// importStructuredContent adds the top-level values of a decrypted YAML or
+// JSON document, without its sops metadata, to data. Partially encrypted
+// documents contain a mix of plaintext and decrypted values, which are
+// imported alike. YAML and JSON numbers and booleans are kept as written, so
+// that 1.10 is not 1.1 and large integers are not rounded; TOML ones are
+// written as in JSON, such as 5432 and true. Lists and maps are serialized as
+// compact JSON if valueEncoding is json, or as YAML if it is yaml.
+func importStructuredContent(d map[string]interface{}, data kvMap, valueEncoding string) error {
+	for k, v := range d {
+		switch value := v.(type) {
+		case nil:
+			data[k] = ""
+		case string:
+			data[k] = value
+		case json.Number:
+			data[k] = value.String()
+		case yamlScalar:
+			data[k] = value.text
+		case bool, int, int64, uint64, float64:
+			encoded, err := marshalJSONValue(value)
+			if err != nil {
+				return errors.Wrapf(err, "value for key %v", k)
+			}
+			data[k] = string(encoded)
+		default:
+			var encoded []byte
+			var err error
+			switch valueEncoding {
+			case "json":
+				encoded, err = marshalJSONValue(value)
+			case "yaml":
+				encoded, err = marshalYAMLValue(value)
+			default:
+				return fmt.Errorf("value for key %v must be a string, number or boolean", k)
+			}
+			if err != nil {
+				return errors.Wrapf(err, "value for key %v", k)
+			}
+			data[k] = string(encoded)
+		}
+	}
+	return nil
+}
+
+// stripSopsMetadata removes the sops metadata block from a decrypted
+// document, so that it does not end up in the secret, and returns the keys
+// of the document without it. It must be removed before the document is
+// flattened, which would turn it into keys such as sops.mac. Other keys, even
+// mac and lastmodified, are data of the user.
+func stripSopsMetadata(d map[string]interface{}, keys []string) []string {
+	if _, ok := d["sops"]; !ok {
+		return keys
+	}
+	delete(d, "sops")
+	var stripped []string
+	for _, k := range keys {
+		if k != "sops" {
+			stripped = append(stripped, k)
+		}
+	}
+	return stripped
+}
+
+func parseFileSources(ctx context.Context, sources []Source, data kvMap, stringKeys map[string]bool, opts Options) ([]string, error) {
+	merged := copyData(data)
+	var keys []string
+	var errs []error
+	for _, source := range sources {
+		if _, fn, err := source.fileName(); err == nil && missingOptionalSource(source, fn) {
+			warnf(opts, "ignoring optional file source %v, which does not exist", source.Path)
+			continue
+		}
+		sourceData := make(kvMap)
+		err := parseFileSource(ctx, source, sourceData, opts)
+		if err == nil && containsEmptyValue(sourceData) {
+			err = emptySource("file", source.Path, opts)
+		}
+		var added []string
+		if err == nil {
+			added, err = mergeSourceData(merged, sourceData, nil, source.Override)
+		}
+		if err == nil {
+			markStringData(stringKeys, sourceData, source.StringData)
+			// The path of a file source may contain the key
+			_, fn, _ := source.fileName()
+			opts.Summary.addSource(fn, sourceData)
+		}
+		if err != nil {
+			err = errors.Wrapf(err, "file source %v", source.Path)
+			if !opts.AllErrors {
+				return nil, err
+			}
+			errs = append(errs, err)
+			continue
+		}
+		keys = append(keys, added...)
+	}
+	if err := combineErrors(errs...); err != nil {
+		return nil, err
+	}
+	for k, v := range merged {
+		data[k] = v
+	}
+	return keys, nil
+}
+
+func parseFileSource(ctx context.Context, source Source, data kvMap, opts Options) error {
+	key, fn, err := source.fileName()
+	if err != nil {
+		return err
+	}
+
+	file, extract := splitExtractPath(fn, source.Format)
+	format, err := source.format(file)
+	if err != nil {
+		return err
+	}
+	var decrypted []byte
+	if isVaultPath(fn) {
+		decrypted, err = readVaultField(ctx, fn)
+	} else {
+		decrypted, err = readSource(ctx, file, opts)
+		if err == nil {
+			err = verifyChecksum(decrypted, source.Checksum)
+		}
+		if err == nil && !source.Plain {
+			decrypted, err = decrypt(ctx, decrypted, sopsFormat(format), opts)
+		}
+	}
+	if err != nil {
+		return err
+	}
+	if extract != "" {
+		decrypted, err = extractValue(decrypted, format, extract, source.ValueEncoding)
+		if err != nil {
+			return errors.Wrapf(err, "extract %v", extract)
+		}
+	}
+	if source.DecodeBase64 {
+		decrypted, err = decodeBase64(decrypted)
+		if err != nil {
+			return err
+		}
+	}
+
+	data[key] = string(decrypted)
+	return nil
+}
+
+func containsEmptyValue(data kvMap) bool {
+	for _, v := range data {
+		if v == "" {
+			return true
+		}
+	}
+	return false
+}
+
+// emptySource reports a source without data, which usually indicates a
+// misconfigured sops file. It is an error unless empty sources are allowed.
+func emptySource(sourceType string, source string, opts Options) error {
+	if !opts.AllowEmpty {
+		return errors.New("source is empty")
+	}
+	warnf(opts, "%s source %v is empty", sourceType, source)
+	return nil
+}
+
+func warnf(opts Options, format string, args ...interface{}) {
+	if opts.Warnings != nil {
+		_, _ = fmt.Fprintf(opts.Warnings, "Warning: "+format+"\n", args...)
+	}
+}
+
+// mergeSourceData adds the data of a source to the data of earlier sources.
+// Keys defined by earlier sources are only replaced if override is set. The
+// keys are merged in the given order, or sorted if there is none, and the new
+// keys are returned in that order.
+// On a collision, data is left unchanged.
+func mergeSourceData(data kvMap, sourceData kvMap, order []string, override bool) ([]string, error) {
+	keys := order
+	if keys == nil {
+		keys = make([]string, 0, len(sourceData))
+		for k := range sourceData {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+	}
+	var added []string
+	for _, k := range keys {
+		if _, ok := data[k]; ok {
+			if !override {
+				return nil, fmt.Errorf("key %v is already defined by an earlier source", k)
+			}
+		} else {
+			added = append(added, k)
+		}
+	}
+	for _, k := range keys {
+		data[k] = sourceData[k]
+	}
+	return added, nil
+}
+
+// copyData returns a copy of data, to which sources can be merged without
+// changing data if one of them fails.
+func copyData(data kvMap) kvMap {
+	c := make(kvMap, len(data))
+	for k, v := range data {
+		c[k] = v
+	}
+	return c
+}
+
+// decodeBase64 decodes standard base64 text, ignoring whitespace such as
+// line breaks.
+func decodeBase64(content []byte) ([]byte, error) {
+	text := strings.Map(func(r rune) rune {
+		if unicode.IsSpace(r) {
+			return -1
+		}
+		return r
+	}, string(content))
+	decoded, err := base64.StdEncoding.DecodeString(text)
+	if err != nil {
+		return nil, errors.Wrap(err, "content is not valid base64")
+	}
+	return decoded, nil
+}
+
+// parseFileName splits the path of a file source into the key and the path
+// of the file. Without a key, it is named after the file, or the value that
+// is extracted from the file in the given format.
+func parseFileName(source string, format string) (key string, fn string, err error) {
+	components := strings.Split(source, "=")
+	// The ref of a Git source contains '='
+	if i := strings.Index(source, gitScheme); i >= 0 {
+		components = []string{source[i:]}
+		if i > 0 {
+			if source[i-1] != '=' {
+				return "", "", fmt.Errorf("invalid git source %v", source)
+			} else if strings.Contains(source[:i-1], "=") {
+				return "", "", errors.New("key names or file paths cannot contain '='")
+			}
+			components = []string{source[:i-1], source[i:]}
+		}
+	}
+
+	switch len(components) {
+	case 1:
+		if isVaultPath(source) {
+			_, field := splitVaultPath(source)
+			return field, source, nil
+		}
+		if _, extract := splitExtractPath(source, format); extract != "" {
+			if keys, err := parseExtractPath(extract); err == nil {
+				return keys[len(keys)-1], source, nil
+			}
+		}
+		if isGitPath(source) {
+			if _, file, _, err := parseGitPath(source); err == nil {
+				return path.Base(file), source, nil
+			}
+		}
+		return path.Base(source), source, nil
+	case 2:
+		key, fn = components[0], components[1]
+		if key == "" {
+			return "", "", fmt.Errorf("key name for file path %v missing", fn)
+		} else if fn == "" {
+			return "", "", fmt.Errorf("file path for key name %v missing", key)
+		}
+		return key, fn, nil
+	default:
+		return "", "", errors.New("key names or file paths cannot contain '='")
+	}
+}
+
+// formats are the formats of sources.
+var formats = []string{"dotenv", "yaml", "json", "xml", "ini", "toml", "properties", "binary"}
+
+// formatPath returns the part of a source path whose extension tells the
+// format: the path of a URL without its query, or the path of a file in Git.
+func formatPath(path string) string {
+	if isRemotePath(path) {
+		return remoteFilePath(path)
+	} else if isGitPath(path) {
+		if _, file, _, err := parseGitPath(path); err == nil {
+			return file
+		}
+	}
+	return path
+}
+
+func formatForPath(path string) string {
+	path = formatPath(path)
+	if sopscommon.IsYAMLFile(path) {
+		return "yaml"
+	} else if sopscommon.IsJSONFile(path) {
+		return "json"
+	} else if sopscommon.IsEnvFile(path) {
+		return "dotenv"
+	} else if strings.HasSuffix(path, ".xml") {
+		return "xml"
+	} else if strings.HasSuffix(path, ".ini") {
+		return "ini"
+	} else if strings.HasSuffix(path, ".toml") {
+		return "toml"
+	} else if strings.HasSuffix(path, ".properties") {
+		return "properties"
+	}
+	return "binary"
+}
+
+// sopsFormat returns the sops store format for a file format. Formats that
+// sops does not support are encrypted as binary files.
+func sopsFormat(format string) string {
+	switch format {
+	case "yaml", "json", "dotenv":
+		return format
+	default:
+		return "binary"
+	}
+}
@@ -0,0 +1,2057 @@
+// Copyright 2019 Go About B.V. and contributors
+// Licensed under the Apache License, Version 2.0.
+
+package generator
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"runtime"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/lithammer/dedent"
+	"github.com/pkg/errors"
+	"go.mozilla.org/sops/pgp"
+)
+
+const testkeyFingerprint = "2D2483DF73A3A0FAEE3C2A695BDC395360CE8FF4"
+const testkeyCrypttext = `
+-----BEGIN PGP MESSAGE-----
+
+hQEMA6z+tHR/duVIAQf/VO9SoP3PcDg7iZzm5CUQ1jgF6BGrJqL5azjF/D74I83t
+UalWAsewjd+xcKLBSnzr+uf90NcfIGpWx9u3IIyOZgIDkshp89jxz+mzj1MHsXM4
+/gMBzRwFoynYKtdFs6u5MnB/e4tw0tMkxgqp8tPog1FEEyWmGSV6WOpL0SOzc2mV
+PUA167We9+DLR8Yj9ABBEPpFDDq2bucOV9d3bkQS6+hWBbTPZMGcHvcupdDtALjv
+7FMKftz9FAoPNDSR4RXkXQSkD1jdNfx5d+SYxNyxR2IWk1pigkBzKPlL9BHFCHQD
+KCRtg392tGQ7WRY0s1J5GHHvnaDd+p0m3LWbUG28JtI7AZZSOue8gect+bw+Z5bO
+sDRQLEMprueQOkhMr/JzgWRCV8JYxRFOqXjl7PRBjmgNPMu2GzRIB8D/+SU=
+=7dAF
+-----END PGP MESSAGE-----
+`
+
+// Test suite setup
+
+func TestMain(m *testing.M) {
+	err := setupGnuPG()
+	if err != nil {
+		_, _ = fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+	os.Exit(m.Run())
+}
+
+func setupGnuPG() error {
+	err := os.Setenv("GNUPGHOME", "testdata")
+	if err != nil {
+		return err
+	}
+	// Check whether the test key was loaded correctly
+	key := pgp.NewMasterKeyFromFingerprint(testkeyFingerprint)
+	key.EncryptedKey = testkeyCrypttext
+	_, err = key.Decrypt()
+	if err != nil {
+		return errors.Wrap(err, "PGP decryption check failed")
+	}
+	return nil
+}
+
+// Tests
+
+func Test_Generate(t *testing.T) {
+	type args struct {
+		fn   string
+		opts Options
+	}
+	tests := []struct {
+		name    string
+		args    args
+		want    string
+		wantErr bool
+	}{
+		{
+			"SopsSecretGenerator",
+			args{"testdata/generator.yaml", Options{}},
+			strings.TrimLeft(dedent.Dedent(`
+				apiVersion: v1
+				kind: Secret
+				metadata:
+				  name: secret
+				data:
+				  file.txt: c2VjcmV0Cg==
+			`), "\n"),
+			false,
+		},
+		{
+			"Namespace",
+			args{"testdata/generator.yaml", Options{Namespace: "override"}},
+			strings.TrimLeft(dedent.Dedent(`
+				apiVersion: v1
+				kind: Secret
+				metadata:
+				  name: secret
+				  namespace: override
+				data:
+				  file.txt: c2VjcmV0Cg==
+			`), "\n"),
+			false,
+		},
+		{
+			"HeaderComment",
+			args{"testdata/generator.yaml", Options{HeaderComment: "Generated by SopsSecretGenerator; do not edit"}},
+			strings.TrimLeft(dedent.Dedent(`
+				# Generated by SopsSecretGenerator; do not edit
+				apiVersion: v1
+				kind: Secret
+				metadata:
+				  name: secret
+				data:
+				  file.txt: c2VjcmV0Cg==
+			`), "\n"),
+			false,
+		},
+		{
+			"PreserveOrder",
+			args{"testdata/generator-order.yaml", Options{PreserveOrder: true}},
+			strings.TrimLeft(dedent.Dedent(`
+				apiVersion: v1
+				kind: Secret
+				metadata:
+				  name: secret
+				data:
+				  file2.txt: c2VjcmV0Mgo=
+				  file.txt: c2VjcmV0Cg==
+			`), "\n"),
+			false,
+		},
+		{
+			"WrapWidth",
+			args{"testdata/generator.yaml", Options{WrapWidth: 8}},
+			strings.TrimLeft(dedent.Dedent(`
+				apiVersion: v1
+				kind: Secret
+				metadata:
+				  name: secret
+				data:
+				  file.txt: |-
+				    c2VjcmV0
+				    Cg==
+			`), "\n"),
+			false,
+		},
+		{
+			"ConfigMap",
+			args{"testdata/configmap.yaml", Options{}},
+			strings.TrimLeft(dedent.Dedent(`
+				apiVersion: v1
+				kind: ConfigMap
+				metadata:
+				  name: config
+				data:
+				  VAR_ENV: val_env
+				  file.txt: |
+				    secret
+			`), "\n"),
+			false,
+		},
+		{
+			"Literals",
+			args{"testdata/generator-literals.yaml", Options{}},
+			strings.TrimLeft(dedent.Dedent(`
+				apiVersion: v1
+				kind: Secret
+				metadata:
+				  name: secret
+				data:
+				  LITERAL: dmFsX2xpdGVyYWw=
+				  file.txt: c2VjcmV0Cg==
+			`), "\n"),
+			false,
+		},
+		{
+			"MultipleDocuments",
+			args{"testdata/generator-multidoc.yaml", Options{HeaderComment: "Generated"}},
+			strings.TrimLeft(dedent.Dedent(`
+				# Generated
+				apiVersion: v1
+				kind: Secret
+				metadata:
+				  name: secret
+				data:
+				  file.txt: c2VjcmV0Cg==
+				---
+				apiVersion: v1
+				kind: Secret
+				metadata:
+				  name: secret2
+				data:
+				  file2.txt: c2VjcmV0Mgo=
+			`), "\n"),
+			false,
+		},
+		{
+			"Secrets",
+			args{"testdata/generator-secrets.yaml", Options{}},
+			strings.TrimLeft(dedent.Dedent(`
+				apiVersion: v1
+				kind: Secret
+				metadata:
+				  name: first
+				  namespace: default
+				data:
+				  file.txt: c2VjcmV0Cg==
+				---
+				apiVersion: v1
+				kind: Secret
+				metadata:
+				  name: second
+				  namespace: default
+				data:
+				  file2.txt: c2VjcmV0Mgo=
+				type: Opaque
+			`), "\n"),
+			false,
+		},
+		{"InvalidEnvs", args{"testdata/generator-invalidenv.yaml", Options{}}, "", true},
+		{"MissingFile", args{"testdata/missing.yaml", Options{}}, "", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			spec, _ := ioutil.ReadFile(tt.args.fn)
+			got, err := Generate(spec, tt.args.opts)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("Generate() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if string(got) != tt.want {
+				t.Errorf("Generate() got = %v, want %v", string(got), tt.want)
+			}
+		})
+	}
+}
+
+func Test_generateSecret(t *testing.T) {
+	now = func() time.Time { return time.Date(2019, 9, 12, 23, 20, 43, 0, time.UTC) }
+	defer func() { now = time.Now }()
+
+	type args struct {
+		sopsSecret SopsSecretGenerator
+		opts       Options
+	}
+	tests := []struct {
+		name    string
+		args    args
+		want    Secret
+		wantErr bool
+	}{
+		{
+			"Normal",
+			args{
+				SopsSecretGenerator{
+					TypeMeta: TypeMeta{
+						APIVersion: "goabout/v1beta1",
+						Kind:       "SopsSecretGenerator",
+					},
+					ObjectMeta: ObjectMeta{
+						Name:        "secret",
+						Namespace:   "default",
+						Labels:      kvMap{"label": "value"},
+						Annotations: kvMap{"annotation": "value"},
+					},
+					Behavior:    "merge",
+					EnvSources:  sources("testdata/vars.env"),
+					FileSources: sources("testdata/file.txt"),
+					Type:        "Oblique",
+				},
+				Options{},
+			},
+			Secret{
+				TypeMeta: TypeMeta{
+					APIVersion: "v1",
+					Kind:       "Secret",
+				},
+				ObjectMeta: ObjectMeta{
+					Name:      "secret",
+					Namespace: "default",
+					Labels:    kvMap{"label": "value"},
+					Annotations: kvMap{
+						"annotation":                         "value",
+						"kustomize.config.k8s.io/needs-hash": "true",
+						"kustomize.config.k8s.io/behavior":   "merge",
+					},
+				},
+				Data: kvMap{"VAR_ENV": b64("val_env"), "file.txt": b64("secret\n")},
+				Type: "Oblique",
+			},
+			false,
+		},
+		{
+			"Options",
+			args{
+				SopsSecretGenerator{
+					TypeMeta: TypeMeta{
+						APIVersion: "goabout/v1beta1",
+						Kind:       "SopsSecretGenerator",
+					},
+					ObjectMeta: ObjectMeta{
+						Name:      "secret",
+						Namespace: "default",
+						Labels:    kvMap{"label": "value"},
+					},
+					DisableNameSuffixHash: true,
+					FileSources:           sources("testdata/file.txt"),
+				},
+				Options{
+					Namespace:    "override",
+					CommonLabels: map[string]string{"label": "common", "team": "ops"},
+				},
+			},
+			Secret{
+				TypeMeta: TypeMeta{
+					APIVersion: "v1",
+					Kind:       "Secret",
+				},
+				ObjectMeta: ObjectMeta{
+					Name:        "secret",
+					Namespace:   "override",
+					Labels:      kvMap{"label": "value", "team": "ops"},
+					Annotations: kvMap{},
+				},
+				Data: kvMap{"file.txt": b64("secret\n")},
+			},
+			false,
+		},
+		{
+			"Encoding",
+			args{
+				SopsSecretGenerator{
+					TypeMeta: TypeMeta{
+						APIVersion: "goabout/v1beta1",
+						Kind:       "SopsSecretGenerator",
+					},
+					ObjectMeta: ObjectMeta{
+						Name: "secret",
+					},
+					DisableNameSuffixHash: true,
+					FileSources:           sources("testdata/file.txt"),
+					Encoding:              "rawurl",
+				},
+				Options{},
+			},
+			Secret{
+				TypeMeta: TypeMeta{
+					APIVersion: "v1",
+					Kind:       "Secret",
+				},
+				ObjectMeta: ObjectMeta{
+					Name:        "secret",
+					Annotations: kvMap{},
+				},
+				Data: kvMap{"file.txt": "c2VjcmV0Cg"},
+			},
+			false,
+		},
+		{
+			"GenerateName",
+			args{
+				SopsSecretGenerator{
+					TypeMeta: TypeMeta{
+						APIVersion: "goabout/v1beta1",
+						Kind:       "SopsSecretGenerator",
+					},
+					ObjectMeta: ObjectMeta{
+						GenerateName: "secret-",
+					},
+					FileSources: sources("testdata/file.txt"),
+				},
+				Options{AppendNameHash: true, DisableNameSuffixHash: boolPtr(false)},
+			},
+			Secret{
+				TypeMeta: TypeMeta{
+					APIVersion: "v1",
+					Kind:       "Secret",
+				},
+				ObjectMeta: ObjectMeta{
+					GenerateName: "secret-",
+					Annotations:  kvMap{},
+				},
+				Data: kvMap{"file.txt": b64("secret\n")},
+			},
+			false,
+		},
+		{
+			"StringData",
+			args{
+				SopsSecretGenerator{
+					TypeMeta: TypeMeta{
+						APIVersion: "goabout/v1beta1",
+						Kind:       "SopsSecretGenerator",
+					},
+					ObjectMeta: ObjectMeta{
+						Name: "secret",
+					},
+					DisableNameSuffixHash: true,
+					EnvSources:            []Source{{Path: "testdata/vars.env", StringData: true}},
+					FileSources:           []Source{{Path: "testdata/file-base64.txt", DecodeBase64: true}},
+				},
+				Options{},
+			},
+			Secret{
+				TypeMeta: TypeMeta{
+					APIVersion: "v1",
+					Kind:       "Secret",
+				},
+				ObjectMeta: ObjectMeta{
+					Name:        "secret",
+					Annotations: kvMap{},
+				},
+				Data:       kvMap{"file-base64.txt": b64("\x00\x01\x02\xff")},
+				StringData: kvMap{"VAR_ENV": "val_env"},
+			},
+			false,
+		},
+		{
+			"SpecStringData",
+			args{
+				SopsSecretGenerator{
+					TypeMeta: TypeMeta{
+						APIVersion: "goabout/v1beta1",
+						Kind:       "SopsSecretGenerator",
+					},
+					ObjectMeta: ObjectMeta{
+						Name: "secret",
+					},
+					DisableNameSuffixHash: true,
+					EnvSources:            sources("testdata/vars.env"),
+					FileSources:           []Source{{Path: "testdata/file-base64.txt", DecodeBase64: true}, {Path: "testdata/file.txt"}},
+					StringData:            true,
+				},
+				Options{},
+			},
+			Secret{
+				TypeMeta: TypeMeta{
+					APIVersion: "v1",
+					Kind:       "Secret",
+				},
+				ObjectMeta: ObjectMeta{
+					Name:        "secret",
+					Annotations: kvMap{},
+				},
+				Data:       kvMap{"file-base64.txt": b64("\x00\x01\x02\xff")},
+				StringData: kvMap{"VAR_ENV": "val_env", "file.txt": "secret\n"},
+			},
+			false,
+		},
+		{
+			"StringDataBinary",
+			args{
+				SopsSecretGenerator{
+					TypeMeta: TypeMeta{
+						APIVersion: "goabout/v1beta1",
+						Kind:       "SopsSecretGenerator",
+					},
+					ObjectMeta: ObjectMeta{
+						Name: "secret",
+					},
+					FileSources: []Source{{Path: "testdata/file-base64.txt", DecodeBase64: true, StringData: true}},
+				},
+				Options{},
+			},
+			Secret{},
+			true,
+		},
+		{
+			"AppendNameHash",
+			args{
+				SopsSecretGenerator{
+					TypeMeta: TypeMeta{
+						APIVersion: "goabout/v1beta1",
+						Kind:       "SopsSecretGenerator",
+					},
+					ObjectMeta: ObjectMeta{
+						Name: "secret",
+					},
+					FileSources: sources("testdata/file.txt"),
+				},
+				Options{AppendNameHash: true},
+			},
+			Secret{
+				TypeMeta: TypeMeta{
+					APIVersion: "v1",
+					Kind:       "Secret",
+				},
+				ObjectMeta: ObjectMeta{
+					Name:        "secret-7gd94gtc2h",
+					Annotations: kvMap{},
+				},
+				Data: kvMap{"file.txt": b64("secret\n")},
+			},
+			false,
+		},
+		{
+			"ManagedBy",
+			args{
+				SopsSecretGenerator{
+					TypeMeta: TypeMeta{
+						APIVersion: "goabout/v1beta1",
+						Kind:       "SopsSecretGenerator",
+					},
+					ObjectMeta: ObjectMeta{
+						Name:   "secret",
+						Labels: kvMap{"app": "my-app"},
+					},
+					DisableNameSuffixHash: true,
+					FileSources:           sources("testdata/file.txt"),
+				},
+				Options{ManagedBy: "sopssecretgenerator"},
+			},
+			Secret{
+				TypeMeta: TypeMeta{
+					APIVersion: "v1",
+					Kind:       "Secret",
+				},
+				ObjectMeta: ObjectMeta{
+					Name:        "secret",
+					Labels:      kvMap{"app": "my-app", "app.kubernetes.io/managed-by": "sopssecretgenerator"},
+					Annotations: kvMap{},
+				},
+				Data: kvMap{"file.txt": b64("secret\n")},
+			},
+			false,
+		},
+		{
+			"ManagedBySpecWins",
+			args{
+				SopsSecretGenerator{
+					TypeMeta: TypeMeta{
+						APIVersion: "goabout/v1beta1",
+						Kind:       "SopsSecretGenerator",
+					},
+					ObjectMeta: ObjectMeta{
+						Name:   "secret",
+						Labels: kvMap{"app.kubernetes.io/managed-by": "me"},
+					},
+					DisableNameSuffixHash: true,
+					FileSources:           sources("testdata/file.txt"),
+				},
+				Options{ManagedBy: "sopssecretgenerator"},
+			},
+			Secret{
+				TypeMeta: TypeMeta{
+					APIVersion: "v1",
+					Kind:       "Secret",
+				},
+				ObjectMeta: ObjectMeta{
+					Name:        "secret",
+					Labels:      kvMap{"app.kubernetes.io/managed-by": "me"},
+					Annotations: kvMap{},
+				},
+				Data: kvMap{"file.txt": b64("secret\n")},
+			},
+			false,
+		},
+		{
+			"ForceManagedBy",
+			args{
+				SopsSecretGenerator{
+					TypeMeta: TypeMeta{
+						APIVersion: "goabout/v1beta1",
+						Kind:       "SopsSecretGenerator",
+					},
+					ObjectMeta: ObjectMeta{
+						Name:   "secret",
+						Labels: kvMap{"app.kubernetes.io/managed-by": "me"},
+					},
+					DisableNameSuffixHash: true,
+					FileSources:           sources("testdata/file.txt"),
+				},
+				Options{ManagedBy: "sopssecretgenerator", ForceManagedBy: true},
+			},
+			Secret{
+				TypeMeta: TypeMeta{
+					APIVersion: "v1",
+					Kind:       "Secret",
+				},
+				ObjectMeta: ObjectMeta{
+					Name:        "secret",
+					Labels:      kvMap{"app.kubernetes.io/managed-by": "sopssecretgenerator"},
+					Annotations: kvMap{},
+				},
+				Data: kvMap{"file.txt": b64("secret\n")},
+			},
+			false,
+		},
+		{
+			"OwnerReferences",
+			args{
+				SopsSecretGenerator{
+					TypeMeta: TypeMeta{
+						APIVersion: "goabout/v1beta1",
+						Kind:       "SopsSecretGenerator",
+					},
+					ObjectMeta: ObjectMeta{
+						Name: "secret",
+						OwnerReferences: []OwnerReference{
+							{APIVersion: "example.com/v1", Kind: "MyApp", Name: "my-app", UID: "d9607e19", Controller: boolPtr(true)},
+						},
+					},
+					DisableNameSuffixHash: true,
+					FileSources:           sources("testdata/file.txt"),
+				},
+				Options{},
+			},
+			Secret{
+				TypeMeta: TypeMeta{
+					APIVersion: "v1",
+					Kind:       "Secret",
+				},
+				ObjectMeta: ObjectMeta{
+					Name:        "secret",
+					Annotations: kvMap{},
+					OwnerReferences: []OwnerReference{
+						{APIVersion: "example.com/v1", Kind: "MyApp", Name: "my-app", UID: "d9607e19", Controller: boolPtr(true)},
+					},
+				},
+				Data: kvMap{"file.txt": b64("secret\n")},
+			},
+			false,
+		},
+		{
+			"InvalidOwnerReferences",
+			args{
+				SopsSecretGenerator{
+					TypeMeta: TypeMeta{
+						APIVersion: "goabout/v1beta1",
+						Kind:       "SopsSecretGenerator",
+					},
+					ObjectMeta: ObjectMeta{
+						Name:            "secret",
+						OwnerReferences: []OwnerReference{{Kind: "MyApp", Name: "my-app"}},
+					},
+					FileSources: sources("testdata/file.txt"),
+				},
+				Options{},
+			},
+			Secret{},
+			true,
+		},
+		{
+			"HashKeys",
+			args{
+				SopsSecretGenerator{
+					TypeMeta: TypeMeta{
+						APIVersion: "goabout/v1beta1",
+						Kind:       "SopsSecretGenerator",
+					},
+					ObjectMeta: ObjectMeta{
+						Name: "secret",
+					},
+					FileSources: sources("testdata/file.txt", "testdata/file2.txt"),
+					HashKeys:    []string{"file.txt"},
+				},
+				Options{},
+			},
+			Secret{
+				TypeMeta: TypeMeta{
+					APIVersion: "v1",
+					Kind:       "Secret",
+				},
+				ObjectMeta: ObjectMeta{
+					Name:        "secret-7gd94gtc2h",
+					Annotations: kvMap{},
+				},
+				Data: kvMap{"file.txt": b64("secret\n"), "file2.txt": b64("secret2\n")},
+			},
+			false,
+		},
+		{
+			"HashKeysMissing",
+			args{
+				SopsSecretGenerator{
+					TypeMeta: TypeMeta{
+						APIVersion: "goabout/v1beta1",
+						Kind:       "SopsSecretGenerator",
+					},
+					ObjectMeta: ObjectMeta{
+						Name: "secret",
+					},
+					FileSources: sources("testdata/file.txt"),
+					HashKeys:    []string{"missing.txt"},
+				},
+				Options{},
+			},
+			Secret{},
+			true,
+		},
+		{
+			"AnnotateProvenance",
+			args{
+				SopsSecretGenerator{
+					TypeMeta: TypeMeta{
+						APIVersion: "goabout/v1beta1",
+						Kind:       "SopsSecretGenerator",
+					},
+					ObjectMeta: ObjectMeta{
+						Name: "secret",
+					},
+					EnvSources:  sources("testdata/vars.env"),
+					FileSources: sources("testdata/file.txt", "file3.txt=testdata/file2.txt"),
+				},
+				Options{AnnotateProvenance: true},
+			},
+			Secret{
+				TypeMeta: TypeMeta{
+					APIVersion: "v1",
+					Kind:       "Secret",
+				},
+				ObjectMeta: ObjectMeta{
+					Name: "secret",
+					Annotations: kvMap{
+						"kustomize.config.k8s.io/needs-hash":           "true",
+						"sopssecretgenerator.goabout.com/sources":      "testdata/vars.env,testdata/file.txt,testdata/file2.txt",
+						"sopssecretgenerator.goabout.com/generated-at": "2019-09-12T23:20:43Z",
+					},
+				},
+				Data: kvMap{"VAR_ENV": b64("val_env"), "file.txt": b64("secret\n"), "file3.txt": b64("secret2\n")},
+			},
+			false,
+		},
+		{
+			"AnnotateProvenanceNameHash",
+			args{
+				SopsSecretGenerator{
+					TypeMeta: TypeMeta{
+						APIVersion: "goabout/v1beta1",
+						Kind:       "SopsSecretGenerator",
+					},
+					ObjectMeta: ObjectMeta{
+						Name: "secret",
+					},
+					FileSources: sources("testdata/file.txt"),
+				},
+				Options{AnnotateProvenance: true, AppendNameHash: true},
+			},
+			Secret{
+				TypeMeta: TypeMeta{
+					APIVersion: "v1",
+					Kind:       "Secret",
+				},
+				ObjectMeta: ObjectMeta{
+					Name: "secret-7gd94gtc2h",
+					Annotations: kvMap{
+						"sopssecretgenerator.goabout.com/sources":      "testdata/file.txt",
+						"sopssecretgenerator.goabout.com/generated-at": "2019-09-12T23:20:43Z",
+					},
+				},
+				Data: kvMap{"file.txt": b64("secret\n")},
+			},
+			false,
+		},
+		{
+			"DisableNameSuffixHashOption",
+			args{
+				SopsSecretGenerator{
+					TypeMeta: TypeMeta{
+						APIVersion: "goabout/v1beta1",
+						Kind:       "SopsSecretGenerator",
+					},
+					ObjectMeta: ObjectMeta{
+						Name: "secret",
+					},
+					FileSources: sources("testdata/file.txt"),
+				},
+				Options{DisableNameSuffixHash: boolPtr(true)},
+			},
+			Secret{
+				TypeMeta: TypeMeta{
+					APIVersion: "v1",
+					Kind:       "Secret",
+				},
+				ObjectMeta: ObjectMeta{
+					Name:        "secret",
+					Annotations: kvMap{},
+				},
+				Data: kvMap{"file.txt": b64("secret\n")},
+			},
+			false,
+		},
+		{
+			"EnableNameSuffixHashOption",
+			args{
+				SopsSecretGenerator{
+					TypeMeta: TypeMeta{
+						APIVersion: "goabout/v1beta1",
+						Kind:       "SopsSecretGenerator",
+					},
+					ObjectMeta: ObjectMeta{
+						Name: "secret",
+					},
+					FileSources:           sources("testdata/file.txt"),
+					DisableNameSuffixHash: true,
+				},
+				Options{DisableNameSuffixHash: boolPtr(false)},
+			},
+			Secret{
+				TypeMeta: TypeMeta{
+					APIVersion: "v1",
+					Kind:       "Secret",
+				},
+				ObjectMeta: ObjectMeta{
+					Name:        "secret",
+					Annotations: kvMap{"kustomize.config.k8s.io/needs-hash": "true"},
+				},
+				Data: kvMap{"file.txt": b64("secret\n")},
+			},
+			false,
+		},
+		{
+			"InvalidEncoding",
+			args{
+				SopsSecretGenerator{
+					TypeMeta: TypeMeta{
+						APIVersion: "goabout/v1beta1",
+						Kind:       "SopsSecretGenerator",
+					},
+					ObjectMeta: ObjectMeta{
+						Name: "secret",
+					},
+					FileSources: sources("testdata/file.txt"),
+					Encoding:    "hex",
+				},
+				Options{},
+			},
+			Secret{},
+			true,
+		},
+		{
+			"InvalidSources",
+			args{
+				SopsSecretGenerator{
+					TypeMeta: TypeMeta{
+						APIVersion: "goabout/v1beta1",
+						Kind:       "SopsSecretGenerator",
+					},
+					ObjectMeta: ObjectMeta{
+						Name: "secret",
+					},
+					FileSources: sources("testdata/missing.txt"),
+				},
+				Options{},
+			},
+			Secret{},
+			true,
+		},
+		{
+			"ConfigMapKeys",
+			args{
+				SopsSecretGenerator{
+					TypeMeta: TypeMeta{
+						APIVersion: "goabout/v1beta1",
+						Kind:       "SopsSecretGenerator",
+					},
+					ObjectMeta: ObjectMeta{
+						Name:      "secret",
+						Namespace: "default",
+						Labels:    kvMap{"label": "value"},
+					},
+					EnvSources:    sources("testdata/vars.env"),
+					FileSources:   sources("testdata/file.txt"),
+					ConfigMapKeys: []string{"VAR_ENV"},
+				},
+				Options{},
+			},
+			Secret{
+				TypeMeta: TypeMeta{
+					APIVersion: "v1",
+					Kind:       "Secret",
+				},
+				ObjectMeta: ObjectMeta{
+					Name:        "secret",
+					Namespace:   "default",
+					Labels:      kvMap{"label": "value"},
+					Annotations: kvMap{"kustomize.config.k8s.io/needs-hash": "true"},
+				},
+				Data: kvMap{"file.txt": b64("secret\n")},
+				configMap: &ConfigMap{
+					TypeMeta: TypeMeta{
+						APIVersion: "v1",
+						Kind:       "ConfigMap",
+					},
+					ObjectMeta: ObjectMeta{
+						Name:        "secret",
+						Namespace:   "default",
+						Labels:      kvMap{"label": "value"},
+						Annotations: kvMap{"kustomize.config.k8s.io/needs-hash": "true"},
+					},
+					Data: kvMap{"VAR_ENV": "val_env"},
+				},
+			},
+			false,
+		},
+		{
+			"ConfigMapKeysMissing",
+			args{
+				SopsSecretGenerator{
+					TypeMeta: TypeMeta{
+						APIVersion: "goabout/v1beta1",
+						Kind:       "SopsSecretGenerator",
+					},
+					ObjectMeta: ObjectMeta{
+						Name: "secret",
+					},
+					FileSources:   sources("testdata/file.txt"),
+					ConfigMapKeys: []string{"VAR_ENV"},
+				},
+				Options{},
+			},
+			Secret{},
+			true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Run(tt.name, func(t *testing.T) {
+				got, err := generateSecret(context.Background(), tt.args.sopsSecret, tt.args.opts)
+				if (err != nil) != tt.wantErr {
+					t.Errorf("generateSecret() error = %v, wantErr %v", err, tt.wantErr)
+					return
+				}
+				if !reflect.DeepEqual(got, tt.want) {
+					t.Errorf("generateSecret() got = %v, want %v", got, tt.want)
+				}
+			})
+		})
+	}
+}
+
+func Test_writeDataFiles(t *testing.T) {
+	type args struct {
+		data kvMap
+	}
+	tests := []struct {
+		name    string
+		args    args
+		wantErr bool
+	}{
+		{"Files", args{kvMap{"VAR": "val", "file.txt": "secret\n"}}, false},
+		{"NoFiles", args{kvMap{}}, false},
+		{"Separator", args{kvMap{"dir/file.txt": "secret\n"}}, true},
+		{"Parent", args{kvMap{"..": "secret\n"}}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir, err := ioutil.TempDir("", "sopssecretgenerator")
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer os.RemoveAll(dir)
+			err = writeDataFiles(tt.args.data, filepath.Join(dir, "secret"))
+			if (err != nil) != tt.wantErr {
+				t.Errorf("writeDataFiles() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if tt.wantErr {
+				return
+			}
+			for k, v := range tt.args.data {
+				fn := filepath.Join(dir, "secret", k)
+				content, err := ioutil.ReadFile(fn)
+				if err != nil {
+					t.Errorf("writeDataFiles() did not write %v: %v", k, err)
+				} else if string(content) != v {
+					t.Errorf("writeDataFiles() wrote %v = %q, want %q", k, content, v)
+				}
+				info, err := os.Stat(fn)
+				if err == nil && runtime.GOOS != "windows" && info.Mode().Perm() != 0600 {
+					t.Errorf("writeDataFiles() wrote %v with mode %v, want 0600", k, info.Mode().Perm())
+				}
+			}
+		})
+	}
+}
+
+func Test_commentLines(t *testing.T) {
+	tests := []struct {
+		name string
+		text string
+		want string
+	}{
+		{"None", "", ""},
+		{"Line", "Generated by SopsSecretGenerator; do not edit", "# Generated by SopsSecretGenerator; do not edit\n"},
+		{"Lines", "Generated\n\ndo not edit\n", "# Generated\n#\n# do not edit\n"},
+		{"Comment", "# Generated", "# Generated\n"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := string(commentLines(tt.text)); got != tt.want {
+				t.Errorf("commentLines() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func Test_wrapData(t *testing.T) {
+	type args struct {
+		data  kvMap
+		width int
+	}
+	tests := []struct {
+		name string
+		args args
+		want kvMap
+	}{
+		{"Off", args{kvMap{"A": "c2VjcmV0Cg=="}, 0}, kvMap{"A": "c2VjcmV0Cg=="}},
+		{"Short", args{kvMap{"A": "c2VjcmV0Cg=="}, 12}, kvMap{"A": "c2VjcmV0Cg=="}},
+		{"Wrapped", args{kvMap{"A": "c2VjcmV0Cg==", "B": ""}, 4}, kvMap{"A": "c2Vj\ncmV0\nCg==", "B": ""}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := wrapData(tt.args.data, tt.args.width); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("wrapData() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func Test_mergeLabels(t *testing.T) {
+	type args struct {
+		common map[string]string
+		labels kvMap
+	}
+	tests := []struct {
+		name string
+		args args
+		want kvMap
+	}{
+		{"NoCommonLabels", args{nil, kvMap{"label": "value"}}, kvMap{"label": "value"}},
+		{"NoLabels", args{map[string]string{"label": "common"}, nil}, kvMap{"label": "common"}},
+		{"SpecWins", args{map[string]string{"label": "common", "team": "ops"}, kvMap{"label": "value"}}, kvMap{"label": "value", "team": "ops"}},
+		{"Neither", args{nil, nil}, nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := mergeLabels(tt.args.common, tt.args.labels); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("mergeLabels() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func Test_addGeneratedAnnotations(t *testing.T) {
+	type args struct {
+		annotations kvMap
+		generated   kvMap
+	}
+	tests := []struct {
+		name    string
+		args    args
+		want    kvMap
+		wantErr bool
+	}{
+		{"Added", args{kvMap{"created-by": "me"}, kvMap{needsHashAnnotation: "true"}}, kvMap{"created-by": "me", needsHashAnnotation: "true"}, false},
+		{"SameValue", args{kvMap{behaviorAnnotation: "merge"}, kvMap{behaviorAnnotation: "merge"}}, kvMap{behaviorAnnotation: "merge"}, false},
+		{"NotGenerated", args{kvMap{needsHashAnnotation: "false"}, kvMap{}}, kvMap{needsHashAnnotation: "false"}, false},
+		{"Conflict", args{kvMap{needsHashAnnotation: "false"}, kvMap{needsHashAnnotation: "true"}}, nil, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := addGeneratedAnnotations(tt.args.annotations, tt.args.generated)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("addGeneratedAnnotations() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if !tt.wantErr && !reflect.DeepEqual(tt.args.annotations, tt.want) {
+				t.Errorf("addGeneratedAnnotations() got = %v, want %v", tt.args.annotations, tt.want)
+			}
+		})
+	}
+}
+
+func Test_base64Encoding(t *testing.T) {
+	type args struct {
+		name string
+	}
+	tests := []struct {
+		name    string
+		args    args
+		want    string
+		wantErr bool
+	}{
+		{"Default", args{""}, "/+8=", false},
+		{"Std", args{"std"}, "/+8=", false},
+		{"URL", args{"url"}, "_-8=", false},
+		{"RawStd", args{"rawstd"}, "/+8", false},
+		{"RawURL", args{"rawurl"}, "_-8", false},
+		{"Unknown", args{"hex"}, "", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			encoding, err := base64Encoding(tt.args.name)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("base64Encoding() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if err != nil {
+				return
+			}
+			if got := encoding.EncodeToString([]byte{0xff, 0xef}); got != tt.want {
+				t.Errorf("base64Encoding() encodes as %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func Test_markStringData(t *testing.T) {
+	stringKeys := make(map[string]bool)
+	markStringData(stringKeys, kvMap{"A": "1", "B": "2"}, true)
+	markStringData(stringKeys, kvMap{"B": "3", "C": "4"}, false)
+	want := map[string]bool{"A": true}
+	if !reflect.DeepEqual(stringKeys, want) {
+		t.Errorf("markStringData() got = %v, want %v", stringKeys, want)
+	}
+	// Without stringKeys, nothing is recorded
+	markStringData(nil, kvMap{"A": "1"}, true)
+}
+
+func Test_splitStringData(t *testing.T) {
+	type args struct {
+		data       kvMap
+		stringKeys map[string]bool
+	}
+	tests := []struct {
+		name     string
+		args     args
+		want     kvMap
+		wantData kvMap
+		wantErr  bool
+	}{
+		{"None", args{kvMap{"A": "1"}, map[string]bool{}}, nil, kvMap{"A": "1"}, false},
+		{"Split", args{kvMap{"A": "1", "B": "2"}, map[string]bool{"B": true}}, kvMap{"B": "2"}, kvMap{"A": "1"}, false},
+		{"Sanitized", args{kvMap{"A_B": "1"}, map[string]bool{"A/B": true}}, kvMap{"A_B": "1"}, kvMap{}, false},
+		{"Binary", args{kvMap{"A": "\xff"}, map[string]bool{"A": true}}, nil, nil, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := splitStringData(tt.args.data, tt.args.stringKeys)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("splitStringData() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if tt.wantErr {
+				return
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("splitStringData() got = %v, want %v", got, tt.want)
+			}
+			if !reflect.DeepEqual(tt.args.data, tt.wantData) {
+				t.Errorf("splitStringData() data = %v, want %v", tt.args.data, tt.wantData)
+			}
+		})
+	}
+}
+
+func Test_validateSize(t *testing.T) {
+	secret := Secret{
+		ObjectMeta: ObjectMeta{Name: "secret", Labels: kvMap{"app": "x"}},
+		Data:       kvMap{"a": "1234", "b": "12345678", "c": "12", "d": "123456"},
+	}
+	tests := []struct {
+		name    string
+		max     int
+		wantErr string
+	}{
+		{"NoMaximum", 0, ""},
+		{"Exact", 34, ""},
+		{"TooLarge", 33, "secret is 34 bytes, more than the maximum of 33; largest keys: b (8 bytes), d (6 bytes), a (4 bytes)"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := validateSize(secret, tt.max)
+			if tt.wantErr == "" {
+				if err != nil {
+					t.Errorf("validateSize() error = %v, want nil", err)
+				}
+				return
+			}
+			if err == nil || err.Error() != tt.wantErr {
+				t.Errorf("validateSize() error = %v, want %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func Test_validateBehavior(t *testing.T) {
+	tests := []struct {
+		name     string
+		behavior string
+		wantErr  bool
+	}{
+		{"None", "", false},
+		{"Create", "create", false},
+		{"Replace", "replace", false},
+		{"Merge", "merge", false},
+		{"Typo", "replce", true},
+		{"Uppercase", "Merge", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := validateBehavior(tt.behavior); (err != nil) != tt.wantErr {
+				t.Errorf("validateBehavior() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func Test_validateOwnerReferences(t *testing.T) {
+	owner := OwnerReference{APIVersion: "example.com/v1", Kind: "MyApp", Name: "my-app", UID: "d9607e19"}
+	controller := owner
+	controller.Controller = boolPtr(true)
+	tests := []struct {
+		name    string
+		refs    []OwnerReference
+		wantErr bool
+	}{
+		{"None", nil, false},
+		{"Owner", []OwnerReference{owner}, false},
+		{"OneController", []OwnerReference{owner, controller}, false},
+		{"TwoControllers", []OwnerReference{controller, controller}, true},
+		{"MissingAPIVersion", []OwnerReference{{Kind: "MyApp", Name: "my-app", UID: "d9607e19"}}, true},
+		{"MissingKind", []OwnerReference{{APIVersion: "example.com/v1", Name: "my-app", UID: "d9607e19"}}, true},
+		{"MissingName", []OwnerReference{{APIVersion: "example.com/v1", Kind: "MyApp", UID: "d9607e19"}}, true},
+		{"MissingUID", []OwnerReference{{APIVersion: "example.com/v1", Kind: "MyApp", Name: "my-app"}}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := validateOwnerReferences(tt.refs); (err != nil) != tt.wantErr {
+				t.Errorf("validateOwnerReferences() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func Test_validateDecrypted(t *testing.T) {
+	tests := []struct {
+		name    string
+		data    kvMap
+		wantErr bool
+	}{
+		{"Decrypted", kvMap{"VAR": "val", "OTHER": "contains ENC[ later"}, false},
+		{"Empty", kvMap{}, false},
+		{"Encrypted", kvMap{"VAR": "val", "PASSWORD": "ENC[AES256_GCM,data:x,iv:y,tag:z,type:str]"}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := validateDecrypted(tt.data); (err != nil) != tt.wantErr {
+				t.Errorf("validateDecrypted() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func Test_validateKeys(t *testing.T) {
+	type args struct {
+		data     kvMap
+		sanitize bool
+	}
+	tests := []struct {
+		name    string
+		args    args
+		want    kvMap
+		wantErr bool
+	}{
+		{"Valid", args{kvMap{"VAR-1_a.txt": "val"}, false}, kvMap{"VAR-1_a.txt": "val"}, false},
+		{"Invalid", args{kvMap{"config.server@port": "80"}, false}, nil, true},
+		{"Empty", args{kvMap{"": "val"}, true}, nil, true},
+		{"Sanitize", args{kvMap{"config.server@port": "80", "a/b c": "val"}, true}, kvMap{"config.server_port": "80", "a_b_c": "val"}, false},
+		{"SanitizeConflict", args{kvMap{"a@b": "1", "a_b": "2"}, true}, nil, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := validateKeys(tt.args.data, tt.args.sanitize)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("validateKeys() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("validateKeys() got = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func Test_validateSecretData(t *testing.T) {
+	type args struct {
+		secretType string
+		data       kvMap
+	}
+	tests := []struct {
+		name    string
+		args    args
+		wantErr bool
+	}{
+		{"Opaque", args{"", kvMap{"VAR": "val"}}, false},
+		{"BootstrapToken", args{bootstrapTokenType, kvMap{"token-id": "abcdef", "token-secret": "0123456789abcdef"}}, false},
+		{"BootstrapTokenMissingID", args{bootstrapTokenType, kvMap{"token-secret": "0123456789abcdef"}}, true},
+		{"BootstrapTokenMissingSecret", args{bootstrapTokenType, kvMap{"token-id": "abcdef"}}, true},
+		{"BootstrapTokenInvalidID", args{bootstrapTokenType, kvMap{"token-id": "ABCDEF", "token-secret": "0123456789abcdef"}}, true},
+		{"BootstrapTokenInvalidSecret", args{bootstrapTokenType, kvMap{"token-id": "abcdef", "token-secret": "0123456789"}}, true},
+		{"DockerConfigJSON", args{dockerConfigJSONType, kvMap{".dockerconfigjson": `{"auths": {}}`}}, false},
+		{"DockerConfigJSONInvalid", args{dockerConfigJSONType, kvMap{".dockerconfigjson": `{"auths"`}}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := validateSecretData(tt.args.secretType, tt.args.data); (err != nil) != tt.wantErr {
+				t.Errorf("validateSecretData() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func Test_readInput(t *testing.T) {
+	type args struct {
+		fn     string
+		strict bool
+	}
+	tests := []struct {
+		name    string
+		args    args
+		want    SopsSecretGenerator
+		wantErr bool
+	}{
+		{"SopsSecretGenerator", args{"testdata/generator.yaml", false}, ssg(nil, []string{"testdata/file.txt"}), false},
+		{"SopsSecret", args{"testdata/generator-oldkind.yaml", false}, ssg(nil, []string{"testdata/file.txt"}), false},
+		{"SourceObjects", args{"testdata/generator-sources.yaml", false}, SopsSecretGenerator{
+			TypeMeta:              TypeMeta{APIVersion: apiVersion, Kind: kind},
+			ObjectMeta:            ObjectMeta{Name: "secret", Annotations: kvMap{}},
+			DisableNameSuffixHash: true,
+			EnvSources:            []Source{{Path: "testdata/vars.env"}, {Path: "testdata/vars.yaml", Override: true}},
+			FileSources:           []Source{{Path: "testdata/file.txt", Override: true}},
+		}, false},
+		{"GenerateName", args{"testdata/generator-generatename.yaml", false}, SopsSecretGenerator{
+			TypeMeta:    TypeMeta{APIVersion: apiVersion, Kind: kind},
+			ObjectMeta:  ObjectMeta{GenerateName: "secret-", Annotations: kvMap{}},
+			FileSources: sources("testdata/file.txt"),
+		}, false},
+		{"Strict", args{"testdata/generator.yaml", true}, ssg(nil, []string{"testdata/file.txt"}), false},
+		{"UnknownField", args{"testdata/generator-unknownfield.yaml", false}, SopsSecretGenerator{
+			TypeMeta:   TypeMeta{APIVersion: apiVersion, Kind: kind},
+			ObjectMeta: ObjectMeta{Name: "secret", Annotations: kvMap{}},
+		}, false},
+		{"UnknownFieldStrict", args{"testdata/generator-unknownfield.yaml", true}, SopsSecretGenerator{}, true},
+		{"Missing", args{"testdata/missing.yaml", false}, SopsSecretGenerator{}, true},
+		{"NotYaml", args{"testdata/notyaml.txt", false}, SopsSecretGenerator{}, true},
+		{"WrongVersion", args{"testdata/generator-wrongversion.yaml", false}, SopsSecretGenerator{}, true},
+		{"WrongKind", args{"testdata/generator-wrongkind.yaml", false}, SopsSecretGenerator{}, true},
+		{"NoName", args{"testdata/generator-noname.yaml", false}, SopsSecretGenerator{}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			content, _ := ioutil.ReadFile(tt.args.fn)
+			got, err := readInput(content, Options{Strict: tt.args.strict})
+			if (err != nil) != tt.wantErr {
+				t.Errorf("readInput() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("readInput() got = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func Test_parseInput(t *testing.T) {
+	type args struct {
+		input SopsSecretGenerator
+	}
+	tests := []struct {
+		name    string
+		args    args
+		want    kvMap
+		wantErr bool
+	}{
+		{"Input", args{ssg([]string{"testdata/vars.env"}, []string{"testdata/file.txt"})}, kvMap{"VAR_ENV": "val_env", "file.txt": "secret\n"}, false},
+		{"EnvsError", args{ssg([]string{"testdata/file.txt"}, []string{"testdata/file.txt"})}, nil, true},
+		{"FilesError", args{ssg([]string{"testdata/vars.env"}, []string{"testdata/missing.txt"})}, nil, true},
+		{"Collision", args{ssg([]string{"testdata/vars.env"}, []string{"VAR_ENV=testdata/file.txt"})}, nil, true},
+		{"When", args{SopsSecretGenerator{FileSources: []Source{{Path: "testdata/file.txt"}, {Path: "testdata/missing.txt", When: "false"}}}}, kvMap{"file.txt": "secret\n"}, false},
+		{"SourceDir", args{SopsSecretGenerator{SourceDir: SourceDir{Path: "testdata/sourcedir"}}}, kvMap{"VAR_ENV": "val_env", "VAR_YAML": "val_yaml", "file.txt": "secret\n"}, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, _, err := parseInput(context.Background(), tt.args.input, nil, Options{})
+			if (err != nil) != tt.wantErr {
+				t.Errorf("parseInput() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("parseInput() got = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func Test_parseEnvSources(t *testing.T) {
+	type args struct {
+		sources []Source
+		opts    Options
+	}
+	tests := []struct {
+		name    string
+		args    args
+		want    kvMap
+		wantErr bool
+	}{
+		{"Envs", args{sources("testdata/vars.env", "testdata/vars.yaml"), Options{}}, kvMap{"VAR_ENV": "val_env", "VAR_YAML": "val_yaml"}, false},
+		{"NoEnvs", args{[]Source{}, Options{}}, kvMap{}, false},
+		{"Error", args{sources("testdata/missing.env"), Options{}}, kvMap{}, true},
+		{"Collision", args{sources("testdata/vars.env", "testdata/vars.env"), Options{}}, kvMap{}, true},
+		{"Empty", args{sources("testdata/vars-empty.json"), Options{}}, kvMap{}, true},
+		{"AllowEmpty", args{sources("testdata/vars-empty.json"), Options{AllowEmpty: true}}, kvMap{}, false},
+		{"Override", args{[]Source{{Path: "testdata/vars.env"}, {Path: "testdata/vars.env", Override: true}}, Options{}}, kvMap{"VAR_ENV": "val_env"}, false},
+		{"InvalidValueEncoding", args{[]Source{{Path: "testdata/vars.yaml", ValueEncoding: "xml"}}, Options{}}, kvMap{}, true},
+		{"Plain", args{[]Source{{Path: "testdata/vars.env"}, {Path: "testdata/plain.env", Plain: true}}, Options{}}, kvMap{"VAR_ENV": "val_env", "LOG_LEVEL": "info"}, false},
+		{"Optional", args{[]Source{{Path: "testdata/plain.env", Plain: true}, {Path: "testdata/missing.env", Optional: true}}, Options{}}, kvMap{"LOG_LEVEL": "info"}, false},
+		{
+			"Affixes",
+			args{[]Source{{Path: "testdata/plain.env", Plain: true, Prefix: "APP_"}, {Path: "testdata/plain.env", Plain: true, Prefix: "DB_", Suffix: "_1"}}, Options{}},
+			kvMap{"APP_LOG_LEVEL": "info", "DB_LOG_LEVEL_1": "info"},
+			false,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := make(kvMap)
+			_, err := parseEnvSources(context.Background(), tt.args.sources, got, nil, tt.args.opts)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("parseEnvSources() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("parseEnvSources() got = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func Test_parseEnvSources_AllErrors(t *testing.T) {
+	_, err := parseEnvSources(context.Background(), sources("testdata/missing.env", "testdata/vars.env", "testdata/missing.yaml"), make(kvMap), nil, Options{AllErrors: true})
+	if err == nil {
+		t.Fatal("parseEnvSources() error = nil, want an error")
+	}
+	for _, fn := range []string{"testdata/missing.env", "testdata/missing.yaml"} {
+		if !strings.Contains(err.Error(), fn) {
+			t.Errorf("parseEnvSources() error = %v, want an error for %v", err, fn)
+		}
+	}
+}
+
+func Test_parseEnvSource(t *testing.T) {
+	type args struct {
+		source string
+	}
+	tests := []struct {
+		name    string
+		args    args
+		want    kvMap
+		wantErr bool
+	}{
+		{"DotEnv", args{"testdata/vars.env"}, kvMap{"VAR_ENV": "val_env"}, false},
+		{"YAML", args{"testdata/vars.yaml"}, kvMap{"VAR_YAML": "val_yaml"}, false},
+		{"JSON", args{"testdata/vars.json"}, kvMap{"VAR_JSON": "val_json"}, false},
+		{"XML", args{"testdata/config.xml"}, kvMap{"config.database.host": "db.example.com", "config.database.password": "val_xml"}, false},
+		{"INI", args{"testdata/config.ini"}, kvMap{"TOKEN": "top", "database.host": "db.example.com", "database.password": "val_ini"}, false},
+		{"TOML", args{"testdata/vars.toml"}, kvMap{"VAR_TOML": "val_toml"}, false},
+		{"Properties", args{"testdata/vars.properties"}, kvMap{"var.properties": "val_properties"}, false},
+		{"PartialYAML", args{"testdata/vars-partial.yaml"}, kvMap{"VAR_PARTIAL": "val_partial", "HOST_unencrypted": "db.example.com"}, false},
+		{"PartialJSON", args{"testdata/vars-partial.json"}, kvMap{"VAR_PARTIAL": "val_partial", "HOST_unencrypted": "db.example.com"}, false},
+		{"Binary", args{"testdata/file.txt"}, kvMap{}, true},
+		{"Missing", args{"testdata/missing.txt"}, kvMap{}, true},
+		{"NotSops", args{"testdata/empty.txt"}, kvMap{}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := make(kvMap)
+			_, err := parseEnvSource(context.Background(), Source{Path: tt.args.source}, got, Options{})
+			if (err != nil) != tt.wantErr {
+				t.Errorf("parseEnvSource() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("parseEnvSource() got = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func Test_decrypt(t *testing.T) {
+	canceled, cancel := context.WithCancel(context.Background())
+	cancel()
+	content, err := ioutil.ReadFile("testdata/file.txt")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	type args struct {
+		ctx context.Context
+	}
+	tests := []struct {
+		name    string
+		args    args
+		want    string
+		wantErr bool
+	}{
+		{"Decrypt", args{context.Background()}, "secret\n", false},
+		{"Canceled", args{canceled}, "", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := decrypt(tt.args.ctx, content, "binary", Options{})
+			if (err != nil) != tt.wantErr {
+				t.Errorf("decrypt() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if string(got) != tt.want {
+				t.Errorf("decrypt() got = %v, want %v", string(got), tt.want)
+			}
+		})
+	}
+}
+
+func Test_validateUTF8(t *testing.T) {
+	tests := []struct {
+		name    string
+		content []byte
+		wantErr string
+	}{
+		{"Empty", b(""), ""},
+		{"ASCII", b("VAR: val\n"), ""},
+		{"Multibyte", b("VAR: vál€\n"), ""},
+		{"Invalid", []byte("VAR: v\xffal\n"), "invalid UTF-8 byte 0xff at offset 6"},
+		{"Truncated", []byte("VAR: \xe2\x82"), "invalid UTF-8 byte 0xe2 at offset 5"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := validateUTF8(tt.content)
+			if tt.wantErr == "" {
+				if err != nil {
+					t.Errorf("validateUTF8() error = %v, want nil", err)
+				}
+				return
+			}
+			if err == nil || err.Error() != tt.wantErr {
+				t.Errorf("validateUTF8() error = %v, want %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func Test_parseDotEnvContent(t *testing.T) {
+	type args struct {
+		content []byte
+		unquote bool
+	}
+	tests := []struct {
+		name    string
+		args    args
+		want    kvMap
+		wantErr bool
+	}{
+		{"Variables", args{b("VAR1=val1\nVAR2=val2"), false}, kvMap{"VAR1": "val1", "VAR2": "val2"}, false},
+		{"StringBOM", args{append(utf8bom, b("VAR=val")...), false}, kvMap{"VAR": "val"}, false},
+		{"Quoted", args{b(`VAR="val"`), false}, kvMap{"VAR": `"val"`}, false},
+		{"Unquote", args{b(`VAR="val"`), true}, kvMap{"VAR": "val"}, false},
+		{"UnquoteEscapes", args{b(`VAR="a \"b\" c\\" `), true}, kvMap{"VAR": `a "b" c\`}, false},
+		{"UnquoteTextAfterQuote", args{b(`VAR="a"b`), true}, kvMap{"VAR": `"a"b`}, false},
+		{"UnquoteEmpty", args{b(`VAR=""`), true}, kvMap{"VAR": ""}, false},
+		{"UnquoteMultiline", args{b("VAR1=\"line1\nline2\"\nVAR2=\"val2\""), true}, kvMap{"VAR1": "line1\nline2", "VAR2": "val2"}, false},
+		{"Multiline", args{b("VAR1=\"line1\nline2\nline3\"\nVAR2=val2"), false}, kvMap{"VAR1": "line1\nline2\nline3", "VAR2": "val2"}, false},
+		{"MultilineEscapes", args{b("VAR=\"a \\\"b\\\"\nc\\\\\""), false}, kvMap{"VAR": "a \"b\"\nc\\"}, false},
+		{"MultilineComment", args{b("VAR=\"line1\n# line2\"\n# Comment"), false}, kvMap{"VAR": "line1\n# line2"}, false},
+		{"Unterminated", args{b("VAR1=\"line1\nVAR2=val2"), false}, kvMap{}, true},
+		{"TextAfterQuote", args{b("VAR=\"line1\nline2\" extra"), false}, kvMap{}, true},
+		{"Empty", args{b(""), false}, kvMap{}, false},
+		{"InvalidLine", args{b("VAR"), false}, kvMap{}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := make(kvMap)
+			err := parseDotEnvContent(tt.args.content, got, tt.args.unquote)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("parseDotEnvContent() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("parseDotEnvContent() got = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func Test_parseDotEnvLine(t *testing.T) {
+	type args struct {
+		line []byte
+	}
+	tests := []struct {
+		name    string
+		args    args
+		want    kvMap
+		wantErr bool
+	}{
+		{"Variable", args{b("VAR=value")}, kvMap{"VAR": "value"}, false},
+		{"TrimLeft", args{b(" VAR=value")}, kvMap{"VAR": "value"}, false},
+		{"EmptyLine", args{b("")}, kvMap{}, false},
+		{"Comment", args{b("# Comment")}, kvMap{}, false},
+		{"NoValue", args{b("VAR")}, kvMap{}, true},
+		{"InvalidUTF8", args{[]byte{0xff, 0xfe, 0xfd}}, kvMap{}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := make(kvMap)
+			err := parseDotEnvLine(tt.args.line, got, false)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("parseDotEnvLine() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("parseDotEnvLine() got = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func Test_parseYAMLContent(t *testing.T) {
+	type args struct {
+		content       []byte
+		valueEncoding string
+	}
+	tests := []struct {
+		name      string
+		args      args
+		want      kvMap
+		wantOrder []string
+		wantErr   bool
+	}{
+		{"Variables", args{b("VAR1: val1\nVAR2: val2"), ""}, kvMap{"VAR1": "val1", "VAR2": "val2"}, []string{"VAR1", "VAR2"}, false},
+		{"Order", args{b("B: val1\nA: val2\nC: val3"), ""}, kvMap{"A": "val2", "B": "val1", "C": "val3"}, []string{"B", "A", "C"}, false},
+		{"Null", args{b("VAR:"), ""}, kvMap{"VAR": ""}, []string{"VAR"}, false},
+		{"SopsMetadata", args{b("VAR: val\nsops:\n  version: 3.4.0"), ""}, kvMap{"VAR": "val"}, []string{"VAR"}, false},
+		{"KeysNextToSopsMetadata", args{b("VAR: val\nmac: value\nlastmodified: '2019-09-12T23:26:27Z'\nsops:\n  version: 3.4.0"), ""}, kvMap{"VAR": "val", "mac": "value", "lastmodified": "2019-09-12T23:26:27Z"}, []string{"VAR", "mac", "lastmodified"}, false},
+		{"MacWithoutSops", args{b("VAR: val\nmac: value"), ""}, kvMap{"VAR": "val", "mac": "value"}, []string{"VAR", "mac"}, false},
+		{"Empty", args{b(""), ""}, kvMap{}, []string{}, false},
+		{"InvalidSyntax", args{b("VAR:val"), ""}, kvMap{}, nil, true},
+		{"InvalidType", args{b("VAR: [1, 2]"), ""}, kvMap{}, nil, true},
+		{"Scalars", args{b("PORT: 5432\nRATIO: 0.5\nENABLED: true\nBIG: 9007199254740993"), ""}, kvMap{"PORT": "5432", "RATIO": "0.5", "ENABLED": "true", "BIG": "9007199254740993"}, []string{"PORT", "RATIO", "ENABLED", "BIG"}, false},
+		{"ScalarsAsWritten", args{b("OCTAL: 01234\nFLOAT: 1.10\nBOOL: yes\nEXPONENT: 1e3\nHEX: 0x1F"), ""}, kvMap{"OCTAL": "01234", "FLOAT": "1.10", "BOOL": "yes", "EXPONENT": "1e3", "HEX": "0x1F"}, []string{"OCTAL", "FLOAT", "BOOL", "EXPONENT", "HEX"}, false},
+		{"NestedScalarsAsJSON", args{b("MAP:\n  octal: 01234\n  float: 1.10\n  bool: yes\n"), "json"}, kvMap{"MAP": `{"octal":668,"float":1.1,"bool":true}`}, []string{"MAP"}, false},
+		{"KeysAsWritten", args{b("1: a\nNO: b\non: c\n01: d\n~: e"), ""}, kvMap{"1": "a", "NO": "b", "on": "c", "01": "d", "": "e"}, []string{"1", "NO", "on", "01", ""}, false},
+		{"QuotedKey", args{b("1: a\n\"1\": b"), ""}, kvMap{"1": "b"}, []string{"1"}, false},
+		{"DuplicateKey", args{b("A: val1\nB: val2\nA: val3"), ""}, kvMap{"A": "val3", "B": "val2"}, []string{"A", "B"}, false},
+		{"ComplexKey", args{b("? [a, b]\n: val"), ""}, kvMap{}, nil, true},
+		{"JSONValues", args{b("LIST: [a, 1]\nMAP:\n  b: true\n  a: null\nVAR: val"), "json"}, kvMap{"LIST": `["a",1]`, "MAP": `{"b":true,"a":null}`, "VAR": "val"}, []string{"LIST", "MAP", "VAR"}, false},
+		{"YAMLValues", args{b("LIST: [a, 1]\nMAP:\n  b: true\nPORT: 5432"), "yaml"}, kvMap{"LIST": "- a\n- 1\n", "MAP": "b: true\n", "PORT": "5432"}, []string{"LIST", "MAP", "PORT"}, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := make(kvMap)
+			order, err := parseYAMLContent(tt.args.content, got, tt.args.valueEncoding, "")
+			if (err != nil) != tt.wantErr {
+				t.Errorf("parseYAMLContent() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("parseYAMLContent() got = %v, want %v", got, tt.want)
+			}
+			if !reflect.DeepEqual(order, tt.wantOrder) {
+				t.Errorf("parseYAMLContent() order = %v, want %v", order, tt.wantOrder)
+			}
+		})
+	}
+}
+
+func Test_parseJsonContent(t *testing.T) {
+	type args struct {
+		content       []byte
+		valueEncoding string
+		index         *int
+	}
+	credentials := b(`[{"user": "a", "password": "pa"}, {"user": "b", "password": "pb"}, "c"]`)
+	tests := []struct {
+		name    string
+		args    args
+		want    kvMap
+		wantErr bool
+	}{
+		{"Variables", args{b(`{"VAR1": "val1", "VAR2": "val2"}`), "", nil}, kvMap{"VAR1": "val1", "VAR2": "val2"}, false},
+		{"SopsMetadata", args{b(`{"VAR": "val", "sops": {"version": "3.4.0"}}`), "", nil}, kvMap{"VAR": "val"}, false},
+		{"KeysNextToSopsMetadata", args{b(`{"VAR": "val", "mac": "value", "lastmodified": "2019-09-12T23:26:27Z", "sops": {}}`), "", nil}, kvMap{"VAR": "val", "mac": "value", "lastmodified": "2019-09-12T23:26:27Z"}, false},
+		{"Empty", args{b(`{}`), "", nil}, kvMap{}, false},
+		{"InvalidSyntax", args{b(`{"VAR"}`), "", nil}, kvMap{}, true},
+		{"InvalidType", args{b(`{"VAR": ["val"]}`), "", nil}, kvMap{}, true},
+		{"JSONValues", args{b(`{"LIST": ["val", 1], "NUM": 2, "VAR": "val"}`), "json", nil}, kvMap{"LIST": `["val",1]`, "NUM": "2", "VAR": "val"}, false},
+		{"Numbers", args{b(`{"BIG": 123456789012345678, "EXP": 1e21, "RATIO": 0.5}`), "", nil}, kvMap{"BIG": "123456789012345678", "EXP": "1e21", "RATIO": "0.5"}, false},
+		{"JSONNumbers", args{b(`{"LIST": [123456789012345678, 1e21]}`), "json", nil}, kvMap{"LIST": "[123456789012345678,1e21]"}, false},
+		{"TrailingData", args{b(`{"VAR": "val"} {}`), "", nil}, kvMap{}, true},
+		{"Array", args{credentials, "", nil}, kvMap{}, true},
+		{"Index", args{credentials, "", intPtr(1)}, kvMap{"user": "b", "password": "pb"}, false},
+		{"IndexOutOfRange", args{credentials, "", intPtr(3)}, kvMap{}, true},
+		{"IndexNegative", args{credentials, "", intPtr(-1)}, kvMap{}, true},
+		{"IndexNotObject", args{credentials, "", intPtr(2)}, kvMap{}, true},
+		{"IndexNotArray", args{b(`{"VAR": "val"}`), "", intPtr(0)}, kvMap{}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := make(kvMap)
+			err := parseJSONContent(tt.args.content, got, tt.args.valueEncoding, tt.args.index, "")
+			if (err != nil) != tt.wantErr {
+				t.Errorf("parseJSONContent() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("parseJSONContent() got = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func Test_mergeSourceData(t *testing.T) {
+	type args struct {
+		data       kvMap
+		sourceData kvMap
+		order      []string
+		override   bool
+	}
+	tests := []struct {
+		name      string
+		args      args
+		want      kvMap
+		wantAdded []string
+		wantErr   bool
+	}{
+		{"Sorted", args{kvMap{}, kvMap{"B": "b", "A": "a"}, nil, false}, kvMap{"A": "a", "B": "b"}, []string{"A", "B"}, false},
+		{"Ordered", args{kvMap{}, kvMap{"B": "b", "A": "a"}, []string{"B", "A"}, false}, kvMap{"A": "a", "B": "b"}, []string{"B", "A"}, false},
+		{"Collision", args{kvMap{"A": "old"}, kvMap{"A": "a"}, nil, false}, kvMap{"A": "old"}, nil, true},
+		{"PartialCollision", args{kvMap{"B": "old"}, kvMap{"A": "a", "B": "b"}, nil, false}, kvMap{"B": "old"}, nil, true},
+		{"Override", args{kvMap{"A": "old"}, kvMap{"A": "a", "B": "b"}, nil, true}, kvMap{"A": "a", "B": "b"}, []string{"B"}, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			added, err := mergeSourceData(tt.args.data, tt.args.sourceData, tt.args.order, tt.args.override)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("mergeSourceData() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if !reflect.DeepEqual(tt.args.data, tt.want) {
+				t.Errorf("mergeSourceData() data = %v, want %v", tt.args.data, tt.want)
+			}
+			if !reflect.DeepEqual(added, tt.wantAdded) {
+				t.Errorf("mergeSourceData() added = %v, want %v", added, tt.wantAdded)
+			}
+		})
+	}
+}
+
+func Test_parseFileSources(t *testing.T) {
+	type args struct {
+		sources []Source
+		opts    Options
+	}
+	tests := []struct {
+		name    string
+		args    args
+		want    kvMap
+		wantErr bool
+	}{
+		{"Files", args{sources("testdata/file.txt", "testdata/file2.txt"), Options{}}, kvMap{"file.txt": "secret\n", "file2.txt": "secret2\n"}, false},
+		{"NoFiles", args{[]Source{}, Options{}}, kvMap{}, false},
+		{"Error", args{sources("testdata/missing.txt"), Options{}}, kvMap{}, true},
+		{"Collision", args{sources("testdata/file.txt", "file.txt=testdata/file2.txt"), Options{}}, kvMap{}, true},
+		{"Optional", args{[]Source{{Path: "testdata/plain.txt", Plain: true}, {Path: "key=testdata/missing.txt", Optional: true}}, Options{}}, kvMap{"plain.txt": "public\n"}, false},
+		{"Override", args{[]Source{{Path: "testdata/file.txt"}, {Path: "file.txt=testdata/file2.txt", Override: true}}, Options{}}, kvMap{"file.txt": "secret2\n"}, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := make(kvMap)
+			_, err := parseFileSources(context.Background(), tt.args.sources, got, nil, tt.args.opts)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("parseFileSources() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("parseFileSources() got = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func Test_parseFileSources_AllErrors(t *testing.T) {
+	_, err := parseFileSources(context.Background(), sources("testdata/missing.txt", "testdata/file.txt", "testdata/missing2.txt"), make(kvMap), nil, Options{AllErrors: true})
+	if err == nil {
+		t.Fatal("parseFileSources() error = nil, want an error")
+	}
+	for _, fn := range []string{"testdata/missing.txt", "testdata/missing2.txt"} {
+		if !strings.Contains(err.Error(), fn) {
+			t.Errorf("parseFileSources() error = %v, want an error for %v", err, fn)
+		}
+	}
+}
+
+func Test_parseFileSource(t *testing.T) {
+	type args struct {
+		source Source
+	}
+	tests := []struct {
+		name    string
+		args    args
+		want    kvMap
+		wantErr bool
+	}{
+		{"File", args{Source{Path: "testdata/file.txt"}}, kvMap{"file.txt": "secret\n"}, false},
+		{"MissingFile", args{Source{Path: "testdata/missing.txt"}}, kvMap{}, true},
+		{"InvalidName", args{Source{Path: "=testdata/file.txt"}}, kvMap{}, true},
+		{"NotSopsFile", args{Source{Path: "testdata/empty.txt"}}, kvMap{}, true},
+		{"Plain", args{Source{Path: "testdata/plain.txt", Plain: true}}, kvMap{"plain.txt": "public\n"}, false},
+		{"Checksum", args{Source{Path: "testdata/plain.txt", Plain: true, Checksum: "sha256:cde1925e8f892f5ddaadebfecbdd060398f5d76d3d19224f60d08343d3bbde20"}}, kvMap{"plain.txt": "public\n"}, false},
+		{"Key", args{Source{Path: "testdata/plain.txt", Key: "public.txt", Plain: true}}, kvMap{"public.txt": "public\n"}, false},
+		{"UnknownFormat", args{Source{Path: "testdata/plain.txt", Format: "hcl", Plain: true}}, kvMap{}, true},
+		{"ChecksumMismatch", args{Source{Path: "testdata/plain.txt", Plain: true, Checksum: "sha256:0000000000000000000000000000000000000000000000000000000000000000"}}, kvMap{}, true},
+		{"DecodeBase64", args{Source{Path: "testdata/file-base64.txt", DecodeBase64: true}}, kvMap{"file-base64.txt": "\x00\x01\x02\xff"}, false},
+		{"DecodeInvalidBase64", args{Source{Path: "testdata/file.txt", DecodeBase64: true}}, kvMap{}, true},
+		{"Extract", args{Source{Path: "testdata/vars.json#VAR_JSON"}}, kvMap{"VAR_JSON": "val_json"}, false},
+		{"ExtractKey", args{Source{Path: "key=testdata/vars.yaml#VAR_YAML"}}, kvMap{"key": "val_yaml"}, false},
+		{"ExtractMissing", args{Source{Path: "testdata/vars.json#MISSING"}}, kvMap{}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := make(kvMap)
+			err := parseFileSource(context.Background(), tt.args.source, got, Options{})
+			if (err != nil) != tt.wantErr {
+				t.Errorf("parseFileSource() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("parseFileSource() got = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func Test_affixKeys(t *testing.T) {
+	data, order := affixKeys(kvMap{"a": "1", "b": "2"}, []string{"b", "a"}, "P_", "_S")
+	if want := (kvMap{"P_a_S": "1", "P_b_S": "2"}); !reflect.DeepEqual(data, want) {
+		t.Errorf("affixKeys() data = %v, want %v", data, want)
+	}
+	if want := []string{"P_b_S", "P_a_S"}; !reflect.DeepEqual(order, want) {
+		t.Errorf("affixKeys() order = %v, want %v", order, want)
+	}
+	if _, order := affixKeys(kvMap{"a": "1"}, nil, "P_", ""); order != nil {
+		t.Errorf("affixKeys() order = %v, want nil", order)
+	}
+}
+
+func Test_expandVars(t *testing.T) {
+	_ = os.Setenv("SOPSSECRETGENERATOR_TEST_DIR", "/base")
+	defer os.Unsetenv("SOPSSECRETGENERATOR_TEST_DIR")
+	_ = os.Unsetenv("SOPSSECRETGENERATOR_TEST_UNDEFINED")
+
+	type args struct {
+		data           kvMap
+		undefinedError bool
+	}
+	tests := []struct {
+		name    string
+		args    args
+		want    kvMap
+		wantErr bool
+	}{
+		{"Braces", args{kvMap{"VAR": "${SOPSSECRETGENERATOR_TEST_DIR}/config"}, false}, kvMap{"VAR": "/base/config"}, false},
+		{"Plain", args{kvMap{"VAR": "$SOPSSECRETGENERATOR_TEST_DIR"}, false}, kvMap{"VAR": "/base"}, false},
+		{"Escape", args{kvMap{"VAR": "pa$$word"}, false}, kvMap{"VAR": "pa$word"}, false},
+		{"Undefined", args{kvMap{"VAR": "a${SOPSSECRETGENERATOR_TEST_UNDEFINED}b"}, false}, kvMap{"VAR": "ab"}, false},
+		{"UndefinedError", args{kvMap{"VAR": "${SOPSSECRETGENERATOR_TEST_UNDEFINED}"}, true}, nil, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := expandVars(tt.args.data, tt.args.undefinedError)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("expandVars() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if !tt.wantErr && !reflect.DeepEqual(tt.args.data, tt.want) {
+				t.Errorf("expandVars() got = %v, want %v", tt.args.data, tt.want)
+			}
+		})
+	}
+}
+
+func Test_emptySource(t *testing.T) {
+	type args struct {
+		opts Options
+	}
+	tests := []struct {
+		name        string
+		args        args
+		wantWarning string
+		wantErr     bool
+	}{
+		{"Error", args{Options{}}, "", true},
+		{"AllowEmpty", args{Options{AllowEmpty: true}}, "Warning: file source empty.txt is empty\n", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var warnings bytes.Buffer
+			tt.args.opts.Warnings = &warnings
+			err := emptySource("file", "empty.txt", tt.args.opts)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("emptySource() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if warnings.String() != tt.wantWarning {
+				t.Errorf("emptySource() warning = %q, want %q", warnings.String(), tt.wantWarning)
+			}
+		})
+	}
+}
+
+func Test_decodeBase64(t *testing.T) {
+	tests := []struct {
+		name    string
+		content []byte
+		want    []byte
+		wantErr bool
+	}{
+		{"Base64", b("c2VjcmV0Cg=="), b("secret\n"), false},
+		{"Lines", b("AAEC\n/w==\n"), []byte{0, 1, 2, 255}, false},
+		{"Invalid", b("secret\n"), nil, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := decodeBase64(tt.content)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("decodeBase64() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if !bytes.Equal(got, tt.want) {
+				t.Errorf("decodeBase64() got = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func Test_parseFileName(t *testing.T) {
+	type args struct {
+		source string
+	}
+	tests := []struct {
+		name     string
+		args     args
+		wantKey  string
+		wantFile string
+		wantErr  bool
+	}{
+		{"WithoutDirectory", args{"filename"}, "filename", "filename", false},
+		{"WithDirectory", args{"directory/filename"}, "filename", "directory/filename", false},
+		{"ExplicitKey", args{"key=filename"}, "key", "filename", false},
+		{"MissingKey", args{"=filename"}, "", "", true},
+		{"MissingFilename", args{"key="}, "", "", true},
+		{"TooManyEqualSigns", args{"key=filename=extra"}, "", "", true},
+		{"Extract", args{"secrets.yaml#stripe.apiKey"}, "apiKey", "secrets.yaml#stripe.apiKey", false},
+		{"ExtractSopsSyntax", args{"secrets.json#[\"servers\"][0]"}, "0", "secrets.json#[\"servers\"][0]", false},
+		{"ExtractKey", args{"key=secrets.yaml#stripe.apiKey"}, "key", "secrets.yaml#stripe.apiKey", false},
+		{"HashInName", args{"notes#1.txt"}, "notes#1.txt", "notes#1.txt", false},
+		{"Git", args{"git::https://example.com/secrets.git//app/tls.crt?ref=v1"}, "tls.crt", "git::https://example.com/secrets.git//app/tls.crt?ref=v1", false},
+		{"GitKey", args{"cert=git::https://example.com/secrets.git//tls.crt?ref=v1"}, "cert", "git::https://example.com/secrets.git//tls.crt?ref=v1", false},
+		{"GitInvalidKey", args{"a=b=git::https://example.com/secrets.git//tls.crt"}, "", "", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, got1, err := parseFileName(tt.args.source, "")
+			if (err != nil) != tt.wantErr {
+				t.Errorf("parseFileName() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if got != tt.wantKey {
+				t.Errorf("parseFileName() got = %v, wantKey %v", got, tt.wantKey)
+			}
+			if got1 != tt.wantFile {
+				t.Errorf("parseFileName() got1 = %v, wantFile %v", got1, tt.wantFile)
+			}
+		})
+	}
+}
+
+func Test_formatForPath(t *testing.T) {
+	type args struct {
+		path string
+	}
+	tests := []struct {
+		name string
+		args args
+		want string
+	}{
+		{"YAMLLong", args{"dir/file.yaml"}, "yaml"},
+		{"YAMLShort", args{"dir/file.yml"}, "yaml"},
+		{"JSON", args{"dir/file.json"}, "json"},
+		{"DotEnv", args{"dir/file.env"}, "dotenv"},
+		{"XML", args{"dir/file.xml"}, "xml"},
+		{"INI", args{"dir/file.ini"}, "ini"},
+		{"TOML", args{"dir/file.toml"}, "toml"},
+		{"Properties", args{"dir/file.properties"}, "properties"},
+		{"Other", args{"dir/file.txt"}, "binary"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := formatForPath(tt.args.path); got != tt.want {
+				t.Errorf("formatForPath() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+// Test util functions
+
+func b64(s string) string {
+	return base64.StdEncoding.EncodeToString([]byte(s))
+}
+
+func b(s string) []byte {
+	return []byte(s)
+}
+
+func boolPtr(v bool) *bool {
+	return &v
+}
+
+func intPtr(v int) *int {
+	return &v
+}
+
+func ssg(envSources []string, fileSources []string) SopsSecretGenerator {
+	return SopsSecretGenerator{
+		TypeMeta: TypeMeta{
+			APIVersion: apiVersion,
+			Kind:       kind,
+		},
+		ObjectMeta: ObjectMeta{
+			Name:        "secret",
+			Annotations: kvMap{},
+		},
+		DisableNameSuffixHash: true,
+		EnvSources:            sources(envSources...),
+		FileSources:           sources(fileSources...),
+	}
+}
+
+func sources(paths ...string) []Source {
+	var s []Source
+	for _, p := range paths {
+		s = append(s, Source{Path: p})
+	}
+	return s
+}
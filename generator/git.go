@@ -0,0 +1,116 @@
+// Copyright 2019 Go About B.V. and contributors
+// Licensed under the Apache License, Version 2.0.
+
+package generator
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// gitScheme starts the path of a source in a Git repository, in the form
+// git::REPO//PATH?ref=REF, like the remote bases of kustomize.
+const gitScheme = "git::"
+
+// isGitPath returns whether a source path refers to a file in Git.
+func isGitPath(source string) bool {
+	return strings.HasPrefix(source, gitScheme)
+}
+
+// parseGitPath splits a Git source into the URL of the repository, the path
+// of the file in it, and the ref to check out, which is empty for the
+// default branch.
+func parseGitPath(source string) (repo string, file string, ref string, err error) {
+	rest := strings.TrimPrefix(source, gitScheme)
+	if i := strings.LastIndex(rest, "?"); i >= 0 {
+		query := rest[i+1:]
+		rest = rest[:i]
+		if !strings.HasPrefix(query, "ref=") || strings.Contains(query, "&") {
+			return "", "", "", fmt.Errorf("git source %v: only ?ref=REF is supported", source)
+		}
+		ref = strings.TrimPrefix(query, "ref=")
+	}
+	// The path starts after a double slash that is not part of the scheme
+	start := 0
+	if i := strings.Index(rest, "://"); i >= 0 {
+		start = i + 3
+	}
+	i := strings.Index(rest[start:], "//")
+	if i < 0 {
+		return "", "", "", fmt.Errorf("git source %v must be git::REPO//PATH", source)
+	}
+	repo, file = rest[:start+i], rest[start+i+2:]
+	if repo == "" || file == "" {
+		return "", "", "", fmt.Errorf("git source %v must be git::REPO//PATH", source)
+	}
+	return repo, file, ref, nil
+}
+
+// readGit reads a file from a Git repository, fetching only the commit of
+// its ref into a temporary repository. The fetch is aborted after
+// opts.FetchTimeout, and the file limited to opts.MaxSourceSize bytes.
+func readGit(ctx context.Context, source string, opts Options) ([]byte, error) {
+	repo, file, ref, err := parseGitPath(source)
+	if err != nil {
+		return nil, err
+	}
+	if ref == "" {
+		ref = "HEAD"
+	}
+	timeout := opts.FetchTimeout
+	if timeout <= 0 {
+		timeout = defaultFetchTimeout
+	}
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	dir, err := ioutil.TempDir("", "sopssecretgenerator-git-")
+	if err != nil {
+		return nil, err
+	}
+	defer os.RemoveAll(dir)
+
+	_, err = runGit(ctx, dir, "init", "--quiet")
+	if err == nil {
+		_, err = runGit(ctx, dir, "fetch", "--quiet", "--depth=1", "--", repo, ref)
+	}
+	if err != nil {
+		return nil, errors.Wrapf(err, "fetching %v of %v", ref, repo)
+	}
+	content, err := runGit(ctx, dir, "show", "FETCH_HEAD:"+file)
+	if err != nil {
+		return nil, errors.Wrapf(err, "reading %v at %v of %v", file, ref, repo)
+	}
+	if opts.MaxSourceSize > 0 && int64(len(content)) > opts.MaxSourceSize {
+		return nil, fmt.Errorf("source is larger than %d bytes", opts.MaxSourceSize)
+	}
+	return content, nil
+}
+
+// runGit runs git with args in dir and returns its output. Git does not
+// prompt for credentials, which would block the build.
+func runGit(ctx context.Context, dir string, args ...string) ([]byte, error) {
+	cmd := exec.CommandContext(ctx, "git", args...)
+	cmd.Dir = dir
+	cmd.Env = append(os.Environ(), "GIT_TERMINAL_PROMPT=0")
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	output, err := cmd.Output()
+	if ctx.Err() != nil {
+		return nil, ctx.Err()
+	}
+	if err != nil {
+		if msg := strings.TrimSpace(stderr.String()); msg != "" {
+			return nil, fmt.Errorf("git %v: %v", args[0], msg)
+		}
+		return nil, errors.Wrapf(err, "git %v", args[0])
+	}
+	return output, nil
+}
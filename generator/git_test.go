@@ -0,0 +1,96 @@
+// Copyright 2019 Go About B.V. and contributors
+// Licensed under the Apache License, Version 2.0.
+
+package generator
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func Test_parseGitPath(t *testing.T) {
+	tests := []struct {
+		name     string
+		source   string
+		wantRepo string
+		wantFile string
+		wantRef  string
+		wantErr  bool
+	}{
+		{"HTTPS", "git::https://example.com/secrets.git//app/secrets.yaml?ref=v1.2.3", "https://example.com/secrets.git", "app/secrets.yaml", "v1.2.3", false},
+		{"SCP", "git::git@example.com:org/secrets.git//secrets.env", "git@example.com:org/secrets.git", "secrets.env", "", false},
+		{"NoPath", "git::https://example.com/secrets.git", "", "", "", true},
+		{"EmptyPath", "git::https://example.com/secrets.git//", "", "", "", true},
+		{"UnknownQuery", "git::https://example.com/secrets.git//secrets.env?depth=1", "", "", "", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			repo, file, ref, err := parseGitPath(tt.source)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("parseGitPath() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if repo != tt.wantRepo || file != tt.wantFile || ref != tt.wantRef {
+				t.Errorf("parseGitPath() = %v, %v, %v, want %v, %v, %v", repo, file, ref, tt.wantRepo, tt.wantFile, tt.wantRef)
+			}
+		})
+	}
+}
+
+func Test_readGit(t *testing.T) {
+	dir, err := ioutil.TempDir("", "generator-git-test-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	ctx := context.Background()
+	git := func(args ...string) {
+		if _, err := runGit(ctx, dir, args...); err != nil {
+			t.Fatal(err)
+		}
+	}
+	write := func(content string) {
+		if err := ioutil.WriteFile(filepath.Join(dir, "vars.env"), []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	git("init", "--quiet")
+	git("config", "user.email", "test@example.com")
+	git("config", "user.name", "Test")
+	write("VAR=v1\n")
+	git("add", "vars.env")
+	git("commit", "--quiet", "-m", "v1")
+	git("tag", "v1")
+	write("VAR=v2\n")
+	git("commit", "--quiet", "-am", "v2")
+
+	repo := "git::file://" + dir
+	tests := []struct {
+		name    string
+		source  string
+		opts    Options
+		want    string
+		wantErr bool
+	}{
+		{"DefaultBranch", repo + "//vars.env", Options{}, "VAR=v2\n", false},
+		{"Ref", repo + "//vars.env?ref=v1", Options{}, "VAR=v1\n", false},
+		{"MissingRef", repo + "//vars.env?ref=v2", Options{}, "", true},
+		{"MissingFile", repo + "//missing.env", Options{}, "", true},
+		{"TooLarge", repo + "//vars.env", Options{MaxSourceSize: 4}, "", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := readGit(ctx, tt.source, tt.opts)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("readGit() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if string(got) != tt.want {
+				t.Errorf("readGit() got = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,65 @@
+// Copyright 2019 Go About B.V. and contributors
+// Licensed under the Apache License, Version 2.0.
+
+package generator
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// isGlobPattern reports whether the path of a local file source contains
+// glob characters, outside the path of an extracted value.
+func isGlobPattern(fn string) bool {
+	if !isLocalPath(fn) {
+		return false
+	}
+	file, _ := splitExtractPath(fn, "")
+	return strings.ContainsAny(file, "*?[")
+}
+
+// expandFileGlobs replaces file sources whose path is a glob pattern by a
+// source for every matching file, in order of their paths, which are keyed
+// by their base name. Other options of the source apply to each match. A
+// pattern that matches no files is an error, unless the source is optional.
+func expandFileGlobs(sources []Source) ([]Source, error) {
+	var expanded []Source
+	for _, source := range sources {
+		if !isGlobPattern(source.Path) {
+			expanded = append(expanded, source)
+			continue
+		}
+		if source.Key != "" || strings.Contains(source.Path, "=") {
+			return nil, fmt.Errorf("file source %v: pattern cannot have a key name, files are keyed by their name", source.Path)
+		}
+		if _, extract := splitExtractPath(source.Path, source.Format); extract != "" {
+			return nil, fmt.Errorf("file source %v: pattern cannot extract a value", source.Path)
+		}
+		matches, err := filepath.Glob(source.Path)
+		if err != nil {
+			return nil, errors.Wrapf(err, "file source %v", source.Path)
+		}
+		n := 0
+		for _, match := range matches {
+			info, err := os.Stat(match)
+			if err != nil {
+				return nil, errors.Wrapf(err, "file source %v", source.Path)
+			}
+			if info.IsDir() {
+				continue
+			}
+			matched := source
+			matched.Path = match
+			expanded = append(expanded, matched)
+			n++
+		}
+		if n == 0 && !source.Optional {
+			return nil, fmt.Errorf("file source %v: pattern matches no files", source.Path)
+		}
+	}
+	return expanded, nil
+}
@@ -0,0 +1,46 @@
+// Copyright 2019 Go About B.V. and contributors
+// Licensed under the Apache License, Version 2.0.
+
+package generator
+
+import (
+	"reflect"
+	"testing"
+)
+
+func Test_expandFileGlobs(t *testing.T) {
+	tests := []struct {
+		name    string
+		sources []Source
+		want    []Source
+		wantErr bool
+	}{
+		{"NoPattern", sources("testdata/file.txt", "key=testdata/file2.txt"), sources("testdata/file.txt", "key=testdata/file2.txt"), false},
+		{"Pattern", sources("testdata/tls*"), sources("testdata/tls-other.key", "testdata/tls.crt", "testdata/tls.key"), false},
+		{
+			"Options",
+			[]Source{{Path: "testdata/file?.txt", Plain: true}},
+			[]Source{{Path: "testdata/file2.txt", Plain: true}},
+			false,
+		},
+		{"Vault", sources("vault://secret/data/app*#password"), sources("vault://secret/data/app*#password"), false},
+		{"NoMatches", sources("testdata/*.pem"), nil, true},
+		{"OnlyDirectories", sources("testdata/source*"), nil, true},
+		{"OptionalNoMatches", []Source{{Path: "testdata/*.pem", Optional: true}}, nil, false},
+		{"KeyName", sources("cert=testdata/tls*"), nil, true},
+		{"Extract", sources("testdata/vars*.json#VAR_JSON"), nil, true},
+		{"InvalidPattern", sources("testdata/[.txt"), nil, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := expandFileGlobs(tt.sources)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("expandFileGlobs() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("expandFileGlobs() got = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
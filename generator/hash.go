@@ -0,0 +1,77 @@
+// Copyright 2019 Go About B.V. and contributors
+// Parts adapted from kustomize, Copyright 2019 The Kubernetes Authors.
+// Licensed under the Apache License, Version 2.0.
+
+package generator
+
+import (
+	"crypto/sha256"
+	"encoding/json"
+	"fmt"
+)
+
+// SecretHash returns the hash that kustomize appends to the name of a
+// generated Secret. It is computed over the kind, name, type, data and
+// stringData of the Secret, so the result does not depend on labels or
+// annotations.
+func SecretHash(secret Secret) (string, error) {
+	m := map[string]interface{}{
+		"kind": "Secret",
+		"name": secret.Name,
+		"type": secret.Type,
+		"data": secret.Data,
+	}
+	if len(secret.StringData) > 0 {
+		m["stringData"] = secret.StringData
+	}
+	encoded, err := json.Marshal(m)
+	if err != nil {
+		return "", err
+	}
+	return encodeHash(fmt.Sprintf("%x", sha256.Sum256(encoded))), nil
+}
+
+// keysHash returns the hash of the secret as SecretHash does, but computed
+// over the given data keys only.
+func keysHash(secret Secret, keys []string) (string, error) {
+	data := make(kvMap)
+	var stringData kvMap
+	for _, k := range keys {
+		if v, ok := secret.StringData[k]; ok {
+			if stringData == nil {
+				stringData = make(kvMap)
+			}
+			stringData[k] = v
+			continue
+		}
+		v, ok := secret.Data[k]
+		if !ok {
+			return "", fmt.Errorf("hash key %v is not in the secret", k)
+		}
+		data[k] = v
+	}
+	secret.Data = data
+	secret.StringData = stringData
+	return SecretHash(secret)
+}
+
+// encodeHash shortens a hex hash to 10 characters, replacing some characters
+// to avoid forming words.
+func encodeHash(hex string) string {
+	enc := []rune(hex[:10])
+	for i := range enc {
+		switch enc[i] {
+		case '0':
+			enc[i] = 'g'
+		case '1':
+			enc[i] = 'h'
+		case '3':
+			enc[i] = 'k'
+		case 'a':
+			enc[i] = 'm'
+		case 'e':
+			enc[i] = 't'
+		}
+	}
+	return string(enc)
+}
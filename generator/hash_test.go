@@ -0,0 +1,67 @@
+// Copyright 2019 Go About B.V. and contributors
+// Licensed under the Apache License, Version 2.0.
+
+package generator
+
+import (
+	"testing"
+)
+
+func Test_SecretHash(t *testing.T) {
+	type args struct {
+		secret Secret
+	}
+	tests := []struct {
+		name string
+		args args
+		want string
+	}{
+		// Expected hashes are taken from the kustomize hasher tests
+		{"OneKey", args{Secret{Type: "my-type", Data: kvMap{"one": ""}}}, "74bd68bm66"},
+		{"ThreeKeys", args{Secret{Type: "my-type", Data: kvMap{"two": b64("2"), "one": "", "three": b64("3")}}}, "dgcb6h9tmk"},
+		{"IgnoresMetadata", args{Secret{ObjectMeta: ObjectMeta{Labels: kvMap{"label": "value"}}, Type: "my-type", Data: kvMap{"one": ""}}}, "74bd68bm66"},
+		{"StringData", args{Secret{Type: "my-type", Data: kvMap{"one": ""}, StringData: kvMap{"two": "2"}}}, "ckm7f798g2"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := SecretHash(tt.args.secret)
+			if err != nil {
+				t.Errorf("SecretHash() error = %v", err)
+				return
+			}
+			if got != tt.want {
+				t.Errorf("SecretHash() got = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func Test_keysHash(t *testing.T) {
+	type args struct {
+		secret Secret
+		keys   []string
+	}
+	tests := []struct {
+		name    string
+		args    args
+		want    string
+		wantErr bool
+	}{
+		{"OneKey", args{Secret{Type: "my-type", Data: kvMap{"one": "", "two": b64("2")}}, []string{"one"}}, "74bd68bm66", false},
+		{"AllKeys", args{Secret{Type: "my-type", Data: kvMap{"two": b64("2"), "one": "", "three": b64("3")}}, []string{"one", "two", "three"}}, "dgcb6h9tmk", false},
+		{"StringDataKey", args{Secret{Type: "my-type", Data: kvMap{"one": "", "three": b64("3")}, StringData: kvMap{"two": "2"}}, []string{"one", "two"}}, "ckm7f798g2", false},
+		{"MissingKey", args{Secret{Type: "my-type", Data: kvMap{"one": ""}}, []string{"two"}}, "", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := keysHash(tt.args.secret, tt.args.keys)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("keysHash() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if got != tt.want {
+				t.Errorf("keysHash() got = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,50 @@
+// Copyright 2019 Go About B.V. and contributors
+// Licensed under the Apache License, Version 2.0.
+
+package generator
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/pkg/errors"
+	"gopkg.in/ini.v1"
+)
+
+// defaultINISeparator joins the section and the name of an INI key, if the
+// source does not set a separator.
+const defaultINISeparator = "."
+
+// parseINIContent adds the keys of an INI document to data. Keys in a
+// section are named section.key, with separator between them; keys before
+// the first section keep their name. It returns the keys in the order of
+// the document.
+func parseINIContent(content []byte, data kvMap, separator string) ([]string, error) {
+	if separator == "" {
+		separator = defaultINISeparator
+	}
+	file, err := ini.LoadSources(ini.LoadOptions{AllowShadows: true}, content)
+	if err != nil {
+		return nil, err
+	}
+
+	var order []string
+	for _, section := range file.Sections() {
+		name := strings.TrimSpace(section.Name())
+		if name == "" {
+			return nil, errors.New("empty section name")
+		}
+		for _, key := range section.Keys() {
+			k := key.Name()
+			if name != ini.DefaultSection {
+				k = name + separator + k
+			}
+			if _, ok := data[k]; ok || len(key.ValueWithShadows()) > 1 {
+				return nil, fmt.Errorf("key %v is defined twice", k)
+			}
+			data[k] = key.Value()
+			order = append(order, k)
+		}
+	}
+	return order, nil
+}
@@ -0,0 +1,63 @@
+// Copyright 2019 Go About B.V. and contributors
+// Licensed under the Apache License, Version 2.0.
+
+package generator
+
+import (
+	"reflect"
+	"testing"
+)
+
+func Test_parseINIContent(t *testing.T) {
+	type args struct {
+		content   []byte
+		separator string
+	}
+	tests := []struct {
+		name      string
+		args      args
+		want      kvMap
+		wantOrder []string
+		wantErr   bool
+	}{
+		{
+			"Sections",
+			args{b("top = 1\n[db]\nhost = localhost\nport: 5432\n"), ""},
+			kvMap{"top": "1", "db.host": "localhost", "db.port": "5432"},
+			[]string{"top", "db.host", "db.port"},
+			false,
+		},
+		{"Separator", args{b("[db]\nhost=localhost\n"), "_"}, kvMap{"db_host": "localhost"}, []string{"db_host"}, false},
+		{"Comments", args{b("; comment\n# comment\n\n[s]\nk = v\n"), ""}, kvMap{"s.k": "v"}, []string{"s.k"}, false},
+		{"SectionComment", args{b("[s] ; comment\nk = v\n"), ""}, kvMap{"s.k": "v"}, []string{"s.k"}, false},
+		{"InlineComments", args{b("a = 1 ; comment\nb = 2 # comment\n"), ""}, kvMap{"a": "1", "b": "2"}, []string{"a", "b"}, false},
+		{"Quoted", args{b("a = \"x = y\"\nb = 'z'\nc = \"open\n"), ""}, kvMap{"a": "x = y", "b": "z", "c": "\"open"}, []string{"a", "b", "c"}, false},
+		{"EmptyValue", args{b("k =\n"), ""}, kvMap{"k": ""}, []string{"k"}, false},
+		{"Empty", args{b(""), ""}, kvMap{}, nil, false},
+		{"Duplicate", args{b("[s]\nk = 1\n[s]\nk = 2\n"), ""}, kvMap{}, nil, true},
+		{"FlattenedDuplicate", args{b("s.k = 1\n[s]\nk = 2\n"), ""}, kvMap{}, nil, true},
+		{"UnclosedSection", args{b("[s\nk = 1\n"), ""}, kvMap{}, nil, true},
+		{"EmptySection", args{b("[ ]\nk = 1\n"), ""}, kvMap{}, nil, true},
+		{"NoValue", args{b("[s]\nkey\n"), ""}, kvMap{}, nil, true},
+		{"EmptyKey", args{b("= v\n"), ""}, kvMap{}, nil, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := make(kvMap)
+			order, err := parseINIContent(tt.args.content, got, tt.args.separator)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("parseINIContent() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if tt.wantErr {
+				return
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("parseINIContent() got = %v, want %v", got, tt.want)
+			}
+			if !reflect.DeepEqual(order, tt.wantOrder) {
+				t.Errorf("parseINIContent() order = %v, want %v", order, tt.wantOrder)
+			}
+		})
+	}
+}
@@ -0,0 +1,119 @@
+// Copyright 2019 Go About B.V. and contributors
+// Licensed under the Apache License, Version 2.0.
+
+package generator
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+
+	"github.com/pkg/errors"
+	"gopkg.in/yaml.v2"
+)
+
+// unmarshalJSON decodes a JSON document like json.Unmarshal, but keeps numbers
+// as json.Number, so that they are not rounded to a float64.
+func unmarshalJSON(content []byte, v interface{}) error {
+	d := json.NewDecoder(bytes.NewReader(content))
+	d.UseNumber()
+	err := d.Decode(v)
+	if err != nil {
+		return err
+	}
+	if _, err := d.Token(); err != io.EOF {
+		return errors.New("invalid character after top-level value")
+	}
+	return nil
+}
+
+// marshalJSONValue serializes a decoded YAML or JSON value as compact JSON.
+// YAML mappings keep the order of their keys.
+func marshalJSONValue(v interface{}) ([]byte, error) {
+	var buf bytes.Buffer
+	err := writeJSONValue(&buf, v)
+	if err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// marshalYAMLValue serializes a decoded YAML, JSON or TOML value as YAML.
+// Lists and maps end with a newline, like a YAML file; scalars do not, so
+// that 5 becomes "5".
+func marshalYAMLValue(v interface{}) ([]byte, error) {
+	encoded, err := yaml.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+	switch v.(type) {
+	case yaml.MapSlice, map[interface{}]interface{}, map[string]interface{}, []interface{}:
+		return encoded, nil
+	}
+	return bytes.TrimSuffix(encoded, []byte("\n")), nil
+}
+
+func writeJSONValue(buf *bytes.Buffer, v interface{}) error {
+	switch value := v.(type) {
+	case yaml.MapSlice:
+		buf.WriteByte('{')
+		for i, item := range value {
+			if i > 0 {
+				buf.WriteByte(',')
+			}
+			err := writeJSONKey(buf, item.Key)
+			if err != nil {
+				return err
+			}
+			err = writeJSONValue(buf, item.Value)
+			if err != nil {
+				return err
+			}
+		}
+		buf.WriteByte('}')
+	case map[interface{}]interface{}:
+		ms := make(map[string]json.RawMessage)
+		for k, v := range value {
+			encoded, err := marshalJSONValue(v)
+			if err != nil {
+				return err
+			}
+			ms[fmt.Sprint(k)] = encoded
+		}
+		return writeJSON(buf, ms)
+	case []interface{}:
+		buf.WriteByte('[')
+		for i, item := range value {
+			if i > 0 {
+				buf.WriteByte(',')
+			}
+			err := writeJSONValue(buf, item)
+			if err != nil {
+				return err
+			}
+		}
+		buf.WriteByte(']')
+	default:
+		return writeJSON(buf, value)
+	}
+	return nil
+}
+
+func writeJSONKey(buf *bytes.Buffer, key interface{}) error {
+	err := writeJSON(buf, fmt.Sprint(key))
+	if err != nil {
+		return err
+	}
+	buf.WriteByte(':')
+	return nil
+}
+
+func writeJSON(buf *bytes.Buffer, v interface{}) error {
+	encoded, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	buf.Write(encoded)
+	return nil
+}
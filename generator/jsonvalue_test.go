@@ -0,0 +1,64 @@
+// Copyright 2019 Go About B.V. and contributors
+// Licensed under the Apache License, Version 2.0.
+
+package generator
+
+import (
+	"testing"
+
+	"gopkg.in/yaml.v2"
+)
+
+func Test_marshalJSONValue(t *testing.T) {
+	tests := []struct {
+		name    string
+		value   interface{}
+		want    string
+		wantErr bool
+	}{
+		{"Number", 42, `42`, false},
+		{"Bool", true, `true`, false},
+		{"List", []interface{}{"a", "b", 1}, `["a","b",1]`, false},
+		{"MapSlice", yaml.MapSlice{{Key: "b", Value: 1}, {Key: "a", Value: []interface{}{"x"}}}, `{"b":1,"a":["x"]}`, false},
+		{"Map", map[interface{}]interface{}{"b": 1, 2: "a"}, `{"2":"a","b":1}`, false},
+		{"JSONMap", map[string]interface{}{"b": 1.5, "a": nil}, `{"a":null,"b":1.5}`, false},
+		{"Unsupported", func() {}, "", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := marshalJSONValue(tt.value)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("marshalJSONValue() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if string(got) != tt.want {
+				t.Errorf("marshalJSONValue() got = %v, want %v", string(got), tt.want)
+			}
+		})
+	}
+}
+
+func Test_marshalYAMLValue(t *testing.T) {
+	tests := []struct {
+		name  string
+		value interface{}
+		want  string
+	}{
+		{"Number", 42, "42"},
+		{"Bool", true, "true"},
+		{"List", []interface{}{"a", 1}, "- a\n- 1\n"},
+		{"MapSlice", yaml.MapSlice{{Key: "b", Value: 1}, {Key: "a", Value: "x"}}, "b: 1\na: x\n"},
+		{"JSONMap", map[string]interface{}{"b": 1.5, "a": "x"}, "a: x\nb: 1.5\n"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := marshalYAMLValue(tt.value)
+			if err != nil {
+				t.Fatalf("marshalYAMLValue() error = %v", err)
+			}
+			if string(got) != tt.want {
+				t.Errorf("marshalYAMLValue() got = %q, want %q", string(got), tt.want)
+			}
+		})
+	}
+}
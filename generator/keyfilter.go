@@ -0,0 +1,73 @@
+// Copyright 2019 Go About B.V. and contributors
+// Licensed under the Apache License, Version 2.0.
+
+package generator
+
+import (
+	"path"
+	"regexp"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// filterKeys returns the data of a source and the order of its keys with only
+// the keys that match one of the include patterns, if there are any, and
+// none of the exclude patterns.
+func filterKeys(data kvMap, order []string, include []string, exclude []string) (kvMap, []string, error) {
+	filtered := make(kvMap, len(data))
+	for k, v := range data {
+		use, err := keySelected(k, include, exclude)
+		if err != nil {
+			return nil, nil, err
+		}
+		if use {
+			filtered[k] = v
+		}
+	}
+	var filteredOrder []string
+	for _, k := range order {
+		if _, ok := filtered[k]; ok {
+			filteredOrder = append(filteredOrder, k)
+		}
+	}
+	return filtered, filteredOrder, nil
+}
+
+// keySelected returns whether the include and exclude patterns select a key.
+func keySelected(key string, include []string, exclude []string) (bool, error) {
+	included := len(include) == 0
+	for _, pattern := range include {
+		match, err := matchKey(pattern, key)
+		if err != nil {
+			return false, errors.Wrapf(err, "includeKeys pattern %v", pattern)
+		}
+		included = included || match
+	}
+	if !included {
+		return false, nil
+	}
+	for _, pattern := range exclude {
+		match, err := matchKey(pattern, key)
+		if err != nil {
+			return false, errors.Wrapf(err, "excludeKeys pattern %v", pattern)
+		}
+		if match {
+			return false, nil
+		}
+	}
+	return true, nil
+}
+
+// matchKey matches a key against a glob pattern, or against a regular
+// expression if the pattern is enclosed in slashes, as in /^DB_/.
+func matchKey(pattern string, key string) (bool, error) {
+	if len(pattern) > 1 && strings.HasPrefix(pattern, "/") && strings.HasSuffix(pattern, "/") {
+		re, err := regexp.Compile(pattern[1 : len(pattern)-1])
+		if err != nil {
+			return false, err
+		}
+		return re.MatchString(key), nil
+	}
+	return path.Match(pattern, key)
+}
@@ -0,0 +1,47 @@
+// Copyright 2019 Go About B.V. and contributors
+// Licensed under the Apache License, Version 2.0.
+
+package generator
+
+import (
+	"reflect"
+	"testing"
+)
+
+func Test_filterKeys(t *testing.T) {
+	data := kvMap{"DB_HOST": "h", "DB_PASSWORD": "p", "API_TOKEN": "t", "LOG_LEVEL": "l"}
+	order := []string{"LOG_LEVEL", "DB_PASSWORD", "API_TOKEN", "DB_HOST"}
+	tests := []struct {
+		name      string
+		include   []string
+		exclude   []string
+		want      kvMap
+		wantOrder []string
+		wantErr   bool
+	}{
+		{"None", nil, nil, data, order, false},
+		{"IncludeGlob", []string{"DB_*"}, nil, kvMap{"DB_HOST": "h", "DB_PASSWORD": "p"}, []string{"DB_PASSWORD", "DB_HOST"}, false},
+		{"IncludeExact", []string{"API_TOKEN", "LOG_LEVEL"}, nil, kvMap{"API_TOKEN": "t", "LOG_LEVEL": "l"}, []string{"LOG_LEVEL", "API_TOKEN"}, false},
+		{"Exclude", nil, []string{"*_PASSWORD"}, kvMap{"DB_HOST": "h", "API_TOKEN": "t", "LOG_LEVEL": "l"}, []string{"LOG_LEVEL", "API_TOKEN", "DB_HOST"}, false},
+		{"IncludeExclude", []string{"DB_*"}, []string{"DB_HOST"}, kvMap{"DB_PASSWORD": "p"}, []string{"DB_PASSWORD"}, false},
+		{"Regexp", []string{"/^(API|LOG)_/"}, nil, kvMap{"API_TOKEN": "t", "LOG_LEVEL": "l"}, []string{"LOG_LEVEL", "API_TOKEN"}, false},
+		{"NoMatch", []string{"CACHE_*"}, nil, kvMap{}, nil, false},
+		{"InvalidGlob", []string{"["}, nil, nil, nil, true},
+		{"InvalidRegexp", nil, []string{"/(/"}, nil, nil, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, gotOrder, err := filterKeys(data, order, tt.include, tt.exclude)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("filterKeys() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("filterKeys() got = %v, want %v", got, tt.want)
+			}
+			if !reflect.DeepEqual(gotOrder, tt.wantOrder) {
+				t.Errorf("filterKeys() order = %v, want %v", gotOrder, tt.wantOrder)
+			}
+		})
+	}
+}
@@ -0,0 +1,54 @@
+// Copyright 2019 Go About B.V. and contributors
+// Licensed under the Apache License, Version 2.0.
+
+package generator
+
+import (
+	"context"
+	"sort"
+)
+
+// Keys reads a SopsSecretGenerator spec and returns the sorted keys of the
+// Secret, without its values. The sources are decrypted to find the keys,
+// as generated for the type of the Secret, such as .dockerconfigjson.
+// Keys of the companion ConfigMap are left out.
+func Keys(spec []byte, opts Options) ([]string, error) {
+	return KeysContext(context.Background(), spec, opts)
+}
+
+// KeysContext is like Keys, but aborts decryption when ctx is done.
+func KeysContext(ctx context.Context, spec []byte, opts Options) ([]string, error) {
+	input, err := readInput(spec, opts)
+	if err != nil {
+		return nil, err
+	}
+	err = requireSingleSecret(input)
+	if err != nil {
+		return nil, err
+	}
+	return listKeys(ctx, input, opts)
+}
+
+func listKeys(ctx context.Context, input SopsSecretGenerator, opts Options) ([]string, error) {
+	data, _, err := generateData(ctx, input, nil, opts)
+	if err != nil {
+		return nil, err
+	}
+	data, err = validateKeys(data, opts.SanitizeKeys)
+	if err != nil {
+		return nil, withClass(ClassSource, err)
+	}
+	if input.Kind != configMapKind {
+		_, err = splitConfigMapData(data, nil, input.ConfigMapKeys)
+		if err != nil {
+			return nil, withClass(ClassSpec, err)
+		}
+	}
+
+	keys := make([]string, 0, len(data))
+	for k := range data {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys, nil
+}
@@ -0,0 +1,87 @@
+// Copyright 2019 Go About B.V. and contributors
+// Licensed under the Apache License, Version 2.0.
+
+package generator
+
+import (
+	"context"
+	"io/ioutil"
+	"reflect"
+	"testing"
+)
+
+func Test_listKeys(t *testing.T) {
+	type args struct {
+		input SopsSecretGenerator
+		opts  Options
+	}
+	tests := []struct {
+		name    string
+		args    args
+		want    []string
+		wantErr bool
+	}{
+		{"Keys", args{ssg([]string{"testdata/vars.env"}, []string{"testdata/file.txt", "other.txt=testdata/file2.txt"}), Options{}}, []string{"VAR_ENV", "file.txt", "other.txt"}, false},
+		{"FileError", args{ssg(nil, []string{"missing.txt=testdata/missing.txt"}), Options{}}, nil, true},
+		{
+			"DockerConfigJSON",
+			args{typedSSG(literalSSG(ssg(nil, nil),
+				Literal{Key: "registry", Value: "registry.example.com"},
+				Literal{Key: "username", Value: "user"},
+				Literal{Key: "password", Value: "secret"},
+			), dockerConfigJSONType), Options{}},
+			[]string{".dockerconfigjson"},
+			false,
+		},
+		{"ConfigMapKeys", args{configMapKeysSSG(ssg([]string{"testdata/vars.env"}, []string{"testdata/file.txt"}), "VAR_ENV"), Options{}}, []string{"file.txt"}, false},
+		{"MissingConfigMapKey", args{configMapKeysSSG(ssg(nil, []string{"testdata/file.txt"}), "OTHER"), Options{}}, nil, true},
+		{"Collision", args{ssg([]string{"testdata/vars.env"}, []string{"VAR_ENV=testdata/file.txt"}), Options{}}, nil, true},
+		{"InvalidFileName", args{ssg(nil, []string{"=testdata/file.txt"}), Options{}}, nil, true},
+		{"InvalidKey", args{ssg(nil, []string{"a@b=testdata/file.txt"}), Options{}}, nil, true},
+		{"SanitizeKeys", args{ssg(nil, []string{"a@b=testdata/file.txt"}), Options{SanitizeKeys: true}}, []string{"a_b"}, false},
+		{"Literals", args{literalSSG(ssg(nil, []string{"testdata/file.txt"}), Literal{Key: "LIT", Value: "not decrypted"}), Options{}}, []string{"LIT", "file.txt"}, false},
+		{"LiteralCollision", args{literalSSG(ssg([]string{"testdata/vars.env"}, nil), Literal{Key: "VAR_ENV", Value: "not decrypted"}), Options{}}, nil, true},
+		{"EnvError", args{ssg([]string{"testdata/missing.env"}, nil), Options{}}, nil, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := listKeys(context.Background(), tt.args.input, tt.args.opts)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("listKeys() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("listKeys() got = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func literalSSG(input SopsSecretGenerator, literals ...Literal) SopsSecretGenerator {
+	input.Literals = literals
+	return input
+}
+
+func typedSSG(input SopsSecretGenerator, secretType string) SopsSecretGenerator {
+	input.Type = secretType
+	return input
+}
+
+func configMapKeysSSG(input SopsSecretGenerator, keys ...string) SopsSecretGenerator {
+	input.ConfigMapKeys = keys
+	return input
+}
+
+func TestKeys_Literals(t *testing.T) {
+	spec, err := ioutil.ReadFile("testdata/generator-literals.yaml")
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, err := Keys(spec, Options{})
+	if err != nil {
+		t.Fatalf("Keys() error = %v", err)
+	}
+	if want := []string{"LITERAL", "file.txt"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("Keys() got = %v, want %v", got, want)
+	}
+}
@@ -0,0 +1,183 @@
+// Copyright 2019 Go About B.V. and contributors
+// Licensed under the Apache License, Version 2.0.
+
+package generator
+
+import (
+	"fmt"
+	"net"
+	"net/url"
+	"time"
+
+	"github.com/pkg/errors"
+	"go.mozilla.org/sops"
+	"go.mozilla.org/sops/aes"
+	"go.mozilla.org/sops/keyservice"
+	"go.mozilla.org/sops/kms"
+	"google.golang.org/grpc"
+)
+
+// parseKeyServiceURI returns the network and address of a sops keyservice,
+// given as tcp://host:port or unix:///path/to/socket like sops --keyservice.
+func parseKeyServiceURI(uri string) (network string, address string, err error) {
+	u, err := url.Parse(uri)
+	if err != nil {
+		return "", "", errors.Wrapf(err, "keyservice %v", uri)
+	}
+	switch u.Scheme {
+	case "tcp":
+		if u.Host == "" {
+			return "", "", fmt.Errorf("keyservice %v has no host", uri)
+		}
+		return u.Scheme, u.Host, nil
+	case "unix":
+		if u.Path == "" {
+			return "", "", fmt.Errorf("keyservice %v has no socket path", uri)
+		}
+		return u.Scheme, u.Path, nil
+	}
+	return "", "", fmt.Errorf("keyservice %v must start with tcp:// or unix://", uri)
+}
+
+// decryptOptions returns opts with the keyservices and required recipients
+// of the configuration added after those of the options, and with its key
+// groups and AWS settings. The AWS profile is not used with a role, whose
+// credentials apply sets instead.
+func (c SopsConfig) decryptOptions(opts Options) Options {
+	if len(c.KeyServices) > 0 {
+		opts.KeyServices = append(append([]string{}, opts.KeyServices...), c.KeyServices...)
+	}
+	if len(c.RequiredRecipients) > 0 {
+		opts.RequiredRecipients = append(append([]string{}, opts.RequiredRecipients...), c.RequiredRecipients...)
+	}
+	if len(c.KeyGroups) > 0 {
+		opts.KeyGroups = c.KeyGroups
+	}
+	if profile := c.awsProfile(); profile != "" && c.AWS.RoleArn == "" {
+		opts.AWSProfile = profile
+	}
+	if c.AWSRegion != "" {
+		opts.AWSRegion = c.AWSRegion
+	}
+	return opts
+}
+
+// keyServiceDecrypt returns a DecryptFunc that decrypts like sops, as
+// configured by opts: it asks the keyservices of opts for the data key of a
+// file, after the local keyservice unless it is disabled, so that sops can
+// decrypt without access to the keys itself; it only uses the selected key
+// groups; it uses the AWS profile for the KMS keys; and it ignores MAC
+// mismatches if asked to. The returned function closes the connections to
+// the keyservices.
+func keyServiceDecrypt(opts Options) (DecryptFunc, func(), error) {
+	var svcs []keyservice.KeyServiceClient
+	if !opts.DisableLocalKeyService {
+		svcs = append(svcs, keyservice.NewLocalClient())
+	}
+	var conns []*grpc.ClientConn
+	closeConns := func() {
+		for _, conn := range conns {
+			_ = conn.Close()
+		}
+	}
+	for _, uri := range opts.KeyServices {
+		network, address, err := parseKeyServiceURI(uri)
+		if err != nil {
+			closeConns()
+			return nil, nil, err
+		}
+		dialer := func(address string, timeout time.Duration) (net.Conn, error) {
+			return net.DialTimeout(network, address, timeout)
+		}
+		conn, err := grpc.Dial(address, grpc.WithInsecure(), grpc.WithDialer(dialer))
+		if err != nil {
+			closeConns()
+			return nil, nil, errors.Wrapf(err, "keyservice %v", uri)
+		}
+		conns = append(conns, conn)
+		svcs = append(svcs, keyservice.NewKeyServiceClient(conn))
+	}
+	if len(svcs) == 0 {
+		return nil, nil, errors.New("the local keyservice is disabled, but no keyservices are configured")
+	}
+
+	decryptData := func(content []byte, format string) ([]byte, error) {
+		store := newSopsStore(format)
+		tree, err := store.LoadEncryptedFile(content)
+		if err != nil {
+			return nil, err
+		}
+		if len(opts.KeyGroups) > 0 {
+			tree.Metadata, err = selectKeyGroups(tree.Metadata, opts.KeyGroups)
+			if err != nil {
+				return nil, err
+			}
+		}
+		if opts.AWSProfile != "" {
+			setKMSProfile(tree.Metadata, opts.AWSProfile)
+		}
+		key, err := tree.Metadata.GetDataKeyWithKeyServices(svcs)
+		if err != nil {
+			return nil, err
+		}
+		cipher := aes.NewCipher()
+		mac, err := tree.Decrypt(key, cipher)
+		if err != nil {
+			return nil, errors.Wrap(err, "decrypting tree")
+		}
+		originalMac, err := cipher.Decrypt(tree.Metadata.MessageAuthenticationCode, key, tree.Metadata.LastModified.Format(time.RFC3339))
+		if err != nil && !opts.IgnoreMAC {
+			return nil, errors.Wrap(err, "decrypting MAC")
+		}
+		if originalMac != mac {
+			if !opts.IgnoreMAC {
+				return nil, errors.New("failed to verify data integrity: MAC mismatch")
+			}
+			warnf(opts, "MAC mismatch ignored; the decrypted data may have been tampered with")
+		}
+		return store.EmitPlainFile(tree.Branches)
+	}
+	return decryptData, closeConns, nil
+}
+
+// setKMSProfile makes the KMS keys of a file use an AWS profile, which sops
+// passes on to the keyservices, instead of the profile of the environment.
+func setKMSProfile(metadata sops.Metadata, profile string) {
+	for _, group := range metadata.KeyGroups {
+		for _, key := range group {
+			if k, ok := key.(*kms.MasterKey); ok {
+				k.AwsProfile = profile
+			}
+		}
+	}
+}
+
+// selectKeyGroups removes the keys of the key groups that are not selected,
+// so that sops does not try them. The groups stay in place, because with
+// several groups the data key is split between them with Shamir's secret
+// sharing, and sops needs the number of groups to recombine it.
+func selectKeyGroups(metadata sops.Metadata, indexes []int) (sops.Metadata, error) {
+	selected := make(map[int]bool)
+	for _, i := range indexes {
+		if i < 0 || i >= len(metadata.KeyGroups) {
+			return metadata, fmt.Errorf("key group %d does not exist, the file has %d", i, len(metadata.KeyGroups))
+		}
+		selected[i] = true
+	}
+	// A file with a single group has no threshold, but needs that group
+	threshold := 1
+	if len(metadata.KeyGroups) > 1 && metadata.ShamirThreshold > 0 {
+		threshold = metadata.ShamirThreshold
+	}
+	if len(selected) < threshold {
+		return metadata, fmt.Errorf("%d key groups selected, but the file needs %d", len(selected), threshold)
+	}
+	groups := make([]sops.KeyGroup, len(metadata.KeyGroups))
+	for i, group := range metadata.KeyGroups {
+		if selected[i] {
+			groups[i] = group
+		}
+	}
+	metadata.KeyGroups = groups
+	return metadata, nil
+}
@@ -0,0 +1,166 @@
+// Copyright 2019 Go About B.V. and contributors
+// Licensed under the Apache License, Version 2.0.
+
+package generator
+
+import (
+	"bytes"
+	"context"
+	"io/ioutil"
+	"reflect"
+	"strings"
+	"testing"
+
+	"go.mozilla.org/sops"
+	"go.mozilla.org/sops/kms"
+	"go.mozilla.org/sops/pgp"
+)
+
+func Test_parseKeyServiceURI(t *testing.T) {
+	tests := []struct {
+		name        string
+		uri         string
+		wantNetwork string
+		wantAddress string
+		wantErr     bool
+	}{
+		{"TCP", "tcp://localhost:5000", "tcp", "localhost:5000", false},
+		{"Unix", "unix:///run/sops/keyservice.sock", "unix", "/run/sops/keyservice.sock", false},
+		{"NoHost", "tcp://", "", "", true},
+		{"NoPath", "unix://", "", "", true},
+		{"NoScheme", "localhost:5000", "", "", true},
+		{"HTTP", "http://localhost:5000", "", "", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			network, address, err := parseKeyServiceURI(tt.uri)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("parseKeyServiceURI() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if network != tt.wantNetwork || address != tt.wantAddress {
+				t.Errorf("parseKeyServiceURI() = %v, %v, want %v, %v", network, address, tt.wantNetwork, tt.wantAddress)
+			}
+		})
+	}
+}
+
+func TestSopsConfig_decryptOptions(t *testing.T) {
+	opts := Options{KeyServices: []string{"tcp://localhost:5000"}}
+	config := SopsConfig{KeyServices: []string{"unix:///run/sops.sock"}, KeyGroups: []int{1}}
+	got := config.decryptOptions(opts)
+	want := []string{"tcp://localhost:5000", "unix:///run/sops.sock"}
+	if !reflect.DeepEqual(got.KeyServices, want) {
+		t.Errorf("decryptOptions() KeyServices = %v, want %v", got.KeyServices, want)
+	}
+	if !reflect.DeepEqual(got.KeyGroups, []int{1}) {
+		t.Errorf("decryptOptions() KeyGroups = %v, want [1]", got.KeyGroups)
+	}
+	if len(opts.KeyServices) != 1 {
+		t.Errorf("decryptOptions() changed the options")
+	}
+
+	got = SopsConfig{AWSRegion: "eu-west-1", AWS: SopsAWSConfig{Profile: "prod"}}.decryptOptions(opts)
+	if got.AWSProfile != "prod" || got.AWSRegion != "eu-west-1" {
+		t.Errorf("decryptOptions() AWS = %v, %v, want prod, eu-west-1", got.AWSProfile, got.AWSRegion)
+	}
+	got = SopsConfig{AWSProfile: "prod", AWS: SopsAWSConfig{RoleArn: "arn:aws:iam::123456789012:role/sops"}}.decryptOptions(opts)
+	if got.AWSProfile != "" {
+		t.Errorf("decryptOptions() AWSProfile = %v, want none with a role", got.AWSProfile)
+	}
+}
+
+func Test_setKMSProfile(t *testing.T) {
+	key := kms.NewMasterKeyFromArn("arn:aws:kms:eu-west-1:123456789012:key/abc", nil, "")
+	other := pgp.NewMasterKeyFromFingerprint("AAAA")
+	setKMSProfile(sops.Metadata{KeyGroups: []sops.KeyGroup{{other}, {key}}}, "prod")
+	if key.AwsProfile != "prod" {
+		t.Errorf("setKMSProfile() AwsProfile = %v, want prod", key.AwsProfile)
+	}
+}
+
+func Test_keyServiceDecrypt(t *testing.T) {
+	tests := []struct {
+		name    string
+		opts    Options
+		wantErr bool
+	}{
+		{"Local", Options{}, false},
+		{"KeyServices", Options{KeyServices: []string{"tcp://localhost:5000", "unix:///run/sops.sock"}, DisableLocalKeyService: true}, false},
+		{"NoKeyServices", Options{DisableLocalKeyService: true}, true},
+		{"InvalidURI", Options{KeyServices: []string{"localhost:5000"}}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			decryptData, closeKeyServices, err := keyServiceDecrypt(tt.opts)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("keyServiceDecrypt() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if err == nil {
+				if decryptData == nil {
+					t.Errorf("keyServiceDecrypt() returned no DecryptFunc")
+				}
+				closeKeyServices()
+			}
+		})
+	}
+}
+
+func Test_selectKeyGroups(t *testing.T) {
+	a := pgp.NewMasterKeyFromFingerprint("AAAA")
+	b := pgp.NewMasterKeyFromFingerprint("BBBB")
+	c := pgp.NewMasterKeyFromFingerprint("CCCC")
+	groups := []sops.KeyGroup{{a}, {b}, {c}}
+	tests := []struct {
+		name      string
+		groups    []sops.KeyGroup
+		threshold int
+		indexes   []int
+		want      []sops.KeyGroup
+		wantErr   bool
+	}{
+		{"Single", []sops.KeyGroup{{a}}, 0, []int{0}, []sops.KeyGroup{{a}}, false},
+		{"Threshold", groups, 2, []int{2, 1}, []sops.KeyGroup{nil, {b}, {c}}, false},
+		{"BelowThreshold", groups, 2, []int{1}, nil, true},
+		{"Duplicate", groups, 2, []int{1, 1}, nil, true},
+		{"OutOfRange", groups, 1, []int{3}, nil, true},
+		{"Negative", groups, 1, []int{-1}, nil, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			metadata := sops.Metadata{KeyGroups: tt.groups, ShamirThreshold: tt.threshold}
+			got, err := selectKeyGroups(metadata, tt.indexes)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("selectKeyGroups() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if err == nil && !reflect.DeepEqual(got.KeyGroups, tt.want) {
+				t.Errorf("selectKeyGroups() = %v, want %v", got.KeyGroups, tt.want)
+			}
+		})
+	}
+}
+
+func Test_decryptIgnoreMAC(t *testing.T) {
+	content, err := ioutil.ReadFile("testdata/file-badmac.txt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = decrypt(context.Background(), content, "binary", Options{})
+	if err == nil {
+		t.Errorf("decrypt() error = nil, want a MAC error")
+	}
+
+	var warnings bytes.Buffer
+	got, err := decrypt(context.Background(), content, "binary", Options{IgnoreMAC: true, Warnings: &warnings})
+	if err != nil {
+		t.Fatalf("decrypt() with IgnoreMAC error = %v", err)
+	}
+	if string(got) != "secret\n" {
+		t.Errorf("decrypt() with IgnoreMAC = %q, want %q", got, "secret\n")
+	}
+	if !strings.Contains(warnings.String(), "MAC mismatch ignored") {
+		t.Errorf("decrypt() with IgnoreMAC warnings = %q, want a MAC warning", warnings.String())
+	}
+}
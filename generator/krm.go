@@ -0,0 +1,194 @@
+// Copyright 2019 Go About B.V. and contributors
+// Licensed under the Apache License, Version 2.0.
+
+package generator
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/pkg/errors"
+	"gopkg.in/yaml.v2"
+)
+
+const resourceListKind = "ResourceList"
+
+// resourceListAPIVersions are the versions of the ResourceList of the KRM
+// function protocol that are accepted. The output has the version of the
+// input.
+var resourceListAPIVersions = []string{"config.kubernetes.io/v1", "config.kubernetes.io/v1alpha1"}
+
+// Annotations that kustomize uses to order and write back the resources of a
+// KRM function. Newer versions of kustomize use the internal variants.
+const (
+	krmAnnotationPrefix         = "config.kubernetes.io/"
+	krmInternalAnnotationPrefix = "internal.config.kubernetes.io/"
+
+	krmIndexAnnotation         = "config.kubernetes.io/index"
+	krmPathAnnotation          = "config.kubernetes.io/path"
+	krmInternalIndexAnnotation = "internal.config.kubernetes.io/index"
+	krmInternalPathAnnotation  = "internal.config.kubernetes.io/path"
+)
+
+// setKRMAnnotations sets the index and path annotations of the secrets in a
+// ResourceList, in their order from index first. The path is the default
+// that kustomize uses, such as ns/secret_name.yaml, unless the secret already
+// has one.
+func setKRMAnnotations(secrets []Secret, first int) {
+	for i := range secrets {
+		secret := &secrets[i]
+		annotations := make(kvMap)
+		for k, v := range secret.Annotations {
+			annotations[k] = v
+		}
+		path := annotations[krmPathAnnotation]
+		if path == "" {
+			path = strings.ToLower(secret.Kind) + "_" + secret.Name + ".yaml"
+			if secret.Namespace != "" {
+				path = secret.Namespace + "/" + path
+			}
+		}
+		index := strconv.Itoa(first + i)
+		annotations[krmIndexAnnotation] = index
+		annotations[krmPathAnnotation] = path
+		annotations[krmInternalIndexAnnotation] = index
+		annotations[krmInternalPathAnnotation] = path
+		secret.Annotations = annotations
+	}
+}
+
+// resourceList is the input of a KRM function: the resources so far, and the
+// function config, which is the spec of the generator.
+type resourceList struct {
+	TypeMeta       `yaml:",inline"`
+	Items          []yaml.MapSlice `yaml:"items"`
+	FunctionConfig yaml.MapSlice   `yaml:"functionConfig"`
+}
+
+// GenerateResourceList implements the KRM function protocol, for use with
+// kustomize fn run and KRM function generators in kustomize. It reads a
+// ResourceList whose functionConfig is a SopsSecretGenerator spec, and
+// returns the ResourceList with the generated Secret added to its items.
+func GenerateResourceList(input []byte, opts Options) ([]byte, error) {
+	return GenerateResourceListContext(context.Background(), input, opts)
+}
+
+// GenerateResourceListContext is like GenerateResourceList, but aborts
+// decryption when ctx is done.
+func GenerateResourceListContext(ctx context.Context, input []byte, opts Options) ([]byte, error) {
+	opts.Summary.reset()
+	list, err := readResourceList(input)
+	if err != nil {
+		return nil, withClass(ClassSpec, err)
+	}
+	spec, err := yaml.Marshal(list.FunctionConfig)
+	if err != nil {
+		return nil, withClass(ClassSpec, err)
+	}
+	sopsSecret, err := readInput(spec, opts)
+	if err != nil {
+		return nil, err
+	}
+	sopsSecret.Annotations = withoutKRMAnnotations(sopsSecret.Annotations)
+	inputs, err := expandSecrets(sopsSecret)
+	if err != nil {
+		return nil, withClass(ClassSpec, err)
+	}
+	items := make([]interface{}, 0, len(list.Items)+len(inputs))
+	for _, item := range list.Items {
+		items = append(items, item)
+	}
+	// The generated resources are numbered across all secrets of the spec
+	for _, input := range inputs {
+		generated, err := generateKRMResources(ctx, input, len(items)-len(list.Items), opts)
+		if err != nil {
+			return nil, errors.Wrapf(err, "secret %v", input.Name)
+		}
+		items = append(items, generated...)
+	}
+	return yaml.Marshal(struct {
+		TypeMeta `yaml:",inline"`
+		Items    []interface{} `yaml:"items"`
+	}{list.TypeMeta, items})
+}
+
+// generateKRMResources returns the resources that the spec generates, with
+// the annotations of a KRM function, numbered from index first: the Secret and
+// its ConfigMap, if it has one, or the ConfigMap of a SopsConfigMap.
+func generateKRMResources(ctx context.Context, sopsSecret SopsSecretGenerator, first int, opts Options) ([]interface{}, error) {
+	var secret Secret
+	var configMap *ConfigMap
+	var metas []Secret
+	if sopsSecret.Kind == configMapKind {
+		generated, err := generateConfigMap(ctx, sopsSecret, opts)
+		if err != nil {
+			return nil, err
+		}
+		configMap = &generated
+	} else {
+		var err error
+		secret, err = generateSecret(ctx, sopsSecret, opts)
+		if err != nil {
+			return nil, err
+		}
+		opts.Summary.setSecret(secret)
+		secret.Data = wrapData(secret.Data, opts.WrapWidth)
+		configMap = secret.configMap
+		metas = append(metas, secret)
+	}
+	if configMap != nil {
+		metas = append(metas, Secret{TypeMeta: configMap.TypeMeta, ObjectMeta: configMap.ObjectMeta})
+	}
+	setKRMAnnotations(metas, first)
+
+	var resources []interface{}
+	if sopsSecret.Kind != configMapKind {
+		secret.Annotations = metas[0].Annotations
+		resources = append(resources, secret)
+	}
+	if configMap != nil {
+		configMap.Annotations = metas[len(metas)-1].Annotations
+		resources = append(resources, *configMap)
+	}
+	return resources, nil
+}
+
+// readResourceList reads a ResourceList, which must have a function config.
+func readResourceList(content []byte) (resourceList, error) {
+	list := resourceList{}
+	err := yaml.Unmarshal(content, &list)
+	if err != nil {
+		return resourceList{}, errors.Wrap(err, "resource list")
+	}
+	if list.Kind != resourceListKind || !isResourceListVersion(list.APIVersion) {
+		return resourceList{}, fmt.Errorf("input must be apiVersion %v, kind %v", resourceListAPIVersions[0], resourceListKind)
+	}
+	if len(list.FunctionConfig) == 0 {
+		return resourceList{}, errors.New("resource list has no functionConfig")
+	}
+	return list, nil
+}
+
+func isResourceListVersion(version string) bool {
+	for _, v := range resourceListAPIVersions {
+		if v == version {
+			return true
+		}
+	}
+	return false
+}
+
+// withoutKRMAnnotations removes the annotations that kustomize adds to the
+// function config, such as its path and the function to run, which do not
+// belong on the generated Secret.
+func withoutKRMAnnotations(annotations kvMap) kvMap {
+	filtered := make(kvMap)
+	for k, v := range annotations {
+		if !strings.HasPrefix(k, krmAnnotationPrefix) && !strings.HasPrefix(k, krmInternalAnnotationPrefix) {
+			filtered[k] = v
+		}
+	}
+	return filtered
+}
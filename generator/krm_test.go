@@ -0,0 +1,157 @@
+// Copyright 2019 Go About B.V. and contributors
+// Licensed under the Apache License, Version 2.0.
+
+package generator
+
+import (
+	"io/ioutil"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/lithammer/dedent"
+)
+
+func Test_GenerateResourceList(t *testing.T) {
+	tests := []struct {
+		name    string
+		fn      string
+		want    string
+		wantErr bool
+	}{
+		{
+			"ResourceList",
+			"testdata/resourcelist.yaml",
+			strings.TrimLeft(dedent.Dedent(`
+				apiVersion: config.kubernetes.io/v1
+				kind: ResourceList
+				items:
+				- apiVersion: v1
+				  kind: ConfigMap
+				  metadata:
+				    name: existing
+				  data:
+				    key: value
+				- apiVersion: v1
+				  kind: Secret
+				  metadata:
+				    name: secret
+				    annotations:
+				      config.kubernetes.io/index: "0"
+				      config.kubernetes.io/path: secret_secret.yaml
+				      internal.config.kubernetes.io/index: "0"
+				      internal.config.kubernetes.io/path: secret_secret.yaml
+				      kustomize.config.k8s.io/needs-hash: "true"
+				  data:
+				    file.txt: c2VjcmV0Cg==
+			`), "\n"),
+			false,
+		},
+		{
+			"Secrets",
+			"testdata/resourcelist-secrets.yaml",
+			strings.TrimLeft(dedent.Dedent(`
+				apiVersion: config.kubernetes.io/v1
+				kind: ResourceList
+				items:
+				- apiVersion: v1
+				  kind: Secret
+				  metadata:
+				    name: first
+				    namespace: default
+				    annotations:
+				      config.kubernetes.io/index: "0"
+				      config.kubernetes.io/path: default/secret_first.yaml
+				      internal.config.kubernetes.io/index: "0"
+				      internal.config.kubernetes.io/path: default/secret_first.yaml
+				  data:
+				    file.txt: c2VjcmV0Cg==
+				- apiVersion: v1
+				  kind: Secret
+				  metadata:
+				    name: second
+				    namespace: default
+				    annotations:
+				      config.kubernetes.io/index: "1"
+				      config.kubernetes.io/path: default/secret_second.yaml
+				      internal.config.kubernetes.io/index: "1"
+				      internal.config.kubernetes.io/path: default/secret_second.yaml
+				  data:
+				    file2.txt: c2VjcmV0Mgo=
+				  type: Opaque
+			`), "\n"),
+			false,
+		},
+		{"NoFunctionConfig", "testdata/resourcelist-noconfig.yaml", "", true},
+		{"NotResourceList", "testdata/generator.yaml", "", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			input, _ := ioutil.ReadFile(tt.fn)
+			got, err := GenerateResourceList(input, Options{})
+			if (err != nil) != tt.wantErr {
+				t.Errorf("GenerateResourceList() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if string(got) != tt.want {
+				t.Errorf("GenerateResourceList() got = %v, want %v", string(got), tt.want)
+			}
+		})
+	}
+}
+
+func Test_withoutKRMAnnotations(t *testing.T) {
+	annotations := kvMap{
+		"config.kubernetes.io/function":      "exec: {}",
+		"internal.config.kubernetes.io/path": "generator.yaml",
+		"kustomize.config.k8s.io/behavior":   "merge",
+	}
+	want := kvMap{"kustomize.config.k8s.io/behavior": "merge"}
+	if got := withoutKRMAnnotations(annotations); !reflect.DeepEqual(got, want) {
+		t.Errorf("withoutKRMAnnotations() = %v, want %v", got, want)
+	}
+}
+
+func Test_setKRMAnnotations(t *testing.T) {
+	secrets := []Secret{
+		{
+			TypeMeta:   TypeMeta{APIVersion: "v1", Kind: "Secret"},
+			ObjectMeta: ObjectMeta{Name: "first", Annotations: kvMap{"created-by": "me"}},
+		},
+		{
+			TypeMeta:   TypeMeta{APIVersion: "v1", Kind: "Secret"},
+			ObjectMeta: ObjectMeta{Name: "second", Namespace: "prod"},
+		},
+		{
+			TypeMeta:   TypeMeta{APIVersion: "v1", Kind: "Secret"},
+			ObjectMeta: ObjectMeta{Name: "third", Annotations: kvMap{krmPathAnnotation: "secrets.yaml"}},
+		},
+	}
+	want := []kvMap{
+		{
+			"created-by":               "me",
+			krmIndexAnnotation:         "0",
+			krmPathAnnotation:          "secret_first.yaml",
+			krmInternalIndexAnnotation: "0",
+			krmInternalPathAnnotation:  "secret_first.yaml",
+		},
+		{
+			krmIndexAnnotation:         "1",
+			krmPathAnnotation:          "prod/secret_second.yaml",
+			krmInternalIndexAnnotation: "1",
+			krmInternalPathAnnotation:  "prod/secret_second.yaml",
+		},
+		{
+			krmIndexAnnotation:         "2",
+			krmPathAnnotation:          "secrets.yaml",
+			krmInternalIndexAnnotation: "2",
+			krmInternalPathAnnotation:  "secrets.yaml",
+		},
+	}
+	setKRMAnnotations(secrets, 0)
+	for i, secret := range secrets {
+		if !reflect.DeepEqual(secret.Annotations, want[i]) {
+			t.Errorf("setKRMAnnotations() secret %d annotations = %v, want %v", i, secret.Annotations, want[i])
+		}
+	}
+}
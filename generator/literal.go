@@ -0,0 +1,93 @@
+// Copyright 2019 Go About B.V. and contributors
+// Licensed under the Apache License, Version 2.0.
+
+package generator
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/pkg/errors"
+	"gopkg.in/yaml.v2"
+)
+
+// Literal is a key of the Secret whose value is a sops-encrypted document in
+// the spec itself. In the spec it is either KEY=DOCUMENT or an object with a
+// key and a value.
+type Literal struct {
+	Key string `json:"key" yaml:"key"`
+	// Value is a document encrypted like a binary file, with sops
+	// --input-type binary, in YAML or JSON
+	Value string `json:"value" yaml:"value"`
+}
+
+// UnmarshalYAML accepts both KEY=DOCUMENT and a literal object.
+func (l *Literal) UnmarshalYAML(unmarshal func(interface{}) error) error {
+	var s string
+	if err := unmarshal(&s); err == nil {
+		parts := strings.SplitN(s, "=", 2)
+		if len(parts) != 2 || parts[0] == "" {
+			return fmt.Errorf("literal must be KEY=VALUE")
+		}
+		*l = Literal{Key: parts[0], Value: parts[1]}
+		return nil
+	}
+	type literal Literal
+	return unmarshal((*literal)(l))
+}
+
+// parseLiterals adds the decrypted values of the literals to data, and
+// returns their keys. Like sources, a literal cannot redefine a key.
+func parseLiterals(ctx context.Context, literals []Literal, data kvMap, opts Options) ([]string, error) {
+	var keys []string
+	var errs []error
+	for _, literal := range literals {
+		value, err := decryptLiteral(ctx, literal.Value, opts)
+		var added []string
+		if err == nil {
+			added, err = mergeSourceData(data, kvMap{literal.Key: value}, nil, false)
+		}
+		if err != nil {
+			err = errors.Wrapf(err, "literal %v", literal.Key)
+			if !opts.AllErrors {
+				return nil, err
+			}
+			errs = append(errs, err)
+			continue
+		}
+		keys = append(keys, added...)
+	}
+	if err := combineErrors(errs...); err != nil {
+		return nil, err
+	}
+	if len(keys) > 0 {
+		literalData := make(kvMap)
+		for _, k := range keys {
+			literalData[k] = data[k]
+		}
+		opts.Summary.addSource("literals", literalData)
+	}
+	return keys, nil
+}
+
+// decryptLiteral decrypts a literal value, which is the YAML or JSON document
+// that sops writes for a binary file, and returns its data.
+func decryptLiteral(ctx context.Context, value string, opts Options) (string, error) {
+	// JSON is YAML too, so the YAML store reads both
+	decrypted, err := decrypt(ctx, []byte(value), "yaml", opts)
+	if err != nil {
+		return "", err
+	}
+	var document struct {
+		Data *string `yaml:"data"`
+	}
+	err = yaml.Unmarshal(decrypted, &document)
+	if err != nil {
+		return "", errors.Wrap(err, "decrypted literal")
+	}
+	if document.Data == nil {
+		return "", errors.New("decrypted literal has no data field, encrypt it with sops --input-type binary")
+	}
+	return *document.Data, nil
+}
@@ -0,0 +1,69 @@
+// Copyright 2019 Go About B.V. and contributors
+// Licensed under the Apache License, Version 2.0.
+
+package generator
+
+import (
+	"context"
+	"io/ioutil"
+	"reflect"
+	"testing"
+
+	"gopkg.in/yaml.v2"
+)
+
+func TestLiteral_UnmarshalYAML(t *testing.T) {
+	tests := []struct {
+		name    string
+		yaml    string
+		want    Literal
+		wantErr bool
+	}{
+		{"String", `"KEY={data: ENC[...]}"`, Literal{Key: "KEY", Value: "{data: ENC[...]}"}, false},
+		{"Object", "key: KEY\nvalue: |\n  data: ENC[...]\n", Literal{Key: "KEY", Value: "data: ENC[...]\n"}, false},
+		{"NoKey", `"=value"`, Literal{}, true},
+		{"NoValue", `"KEY"`, Literal{}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var got Literal
+			err := yaml.Unmarshal([]byte(tt.yaml), &got)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("UnmarshalYAML() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("UnmarshalYAML() got = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func Test_parseLiterals(t *testing.T) {
+	literal, _ := ioutil.ReadFile("testdata/literal.yaml")
+	noData, _ := ioutil.ReadFile("testdata/literal-nodata.yaml")
+	tests := []struct {
+		name     string
+		literals []Literal
+		want     kvMap
+		wantErr  bool
+	}{
+		{"Literal", []Literal{{"LITERAL", string(literal)}}, kvMap{"VAR_ENV": "val_env", "LITERAL": "val_literal"}, false},
+		{"NoData", []Literal{{"LITERAL", string(noData)}}, nil, true},
+		{"NotEncrypted", []Literal{{"LITERAL", "data: plaintext"}}, nil, true},
+		{"Duplicate", []Literal{{"VAR_ENV", string(literal)}}, nil, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			data := kvMap{"VAR_ENV": "val_env"}
+			_, err := parseLiterals(context.Background(), tt.literals, data, Options{})
+			if (err != nil) != tt.wantErr {
+				t.Errorf("parseLiterals() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if !tt.wantErr && !reflect.DeepEqual(data, tt.want) {
+				t.Errorf("parseLiterals() got = %v, want %v", data, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,141 @@
+// Copyright 2019 Go About B.V. and contributors
+// Licensed under the Apache License, Version 2.0.
+
+package generator
+
+import (
+	"fmt"
+
+	"github.com/pkg/errors"
+	"gopkg.in/yaml.v2"
+)
+
+// MergeSpecs merges SopsSecretGenerator spec fragments into a single spec,
+// which is returned as YAML. Sources are concatenated and labels and
+// annotations merged. Later fragments override the other fields, except
+// that the name and type of the fragments must not conflict.
+func MergeSpecs(specs ...[]byte) ([]byte, error) {
+	return mergeSpecFragments(specs, false)
+}
+
+// MergeSpecsStrict is like MergeSpecs, but unknown fields in the fragments are
+// an error.
+func MergeSpecsStrict(specs ...[]byte) ([]byte, error) {
+	return mergeSpecFragments(specs, true)
+}
+
+func mergeSpecFragments(specs [][]byte, strict bool) ([]byte, error) {
+	inputs := make([]SopsSecretGenerator, len(specs))
+	for i, spec := range specs {
+		input, err := readSpec(spec, Options{Strict: strict})
+		if err != nil {
+			return nil, errors.Wrapf(err, "spec %d", i+1)
+		}
+		inputs[i] = input
+	}
+	merged, err := mergeSpecs(inputs)
+	if err != nil {
+		return nil, withClass(ClassSpec, err)
+	}
+	if merged.Name == "" && merged.GenerateName == "" {
+		return nil, withClass(ClassSpec, errors.New("input must contain metadata.name or metadata.generateName value"))
+	}
+	return yaml.Marshal(merged)
+}
+
+func mergeSpecs(inputs []SopsSecretGenerator) (SopsSecretGenerator, error) {
+	merged := SopsSecretGenerator{
+		TypeMeta: TypeMeta{
+			APIVersion: apiVersion,
+			Kind:       kind,
+		},
+		ObjectMeta: ObjectMeta{
+			Annotations: make(kvMap),
+		},
+	}
+	mergedKind := ""
+	for _, input := range inputs {
+		if input.Kind != "" {
+			if mergedKind != "" && mergedKind != input.Kind {
+				return SopsSecretGenerator{}, fmt.Errorf("kind %v conflicts with %v", input.Kind, mergedKind)
+			}
+			mergedKind = input.Kind
+		}
+		if input.Name != "" {
+			if merged.Name != "" && merged.Name != input.Name {
+				return SopsSecretGenerator{}, fmt.Errorf("name %v conflicts with %v", input.Name, merged.Name)
+			}
+			merged.Name = input.Name
+		}
+		if input.Type != "" {
+			if merged.Type != "" && merged.Type != input.Type {
+				return SopsSecretGenerator{}, fmt.Errorf("type %v conflicts with %v", input.Type, merged.Type)
+			}
+			merged.Type = input.Type
+		}
+		merged.GenerateName = override(merged.GenerateName, input.GenerateName)
+		merged.Namespace = override(merged.Namespace, input.Namespace)
+		merged.Labels = mergeLabels(merged.Labels, input.Labels)
+		for k, v := range input.Annotations {
+			merged.Annotations[k] = v
+		}
+		merged.OwnerReferences = append(merged.OwnerReferences, input.OwnerReferences...)
+		merged.EnvSources = append(merged.EnvSources, input.EnvSources...)
+		merged.FileSources = append(merged.FileSources, input.FileSources...)
+		merged.Literals = append(merged.Literals, input.Literals...)
+		merged.Secrets = append(merged.Secrets, input.Secrets...)
+		merged.HashKeys = append(merged.HashKeys, input.HashKeys...)
+		merged.ConfigMapKeys = append(merged.ConfigMapKeys, input.ConfigMapKeys...)
+		merged.Behavior = override(merged.Behavior, input.Behavior)
+		merged.DisableNameSuffixHash = merged.DisableNameSuffixHash || input.DisableNameSuffixHash
+		merged.StringData = merged.StringData || input.StringData
+		merged.Encoding = override(merged.Encoding, input.Encoding)
+		merged.CertFile = override(merged.CertFile, input.CertFile)
+		merged.KeyFile = override(merged.KeyFile, input.KeyFile)
+		merged.SSHPrivateKeyFile = override(merged.SSHPrivateKeyFile, input.SSHPrivateKeyFile)
+		merged.KnownHostsFile = override(merged.KnownHostsFile, input.KnownHostsFile)
+		merged.UsernameFile = override(merged.UsernameFile, input.UsernameFile)
+		merged.PasswordFile = override(merged.PasswordFile, input.PasswordFile)
+		if input.SourceDir.Path != "" {
+			merged.SourceDir = input.SourceDir
+		}
+		merged.Sops.AWSProfile = override(merged.Sops.AWSProfile, input.Sops.AWSProfile)
+		merged.Sops.AWSRegion = override(merged.Sops.AWSRegion, input.Sops.AWSRegion)
+		merged.Sops.AWS.Profile = override(merged.Sops.AWS.Profile, input.Sops.AWS.Profile)
+		merged.Sops.AWS.RoleArn = override(merged.Sops.AWS.RoleArn, input.Sops.AWS.RoleArn)
+		merged.Sops.GCP.CredentialsFile = override(merged.Sops.GCP.CredentialsFile, input.Sops.GCP.CredentialsFile)
+		merged.Sops.Azure.TenantID = override(merged.Sops.Azure.TenantID, input.Sops.Azure.TenantID)
+		merged.Sops.Azure.ClientID = override(merged.Sops.Azure.ClientID, input.Sops.Azure.ClientID)
+		merged.Sops.Azure.UseMSI = merged.Sops.Azure.UseMSI || input.Sops.Azure.UseMSI
+		if input.Sops.HCVault != (SopsHCVaultConfig{}) {
+			merged.Sops.HCVault = input.Sops.HCVault
+		}
+		merged.Sops.PGP.GnuPGHome = override(merged.Sops.PGP.GnuPGHome, input.Sops.PGP.GnuPGHome)
+		merged.Sops.PGP.KeyringFile = override(merged.Sops.PGP.KeyringFile, input.Sops.PGP.KeyringFile)
+		merged.Sops.ConfigPath = override(merged.Sops.ConfigPath, input.Sops.ConfigPath)
+		merged.Sops.KeyServices = append(merged.Sops.KeyServices, input.Sops.KeyServices...)
+		merged.Sops.RequiredRecipients = append(merged.Sops.RequiredRecipients, input.Sops.RequiredRecipients...)
+		if len(input.Sops.KeyGroups) > 0 {
+			merged.Sops.KeyGroups = input.Sops.KeyGroups
+		}
+		merged.MaxAge = override(merged.MaxAge, input.MaxAge)
+		for ext, format := range input.ExtensionFormats {
+			if merged.ExtensionFormats == nil {
+				merged.ExtensionFormats = make(map[string]string)
+			}
+			merged.ExtensionFormats[ext] = format
+		}
+	}
+	if mergedKind == configMapKind {
+		merged.Kind = configMapKind
+	}
+	return merged, nil
+}
+
+// override returns value if it is set, and current otherwise.
+func override(current string, value string) string {
+	if value != "" {
+		return value
+	}
+	return current
+}
@@ -0,0 +1,146 @@
+// Copyright 2019 Go About B.V. and contributors
+// Licensed under the Apache License, Version 2.0.
+
+package generator
+
+import (
+	"io/ioutil"
+	"reflect"
+	"testing"
+)
+
+func Test_MergeSpecs(t *testing.T) {
+	tests := []struct {
+		name    string
+		fns     []string
+		want    SopsSecretGenerator
+		wantErr bool
+	}{
+		{
+			"Fragments",
+			[]string{"testdata/generator-fragment1.yaml", "testdata/generator-fragment2.yaml"},
+			SopsSecretGenerator{
+				TypeMeta:              TypeMeta{APIVersion: apiVersion, Kind: kind},
+				ObjectMeta:            ObjectMeta{Name: "secret", Labels: kvMap{"app": "my-app", "tier": "backend"}, Annotations: kvMap{}},
+				EnvSources:            sources("testdata/vars.env"),
+				FileSources:           sources("testdata/file.txt"),
+				DisableNameSuffixHash: true,
+			},
+			false,
+		},
+		{"MissingName", []string{"testdata/generator-fragment2.yaml"}, SopsSecretGenerator{}, true},
+		{"ConflictingName", []string{"testdata/generator-fragment1.yaml", "testdata/generator-fragment-othername.yaml"}, SopsSecretGenerator{}, true},
+		{"WrongKind", []string{"testdata/generator-fragment1.yaml", "testdata/generator-wrongkind.yaml"}, SopsSecretGenerator{}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var specs [][]byte
+			for _, fn := range tt.fns {
+				spec, _ := ioutil.ReadFile(fn)
+				specs = append(specs, spec)
+			}
+			got, err := MergeSpecs(specs...)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("MergeSpecs() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if tt.wantErr {
+				return
+			}
+			input, err := readInput(got, Options{Strict: true})
+			if err != nil {
+				t.Errorf("readInput() error = %v", err)
+				return
+			}
+			if !reflect.DeepEqual(input, tt.want) {
+				t.Errorf("MergeSpecs() got = %v, want %v", input, tt.want)
+			}
+		})
+	}
+}
+
+func Test_MergeSpecsStrict(t *testing.T) {
+	fragment, _ := ioutil.ReadFile("testdata/generator-fragment1.yaml")
+	unknown, _ := ioutil.ReadFile("testdata/generator-unknownfield.yaml")
+	if _, err := MergeSpecs(fragment, unknown); err != nil {
+		t.Errorf("MergeSpecs() error = %v", err)
+	}
+	if _, err := MergeSpecsStrict(fragment, unknown); err == nil {
+		t.Errorf("MergeSpecsStrict() error = nil, want unknown field error")
+	}
+}
+
+func Test_mergeSpecs(t *testing.T) {
+	tests := []struct {
+		name    string
+		inputs  []SopsSecretGenerator
+		want    SopsSecretGenerator
+		wantErr bool
+	}{
+		{
+			"Override",
+			[]SopsSecretGenerator{
+				{ObjectMeta: ObjectMeta{Name: "secret", Namespace: "a", Annotations: kvMap{"x": "1", "y": "1"}}, Behavior: "create", Encoding: "url"},
+				{ObjectMeta: ObjectMeta{Namespace: "b", Annotations: kvMap{"y": "2"}}, Behavior: "replace", Sops: SopsConfig{AWSRegion: "eu-west-1"}},
+			},
+			SopsSecretGenerator{
+				TypeMeta:   TypeMeta{APIVersion: apiVersion, Kind: kind},
+				ObjectMeta: ObjectMeta{Name: "secret", Namespace: "b", Annotations: kvMap{"x": "1", "y": "2"}},
+				Behavior:   "replace",
+				Encoding:   "url",
+				Sops:       SopsConfig{AWSRegion: "eu-west-1"},
+			},
+			false,
+		},
+		{
+			"Sources",
+			[]SopsSecretGenerator{
+				{EnvSources: sources("a.env"), FileSources: sources("a.txt")},
+				{EnvSources: sources("b.env"), Type: "Opaque"},
+				{Type: "Opaque"},
+			},
+			SopsSecretGenerator{
+				TypeMeta:    TypeMeta{APIVersion: apiVersion, Kind: kind},
+				ObjectMeta:  ObjectMeta{Annotations: kvMap{}},
+				EnvSources:  sources("a.env", "b.env"),
+				FileSources: sources("a.txt"),
+				Type:        "Opaque",
+			},
+			false,
+		},
+		{
+			"ConfigMap",
+			[]SopsSecretGenerator{{TypeMeta: TypeMeta{Kind: configMapKind}}, {EnvSources: sources("a.env")}},
+			SopsSecretGenerator{
+				TypeMeta:   TypeMeta{APIVersion: apiVersion, Kind: configMapKind},
+				ObjectMeta: ObjectMeta{Annotations: kvMap{}},
+				EnvSources: sources("a.env"),
+			},
+			false,
+		},
+		{
+			"ConflictingKind",
+			[]SopsSecretGenerator{{TypeMeta: TypeMeta{Kind: configMapKind}}, {TypeMeta: TypeMeta{Kind: kind}}},
+			SopsSecretGenerator{},
+			true,
+		},
+		{
+			"ConflictingType",
+			[]SopsSecretGenerator{{Type: "Opaque"}, {Type: "kubernetes.io/tls"}},
+			SopsSecretGenerator{},
+			true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := mergeSpecs(tt.inputs)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("mergeSpecs() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("mergeSpecs() got = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
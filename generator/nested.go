@@ -0,0 +1,60 @@
+// Copyright 2019 Go About B.V. and contributors
+// Licensed under the Apache License, Version 2.0.
+
+package generator
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/pkg/errors"
+	"gopkg.in/yaml.v2"
+)
+
+// maxDecryptDepth limits how deeply sops documents can be nested in values.
+const maxDecryptDepth = 5
+
+// decryptNested decrypts values that are sops documents themselves, until
+// they no longer are.
+func decryptNested(ctx context.Context, data kvMap, opts Options) error {
+	for k, v := range data {
+		for depth := 0; ; depth++ {
+			format := nestedSopsFormat(v)
+			if format == "" {
+				break
+			}
+			if depth == maxDecryptDepth {
+				return fmt.Errorf("value for key %v is nested more than %d sops documents deep", k, maxDecryptDepth)
+			}
+			decrypted, err := decrypt(ctx, []byte(v), format, opts)
+			if err != nil {
+				return errors.Wrapf(err, "value for key %v", k)
+			}
+			v = string(decrypted)
+		}
+		data[k] = v
+	}
+	return nil
+}
+
+// nestedSopsFormat returns the sops format of a value that is a YAML or JSON
+// sops document, and "" for other values.
+func nestedSopsFormat(value string) string {
+	if !strings.Contains(value, "sops") {
+		return ""
+	}
+	d := make(map[string]interface{})
+	if yaml.Unmarshal([]byte(value), &d) != nil {
+		return ""
+	}
+	switch d["sops"].(type) {
+	case map[interface{}]interface{}, map[string]interface{}:
+	default:
+		return ""
+	}
+	if strings.HasPrefix(strings.TrimSpace(value), "{") {
+		return "json"
+	}
+	return "yaml"
+}
@@ -0,0 +1,80 @@
+// Copyright 2019 Go About B.V. and contributors
+// Licensed under the Apache License, Version 2.0.
+
+package generator
+
+import (
+	"context"
+	"reflect"
+	"testing"
+
+	"github.com/pkg/errors"
+)
+
+const nestedYAML = "password: ENC[AES256_GCM,data:x]\nsops:\n  version: 3.4.0\n"
+const nestedJSON = `{"password": "ENC[AES256_GCM,data:x]", "sops": {"version": "3.4.0"}}`
+
+func Test_nestedSopsFormat(t *testing.T) {
+	tests := []struct {
+		name  string
+		value string
+		want  string
+	}{
+		{"YAML", nestedYAML, "yaml"},
+		{"JSON", nestedJSON, "json"},
+		{"Plain", "sops", ""},
+		{"SopsNotMap", "sops: yes", ""},
+		{"NotYAML", "sops: [", ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := nestedSopsFormat(tt.value); got != tt.want {
+				t.Errorf("nestedSopsFormat() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func Test_decryptNested(t *testing.T) {
+	// unwrap decrypts a nested document by returning the document it wraps
+	unwrap := map[string]string{
+		nestedYAML: "password: secret\n",
+		nestedJSON: nestedYAML,
+	}
+	decryptFake := func(content []byte, format string) ([]byte, error) {
+		if v, ok := unwrap[string(content)]; ok {
+			return []byte(v), nil
+		}
+		return nil, errors.New("not a sops document")
+	}
+	loop := func(content []byte, format string) ([]byte, error) {
+		return content, nil
+	}
+	type args struct {
+		data    kvMap
+		decrypt DecryptFunc
+	}
+	tests := []struct {
+		name    string
+		args    args
+		want    kvMap
+		wantErr bool
+	}{
+		{"Plain", args{kvMap{"A": "val"}, decryptFake}, kvMap{"A": "val"}, false},
+		{"Nested", args{kvMap{"A": nestedYAML, "B": "val"}, decryptFake}, kvMap{"A": "password: secret\n", "B": "val"}, false},
+		{"NestedTwice", args{kvMap{"A": nestedJSON}, decryptFake}, kvMap{"A": "password: secret\n"}, false},
+		{"DepthLimit", args{kvMap{"A": nestedYAML}, loop}, nil, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := decryptNested(context.Background(), tt.args.data, Options{Decrypt: tt.args.decrypt})
+			if (err != nil) != tt.wantErr {
+				t.Errorf("decryptNested() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if !tt.wantErr && !reflect.DeepEqual(tt.args.data, tt.want) {
+				t.Errorf("decryptNested() got = %v, want %v", tt.args.data, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,112 @@
+// Copyright 2019 Go About B.V. and contributors
+// Licensed under the Apache License, Version 2.0.
+
+package generator
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+	"strings"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/s3"
+	"github.com/aws/aws-sdk-go/service/s3/s3manager"
+	"github.com/pkg/errors"
+	"google.golang.org/api/option"
+	storage "google.golang.org/api/storage/v1"
+)
+
+// Schemes of sources in object stores, s3://BUCKET/KEY and gs://BUCKET/OBJECT
+const (
+	s3Scheme  = "s3://"
+	gcsScheme = "gs://"
+)
+
+// isObjectStorePath returns whether a source path refers to an object in S3
+// or Google Cloud Storage.
+func isObjectStorePath(source string) bool {
+	return strings.HasPrefix(source, s3Scheme) || strings.HasPrefix(source, gcsScheme)
+}
+
+// splitObjectStorePath splits the path of an object store source into the
+// bucket and the name of the object.
+func splitObjectStorePath(source string) (bucket string, object string, err error) {
+	u, err := url.Parse(source)
+	if err != nil {
+		return "", "", err
+	}
+	object = strings.TrimPrefix(u.Path, "/")
+	if u.Host == "" || object == "" {
+		return "", "", fmt.Errorf("object store source %v must be %vBUCKET/OBJECT", source, u.Scheme+"://")
+	}
+	return u.Host, object, nil
+}
+
+// readObjectStore downloads an object from S3 or Google Cloud Storage, with
+// the credentials of the standard chain of the SDK, such as the environment,
+// the shared configuration or the instance role. The download is aborted
+// after opts.FetchTimeout, and limited to opts.MaxSourceSize bytes.
+func readObjectStore(ctx context.Context, source string, opts Options) ([]byte, error) {
+	bucket, object, err := splitObjectStorePath(source)
+	if err != nil {
+		return nil, err
+	}
+	timeout := opts.FetchTimeout
+	if timeout <= 0 {
+		timeout = defaultFetchTimeout
+	}
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	if strings.HasPrefix(source, s3Scheme) {
+		return readS3(ctx, bucket, object, opts)
+	}
+	return readGCS(ctx, bucket, object, opts)
+}
+
+// readS3 downloads an object from S3, with the AWS profile and region of
+// opts, if set. Without a configured region, the region of the bucket is
+// looked up.
+func readS3(ctx context.Context, bucket string, key string, opts Options) ([]byte, error) {
+	sessOpts := session.Options{Profile: opts.AWSProfile, SharedConfigState: session.SharedConfigEnable}
+	if opts.AWSRegion != "" {
+		sessOpts.Config.Region = aws.String(opts.AWSRegion)
+	}
+	sess, err := session.NewSessionWithOptions(sessOpts)
+	if err != nil {
+		return nil, errors.Wrap(err, "AWS session")
+	}
+	region := aws.StringValue(sess.Config.Region)
+	if region == "" {
+		region, err = s3manager.GetBucketRegion(ctx, sess, bucket, "us-east-1")
+		if err != nil {
+			return nil, errors.Wrapf(err, "region of S3 bucket %v", bucket)
+		}
+	}
+	out, err := s3.New(sess, aws.NewConfig().WithRegion(region)).GetObjectWithContext(ctx, &s3.GetObjectInput{
+		Bucket: aws.String(bucket),
+		Key:    aws.String(key),
+	})
+	if err != nil {
+		return nil, err
+	}
+	defer out.Body.Close()
+	return readStream(ctx, out.Body, opts.MaxSourceSize)
+}
+
+// readGCS downloads an object from Google Cloud Storage, with the
+// application default credentials.
+func readGCS(ctx context.Context, bucket string, object string, opts Options) ([]byte, error) {
+	service, err := storage.NewService(ctx, option.WithScopes(storage.DevstorageReadOnlyScope))
+	if err != nil {
+		return nil, errors.Wrap(err, "Google Cloud Storage client")
+	}
+	resp, err := service.Objects.Get(bucket, object).Context(ctx).Download()
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	return readStream(ctx, resp.Body, opts.MaxSourceSize)
+}
@@ -0,0 +1,54 @@
+// Copyright 2019 Go About B.V. and contributors
+// Licensed under the Apache License, Version 2.0.
+
+package generator
+
+import "testing"
+
+func Test_splitObjectStorePath(t *testing.T) {
+	tests := []struct {
+		name       string
+		source     string
+		wantBucket string
+		wantObject string
+		wantErr    bool
+	}{
+		{"S3", "s3://secrets/terraform/app.enc.yaml", "secrets", "terraform/app.enc.yaml", false},
+		{"GCS", "gs://secrets/app.env", "secrets", "app.env", false},
+		{"NoObject", "s3://secrets/", "", "", true},
+		{"NoBucket", "gs:///app.env", "", "", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			bucket, object, err := splitObjectStorePath(tt.source)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("splitObjectStorePath() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if bucket != tt.wantBucket || object != tt.wantObject {
+				t.Errorf("splitObjectStorePath() = %v, %v, want %v, %v", bucket, object, tt.wantBucket, tt.wantObject)
+			}
+		})
+	}
+}
+
+func Test_isLocalPath(t *testing.T) {
+	tests := []struct {
+		path string
+		want bool
+	}{
+		{"secrets/app.env", true},
+		{"vault://secret/data/app", false},
+		{"https://example.com/app.env", false},
+		{"git::https://example.com/secrets.git//app.env", false},
+		{"s3://secrets/app.env", false},
+		{"gs://secrets/app.env", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.path, func(t *testing.T) {
+			if got := isLocalPath(tt.path); got != tt.want {
+				t.Errorf("isLocalPath() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,143 @@
+// Copyright 2019 Go About B.V. and contributors
+// Licensed under the Apache License, Version 2.0.
+
+package generator
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"unicode/utf16"
+)
+
+// parsePropertiesContent adds the keys of a Java properties document to
+// data, following java.util.Properties: a line ending with a backslash
+// continues on the next line, the key ends at the first unescaped =, : or
+// whitespace, and \uXXXX escapes are decoded. As in Java, a key that is
+// repeated takes its last value. It returns the keys in the order of the
+// document.
+func parsePropertiesContent(content []byte, data kvMap) ([]string, error) {
+	lines := strings.Split(strings.Replace(string(content), "\r\n", "\n", -1), "\n")
+	var order []string
+	for i := 0; i < len(lines); i++ {
+		lineNum := i + 1
+		line := strings.TrimLeft(lines[i], " \t\f")
+		if line == "" || line[0] == '#' || line[0] == '!' {
+			continue
+		}
+		for endsWithContinuation(line) && i+1 < len(lines) {
+			i++
+			line = line[:len(line)-1] + strings.TrimLeft(lines[i], " \t\f")
+		}
+		if endsWithContinuation(line) {
+			line = line[:len(line)-1]
+		}
+
+		key, value, err := splitProperty(line)
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %v", lineNum, err)
+		}
+		if _, ok := data[key]; !ok {
+			order = append(order, key)
+		}
+		data[key] = value
+	}
+	return order, nil
+}
+
+// endsWithContinuation reports whether line ends with an odd number of
+// backslashes, so that the last one joins the next line.
+func endsWithContinuation(line string) bool {
+	n := 0
+	for i := len(line) - 1; i >= 0 && line[i] == '\\'; i-- {
+		n++
+	}
+	return n%2 == 1
+}
+
+// splitProperty splits a logical line into its unescaped key and value.
+func splitProperty(line string) (string, string, error) {
+	end := len(line)
+	for i := 0; i < len(line); i++ {
+		c := line[i]
+		if c == '\\' {
+			i++
+			continue
+		}
+		if c == '=' || c == ':' || c == ' ' || c == '\t' || c == '\f' {
+			end = i
+			break
+		}
+	}
+	rest := strings.TrimLeft(line[end:], " \t\f")
+	if rest != "" && (rest[0] == '=' || rest[0] == ':') {
+		rest = strings.TrimLeft(rest[1:], " \t\f")
+	}
+	key, err := unescapeProperty(line[:end])
+	if err != nil {
+		return "", "", err
+	}
+	value, err := unescapeProperty(rest)
+	if err != nil {
+		return "", "", err
+	}
+	return key, value, nil
+}
+
+// unescapeProperty decodes the escapes of a properties key or value. A
+// backslash before any other character stands for that character.
+func unescapeProperty(s string) (string, error) {
+	if !strings.Contains(s, "\\") {
+		return s, nil
+	}
+	var sb strings.Builder
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		if c != '\\' || i+1 == len(s) {
+			sb.WriteByte(c)
+			continue
+		}
+		i++
+		switch s[i] {
+		case 't':
+			sb.WriteByte('\t')
+		case 'n':
+			sb.WriteByte('\n')
+		case 'r':
+			sb.WriteByte('\r')
+		case 'f':
+			sb.WriteByte('\f')
+		case 'u':
+			r, err := parseUnicodeEscape(s[i:])
+			if err != nil {
+				return "", err
+			}
+			i += 4
+			// Characters outside the BMP are escaped as surrogate pairs
+			if utf16.IsSurrogate(r) && strings.HasPrefix(s[i+1:], "\\u") {
+				if low, err := parseUnicodeEscape(s[i+2:]); err == nil {
+					if pair := utf16.DecodeRune(r, low); pair != '\uFFFD' {
+						r = pair
+						i += 6
+					}
+				}
+			}
+			sb.WriteRune(r)
+		default:
+			sb.WriteByte(s[i])
+		}
+	}
+	return sb.String(), nil
+}
+
+// parseUnicodeEscape decodes the XXXX of a uXXXX escape at the start of s.
+func parseUnicodeEscape(s string) (rune, error) {
+	if len(s) < 5 {
+		return 0, fmt.Errorf("invalid unicode escape \\%v", s)
+	}
+	code, err := strconv.ParseUint(s[1:5], 16, 16)
+	if err != nil {
+		return 0, fmt.Errorf("invalid unicode escape \\%v", s[:5])
+	}
+	return rune(code), nil
+}
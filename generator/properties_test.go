@@ -0,0 +1,68 @@
+// Copyright 2019 Go About B.V. and contributors
+// Licensed under the Apache License, Version 2.0.
+
+package generator
+
+import (
+	"reflect"
+	"testing"
+)
+
+func Test_parsePropertiesContent(t *testing.T) {
+	tests := []struct {
+		name      string
+		content   []byte
+		want      kvMap
+		wantOrder []string
+		wantErr   bool
+	}{
+		{
+			"Separators",
+			b("a=1\nb: 2\nc 3\nd = 4\n  e\t:\t5\nf\n"),
+			kvMap{"a": "1", "b": "2", "c": "3", "d": "4", "e": "5", "f": ""},
+			[]string{"a", "b", "c", "d", "e", "f"},
+			false,
+		},
+		{"Comments", b("# comment\n! comment \\\n\nkey=value\n"), kvMap{"key": "value"}, []string{"key"}, false},
+		{
+			"Continuation",
+			b("list = a, \\\n        b, \\\n        c\nnext = d\n"),
+			kvMap{"list": "a, b, c", "next": "d"},
+			[]string{"list", "next"},
+			false,
+		},
+		{"EscapedBackslash", b("path = C:\\\\dir\\\\\nnext = x\n"), kvMap{"path": `C:\dir\`, "next": "x"}, []string{"path", "next"}, false},
+		{"EscapedKey", b("my\\ key\\=x = v\n"), kvMap{"my key=x": "v"}, []string{"my key=x"}, false},
+		{
+			"Escapes",
+			b("e = caf\\u00e9\\tend\\n\nsmile = \\uD83D\\uDE00\nother = \\q\n"),
+			kvMap{"e": "café\tend\n", "smile": "😀", "other": "q"},
+			[]string{"e", "smile", "other"},
+			false,
+		},
+		{"CRLF", b("a=1\r\nb=2\r\n"), kvMap{"a": "1", "b": "2"}, []string{"a", "b"}, false},
+		{"Repeated", b("a=1\nb=2\na=3\n"), kvMap{"a": "3", "b": "2"}, []string{"a", "b"}, false},
+		{"Empty", b(""), kvMap{}, nil, false},
+		{"InvalidUnicode", b("a = \\u00zz\n"), nil, nil, true},
+		{"ShortUnicode", b("a = \\u00\n"), nil, nil, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := make(kvMap)
+			order, err := parsePropertiesContent(tt.content, got)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("parsePropertiesContent() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if tt.wantErr {
+				return
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("parsePropertiesContent() got = %v, want %v", got, tt.want)
+			}
+			if !reflect.DeepEqual(order, tt.wantOrder) {
+				t.Errorf("parsePropertiesContent() order = %v, want %v", order, tt.wantOrder)
+			}
+		})
+	}
+}
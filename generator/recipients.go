@@ -0,0 +1,75 @@
+// Copyright 2019 Go About B.V. and contributors
+// Licensed under the Apache License, Version 2.0.
+
+package generator
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// checkRecipients checks that sops content is encrypted to all required
+// recipients, in any of its key groups, and only to allowed recipients, if
+// any are set. Recipients are the ARNs of KMS keys, the fingerprints of PGP
+// keys, the resource IDs of GCP KMS keys and the key URLs of Azure Key Vault
+// keys, as in the sops metadata. Allowed recipients may contain wildcards.
+func checkRecipients(content []byte, format string, required []string, allowed []string) error {
+	tree, err := newSopsStore(format).LoadEncryptedFile(content)
+	if err != nil {
+		return errors.Wrap(err, "sops metadata")
+	}
+	recipients := make(map[string]bool)
+	var disallowed []string
+	for _, group := range tree.Metadata.KeyGroups {
+		for _, key := range group {
+			r := normalizeRecipient(key.ToString())
+			recipients[r] = true
+			if len(allowed) > 0 && !recipientAllowed(r, allowed) {
+				disallowed = append(disallowed, key.ToString())
+			}
+		}
+	}
+	if len(disallowed) > 0 {
+		return fmt.Errorf("encrypted to recipients that the policy does not allow: %v", strings.Join(disallowed, ", "))
+	}
+	var missing []string
+	for _, r := range required {
+		if !recipients[normalizeRecipient(r)] {
+			missing = append(missing, r)
+		}
+	}
+	if len(missing) > 0 {
+		return fmt.Errorf("not encrypted to required recipients %v", strings.Join(missing, ", "))
+	}
+	return nil
+}
+
+// recipientAllowed returns whether a normalized recipient matches one of the
+// allowed patterns, in which * matches any text, including /.
+func recipientAllowed(r string, allowed []string) bool {
+	for _, pattern := range allowed {
+		parts := strings.Split(normalizeRecipient(pattern), "*")
+		for i, part := range parts {
+			parts[i] = regexp.QuoteMeta(part)
+		}
+		if regexp.MustCompile("^" + strings.Join(parts, ".*") + "$").MatchString(r) {
+			return true
+		}
+	}
+	return false
+}
+
+// normalizeRecipient makes PGP fingerprints comparable, which are written
+// in upper or lower case and often in groups of four.
+func normalizeRecipient(r string) string {
+	r = strings.Replace(strings.TrimSpace(r), " ", "", -1)
+	for _, c := range r {
+		if !strings.ContainsRune("0123456789abcdefABCDEF", c) {
+			return r
+		}
+	}
+	return strings.ToUpper(r)
+}
@@ -0,0 +1,78 @@
+// Copyright 2019 Go About B.V. and contributors
+// Licensed under the Apache License, Version 2.0.
+
+package generator
+
+import (
+	"io/ioutil"
+	"testing"
+)
+
+func Test_checkRecipients(t *testing.T) {
+	content, err := ioutil.ReadFile("testdata/file.txt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		name     string
+		required []string
+		allowed  []string
+		wantErr  bool
+	}{
+		{"Fingerprint", []string{"2D2483DF73A3A0FAEE3C2A695BDC395360CE8FF4"}, nil, false},
+		{"LowerCaseGroups", []string{"2d24 83df 73a3 a0fa ee3c  2a69 5bdc 3953 60ce 8ff4"}, nil, false},
+		{"Missing", []string{"2D2483DF73A3A0FAEE3C2A695BDC395360CE8FF4", "arn:aws:kms:eu-west-1:123456789012:key/team"}, nil, true},
+		{"Allowed", nil, []string{"arn:aws:kms:*:123456789012:key/*", "2d2483df73a3a0faee3c2a695bdc395360ce8ff4"}, false},
+		{"NotAllowed", nil, []string{"arn:aws:kms:*:123456789012:key/*"}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := checkRecipients(content, "binary", tt.required, tt.allowed); (err != nil) != tt.wantErr {
+				t.Errorf("checkRecipients() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func Test_normalizeRecipient(t *testing.T) {
+	tests := []struct {
+		name string
+		r    string
+		want string
+	}{
+		{"Fingerprint", "2d24 83df 73a3", "2D2483DF73A3"},
+		{"ARN", "arn:aws:kms:eu-west-1:123456789012:alias/Team", "arn:aws:kms:eu-west-1:123456789012:alias/Team"},
+		{"Space", " https://vault.vault.azure.net/keys/sops/1 ", "https://vault.vault.azure.net/keys/sops/1"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := normalizeRecipient(tt.r); got != tt.want {
+				t.Errorf("normalizeRecipient() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func Test_recipientAllowed(t *testing.T) {
+	allowed := []string{"arn:aws:kms:*:123456789012:key/*", "https://team.vault.azure.net/keys/*", "2D2483DF73A3A0FAEE3C2A695BDC395360CE8FF4"}
+	tests := []struct {
+		name string
+		r    string
+		want bool
+	}{
+		{"KMS", "arn:aws:kms:eu-west-1:123456789012:key/6b3c0f9e", true},
+		{"OtherAccount", "arn:aws:kms:eu-west-1:210987654321:key/6b3c0f9e", false},
+		{"Azure", "https://team.vault.azure.net/keys/sops/0a1b2c", true},
+		{"PGP", "2D2483DF73A3A0FAEE3C2A695BDC395360CE8FF4", true},
+		{"PersonalPGP", "0123456789ABCDEF0123456789ABCDEF01234567", false},
+		{"Prefix", "arn:aws:kms:eu-west-1:123456789012:key/6b3c0f9e.evil", true},
+		{"Suffix", "xarn:aws:kms:eu-west-1:123456789012:key/6b3c0f9e", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := recipientAllowed(tt.r, allowed); got != tt.want {
+				t.Errorf("recipientAllowed() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
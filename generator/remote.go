@@ -0,0 +1,88 @@
+// Copyright 2019 Go About B.V. and contributors
+// Licensed under the Apache License, Version 2.0.
+
+package generator
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// remoteScheme starts the path of a source that is downloaded, such as a
+// sops-encrypted file published on an artifact server.
+const remoteScheme = "https://"
+
+// defaultFetchTimeout aborts downloading a remote source, if the options do
+// not set a timeout.
+const defaultFetchTimeout = 30 * time.Second
+
+// remoteClient downloads remote sources. Tests replace it by the client of
+// their TLS server.
+var remoteClient = http.DefaultClient
+
+// isRemotePath returns whether a source path is a URL to download.
+func isRemotePath(source string) bool {
+	return strings.HasPrefix(source, remoteScheme)
+}
+
+// remoteFilePath returns the path of the URL of a remote source, without
+// its query, from which the format of the source follows.
+func remoteFilePath(source string) string {
+	u, err := url.Parse(source)
+	if err != nil {
+		return source
+	}
+	return u.Path
+}
+
+// readRemote downloads a remote source. The download is aborted after
+// opts.FetchTimeout, and limited to opts.MaxSourceSize bytes like files.
+func readRemote(ctx context.Context, source string, opts Options) ([]byte, error) {
+	timeout := opts.FetchTimeout
+	if timeout <= 0 {
+		timeout = defaultFetchTimeout
+	}
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	req, err := http.NewRequest("GET", source, nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := remoteClient.Do(req.WithContext(ctx))
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("server returned %v", resp.Status)
+	}
+	return readStream(ctx, resp.Body, opts.MaxSourceSize)
+}
+
+// verifyChecksum checks that content has the checksum of its source, in the
+// form sha256:HEX, if it is set.
+func verifyChecksum(content []byte, checksum string) error {
+	if checksum == "" {
+		return nil
+	}
+	i := strings.Index(checksum, ":")
+	if i < 0 || checksum[:i] != "sha256" {
+		return fmt.Errorf("unsupported checksum %v, use sha256:HEX", checksum)
+	}
+	want, err := hex.DecodeString(checksum[i+1:])
+	if err != nil || len(want) != sha256.Size {
+		return fmt.Errorf("invalid sha256 checksum %v", checksum[i+1:])
+	}
+	got := sha256.Sum256(content)
+	if string(got[:]) != string(want) {
+		return fmt.Errorf("checksum mismatch: got sha256:%x", got)
+	}
+	return nil
+}
@@ -0,0 +1,102 @@
+// Copyright 2019 Go About B.V. and contributors
+// Licensed under the Apache License, Version 2.0.
+
+package generator
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func Test_readRemote(t *testing.T) {
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/vars.env":
+			_, _ = w.Write([]byte("VAR=value\n"))
+		case "/slow.env":
+			time.Sleep(100 * time.Millisecond)
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer server.Close()
+	defer func(client *http.Client) { remoteClient = client }(remoteClient)
+	remoteClient = server.Client()
+
+	tests := []struct {
+		name    string
+		path    string
+		opts    Options
+		want    string
+		wantErr bool
+	}{
+		{"Download", "/vars.env", Options{}, "VAR=value\n", false},
+		{"NotFound", "/missing.env", Options{}, "", true},
+		{"TooLarge", "/vars.env", Options{MaxSourceSize: 4}, "", true},
+		{"Timeout", "/slow.env", Options{FetchTimeout: 10 * time.Millisecond}, "", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := readRemote(context.Background(), server.URL+tt.path, tt.opts)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("readRemote() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if string(got) != tt.want {
+				t.Errorf("readRemote() got = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func Test_remoteFormat(t *testing.T) {
+	tests := []struct {
+		path string
+		want string
+	}{
+		{"https://example.com/secrets/app.enc.yaml", "yaml"},
+		{"https://example.com/secrets/app.env?version=3", "dotenv"},
+		{"https://example.com/secrets/cert.pem", "binary"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.path, func(t *testing.T) {
+			if got := formatForPath(tt.path); got != tt.want {
+				t.Errorf("formatForPath() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func Test_verifyChecksum(t *testing.T) {
+	tests := []struct {
+		name     string
+		checksum string
+		wantErr  bool
+	}{
+		{"None", "", false},
+		{"Match", "sha256:9f86d081884c7d659a2feaa0c55ad015a3bf4f1b2b0b822cd15d6c15b0f00a08", false},
+		{"Mismatch", "sha256:0000000000000000000000000000000000000000000000000000000000000000", true},
+		{"Short", "sha256:9f86d081", true},
+		{"UnknownAlgorithm", "md5:098f6bcd4621d373cade4e832627b4f6", true},
+		{"NoAlgorithm", "9f86d081884c7d659a2feaa0c55ad015a3bf4f1b2b0b822cd15d6c15b0f00a08", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := verifyChecksum([]byte("test"), tt.checksum); (err != nil) != tt.wantErr {
+				t.Errorf("verifyChecksum() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func Test_remoteSource(t *testing.T) {
+	if isGlobPattern("https://example.com/app.env?version=3") {
+		t.Error("isGlobPattern() = true for a remote source")
+	}
+	if missingOptionalSource(Source{Path: "https://example.com/missing.env", Optional: true}, "https://example.com/missing.env") {
+		t.Error("missingOptionalSource() = true for a remote source")
+	}
+}
@@ -0,0 +1,263 @@
+// Copyright 2019 Go About B.V. and contributors
+// Licensed under the Apache License, Version 2.0.
+
+package generator
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+	"go.mozilla.org/sops"
+	sopsdotenv "go.mozilla.org/sops/stores/dotenv"
+	sopsjson "go.mozilla.org/sops/stores/json"
+	sopsyaml "go.mozilla.org/sops/stores/yaml"
+)
+
+const rotationAnnotationPrefix = "rotation.sopssecretgenerator.goabout.com/"
+
+// maxAnnotationNameLength is the maximum length of the name of an annotation,
+// after the prefix.
+const maxAnnotationNameLength = 63
+
+// sopsStore loads the encrypted tree of a sops file, including its
+// metadata, and emits the plain file of a decrypted tree.
+type sopsStore interface {
+	LoadEncryptedFile(in []byte) (sops.Tree, error)
+	EmitPlainFile(in sops.TreeBranches) ([]byte, error)
+}
+
+// rotationAnnotations returns an annotation for every sops-encrypted source
+// with the time it was last modified, according to its sops metadata. The
+// sources are not decrypted, and plain and Vault sources are skipped.
+func rotationAnnotations(ctx context.Context, input SopsSecretGenerator, opts Options) (kvMap, error) {
+	sources, err := encryptedSources(input)
+	if err != nil {
+		return nil, err
+	}
+	lastModified := make(map[string]time.Time)
+	var paths []string
+	for _, source := range sources {
+		t, ok, err := sopsLastModified(ctx, source, opts)
+		if err != nil {
+			return nil, errors.Wrapf(err, "source %v", source.Path)
+		}
+		if !ok {
+			continue
+		}
+		if _, ok := lastModified[source.Path]; !ok {
+			paths = append(paths, source.Path)
+		}
+		lastModified[source.Path] = t
+	}
+	names, err := rotationAnnotationNames(paths)
+	if err != nil {
+		return nil, err
+	}
+	annotations := make(kvMap)
+	for _, path := range paths {
+		annotations[rotationAnnotationPrefix+names[path]] = lastModified[path].UTC().Format(time.RFC3339)
+	}
+	return annotations, nil
+}
+
+// checkMaxAge checks that the sops-encrypted sources of the input were last
+// modified at most maxAge ago, according to their sops metadata, so that
+// sources that are not rotated fail. With opts.WarnMaxAge, they only warn.
+// Vault sources, which have no sops metadata, cannot be checked, and warn.
+func checkMaxAge(ctx context.Context, input SopsSecretGenerator, maxAge time.Duration, opts Options) error {
+	sources, err := encryptedSources(input)
+	if err != nil {
+		return err
+	}
+	for _, source := range sources {
+		lastModified, ok, err := sopsLastModified(ctx, source, opts)
+		if err != nil {
+			return errors.Wrapf(err, "source %v", source.Path)
+		}
+		if !ok {
+			warnf(opts, "source %v has no sops metadata, so its age is not checked against the maximum age %v", source.Path, maxAge)
+			continue
+		}
+		age := now().Sub(lastModified)
+		if age <= maxAge {
+			continue
+		}
+		if !opts.WarnMaxAge {
+			return fmt.Errorf("source %v was last modified %v ago, at %v, more than the maximum age %v", source.Path,
+				age.Round(time.Hour), lastModified.UTC().Format(time.RFC3339), maxAge)
+		}
+		warnf(opts, "source %v was last modified %v ago, at %v, more than the maximum age %v", source.Path,
+			age.Round(time.Hour), lastModified.UTC().Format(time.RFC3339), maxAge)
+	}
+	return nil
+}
+
+// parseMaxAge parses a maximum age, such as 90d or 2160h, like
+// time.ParseDuration but with a d suffix for days. An empty string is no
+// maximum.
+func parseMaxAge(s string) (time.Duration, error) {
+	if s == "" {
+		return 0, nil
+	}
+	var maxAge time.Duration
+	if strings.HasSuffix(s, "d") {
+		days, err := strconv.Atoi(strings.TrimSuffix(s, "d"))
+		if err != nil {
+			return 0, fmt.Errorf("maxAge %v is not a number of days, such as 90d, or a duration, such as 2160h", s)
+		}
+		maxAge = time.Duration(days) * 24 * time.Hour
+	} else {
+		var err error
+		maxAge, err = time.ParseDuration(s)
+		if err != nil {
+			return 0, fmt.Errorf("maxAge %v is not a number of days, such as 90d, or a duration, such as 2160h", s)
+		}
+	}
+	if maxAge <= 0 {
+		return 0, fmt.Errorf("maxAge %v must be positive", s)
+	}
+	return maxAge, nil
+}
+
+// StricterMaxAge returns the smaller of two maximum ages, such as 90d or
+// 2160h, so that neither can loosen the other. An empty string is no maximum.
+func StricterMaxAge(a, b string) (string, error) {
+	maxAgeA, err := parseMaxAge(a)
+	if err != nil {
+		return "", withClass(ClassSpec, err)
+	}
+	maxAgeB, err := parseMaxAge(b)
+	if err != nil {
+		return "", withClass(ClassSpec, err)
+	}
+	if maxAgeA == 0 || (maxAgeB > 0 && maxAgeB < maxAgeA) {
+		return b, nil
+	}
+	return a, nil
+}
+
+// encryptedSources returns the env and file sources of the input that are
+// not plain, with the path of the file they are read from, without a key or
+// an extracted value. Optional sources that do not exist are skipped.
+func encryptedSources(input SopsSecretGenerator) ([]Source, error) {
+	envSources, fileSources, err := inputSources(input)
+	if err != nil {
+		return nil, err
+	}
+	var sources []Source
+	for _, source := range envSources {
+		if !source.Plain && !missingOptionalSource(source, source.Path) {
+			sources = append(sources, source)
+		}
+	}
+	for _, source := range fileSources {
+		if source.Plain {
+			continue
+		}
+		_, fn, err := source.fileName()
+		if err != nil {
+			return nil, errors.Wrapf(err, "file source %v", source.Path)
+		}
+		if !missingOptionalSource(source, fn) {
+			source.Path, _ = splitExtractPath(fn, source.Format)
+			sources = append(sources, source)
+		}
+	}
+	return sources, nil
+}
+
+// sopsLastModified returns the lastmodified time from the sops metadata of
+// an encrypted source, in its format or that of its name. The source is read
+// like for decryption, so with the source cache of opts it is only read or
+// downloaded once. Vault sources have no sops metadata, for which ok is
+// false.
+func sopsLastModified(ctx context.Context, source Source, opts Options) (lastModified time.Time, ok bool, err error) {
+	if isVaultPath(source.Path) {
+		return time.Time{}, false, nil
+	}
+	content, err := readSource(ctx, source.Path, opts)
+	if err == nil {
+		err = verifyChecksum(content, source.Checksum)
+	}
+	if err != nil {
+		return time.Time{}, false, err
+	}
+	format, err := source.format(source.Path)
+	if err != nil {
+		return time.Time{}, false, err
+	}
+	tree, err := newSopsStore(format).LoadEncryptedFile(content)
+	if err != nil {
+		return time.Time{}, false, errors.Wrap(err, "sops metadata")
+	}
+	return tree.Metadata.LastModified, true, nil
+}
+
+// newSopsStore returns the sops store for a format.
+func newSopsStore(format string) sopsStore {
+	switch sopsFormat(format) {
+	case "yaml":
+		return &sopsyaml.Store{}
+	case "json":
+		return &sopsjson.Store{}
+	case "dotenv":
+		return &sopsdotenv.Store{}
+	}
+	return &sopsjson.BinaryStore{}
+}
+
+// rotationAnnotationNames returns the annotation names of source paths.
+// Paths whose names collide, because they differ only in characters that are
+// replaced or in a part that is cut off, get a short hash of the path in
+// their names instead.
+func rotationAnnotationNames(paths []string) (map[string]string, error) {
+	count := make(map[string]int)
+	for _, path := range paths {
+		count[rotationAnnotationName(path)]++
+	}
+	names := make(map[string]string)
+	used := make(map[string]string)
+	for _, path := range paths {
+		name := rotationAnnotationName(path)
+		if count[name] > 1 {
+			name = hashedRotationAnnotationName(path)
+		}
+		if other, ok := used[name]; ok {
+			return nil, fmt.Errorf("sources %v and %v have the same rotation annotation %v", other, path, rotationAnnotationPrefix+name)
+		}
+		used[name] = path
+		names[path] = name
+	}
+	return names, nil
+}
+
+// rotationAnnotationName turns a source path into a valid annotation name.
+// Long paths keep their end, which contains the file name.
+func rotationAnnotationName(path string) string {
+	return trimAnnotationName(secretKey(path), maxAnnotationNameLength)
+}
+
+// hashedRotationAnnotationName is like rotationAnnotationName, but ends in
+// the first 8 hexadecimal digits of the SHA-256 hash of the path.
+func hashedRotationAnnotationName(path string) string {
+	sum := sha256.Sum256([]byte(path))
+	suffix := "-" + hex.EncodeToString(sum[:])[:8]
+	return trimAnnotationName(secretKey(path), maxAnnotationNameLength-len(suffix)) + suffix
+}
+
+// trimAnnotationName keeps the last length characters of a name, without
+// characters at either end that annotation names cannot start or end with.
+func trimAnnotationName(name string, length int) string {
+	if len(name) > length {
+		name = name[len(name)-length:]
+	}
+	return strings.TrimFunc(name, func(r rune) bool {
+		return !(r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r >= '0' && r <= '9')
+	})
+}
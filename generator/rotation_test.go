@@ -0,0 +1,280 @@
+// Copyright 2019 Go About B.V. and contributors
+// Licensed under the Apache License, Version 2.0.
+
+package generator
+
+import (
+	"bytes"
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func Test_rotationAnnotations(t *testing.T) {
+	tests := []struct {
+		name    string
+		input   SopsSecretGenerator
+		want    kvMap
+		wantErr bool
+	}{
+		{
+			"Sources",
+			SopsSecretGenerator{
+				EnvSources:  sources("testdata/vars.env", "testdata/vars.yaml"),
+				FileSources: sources("secret=testdata/file.txt", "vault://kv/app#password"),
+			},
+			kvMap{
+				rotationAnnotationPrefix + "testdata_vars.env":  "2019-09-12T23:26:34Z",
+				rotationAnnotationPrefix + "testdata_vars.yaml": "2019-09-12T23:26:27Z",
+				rotationAnnotationPrefix + "testdata_file.txt":  "2019-09-12T23:06:56Z",
+			},
+			false,
+		},
+		{
+			"Plain",
+			SopsSecretGenerator{
+				EnvSources:  []Source{{Path: "testdata/plain.env", Plain: true}},
+				FileSources: []Source{{Path: "testdata/plain.txt", Plain: true}},
+			},
+			kvMap{},
+			false,
+		},
+		{"Missing", SopsSecretGenerator{EnvSources: sources("testdata/missing.env")}, nil, true},
+		{"NotEncrypted", SopsSecretGenerator{EnvSources: sources("testdata/notyaml.txt")}, nil, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := rotationAnnotations(context.Background(), tt.input, Options{})
+			if (err != nil) != tt.wantErr {
+				t.Errorf("rotationAnnotations() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("rotationAnnotations() got = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func Test_rotationAnnotationNames(t *testing.T) {
+	tests := []struct {
+		name  string
+		paths []string
+		want  map[string]string
+	}{
+		{"Distinct", []string{"a/vars.env", "b/vars.env"}, map[string]string{"a/vars.env": "a_vars.env", "b/vars.env": "b_vars.env"}},
+		{
+			"Collision",
+			[]string{"secrets/vars.env", "secrets_vars.env", "vars.env"},
+			map[string]string{
+				"secrets/vars.env": "secrets_vars.env-ff332208",
+				"secrets_vars.env": "secrets_vars.env-7f677d87",
+				"vars.env":         "vars.env",
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := rotationAnnotationNames(tt.paths)
+			if err != nil {
+				t.Fatalf("rotationAnnotationNames() error = %v", err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("rotationAnnotationNames() got = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func Test_rotationAnnotationName(t *testing.T) {
+	tests := []struct {
+		name string
+		path string
+		want string
+	}{
+		{"Plain", "vars.env", "vars.env"},
+		{"Directory", "secrets/db/vars.env", "secrets_db_vars.env"},
+		{"Relative", "../secrets/.vars.env", "secrets_.vars.env"},
+		{"Long", strings.Repeat("a", 70) + "/vars.env", strings.Repeat("a", 54) + "_vars.env"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := rotationAnnotationName(tt.path); got != tt.want {
+				t.Errorf("rotationAnnotationName() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func Test_checkMaxAge(t *testing.T) {
+	now = func() time.Time { return time.Date(2019, 12, 1, 0, 0, 0, 0, time.UTC) }
+	defer func() { now = time.Now }()
+	input := SopsSecretGenerator{
+		EnvSources:  sources("testdata/vars.env"),
+		FileSources: []Source{{Path: "testdata/plain.txt", Plain: true}},
+	}
+	tests := []struct {
+		name    string
+		maxAge  time.Duration
+		warn    bool
+		wantErr bool
+		want    string
+	}{
+		{"Recent", 90 * 24 * time.Hour, false, false, ""},
+		{"Stale", 30 * 24 * time.Hour, false, true, ""},
+		{"Warn", 30 * 24 * time.Hour, true, false, "Warning: source testdata/vars.env was last modified 1897h0m0s ago, at 2019-09-12T23:26:34Z, more than the maximum age 720h0m0s\n"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var warnings bytes.Buffer
+			err := checkMaxAge(context.Background(), input, tt.maxAge, Options{WarnMaxAge: tt.warn, Warnings: &warnings})
+			if (err != nil) != tt.wantErr {
+				t.Errorf("checkMaxAge() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if got := warnings.String(); got != tt.want {
+				t.Errorf("checkMaxAge() warnings = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func Test_checkMaxAge_NotLocal(t *testing.T) {
+	now = func() time.Time { return time.Date(2019, 12, 1, 0, 0, 0, 0, time.UTC) }
+	defer func() { now = time.Now }()
+	server := httptest.NewTLSServer(http.FileServer(http.Dir("testdata")))
+	defer server.Close()
+	defer func(client *http.Client) { remoteClient = client }(remoteClient)
+	remoteClient = server.Client()
+
+	tests := []struct {
+		name    string
+		input   SopsSecretGenerator
+		maxAge  time.Duration
+		wantErr bool
+		want    string
+	}{
+		{"RemoteRecent", SopsSecretGenerator{EnvSources: sources(server.URL + "/vars.env")}, 90 * 24 * time.Hour, false, ""},
+		{"RemoteStale", SopsSecretGenerator{EnvSources: sources(server.URL + "/vars.env")}, 30 * 24 * time.Hour, true, ""},
+		{"RemoteMissing", SopsSecretGenerator{EnvSources: sources(server.URL + "/missing.env")}, 90 * 24 * time.Hour, true, ""},
+		{
+			"Vault",
+			SopsSecretGenerator{FileSources: sources("vault://kv/app#password")},
+			30 * 24 * time.Hour,
+			false,
+			"Warning: source vault://kv/app#password has no sops metadata, so its age is not checked against the maximum age 720h0m0s\n",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var warnings bytes.Buffer
+			err := checkMaxAge(context.Background(), tt.input, tt.maxAge, Options{Warnings: &warnings})
+			if (err != nil) != tt.wantErr {
+				t.Errorf("checkMaxAge() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if got := warnings.String(); got != tt.want {
+				t.Errorf("checkMaxAge() warnings = %q, want %q", got, tt.want)
+			}
+		})
+	}
+
+	got, err := rotationAnnotations(context.Background(), SopsSecretGenerator{EnvSources: sources(server.URL + "/vars.env")}, Options{})
+	if err != nil {
+		t.Fatalf("rotationAnnotations() error = %v", err)
+	}
+	want := kvMap{rotationAnnotationPrefix + rotationAnnotationName(server.URL+"/vars.env"): "2019-09-12T23:26:34Z"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("rotationAnnotations() got = %v, want %v", got, want)
+	}
+}
+
+func Test_generateSecret_ReadsSourcesOnce(t *testing.T) {
+	now = func() time.Time { return time.Date(2019, 12, 1, 0, 0, 0, 0, time.UTC) }
+	defer func() { now = time.Now }()
+	requests := 0
+	files := http.FileServer(http.Dir("testdata"))
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		files.ServeHTTP(w, r)
+	}))
+	defer server.Close()
+	defer func(client *http.Client) { remoteClient = client }(remoteClient)
+	remoteClient = server.Client()
+
+	input := ssg([]string{server.URL + "/vars.env"}, nil)
+	input.MaxAge = "90d"
+	secret, err := generateSecret(context.Background(), input, Options{RotationAnnotations: true})
+	if err != nil {
+		t.Fatalf("generateSecret() error = %v", err)
+	}
+	if secret.Data["VAR_ENV"] == "" {
+		t.Errorf("generateSecret() got data %v, want VAR_ENV", secret.Data)
+	}
+	if requests != 1 {
+		t.Errorf("generateSecret() downloaded the source %d times, want 1", requests)
+	}
+}
+
+func Test_parseMaxAge(t *testing.T) {
+	tests := []struct {
+		s       string
+		want    time.Duration
+		wantErr bool
+	}{
+		{"", 0, false},
+		{"90d", 90 * 24 * time.Hour, false},
+		{"2160h", 2160 * time.Hour, false},
+		{"0d", 0, true},
+		{"-1h", 0, true},
+		{"ninety days", 0, true},
+		{"1.5d", 0, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.s, func(t *testing.T) {
+			got, err := parseMaxAge(tt.s)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("parseMaxAge() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if got != tt.want {
+				t.Errorf("parseMaxAge() got = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestStricterMaxAge(t *testing.T) {
+	tests := []struct {
+		a       string
+		b       string
+		want    string
+		wantErr bool
+	}{
+		{"", "", "", false},
+		{"90d", "", "90d", false},
+		{"", "90d", "90d", false},
+		{"30d", "90d", "30d", false},
+		{"90d", "30d", "30d", false},
+		{"2160h", "90d", "2160h", false},
+		{"30d", "ninety days", "", true},
+		{"-1h", "30d", "", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.a+","+tt.b, func(t *testing.T) {
+			got, err := StricterMaxAge(tt.a, tt.b)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("StricterMaxAge() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if err != nil && Classify(err) != ClassSpec {
+				t.Errorf("StricterMaxAge() error class = %v, want %v", Classify(err), ClassSpec)
+			}
+			if got != tt.want {
+				t.Errorf("StricterMaxAge() got = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,69 @@
+// Copyright 2019 Go About B.V. and contributors
+// Licensed under the Apache License, Version 2.0.
+
+package generator
+
+import (
+	"github.com/pkg/errors"
+)
+
+// SecretSpec is an entry of the secrets of a spec, which generates a Secret
+// with the metadata and settings of the spec, but its own name and sources.
+type SecretSpec struct {
+	Name        string    `json:"name" yaml:"name"`
+	Type        string    `json:"type,omitempty" yaml:"type,omitempty"`
+	Behavior    string    `json:"behavior,omitempty" yaml:"behavior,omitempty"`
+	EnvSources  []Source  `json:"envs,omitempty" yaml:"envs,omitempty"`
+	FileSources []Source  `json:"files,omitempty" yaml:"files,omitempty"`
+	Literals    []Literal `json:"literals,omitempty" yaml:"literals,omitempty"`
+}
+
+// requireSingleSecret returns an error if input has secrets, for operations
+// that work on a single Secret.
+func requireSingleSecret(input SopsSecretGenerator) error {
+	if len(input.Secrets) > 0 {
+		return withClass(ClassSpec, errors.New("secrets can only be used to generate Secrets"))
+	}
+	return nil
+}
+
+// expandSecrets returns a spec for every entry of the secrets of input, or
+// input itself if it has none. The entries share the metadata and settings
+// of input; its type and behavior are defaults for the entries.
+func expandSecrets(input SopsSecretGenerator) ([]SopsSecretGenerator, error) {
+	if len(input.Secrets) == 0 {
+		return []SopsSecretGenerator{input}, nil
+	}
+	switch {
+	case len(input.EnvSources) > 0 || len(input.FileSources) > 0 || len(input.Literals) > 0 || input.SourceDir.Path != "":
+		return nil, errors.New("secrets cannot be combined with sources of the spec itself")
+	case len(input.HashKeys) > 0:
+		return nil, errors.New("hashKeys cannot be used with secrets")
+	case len(input.ConfigMapKeys) > 0:
+		return nil, errors.New("configMapKeys cannot be used with secrets")
+	}
+
+	inputs := make([]SopsSecretGenerator, 0, len(input.Secrets))
+	names := make(map[string]bool)
+	for i, secret := range input.Secrets {
+		if secret.Name == "" {
+			return nil, errors.Errorf("secret %d has no name", i+1)
+		}
+		if names[secret.Name] {
+			return nil, errors.Errorf("secret %v is defined twice", secret.Name)
+		}
+		names[secret.Name] = true
+
+		expanded := input
+		expanded.Secrets = nil
+		expanded.Name = secret.Name
+		expanded.GenerateName = ""
+		expanded.Type = override(input.Type, secret.Type)
+		expanded.Behavior = override(input.Behavior, secret.Behavior)
+		expanded.EnvSources = secret.EnvSources
+		expanded.FileSources = secret.FileSources
+		expanded.Literals = secret.Literals
+		inputs = append(inputs, expanded)
+	}
+	return inputs, nil
+}
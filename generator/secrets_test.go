@@ -0,0 +1,69 @@
+// Copyright 2019 Go About B.V. and contributors
+// Licensed under the Apache License, Version 2.0.
+
+package generator
+
+import (
+	"reflect"
+	"testing"
+)
+
+func Test_expandSecrets(t *testing.T) {
+	parent := SopsSecretGenerator{
+		TypeMeta:   TypeMeta{APIVersion: apiVersion, Kind: kind},
+		ObjectMeta: ObjectMeta{Namespace: "default", Labels: kvMap{"app": "my-app"}},
+		Behavior:   "create",
+		Type:       "Opaque",
+	}
+	tests := []struct {
+		name    string
+		input   SopsSecretGenerator
+		secrets []SecretSpec
+		want    []SopsSecretGenerator
+		wantErr bool
+	}{
+		{"None", ssg([]string{"a.env"}, nil), nil, []SopsSecretGenerator{ssg([]string{"a.env"}, nil)}, false},
+		{
+			"Secrets",
+			parent,
+			[]SecretSpec{
+				{Name: "first", EnvSources: sources("a.env")},
+				{Name: "second", Type: "kubernetes.io/tls", Behavior: "merge", FileSources: sources("b.txt")},
+			},
+			[]SopsSecretGenerator{
+				{
+					TypeMeta:   TypeMeta{APIVersion: apiVersion, Kind: kind},
+					ObjectMeta: ObjectMeta{Name: "first", Namespace: "default", Labels: kvMap{"app": "my-app"}},
+					Behavior:   "create",
+					Type:       "Opaque",
+					EnvSources: sources("a.env"),
+				},
+				{
+					TypeMeta:    TypeMeta{APIVersion: apiVersion, Kind: kind},
+					ObjectMeta:  ObjectMeta{Name: "second", Namespace: "default", Labels: kvMap{"app": "my-app"}},
+					Behavior:    "merge",
+					Type:        "kubernetes.io/tls",
+					FileSources: sources("b.txt"),
+				},
+			},
+			false,
+		},
+		{"NoName", parent, []SecretSpec{{EnvSources: sources("a.env")}}, nil, true},
+		{"Duplicate", parent, []SecretSpec{{Name: "first"}, {Name: "first"}}, nil, true},
+		{"ParentSources", ssg([]string{"a.env"}, nil), []SecretSpec{{Name: "first"}}, nil, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			input := tt.input
+			input.Secrets = tt.secrets
+			got, err := expandSecrets(input)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("expandSecrets() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("expandSecrets() got = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,369 @@
+// Copyright 2019 Go About B.V. and contributors
+// Licensed under the Apache License, Version 2.0.
+
+package generator
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/credentials"
+	"github.com/aws/aws-sdk-go/aws/credentials/stscreds"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/pkg/errors"
+)
+
+// environmentMu serializes the changes of the environment by apply.
+var environmentMu sync.Mutex
+
+// SopsConfig configures how sops decrypts the sources of a generator. Sops
+// reads most of its configuration from the environment, so those settings
+// are applied by setting environment variables while the sources of the
+// generator are decrypted, and restored afterwards. Because the environment
+// belongs to the process, generators that run at the same time decrypt
+// their sources one after another. The AWS settings are passed to sops
+// directly instead.
+type SopsConfig struct {
+	// AWSProfile is the AWS profile used for KMS
+	AWSProfile string `json:"awsProfile,omitempty" yaml:"awsProfile,omitempty"`
+	// AWSRegion is the default AWS region. KMS requests are sent to the
+	// region of the key.
+	AWSRegion string `json:"awsRegion,omitempty" yaml:"awsRegion,omitempty"`
+	// AWS configures the AWS credentials used for KMS
+	AWS SopsAWSConfig `json:"aws,omitempty" yaml:"aws,omitempty"`
+	// GCP configures the Google Cloud credentials used for KMS
+	GCP SopsGCPConfig `json:"gcp,omitempty" yaml:"gcp,omitempty"`
+	// Azure configures the Azure identity used for Key Vault
+	Azure SopsAzureConfig `json:"azure,omitempty" yaml:"azure,omitempty"`
+	// HCVault configures the HashiCorp Vault server and credentials used
+	// for Vault transit keys, and for vault:// sources
+	HCVault SopsHCVaultConfig `json:"hcVault,omitempty" yaml:"hcVault,omitempty"`
+	// PGP configures the GnuPG keys used for PGP
+	PGP SopsPGPConfig `json:"pgp,omitempty" yaml:"pgp,omitempty"`
+	// ConfigPath is the path of the sops configuration file of the sops
+	// binary that UpdateKeys runs, instead of the .sops.yaml that sops finds
+	// itself. Decryption does not use the configuration.
+	ConfigPath string `json:"configPath,omitempty" yaml:"configPath,omitempty"`
+	// KeyServices are sops keyservices that are asked for the data keys of
+	// the sources, after the local keyservice, as tcp://host:port or
+	// unix:///path/to/socket
+	KeyServices []string `json:"keyServices,omitempty" yaml:"keyServices,omitempty"`
+	// RequiredRecipients are recipients that every source must be
+	// encrypted to, such as the KMS key of the team, so that a secret is not
+	// only encrypted to the key of a single person
+	RequiredRecipients []string `json:"requiredRecipients,omitempty" yaml:"requiredRecipients,omitempty"`
+	// KeyGroups are the indexes, from 0, of the key groups of the sources
+	// that are used for decryption, if set. Files with several key groups
+	// need at least their Shamir threshold of groups.
+	KeyGroups []int `json:"keyGroups,omitempty" yaml:"keyGroups,omitempty"`
+}
+
+// SopsAWSConfig configures the AWS credentials that sops uses for KMS.
+type SopsAWSConfig struct {
+	// Profile is the AWS profile used for KMS, like AWSProfile of SopsConfig
+	Profile string `json:"profile,omitempty" yaml:"profile,omitempty"`
+	// RoleArn is a role that is assumed, with the credentials of the
+	// profile, for KMS
+	RoleArn string `json:"roleArn,omitempty" yaml:"roleArn,omitempty"`
+}
+
+// SopsGCPConfig configures the Google Cloud credentials that sops uses for
+// KMS.
+type SopsGCPConfig struct {
+	// CredentialsFile is the service account key file used for KMS, instead
+	// of GOOGLE_APPLICATION_CREDENTIALS. References to environment variables
+	// in it are expanded.
+	CredentialsFile string `json:"credentialsFile,omitempty" yaml:"credentialsFile,omitempty"`
+}
+
+// SopsAzureConfig configures the Azure identity that sops uses for Key
+// Vault. Sops authenticates like the Azure SDK, from the environment: with
+// AZURE_CLIENT_SECRET or AZURE_CERTIFICATE_PATH if set, and with a managed
+// identity otherwise.
+type SopsAzureConfig struct {
+	// TenantID is the Azure Active Directory tenant of the client
+	TenantID string `json:"tenantID,omitempty" yaml:"tenantID,omitempty"`
+	// ClientID is the application ID of the service principal, or the
+	// client ID of a user-assigned managed identity
+	ClientID string `json:"clientID,omitempty" yaml:"clientID,omitempty"`
+	// UseMSI selects the managed identity of the build agent, ignoring
+	// client secrets and certificates in the environment
+	UseMSI bool `json:"useMSI,omitempty" yaml:"useMSI,omitempty"`
+}
+
+// SopsHCVaultConfig configures the HashiCorp Vault server and credentials that
+// sops uses for Vault transit keys. Vault is authenticated with a token, a
+// token file, or an AppRole login. References to environment variables in
+// the credentials are expanded.
+type SopsHCVaultConfig struct {
+	// Address is the address of the Vault server
+	Address string `json:"address,omitempty" yaml:"address,omitempty"`
+	// Namespace is the Vault Enterprise namespace
+	Namespace string `json:"namespace,omitempty" yaml:"namespace,omitempty"`
+	// Token is the Vault token
+	Token string `json:"token,omitempty" yaml:"token,omitempty"`
+	// TokenFile is a file with the Vault token
+	TokenFile string `json:"tokenFile,omitempty" yaml:"tokenFile,omitempty"`
+	// RoleID and SecretID log in to the AppRole auth method, mounted at
+	// AppRolePath or at approle
+	RoleID      string `json:"roleID,omitempty" yaml:"roleID,omitempty"`
+	SecretID    string `json:"secretID,omitempty" yaml:"secretID,omitempty"`
+	AppRolePath string `json:"appRolePath,omitempty" yaml:"appRolePath,omitempty"`
+}
+
+// token returns the Vault token of the configuration, reading the token file
+// or logging in with the AppRole, or "" if it has no credentials.
+func (c SopsHCVaultConfig) token(addr string, namespace string) (string, error) {
+	set := 0
+	for _, s := range []string{c.Token, c.TokenFile, c.RoleID} {
+		if s != "" {
+			set++
+		}
+	}
+	if set > 1 {
+		return "", errors.New("only one of token, tokenFile and roleID can be set")
+	}
+	if c.SecretID != "" && c.RoleID == "" {
+		return "", errors.New("secretID requires roleID")
+	}
+	switch {
+	case c.Token != "":
+		token := os.ExpandEnv(c.Token)
+		if token == "" {
+			return "", errors.New("token is empty after expanding environment variables")
+		}
+		return token, nil
+	case c.TokenFile != "":
+		token, err := ioutil.ReadFile(os.ExpandEnv(c.TokenFile))
+		if err != nil {
+			return "", errors.Wrap(err, "token file")
+		}
+		return strings.TrimSpace(string(token)), nil
+	case c.RoleID != "":
+		if addr == "" {
+			return "", errors.New("roleID requires address or VAULT_ADDR")
+		}
+		mount := c.AppRolePath
+		if mount == "" {
+			mount = defaultVaultAppRolePath
+		}
+		return vaultAppRoleLogin(addr, namespace, mount, os.ExpandEnv(c.RoleID), os.ExpandEnv(c.SecretID))
+	}
+	return "", nil
+}
+
+// SopsPGPConfig configures the GnuPG keys that sops uses for PGP. References
+// to environment variables in the paths are expanded.
+type SopsPGPConfig struct {
+	// GnuPGHome is the GnuPG home directory, instead of GNUPGHOME or
+	// ~/.gnupg
+	GnuPGHome string `json:"gnupgHome,omitempty" yaml:"gnupgHome,omitempty"`
+	// KeyringFile is a binary secret keyring, which is used from a temporary
+	// GnuPG home directory
+	KeyringFile string `json:"keyringFile,omitempty" yaml:"keyringFile,omitempty"`
+}
+
+// keyringHome creates a temporary GnuPG home directory with the keyring file
+// as its secring.gpg, from which sops reads the keys when gpg cannot decrypt.
+func keyringHome(keyringFile string) (string, error) {
+	keyring, err := ioutil.ReadFile(keyringFile)
+	if err != nil {
+		return "", errors.Wrap(err, "keyring file")
+	}
+	dir, err := ioutil.TempDir("", "sopssecretgenerator-gnupg-")
+	if err != nil {
+		return "", err
+	}
+	err = ioutil.WriteFile(filepath.Join(dir, "secring.gpg"), keyring, 0600)
+	if err != nil {
+		_ = os.RemoveAll(dir)
+		return "", err
+	}
+	return dir, nil
+}
+
+// withDefaults returns the configuration with the settings of the options
+// that the spec does not set.
+func (c SopsConfig) withDefaults(opts Options) SopsConfig {
+	if c.PGP.GnuPGHome == "" && c.PGP.KeyringFile == "" {
+		c.PGP.GnuPGHome = opts.GnuPGHome
+	}
+	return c
+}
+
+// assumeRole returns temporary credentials for an AWS role, assumed with the
+// credentials of the profile, or the default credentials if profile is "".
+var assumeRole = func(profile string, region string, roleArn string) (credentials.Value, error) {
+	opts := session.Options{Profile: profile, SharedConfigState: session.SharedConfigEnable}
+	if region != "" {
+		opts.Config.Region = aws.String(region)
+	}
+	sess, err := session.NewSessionWithOptions(opts)
+	if err != nil {
+		return credentials.Value{}, errors.Wrap(err, "AWS session")
+	}
+	return stscreds.NewCredentials(sess, roleArn).Get()
+}
+
+// awsProfile returns the AWS profile of the configuration, from aws.profile
+// or awsProfile.
+func (c SopsConfig) awsProfile() string {
+	if c.AWS.Profile != "" {
+		return c.AWS.Profile
+	}
+	return c.AWSProfile
+}
+
+// apply checks the configuration and sets its environment. It returns a
+// function that restores the previous environment. Until then, other calls
+// of apply wait, so that they do not change the environment in between.
+func (c SopsConfig) apply() (func(), error) {
+	if c.AWS.Profile != "" && c.AWSProfile != "" && c.AWS.Profile != c.AWSProfile {
+		return nil, fmt.Errorf("aws.profile %v conflicts with awsProfile %v", c.AWS.Profile, c.AWSProfile)
+	}
+	if c.ConfigPath != "" {
+		if _, err := os.Stat(c.ConfigPath); err != nil {
+			return nil, errors.Wrap(err, "sops config")
+		}
+	}
+	if c.GCP.CredentialsFile != "" {
+		if _, err := os.Stat(os.ExpandEnv(c.GCP.CredentialsFile)); err != nil {
+			return nil, errors.Wrap(err, "GCP credentials file")
+		}
+	}
+	if c.PGP.GnuPGHome != "" && c.PGP.KeyringFile != "" {
+		return nil, errors.New("pgp.gnupgHome and pgp.keyringFile cannot be set together")
+	}
+	if c.PGP.GnuPGHome != "" {
+		if _, err := os.Stat(os.ExpandEnv(c.PGP.GnuPGHome)); err != nil {
+			return nil, errors.Wrap(err, "GnuPG home")
+		}
+	}
+	for _, i := range c.KeyGroups {
+		if i < 0 {
+			return nil, fmt.Errorf("invalid key group %d", i)
+		}
+	}
+	for _, uri := range c.KeyServices {
+		if _, _, err := parseKeyServiceURI(uri); err != nil {
+			return nil, err
+		}
+	}
+	env := c.environment()
+	addr, namespace := c.HCVault.Address, c.HCVault.Namespace
+	if addr == "" {
+		addr = os.Getenv("VAULT_ADDR")
+	}
+	if namespace == "" {
+		namespace = os.Getenv("VAULT_NAMESPACE")
+	}
+	token, err := c.HCVault.token(addr, namespace)
+	if err != nil {
+		return nil, errors.Wrap(err, "hcVault")
+	}
+	if token != "" {
+		env["VAULT_TOKEN"] = token
+	}
+	if c.AWS.RoleArn != "" {
+		creds, err := assumeRole(c.awsProfile(), c.AWSRegion, c.AWS.RoleArn)
+		if err != nil {
+			return nil, errors.Wrapf(err, "assuming role %v", c.AWS.RoleArn)
+		}
+		// The KMS keys use these credentials instead of the profile
+		env["AWS_ACCESS_KEY_ID"] = creds.AccessKeyID
+		env["AWS_SECRET_ACCESS_KEY"] = creds.SecretAccessKey
+		env["AWS_SESSION_TOKEN"] = creds.SessionToken
+	}
+	var home string
+	if c.PGP.KeyringFile != "" {
+		home, err = keyringHome(os.ExpandEnv(c.PGP.KeyringFile))
+		if err != nil {
+			return nil, err
+		}
+		env["GNUPGHOME"] = home
+	}
+
+	environmentMu.Lock()
+	restore, err := setEnvironment(env)
+	if err != nil {
+		environmentMu.Unlock()
+		if home != "" {
+			_ = os.RemoveAll(home)
+		}
+		return nil, err
+	}
+	return func() {
+		restore()
+		environmentMu.Unlock()
+		if home != "" {
+			_ = os.RemoveAll(home)
+		}
+	}, nil
+}
+
+// environment returns the environment variables for the configuration.
+func (c SopsConfig) environment() map[string]string {
+	env := make(map[string]string)
+	if c.GCP.CredentialsFile != "" {
+		env["GOOGLE_APPLICATION_CREDENTIALS"] = os.ExpandEnv(c.GCP.CredentialsFile)
+	}
+	if c.Azure.TenantID != "" {
+		env["AZURE_TENANT_ID"] = c.Azure.TenantID
+	}
+	if c.Azure.ClientID != "" {
+		env["AZURE_CLIENT_ID"] = c.Azure.ClientID
+	}
+	if c.Azure.UseMSI {
+		// Sops only uses the managed identity if it is the auth method, and
+		// if no credentials, which take precedence, are set. The Azure SDK
+		// ignores empty variables.
+		env["AZURE_AUTH_METHOD"] = "msi"
+		env["AZURE_CLIENT_SECRET"] = ""
+		env["AZURE_CERTIFICATE_PATH"] = ""
+		env["AZURE_USERNAME"] = ""
+	}
+	if c.HCVault.Address != "" {
+		env["VAULT_ADDR"] = c.HCVault.Address
+	}
+	if c.HCVault.Namespace != "" {
+		env["VAULT_NAMESPACE"] = c.HCVault.Namespace
+	}
+	if c.PGP.GnuPGHome != "" {
+		env["GNUPGHOME"] = os.ExpandEnv(c.PGP.GnuPGHome)
+	}
+	return env
+}
+
+// setEnvironment sets environment variables and returns a function that
+// restores their previous values.
+func setEnvironment(env map[string]string) (func(), error) {
+	type previousValue struct {
+		value string
+		set   bool
+	}
+	previous := make(map[string]previousValue)
+	restore := func() {
+		for k, p := range previous {
+			if p.set {
+				_ = os.Setenv(k, p.value)
+			} else {
+				_ = os.Unsetenv(k)
+			}
+		}
+	}
+	for k, v := range env {
+		value, set := os.LookupEnv(k)
+		previous[k] = previousValue{value, set}
+		err := os.Setenv(k, v)
+		if err != nil {
+			restore()
+			return nil, err
+		}
+	}
+	return restore, nil
+}
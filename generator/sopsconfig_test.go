@@ -0,0 +1,250 @@
+// Copyright 2019 Go About B.V. and contributors
+// Licensed under the Apache License, Version 2.0.
+
+package generator
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws/credentials"
+	"github.com/pkg/errors"
+)
+
+func TestSopsConfig_environment(t *testing.T) {
+	_ = os.Setenv("SOPSSECRETGENERATOR_TEST_DIR", "/ci/project")
+	defer os.Unsetenv("SOPSSECRETGENERATOR_TEST_DIR")
+	tests := []struct {
+		name   string
+		config SopsConfig
+		want   map[string]string
+	}{
+		{"Empty", SopsConfig{}, map[string]string{}},
+		{"AWS", SopsConfig{AWSProfile: "prod", AWSRegion: "eu-west-1", AWS: SopsAWSConfig{Profile: "prod"}}, map[string]string{}},
+		{
+			"HCVault",
+			SopsConfig{HCVault: SopsHCVaultConfig{Address: "https://vault:8200", Namespace: "team-a", Token: "s.token"}},
+			map[string]string{"VAULT_ADDR": "https://vault:8200", "VAULT_NAMESPACE": "team-a"},
+		},
+		{"GnuPGHome", SopsConfig{PGP: SopsPGPConfig{GnuPGHome: "${SOPSSECRETGENERATOR_TEST_DIR}/.gnupg"}}, map[string]string{"GNUPGHOME": "/ci/project/.gnupg"}},
+		{
+			"Azure",
+			SopsConfig{Azure: SopsAzureConfig{TenantID: "tenant", ClientID: "client"}},
+			map[string]string{"AZURE_TENANT_ID": "tenant", "AZURE_CLIENT_ID": "client"},
+		},
+		{
+			"AzureMSI",
+			SopsConfig{Azure: SopsAzureConfig{ClientID: "identity", UseMSI: true}},
+			map[string]string{"AZURE_CLIENT_ID": "identity", "AZURE_AUTH_METHOD": "msi", "AZURE_CLIENT_SECRET": "", "AZURE_CERTIFICATE_PATH": "", "AZURE_USERNAME": ""},
+		},
+		{
+			"GCP",
+			SopsConfig{GCP: SopsGCPConfig{CredentialsFile: "${SOPSSECRETGENERATOR_TEST_DIR}/gcp.json"}},
+			map[string]string{"GOOGLE_APPLICATION_CREDENTIALS": "/ci/project/gcp.json"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.config.environment(); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("environment() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func Test_setEnvironment(t *testing.T) {
+	_ = os.Setenv("SOPSSECRETGENERATOR_TEST_SET", "previous")
+	_ = os.Unsetenv("SOPSSECRETGENERATOR_TEST_UNSET")
+	defer os.Unsetenv("SOPSSECRETGENERATOR_TEST_SET")
+
+	restore, err := setEnvironment(map[string]string{
+		"SOPSSECRETGENERATOR_TEST_SET":   "value",
+		"SOPSSECRETGENERATOR_TEST_UNSET": "value",
+	})
+	if err != nil {
+		t.Fatalf("setEnvironment() error = %v", err)
+	}
+	for _, k := range []string{"SOPSSECRETGENERATOR_TEST_SET", "SOPSSECRETGENERATOR_TEST_UNSET"} {
+		if got := os.Getenv(k); got != "value" {
+			t.Errorf("setEnvironment() %v = %v, want value", k, got)
+		}
+	}
+
+	restore()
+	if got := os.Getenv("SOPSSECRETGENERATOR_TEST_SET"); got != "previous" {
+		t.Errorf("restore() SOPSSECRETGENERATOR_TEST_SET = %v, want previous", got)
+	}
+	if _, set := os.LookupEnv("SOPSSECRETGENERATOR_TEST_UNSET"); set {
+		t.Errorf("restore() did not unset SOPSSECRETGENERATOR_TEST_UNSET")
+	}
+}
+
+func TestSopsConfig_apply(t *testing.T) {
+	tests := []struct {
+		name    string
+		config  SopsConfig
+		wantErr bool
+	}{
+		{"Empty", SopsConfig{}, false},
+		{"ConfigPath", SopsConfig{ConfigPath: "testdata/sourcedir/.sops.yaml"}, false},
+		{"MissingConfigPath", SopsConfig{ConfigPath: "testdata/missing.yaml"}, true},
+		{"GCPCredentialsFile", SopsConfig{GCP: SopsGCPConfig{CredentialsFile: "testdata/plain.txt"}}, false},
+		{"MissingGCPCredentialsFile", SopsConfig{GCP: SopsGCPConfig{CredentialsFile: "testdata/missing.json"}}, true},
+		{"KeyServices", SopsConfig{KeyServices: []string{"unix:///run/sops.sock"}}, false},
+		{"HCVaultTokenFile", SopsConfig{HCVault: SopsHCVaultConfig{TokenFile: "testdata/plain.txt"}}, false},
+		{"MissingHCVaultTokenFile", SopsConfig{HCVault: SopsHCVaultConfig{TokenFile: "testdata/missing.txt"}}, true},
+		{"GnuPGHome", SopsConfig{PGP: SopsPGPConfig{GnuPGHome: "testdata"}}, false},
+		{"MissingGnuPGHome", SopsConfig{PGP: SopsPGPConfig{GnuPGHome: "testdata/missing"}}, true},
+		{"MissingKeyringFile", SopsConfig{PGP: SopsPGPConfig{KeyringFile: "testdata/missing.gpg"}}, true},
+		{"GnuPGHomeAndKeyringFile", SopsConfig{PGP: SopsPGPConfig{GnuPGHome: "testdata", KeyringFile: "testdata/plain.txt"}}, true},
+		{"KeyGroups", SopsConfig{KeyGroups: []int{1, 2}}, false},
+		{"NegativeKeyGroup", SopsConfig{KeyGroups: []int{-1}}, true},
+		{"InvalidKeyService", SopsConfig{KeyServices: []string{"localhost:5000"}}, true},
+		{"SameAWSProfile", SopsConfig{AWSProfile: "prod", AWS: SopsAWSConfig{Profile: "prod"}}, false},
+		{"ConflictingAWSProfile", SopsConfig{AWSProfile: "prod", AWS: SopsAWSConfig{Profile: "staging"}}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			restore, err := tt.config.apply()
+			if (err != nil) != tt.wantErr {
+				t.Errorf("apply() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if restore != nil {
+				restore()
+			}
+		})
+	}
+}
+
+func TestSopsConfig_applyWaits(t *testing.T) {
+	restore, err := SopsConfig{}.apply()
+	if err != nil {
+		t.Fatalf("apply() error = %v", err)
+	}
+	applied := make(chan func(), 1)
+	go func() {
+		restore, _ := SopsConfig{}.apply()
+		applied <- restore
+	}()
+	select {
+	case <-applied:
+		t.Fatalf("apply() did not wait for the restore of an earlier apply")
+	case <-time.After(50 * time.Millisecond):
+	}
+	restore()
+	select {
+	case restore := <-applied:
+		restore()
+	case <-time.After(time.Second):
+		t.Fatalf("apply() still waits after the restore of an earlier apply")
+	}
+}
+
+func TestSopsConfig_applyRoleArn(t *testing.T) {
+	defer func(f func(string, string, string) (credentials.Value, error)) { assumeRole = f }(assumeRole)
+	var assumed []string
+	assumeRole = func(profile string, region string, roleArn string) (credentials.Value, error) {
+		assumed = []string{profile, region, roleArn}
+		if roleArn == "arn:aws:iam::123456789012:role/denied" {
+			return credentials.Value{}, errors.New("AccessDenied")
+		}
+		return credentials.Value{AccessKeyID: "AKID", SecretAccessKey: "SECRET", SessionToken: "TOKEN"}, nil
+	}
+	_ = os.Unsetenv("AWS_ACCESS_KEY_ID")
+	_ = os.Unsetenv("AWS_SECRET_ACCESS_KEY")
+	_ = os.Unsetenv("AWS_SESSION_TOKEN")
+
+	config := SopsConfig{AWSRegion: "eu-west-1", AWS: SopsAWSConfig{Profile: "ci", RoleArn: "arn:aws:iam::123456789012:role/sops"}}
+	restore, err := config.apply()
+	if err != nil {
+		t.Fatalf("apply() error = %v", err)
+	}
+	if want := []string{"ci", "eu-west-1", "arn:aws:iam::123456789012:role/sops"}; !reflect.DeepEqual(assumed, want) {
+		t.Errorf("apply() assumed %v, want %v", assumed, want)
+	}
+	for k, want := range map[string]string{"AWS_ACCESS_KEY_ID": "AKID", "AWS_SECRET_ACCESS_KEY": "SECRET", "AWS_SESSION_TOKEN": "TOKEN"} {
+		if got := os.Getenv(k); got != want {
+			t.Errorf("apply() %v = %v, want %v", k, got, want)
+		}
+	}
+	restore()
+	if _, set := os.LookupEnv("AWS_SESSION_TOKEN"); set {
+		t.Errorf("restore() did not unset AWS_SESSION_TOKEN")
+	}
+
+	config.AWS.RoleArn = "arn:aws:iam::123456789012:role/denied"
+	if _, err := config.apply(); err == nil {
+		t.Errorf("apply() error = nil, want an error for a role that cannot be assumed")
+	}
+}
+
+func TestSopsHCVaultConfig_token(t *testing.T) {
+	_ = os.Setenv("SOPSSECRETGENERATOR_TEST_VAULT_TOKEN", "s.env")
+	defer os.Unsetenv("SOPSSECRETGENERATOR_TEST_VAULT_TOKEN")
+	tests := []struct {
+		name    string
+		config  SopsHCVaultConfig
+		want    string
+		wantErr bool
+	}{
+		{"Empty", SopsHCVaultConfig{}, "", false},
+		{"Token", SopsHCVaultConfig{Token: "${SOPSSECRETGENERATOR_TEST_VAULT_TOKEN}"}, "s.env", false},
+		{"EmptyToken", SopsHCVaultConfig{Token: "$SOPSSECRETGENERATOR_TEST_UNSET"}, "", true},
+		{"TokenFile", SopsHCVaultConfig{TokenFile: "testdata/plain.txt"}, "public", false},
+		{"MissingTokenFile", SopsHCVaultConfig{TokenFile: "testdata/missing.txt"}, "", true},
+		{"TokenAndTokenFile", SopsHCVaultConfig{Token: "s.token", TokenFile: "testdata/plain.txt"}, "", true},
+		{"SecretIDWithoutRoleID", SopsHCVaultConfig{SecretID: "secret"}, "", true},
+		{"RoleIDWithoutAddress", SopsHCVaultConfig{RoleID: "role", SecretID: "secret"}, "", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := tt.config.token("", "")
+			if (err != nil) != tt.wantErr {
+				t.Errorf("token() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if got != tt.want {
+				t.Errorf("token() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSopsConfig_applyKeyringFile(t *testing.T) {
+	previous := os.Getenv("GNUPGHOME")
+	_ = os.Unsetenv("GNUPGHOME")
+	defer os.Setenv("GNUPGHOME", previous)
+	config := SopsConfig{PGP: SopsPGPConfig{KeyringFile: "testdata/plain.txt"}}
+	restore, err := config.apply()
+	if err != nil {
+		t.Fatalf("apply() error = %v", err)
+	}
+	home := os.Getenv("GNUPGHOME")
+	keyring, err := ioutil.ReadFile(filepath.Join(home, "secring.gpg"))
+	if err != nil || string(keyring) != "public\n" {
+		t.Errorf("apply() secring.gpg = %q, %v, want the keyring file", keyring, err)
+	}
+	restore()
+	if _, set := os.LookupEnv("GNUPGHOME"); set {
+		t.Errorf("restore() did not unset GNUPGHOME")
+	}
+	if _, err := os.Stat(home); !os.IsNotExist(err) {
+		t.Errorf("restore() did not remove %v", home)
+	}
+}
+
+func TestSopsConfig_withDefaults(t *testing.T) {
+	opts := Options{GnuPGHome: "/etc/gnupg"}
+	if got := (SopsConfig{}).withDefaults(opts).PGP.GnuPGHome; got != "/etc/gnupg" {
+		t.Errorf("withDefaults() GnuPGHome = %v, want /etc/gnupg", got)
+	}
+	config := SopsConfig{PGP: SopsPGPConfig{KeyringFile: "secring.gpg"}}
+	if got := config.withDefaults(opts).PGP; got != config.PGP {
+		t.Errorf("withDefaults() PGP = %v, want %v", got, config.PGP)
+	}
+}
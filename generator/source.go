@@ -0,0 +1,180 @@
+// Copyright 2019 Go About B.V. and contributors
+// Licensed under the Apache License, Version 2.0.
+
+package generator
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"strings"
+	"sync"
+
+	"github.com/pkg/errors"
+)
+
+// fileName returns the key and the path of a file source. A key set on the
+// source takes the path as it is, which may then contain '='.
+func (s Source) fileName() (key string, fn string, err error) {
+	if s.Key == "" {
+		return parseFileName(s.Path, s.Format)
+	}
+	if s.Path == "" {
+		return "", "", fmt.Errorf("file path for key name %v missing", s.Key)
+	}
+	return s.Key, s.Path, nil
+}
+
+// format returns the format of the source at path, which is that of the
+// source if it sets one.
+func (s Source) format(path string) (string, error) {
+	if s.Format == "" {
+		return formatForPath(path), nil
+	}
+	for _, f := range formats {
+		if s.Format == f {
+			return f, nil
+		}
+	}
+	return "", fmt.Errorf("unknown format %v, use %v", s.Format, strings.Join(formats, ", "))
+}
+
+// isLocalPath returns whether a source path is a local file, rather than a
+// secret in Vault, a URL, a file in Git or an object in a bucket.
+func isLocalPath(path string) bool {
+	return !isVaultPath(path) && !isRemotePath(path) && !isGitPath(path) && !isObjectStorePath(path)
+}
+
+// missingOptionalSource reports whether source is optional and its file at
+// path, without the path of an extracted value, does not exist, so that it
+// is skipped.
+func missingOptionalSource(source Source, path string) bool {
+	if !source.Optional || !isLocalPath(path) {
+		return false
+	}
+	path, _ = splitExtractPath(path, source.Format)
+	_, err := os.Stat(path)
+	return os.IsNotExist(err)
+}
+
+// sourceCache keeps the content of the sources read while generating a
+// secret, so that every source is read or downloaded once, and its sops
+// metadata is checked on the same content that is decrypted.
+type sourceCache struct {
+	mu       sync.Mutex
+	contents map[string][]byte
+}
+
+// withSourceCache returns opts with a new source cache, unless it already
+// has one.
+func (opts Options) withSourceCache() Options {
+	if opts.sources == nil {
+		opts.sources = &sourceCache{contents: make(map[string][]byte)}
+	}
+	return opts
+}
+
+// readSource reads the content of a source file, or returns it from the
+// source cache of opts if it was read before.
+func readSource(ctx context.Context, path string, opts Options) ([]byte, error) {
+	if opts.sources == nil {
+		return readSourceContent(ctx, path, opts)
+	}
+	opts.sources.mu.Lock()
+	content, ok := opts.sources.contents[path]
+	opts.sources.mu.Unlock()
+	if ok {
+		return content, nil
+	}
+	content, err := readSourceContent(ctx, path, opts)
+	if err != nil {
+		return nil, err
+	}
+	opts.sources.mu.Lock()
+	opts.sources.contents[path] = content
+	opts.sources.mu.Unlock()
+	return content, nil
+}
+
+// readSourceContent reads the content of a source file as a stream, so that
+// named pipes and other files that are not seekable work too. The read is
+// limited to opts.MaxSourceSize bytes, and aborted after opts.ReadTimeout or
+// when ctx is done, instead of blocking on a pipe without a writer. Remote
+// sources are downloaded from their server, Git repository or object store.
+func readSourceContent(ctx context.Context, path string, opts Options) ([]byte, error) {
+	if isRemotePath(path) {
+		return readRemote(ctx, path, opts)
+	}
+	if isGitPath(path) {
+		return readGit(ctx, path, opts)
+	}
+	if isObjectStorePath(path) {
+		return readObjectStore(ctx, path, opts)
+	}
+	if opts.ReadTimeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, opts.ReadTimeout)
+		defer cancel()
+	}
+
+	type opened struct {
+		file *os.File
+		err  error
+	}
+	// Opening a named pipe blocks until it has a writer
+	ch := make(chan opened, 1)
+	go func() {
+		file, err := os.Open(path)
+		ch <- opened{file, err}
+	}()
+	var file *os.File
+	select {
+	case o := <-ch:
+		if o.err != nil {
+			return nil, o.err
+		}
+		file = o.file
+	case <-ctx.Done():
+		go func() {
+			if o := <-ch; o.file != nil {
+				_ = o.file.Close()
+			}
+		}()
+		return nil, errors.Wrap(ctx.Err(), "opening source")
+	}
+	// Closing the file also unblocks a read that was abandoned
+	defer file.Close()
+	return readStream(ctx, file, opts.MaxSourceSize)
+}
+
+// readStream reads r until EOF, failing if it has more than limit bytes, if
+// limit is set. If ctx is done first, the read is abandoned; the caller must
+// then close r to end it.
+func readStream(ctx context.Context, r io.Reader, limit int64) ([]byte, error) {
+	if limit > 0 {
+		r = io.LimitReader(r, limit+1)
+	}
+	type result struct {
+		content []byte
+		err     error
+	}
+	done := make(chan result, 1)
+	go func() {
+		content, err := ioutil.ReadAll(r)
+		done <- result{content, err}
+	}()
+	select {
+	case res := <-done:
+		if res.err != nil {
+			return nil, res.err
+		}
+		if limit > 0 && int64(len(res.content)) > limit {
+			return nil, fmt.Errorf("source is larger than %d bytes", limit)
+		}
+		return res.content, nil
+	case <-ctx.Done():
+		return nil, errors.Wrap(ctx.Err(), "reading source")
+	}
+}
@@ -0,0 +1,195 @@
+// Copyright 2019 Go About B.V. and contributors
+// Licensed under the Apache License, Version 2.0.
+
+package generator
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"reflect"
+	"strings"
+	"testing"
+	"testing/iotest"
+	"time"
+
+	"gopkg.in/yaml.v2"
+)
+
+func TestSource_UnmarshalYAML(t *testing.T) {
+	tests := []struct {
+		name string
+		yaml string
+		want Source
+	}{
+		{"Path", "secrets.env", Source{Path: "secrets.env"}},
+		{"OptionalPath", "secrets.local.env?", Source{Path: "secrets.local.env", Optional: true}},
+		{"Object", "path: secrets.env\noverride: true\n", Source{Path: "secrets.env", Override: true}},
+		{"OptionalObject", "path: secrets.local.env\noptional: true\n", Source{Path: "secrets.local.env", Optional: true}},
+		{"KeyAndFormat", "path: secrets.env.enc\nkey: app.env\nformat: dotenv\n", Source{Path: "secrets.env.enc", Key: "app.env", Format: "dotenv"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var got Source
+			if err := yaml.Unmarshal([]byte(tt.yaml), &got); err != nil {
+				t.Fatalf("UnmarshalYAML() error = %v", err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("UnmarshalYAML() got = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSource_fileName(t *testing.T) {
+	tests := []struct {
+		name     string
+		source   Source
+		wantKey  string
+		wantFile string
+		wantErr  bool
+	}{
+		{"Path", Source{Path: "dir/tls.crt"}, "tls.crt", "dir/tls.crt", false},
+		{"KeyInPath", Source{Path: "cert=dir/tls.crt"}, "cert", "dir/tls.crt", false},
+		{"Key", Source{Path: "dir/a=b.txt", Key: "ab"}, "ab", "dir/a=b.txt", false},
+		{"KeyWithoutPath", Source{Key: "ab"}, "", "", true},
+		{"ExtractWithFormat", Source{Path: "secrets.sops#stripe.apiKey", Format: "yaml"}, "apiKey", "secrets.sops#stripe.apiKey", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			key, fn, err := tt.source.fileName()
+			if (err != nil) != tt.wantErr {
+				t.Errorf("fileName() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if key != tt.wantKey || fn != tt.wantFile {
+				t.Errorf("fileName() = %v, %v, want %v, %v", key, fn, tt.wantKey, tt.wantFile)
+			}
+		})
+	}
+}
+
+func TestSource_format(t *testing.T) {
+	tests := []struct {
+		name    string
+		source  Source
+		want    string
+		wantErr bool
+	}{
+		{"Extension", Source{Path: "secrets.yaml"}, "yaml", false},
+		{"Format", Source{Path: "secrets.env.enc", Format: "dotenv"}, "dotenv", false},
+		{"Unknown", Source{Path: "secrets.hcl", Format: "hcl"}, "", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := tt.source.format(tt.source.Path)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("format() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if got != tt.want {
+				t.Errorf("format() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func Test_missingOptionalSource(t *testing.T) {
+	tests := []struct {
+		name   string
+		source Source
+		path   string
+		want   bool
+	}{
+		{"Missing", Source{Optional: true}, "testdata/missing.env", true},
+		{"Exists", Source{Optional: true}, "testdata/vars.env", false},
+		{"Required", Source{}, "testdata/missing.env", false},
+		{"Vault", Source{Optional: true}, "vault://kv/app", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := missingOptionalSource(tt.source, tt.path); got != tt.want {
+				t.Errorf("missingOptionalSource() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+// blockingReader returns its content, then blocks until it is closed, like a
+// pipe whose writer stays open.
+type blockingReader struct {
+	content io.Reader
+	closed  chan struct{}
+}
+
+func (r *blockingReader) Read(p []byte) (int, error) {
+	n, err := r.content.Read(p)
+	if err != io.EOF {
+		return n, err
+	}
+	<-r.closed
+	return 0, io.ErrClosedPipe
+}
+
+func Test_readStream(t *testing.T) {
+	content := strings.Repeat("FOO=secret\n", 100)
+	tests := []struct {
+		name    string
+		reader  func() io.Reader
+		limit   int64
+		want    string
+		wantErr bool
+	}{
+		{"Complete", func() io.Reader { return strings.NewReader(content) }, 0, content, false},
+		{"PartialReads", func() io.Reader { return iotest.HalfReader(strings.NewReader(content)) }, 0, content, false},
+		{"OneByteReads", func() io.Reader { return iotest.OneByteReader(strings.NewReader(content)) }, 0, content, false},
+		{"AtLimit", func() io.Reader { return iotest.OneByteReader(strings.NewReader(content)) }, int64(len(content)), content, false},
+		{"OverLimit", func() io.Reader { return strings.NewReader(content) }, int64(len(content) - 1), "", true},
+		{"ReadError", func() io.Reader { return iotest.TimeoutReader(strings.NewReader(content)) }, 0, "", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := readStream(context.Background(), tt.reader(), tt.limit)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("readStream() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if !bytes.Equal(got, []byte(tt.want)) {
+				t.Errorf("readStream() got %d bytes, want %d", len(got), len(tt.want))
+			}
+		})
+	}
+}
+
+func Test_readStream_Blocked(t *testing.T) {
+	r := &blockingReader{strings.NewReader("FOO=secret\n"), make(chan struct{})}
+	defer close(r.closed)
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	_, err := readStream(ctx, r, 0)
+	if err == nil || !strings.Contains(err.Error(), context.DeadlineExceeded.Error()) {
+		t.Errorf("readStream() error = %v, want deadline exceeded", err)
+	}
+}
+
+func Test_readSource(t *testing.T) {
+	tests := []struct {
+		name    string
+		path    string
+		opts    Options
+		wantErr bool
+	}{
+		{"File", "testdata/vars.env", Options{}, false},
+		{"Timeout", "testdata/vars.env", Options{ReadTimeout: time.Minute}, false},
+		{"MaxSize", "testdata/vars.env", Options{MaxSourceSize: 10}, true},
+		{"Missing", "testdata/missing.env", Options{}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := readSource(context.Background(), tt.path, tt.opts)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("readSource() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
@@ -0,0 +1,163 @@
+// Copyright 2019 Go About B.V. and contributors
+// Licensed under the Apache License, Version 2.0.
+
+package generator
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// SourceDir is a directory of sources. Files with a structured format are
+// env sources, other files are file sources keyed by their name.
+type SourceDir struct {
+	Path string `json:"path,omitempty" yaml:"path,omitempty"`
+	// Include only uses the files matching one of these patterns, if set
+	Include []string `json:"include,omitempty" yaml:"include,omitempty"`
+	// Exclude skips the files matching one of these patterns
+	Exclude []string `json:"exclude,omitempty" yaml:"exclude,omitempty"`
+}
+
+// sources returns the env and file sources in the directory, ordered by
+// name. Subdirectories and hidden files, such as .sops.yaml, are skipped.
+// Files are binary file sources by the extension formats of the spec, or
+// else by their name.
+func (d SourceDir) sources(extensions map[string]string) (envSources []Source, fileSources []Source, err error) {
+	if d.Path == "" {
+		return nil, nil, nil
+	}
+	infos, err := ioutil.ReadDir(d.Path)
+	if err != nil {
+		return nil, nil, errors.Wrap(err, "source directory")
+	}
+	for _, info := range infos {
+		name := info.Name()
+		if info.IsDir() || strings.HasPrefix(name, ".") {
+			continue
+		}
+		use, err := d.matches(name)
+		if err != nil {
+			return nil, nil, err
+		}
+		if !use {
+			continue
+		}
+		source := Source{Path: filepath.Join(d.Path, name)}
+		format := extensionFormat(name, extensions)
+		if format == "" {
+			format = formatForPath(name)
+		}
+		if format == "binary" {
+			fileSources = append(fileSources, source)
+		} else {
+			envSources = append(envSources, source)
+		}
+	}
+	return envSources, fileSources, nil
+}
+
+// matches returns whether the include and exclude patterns select a file.
+func (d SourceDir) matches(name string) (bool, error) {
+	included := len(d.Include) == 0
+	for _, pattern := range d.Include {
+		match, err := filepath.Match(pattern, name)
+		if err != nil {
+			return false, errors.Wrapf(err, "source directory include pattern %v", pattern)
+		}
+		included = included || match
+	}
+	if !included {
+		return false, nil
+	}
+	for _, pattern := range d.Exclude {
+		match, err := filepath.Match(pattern, name)
+		if err != nil {
+			return false, errors.Wrapf(err, "source directory exclude pattern %v", pattern)
+		}
+		if match {
+			return false, nil
+		}
+	}
+	return true, nil
+}
+
+// expandFileDirectories replaces file sources whose path is a directory by a
+// source for every file in it, like kubectl create secret --from-file=DIR.
+// Files in subdirectories are included up to the depth of the source, or at
+// any depth if it has none, and are keyed by their path relative to the
+// directory, sanitized into a valid key. Hidden files and directories are
+// skipped. Other options of the source apply to each file.
+func expandFileDirectories(sources []Source) ([]Source, error) {
+	var expanded []Source
+	for _, source := range sources {
+		if source.Depth < 0 {
+			return nil, fmt.Errorf("file source %v: depth must not be negative", source.Path)
+		}
+		_, dir, err := source.fileName()
+		if err != nil || !isLocalPath(dir) {
+			expanded = append(expanded, source)
+			continue
+		}
+		info, err := os.Stat(dir)
+		if err != nil || !info.IsDir() {
+			expanded = append(expanded, source)
+			continue
+		}
+		if source.Key != "" || strings.Contains(source.Path, "=") {
+			return nil, fmt.Errorf("file source %v: directory cannot have a key name, files are keyed by their path", source.Path)
+		}
+		files, err := directoryFiles(dir, source.Depth)
+		if err != nil {
+			return nil, errors.Wrapf(err, "file source %v", source.Path)
+		}
+		if len(files) == 0 && !source.Optional {
+			return nil, fmt.Errorf("file source %v: directory contains no files", source.Path)
+		}
+		for _, rel := range files {
+			file := source
+			file.Key = secretKey(filepath.ToSlash(rel))
+			file.Path = filepath.Join(dir, rel)
+			expanded = append(expanded, file)
+		}
+	}
+	return expanded, nil
+}
+
+// directoryFiles returns the paths of the files in dir relative to it, in
+// order of their paths, up to depth levels of directories or all if depth is
+// 0.
+func directoryFiles(dir string, depth int) ([]string, error) {
+	var files []string
+	err := filepath.Walk(dir, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if path == dir {
+			return nil
+		}
+		rel, err := filepath.Rel(dir, path)
+		if err != nil {
+			return err
+		}
+		if strings.HasPrefix(info.Name(), ".") {
+			if info.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if info.IsDir() {
+			if depth > 0 && strings.Count(filepath.ToSlash(rel), "/")+1 >= depth {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		files = append(files, rel)
+		return nil
+	})
+	return files, err
+}
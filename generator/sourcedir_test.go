@@ -0,0 +1,119 @@
+// Copyright 2019 Go About B.V. and contributors
+// Licensed under the Apache License, Version 2.0.
+
+package generator
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestSourceDir_sources(t *testing.T) {
+	tests := []struct {
+		name            string
+		dir             SourceDir
+		extensions      map[string]string
+		wantEnvSources  []Source
+		wantFileSources []Source
+		wantErr         bool
+	}{
+		{"NoDir", SourceDir{}, nil, nil, nil, false},
+		{
+			"All",
+			SourceDir{Path: "testdata/sourcedir"},
+			nil,
+			sources("testdata/sourcedir/vars.env", "testdata/sourcedir/vars.yaml"),
+			sources("testdata/sourcedir/file.txt"),
+			false,
+		},
+		{
+			"Include",
+			SourceDir{Path: "testdata/sourcedir", Include: []string{"*.env", "*.txt"}},
+			nil,
+			sources("testdata/sourcedir/vars.env"),
+			sources("testdata/sourcedir/file.txt"),
+			false,
+		},
+		{
+			"Exclude",
+			SourceDir{Path: "testdata/sourcedir", Exclude: []string{"vars.*"}},
+			nil,
+			nil,
+			sources("testdata/sourcedir/file.txt"),
+			false,
+		},
+		{
+			"ExtensionFormats",
+			SourceDir{Path: "testdata/sourcedir"},
+			map[string]string{".txt": "dotenv"},
+			sources("testdata/sourcedir/file.txt", "testdata/sourcedir/vars.env", "testdata/sourcedir/vars.yaml"),
+			nil,
+			false,
+		},
+		{"InvalidPattern", SourceDir{Path: "testdata/sourcedir", Include: []string{"["}}, nil, nil, nil, true},
+		{"Missing", SourceDir{Path: "testdata/missing"}, nil, nil, nil, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			envSources, fileSources, err := tt.dir.sources(tt.extensions)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("sources() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if !reflect.DeepEqual(envSources, tt.wantEnvSources) {
+				t.Errorf("sources() envSources = %v, want %v", envSources, tt.wantEnvSources)
+			}
+			if !reflect.DeepEqual(fileSources, tt.wantFileSources) {
+				t.Errorf("sources() fileSources = %v, want %v", fileSources, tt.wantFileSources)
+			}
+		})
+	}
+}
+
+func Test_expandFileDirectories(t *testing.T) {
+	tests := []struct {
+		name    string
+		sources []Source
+		want    []Source
+		wantErr bool
+	}{
+		{"NoDirectory", sources("testdata/file.txt", "key=testdata/file2.txt"), sources("testdata/file.txt", "key=testdata/file2.txt"), false},
+		{
+			"Directory",
+			sources("testdata/sourcedir/"),
+			[]Source{
+				{Path: "testdata/sourcedir/file.txt", Key: "file.txt"},
+				{Path: "testdata/sourcedir/nested/file2.txt", Key: "nested_file2.txt"},
+				{Path: "testdata/sourcedir/vars.env", Key: "vars.env"},
+				{Path: "testdata/sourcedir/vars.yaml", Key: "vars.yaml"},
+			},
+			false,
+		},
+		{
+			"Depth",
+			[]Source{{Path: "testdata/sourcedir", Depth: 1, Plain: true}},
+			[]Source{
+				{Path: "testdata/sourcedir/file.txt", Key: "file.txt", Depth: 1, Plain: true},
+				{Path: "testdata/sourcedir/vars.env", Key: "vars.env", Depth: 1, Plain: true},
+				{Path: "testdata/sourcedir/vars.yaml", Key: "vars.yaml", Depth: 1, Plain: true},
+			},
+			false,
+		},
+		{"Missing", sources("testdata/missing"), sources("testdata/missing"), false},
+		{"KeyName", sources("key=testdata/sourcedir"), nil, true},
+		{"Key", []Source{{Path: "testdata/sourcedir", Key: "key"}}, nil, true},
+		{"NegativeDepth", []Source{{Path: "testdata/sourcedir", Depth: -1}}, nil, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := expandFileDirectories(tt.sources)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("expandFileDirectories() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("expandFileDirectories() got = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
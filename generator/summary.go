@@ -0,0 +1,89 @@
+// Copyright 2019 Go About B.V. and contributors
+// Licensed under the Apache License, Version 2.0.
+
+package generator
+
+import (
+	"encoding/base64"
+	"sort"
+)
+
+// Summary describes a generated Secret for metrics, without its values.
+type Summary struct {
+	Name      string `json:"name,omitempty"`
+	Namespace string `json:"namespace,omitempty"`
+	// KeyCount is the number of keys of the Secret
+	KeyCount int `json:"keyCount"`
+	// Size is the total size of the base64-encoded values, counting
+	// stringData values as if they were encoded
+	Size    int             `json:"size"`
+	Sources []SourceSummary `json:"sources"`
+	// Keys are the keys of the Secret, in order
+	Keys []string `json:"keys,omitempty"`
+}
+
+// SourceSummary describes the keys that a source contributed.
+type SourceSummary struct {
+	// Path is the path of the source file, without the key of a file source
+	Path     string   `json:"path"`
+	KeyCount int      `json:"keyCount"`
+	Keys     []string `json:"keys,omitempty"`
+}
+
+// WithoutKeys returns the summary without key names, which may reveal more
+// than is wanted in metrics.
+func (s Summary) WithoutKeys() Summary {
+	s.Keys = nil
+	sources := make([]SourceSummary, len(s.Sources))
+	for i, source := range s.Sources {
+		source.Keys = nil
+		sources[i] = source
+	}
+	s.Sources = sources
+	return s
+}
+
+// reset clears a summary that is reused for another Secret. The summary may
+// be nil, which records nothing.
+func (s *Summary) reset() {
+	if s != nil {
+		*s = Summary{Sources: []SourceSummary{}}
+	}
+}
+
+// addSource records the keys of a source that was used.
+func (s *Summary) addSource(path string, data kvMap) {
+	if s == nil {
+		return
+	}
+	keys := make([]string, 0, len(data))
+	for k := range data {
+		keys = append(keys, secretKey(k))
+	}
+	sort.Strings(keys)
+	s.Sources = append(s.Sources, SourceSummary{Path: path, KeyCount: len(keys), Keys: keys})
+}
+
+// setSecret records the metadata and sizes of the generated secret.
+func (s *Summary) setSecret(secret Secret) {
+	if s == nil {
+		return
+	}
+	s.Name = secret.Name
+	if s.Name == "" {
+		s.Name = secret.GenerateName
+	}
+	s.Namespace = secret.Namespace
+	s.Keys = make([]string, 0, len(secret.Data)+len(secret.StringData))
+	s.Size = 0
+	for k, v := range secret.Data {
+		s.Keys = append(s.Keys, k)
+		s.Size += len(v)
+	}
+	for k, v := range secret.StringData {
+		s.Keys = append(s.Keys, k)
+		s.Size += base64.StdEncoding.EncodedLen(len(v))
+	}
+	sort.Strings(s.Keys)
+	s.KeyCount = len(s.Keys)
+}
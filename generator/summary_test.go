@@ -0,0 +1,56 @@
+// Copyright 2019 Go About B.V. and contributors
+// Licensed under the Apache License, Version 2.0.
+
+package generator
+
+import (
+	"io/ioutil"
+	"reflect"
+	"testing"
+)
+
+func Test_Generate_Summary(t *testing.T) {
+	spec, _ := ioutil.ReadFile("testdata/generator-sources.yaml")
+	var got Summary
+	_, err := Generate(spec, Options{Namespace: "default", Summary: &got})
+	if err != nil {
+		t.Fatalf("Generate() error = %v", err)
+	}
+	want := Summary{
+		Name:      "secret",
+		Namespace: "default",
+		KeyCount:  3,
+		Size:      len(b64("val_env")) + len(b64("val_yaml")) + len(b64("secret\n")),
+		Sources: []SourceSummary{
+			{Path: "testdata/vars.env", KeyCount: 1, Keys: []string{"VAR_ENV"}},
+			{Path: "testdata/vars.yaml", KeyCount: 1, Keys: []string{"VAR_YAML"}},
+			{Path: "testdata/file.txt", KeyCount: 1, Keys: []string{"file.txt"}},
+		},
+		Keys: []string{"VAR_ENV", "VAR_YAML", "file.txt"},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("Generate() summary = %+v, want %+v", got, want)
+	}
+}
+
+func TestSummary_WithoutKeys(t *testing.T) {
+	summary := Summary{
+		Name:     "secret",
+		KeyCount: 2,
+		Size:     24,
+		Sources:  []SourceSummary{{Path: "vars.env", KeyCount: 2, Keys: []string{"A", "B"}}},
+		Keys:     []string{"A", "B"},
+	}
+	want := Summary{
+		Name:     "secret",
+		KeyCount: 2,
+		Size:     24,
+		Sources:  []SourceSummary{{Path: "vars.env", KeyCount: 2}},
+	}
+	if got := summary.WithoutKeys(); !reflect.DeepEqual(got, want) {
+		t.Errorf("WithoutKeys() = %+v, want %+v", got, want)
+	}
+	if summary.Sources[0].Keys == nil {
+		t.Errorf("WithoutKeys() modified the summary")
+	}
+}
@@ -0,0 +1,100 @@
+// Copyright 2019 Go About B.V. and contributors
+// Licensed under the Apache License, Version 2.0.
+
+package generator
+
+import (
+	"time"
+
+	"github.com/BurntSushi/toml"
+)
+
+// tomlTimeFormats are the formats of the local dates and times of TOML, by
+// the name of the location that the decoder gives them.
+var tomlTimeFormats = map[string]string{
+	"datetime-local": "2006-01-02T15:04:05.999999999",
+	"date-local":     "2006-01-02",
+	"time-local":     "15:04:05.999999999",
+}
+
+// parseTOMLContent adds the top-level keys of a TOML document to data. Like
+// for YAML and JSON, tables and arrays are only allowed with a value
+// encoding. Dates and times are strings. It returns the keys in the
+// order of the document. Tables and arrays are flattened if separator is
+// set.
+func parseTOMLContent(content []byte, data kvMap, valueEncoding string, separator string) ([]string, error) {
+	d, keys, err := decodeTOML(content)
+	if err != nil {
+		return nil, err
+	}
+	keys = stripSopsMetadata(d, keys)
+	if separator != "" {
+		d, keys, err = flattenStructured(d, keys, separator)
+		if err != nil {
+			return nil, err
+		}
+	}
+	err = importStructuredContent(d, data, valueEncoding)
+	if err != nil {
+		return nil, err
+	}
+	order := make([]string, 0, len(data))
+	for _, k := range keys {
+		if _, ok := data[k]; ok {
+			order = append(order, k)
+		}
+	}
+	return order, nil
+}
+
+// decodeTOML decodes a TOML document and returns it with the order of its
+// top-level keys.
+func decodeTOML(content []byte) (map[string]interface{}, []string, error) {
+	var d map[string]interface{}
+	md, err := toml.Decode(string(content), &d)
+	if err != nil {
+		return nil, nil, err
+	}
+	var keys []string
+	seen := make(map[string]bool)
+	for _, key := range md.Keys() {
+		if !seen[key[0]] {
+			seen[key[0]] = true
+			keys = append(keys, key[0])
+		}
+	}
+	for k, v := range d {
+		d[k] = tomlValue(v)
+	}
+	return d, keys, nil
+}
+
+// tomlValue returns a decoded TOML value with its dates and times as text
+// and its arrays of tables as plain arrays.
+func tomlValue(v interface{}) interface{} {
+	switch value := v.(type) {
+	case time.Time:
+		if format, ok := tomlTimeFormats[value.Location().String()]; ok {
+			return value.Format(format)
+		}
+		return value.Format(time.RFC3339Nano)
+	case map[string]interface{}:
+		for k, child := range value {
+			value[k] = tomlValue(child)
+		}
+		return value
+	case []map[string]interface{}:
+		values := make([]interface{}, len(value))
+		for i, child := range value {
+			values[i] = tomlValue(child)
+		}
+		return values
+	case []interface{}:
+		for i, child := range value {
+			value[i] = tomlValue(child)
+		}
+		return value
+	default:
+		return v
+	}
+}
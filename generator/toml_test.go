@@ -0,0 +1,101 @@
+// Copyright 2019 Go About B.V. and contributors
+// Licensed under the Apache License, Version 2.0.
+
+package generator
+
+import (
+	"reflect"
+	"testing"
+)
+
+func Test_parseTOMLContent(t *testing.T) {
+	type args struct {
+		content       []byte
+		valueEncoding string
+	}
+	tests := []struct {
+		name      string
+		args      args
+		want      kvMap
+		wantOrder []string
+		wantErr   bool
+	}{
+		{
+			"Strings",
+			args{b("# comment\nb = \"x\" # comment\na = 'C:\\path'\n\"quoted key\" = \"\\u00e9\\t\"\n"), ""},
+			kvMap{"a": `C:\path`, "b": "x", "quoted key": "é\t"},
+			[]string{"b", "a", "quoted key"},
+			false,
+		},
+		{
+			"MultilineStrings",
+			args{b("a = \"\"\"\nline 1\nline 2\"\"\"\nb = '''\nraw \\n'''\nc = \"\"\"one \\\n    two\"\"\"\n"), ""},
+			kvMap{"a": "line 1\nline 2", "b": `raw \n`, "c": "one two"},
+			[]string{"a", "b", "c"},
+			false,
+		},
+		{
+			"DateTime",
+			args{b("d = 1979-05-27\ndt = 1979-05-27 07:32:00Z\nt = 07:32:00\nldt = 1979-05-27T07:32:00.5\n"), ""},
+			kvMap{"d": "1979-05-27", "dt": "1979-05-27T07:32:00Z", "t": "07:32:00", "ldt": "1979-05-27T07:32:00.5"},
+			[]string{"d", "dt", "t", "ldt"},
+			false,
+		},
+		{"Table", args{b("[db]\nport = 5432\n"), ""}, nil, nil, true},
+		{
+			"Scalars",
+			args{b("i = 1_000\nh = 0xff\nf = 1.5\nyes = true\n"), ""},
+			kvMap{"i": "1000", "h": "255", "f": "1.5", "yes": "true"},
+			[]string{"i", "h", "f", "yes"},
+			false,
+		},
+		{
+			"Tables",
+			args{b("name = \"app\"\n[db]\nhost = \"localhost\"\nport = 5432\n[db.replica]\nhost = \"r\"\n"), "json"},
+			kvMap{"name": "app", "db": `{"host":"localhost","port":5432,"replica":{"host":"r"}}`},
+			[]string{"name", "db"},
+			false,
+		},
+		{
+			"ArraysOfTables",
+			args{b("[[server]]\nname = \"a\"\n[[server]]\nname = \"b\"\nsince = 2019-11-01\n[server.tls]\nenabled = true\n"), "json"},
+			kvMap{"server": `[{"name":"a"},{"name":"b","since":"2019-11-01","tls":{"enabled":true}}]`},
+			[]string{"server"},
+			false,
+		},
+		{
+			"InlineValues",
+			args{b("a = [ 1, 2,\n  3, # three\n]\nb = { x = \"1\", y.z = 2 }\nc.d = \"e\"\n"), "json"},
+			kvMap{"a": "[1,2,3]", "b": `{"x":"1","y":{"z":2}}`, "c": `{"d":"e"}`},
+			[]string{"a", "b", "c"},
+			false,
+		},
+		{"Empty", args{b(""), ""}, kvMap{}, []string{}, false},
+		{"Duplicate", args{b("a = \"1\"\na = \"2\"\n"), ""}, nil, nil, true},
+		{"DuplicateTable", args{b("[a]\nb = \"1\"\n[a]\nb = \"2\"\n"), ""}, nil, nil, true},
+		{"MissingValue", args{b("a =\n"), ""}, nil, nil, true},
+		{"Unterminated", args{b("a = \"x\n"), ""}, nil, nil, true},
+		{"Trailing", args{b("a = \"x\" b\n"), ""}, nil, nil, true},
+		{"InvalidNumber", args{b("a = 12ab\n"), ""}, nil, nil, true},
+		{"NaN", args{b("a = nan\n"), ""}, nil, nil, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := make(kvMap)
+			order, err := parseTOMLContent(tt.args.content, got, tt.args.valueEncoding, "")
+			if (err != nil) != tt.wantErr {
+				t.Errorf("parseTOMLContent() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if tt.wantErr {
+				return
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("parseTOMLContent() got = %v, want %v", got, tt.want)
+			}
+			if !reflect.DeepEqual(order, tt.wantOrder) {
+				t.Errorf("parseTOMLContent() order = %v, want %v", order, tt.wantOrder)
+			}
+		})
+	}
+}
@@ -0,0 +1,255 @@
+// Copyright 2019 Go About B.V. and contributors
+// Licensed under the Apache License, Version 2.0.
+
+package generator
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"sort"
+
+	"github.com/pkg/errors"
+	"gopkg.in/yaml.v2"
+)
+
+// Transform reads a SopsSecretGenerator spec and an existing Secret manifest,
+// and returns the existing Secret as YAML with its values replaced by the
+// decrypted values of the spec. Keys that only occur on one side are kept, and
+// so are the fields of the Secret that the spec does not set, such as
+// immutable or finalizers. The name, namespace, type, labels and annotations
+// of the Secret and the spec must not conflict.
+func Transform(spec []byte, existing []byte, opts Options) ([]byte, error) {
+	return TransformContext(context.Background(), spec, existing, opts)
+}
+
+// TransformContext is like Transform, but aborts decryption when ctx is done.
+func TransformContext(ctx context.Context, spec []byte, existing []byte, opts Options) ([]byte, error) {
+	input, err := readInput(spec, opts)
+	if err != nil {
+		return nil, err
+	}
+	err = requireSingleSecret(input)
+	if err != nil {
+		return nil, err
+	}
+	if input.Kind == configMapKind {
+		return nil, withClass(ClassSpec, errors.Errorf("kind %v cannot be used to transform a secret", configMapKind))
+	}
+	if len(input.ConfigMapKeys) > 0 {
+		return nil, withClass(ClassSpec, errors.New("configMapKeys cannot be used to transform a secret"))
+	}
+	secret, doc, err := readSecret(existing)
+	if err != nil {
+		return nil, withClass(ClassSpec, err)
+	}
+
+	// The hash covers the merged data, so it is appended afterwards
+	generateOpts := opts
+	generateOpts.AppendNameHash = false
+	generated, err := generateSecret(ctx, input, generateOpts)
+	if err != nil {
+		return nil, err
+	}
+	secret, err = transformSecret(secret, generated)
+	if err != nil {
+		return nil, withClass(ClassSpec, err)
+	}
+	if opts.AppendNameHash {
+		secret, err = appendNameHash(secret, nil)
+		if err != nil {
+			return nil, err
+		}
+	}
+	secret.Data = wrapData(secret.Data, opts.WrapWidth)
+	output, err := yaml.Marshal(updateSecretDocument(doc, secret))
+	if err != nil {
+		return nil, err
+	}
+	return append(commentLines(opts.HeaderComment), output...), nil
+}
+
+// readSecret reads a v1 Secret manifest, both as a Secret and as a document
+// with all of its fields.
+func readSecret(content []byte) (Secret, yaml.MapSlice, error) {
+	secret := Secret{}
+	err := yaml.Unmarshal(content, &secret)
+	if err != nil {
+		return Secret{}, nil, errors.Wrap(err, "existing secret")
+	}
+	if secret.APIVersion != "v1" || secret.Kind != "Secret" {
+		return Secret{}, nil, fmt.Errorf("existing secret has kind %v/%v, must be v1/Secret", secret.APIVersion, secret.Kind)
+	}
+	var doc yaml.MapSlice
+	err = yaml.Unmarshal(content, &doc)
+	if err != nil {
+		return Secret{}, nil, errors.Wrap(err, "existing secret")
+	}
+	return secret, doc, nil
+}
+
+// updateSecretDocument sets the fields of the secret in the document of the
+// existing secret, keeping the fields that Secret does not have and the order
+// of the keys. Owner references are only set if the document has none, so
+// that fields of them that OwnerReference does not have are kept too.
+func updateSecretDocument(doc yaml.MapSlice, secret Secret) yaml.MapSlice {
+	metadata, _ := mapItem(doc, "metadata").(yaml.MapSlice)
+	metadata = setMapItem(metadata, "name", secret.Name, secret.Name != "")
+	metadata = setMapItem(metadata, "namespace", secret.Namespace, secret.Namespace != "")
+	metadata = setMapItem(metadata, "labels", updateMapSlice(mapItem(metadata, "labels"), secret.Labels), len(secret.Labels) > 0)
+	metadata = setMapItem(metadata, "annotations", updateMapSlice(mapItem(metadata, "annotations"), secret.Annotations), len(secret.Annotations) > 0)
+	if mapItem(metadata, "ownerReferences") == nil && len(secret.OwnerReferences) > 0 {
+		metadata = setMapItem(metadata, "ownerReferences", secret.OwnerReferences, true)
+	}
+	doc = setMapItem(doc, "metadata", metadata, true)
+	doc = setMapItem(doc, "data", updateMapSlice(mapItem(doc, "data"), secret.Data), true)
+	doc = setMapItem(doc, "stringData", updateMapSlice(mapItem(doc, "stringData"), secret.StringData), len(secret.StringData) > 0)
+	return setMapItem(doc, "type", secret.Type, secret.Type != "")
+}
+
+// mapItem returns the value of a key of a document, or nil if it does not
+// have the key.
+func mapItem(doc yaml.MapSlice, key string) interface{} {
+	for _, item := range doc {
+		if item.Key == key {
+			return item.Value
+		}
+	}
+	return nil
+}
+
+// setMapItem sets a key of a document to a value in place, or appends it if
+// the document does not have the key. If set is false, the key is removed
+// instead.
+func setMapItem(doc yaml.MapSlice, key string, value interface{}, set bool) yaml.MapSlice {
+	for i, item := range doc {
+		if item.Key != key {
+			continue
+		}
+		if !set {
+			return append(doc[:i:i], doc[i+1:]...)
+		}
+		doc[i].Value = value
+		return doc
+	}
+	if !set {
+		return doc
+	}
+	return append(doc, yaml.MapItem{Key: key, Value: value})
+}
+
+// updateMapSlice returns the key/values of the map as a document in the order
+// of the existing document, followed by the keys that it does not have in
+// sorted order. Keys of the existing document that are not in the map are
+// removed.
+func updateMapSlice(existing interface{}, values kvMap) yaml.MapSlice {
+	updated := make(yaml.MapSlice, 0, len(values))
+	done := make(map[string]bool)
+	items, _ := existing.(yaml.MapSlice)
+	for _, item := range items {
+		k, ok := item.Key.(string)
+		if v, found := values[k]; ok && found && !done[k] {
+			updated = append(updated, yaml.MapItem{Key: k, Value: v})
+			done[k] = true
+		}
+	}
+	keys := make([]string, 0, len(values))
+	for k := range values {
+		if !done[k] {
+			keys = append(keys, k)
+		}
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		updated = append(updated, yaml.MapItem{Key: k, Value: values[k]})
+	}
+	return updated
+}
+
+// transformSecret replaces the values of the existing secret with those of
+// the generated secret, adding keys it did not have. Metadata is merged, but
+// must not conflict.
+func transformSecret(existing Secret, generated Secret) (Secret, error) {
+	if existing.Name == "" {
+		existing.Name = generated.Name
+	} else if existing.Name != generated.Name {
+		return Secret{}, fmt.Errorf("name %v of existing secret conflicts with %v", existing.Name, generated.Name)
+	}
+	if existing.Namespace == "" {
+		existing.Namespace = generated.Namespace
+	} else if generated.Namespace != "" && existing.Namespace != generated.Namespace {
+		return Secret{}, fmt.Errorf("namespace %v of existing secret conflicts with %v", existing.Namespace, generated.Namespace)
+	}
+	if len(existing.OwnerReferences) == 0 {
+		existing.OwnerReferences = generated.OwnerReferences
+	} else if len(generated.OwnerReferences) > 0 && !reflect.DeepEqual(existing.OwnerReferences, generated.OwnerReferences) {
+		return Secret{}, errors.New("owner references of existing secret conflict with the spec")
+	}
+	if secretType(existing.Type) != secretType(generated.Type) {
+		return Secret{}, fmt.Errorf("type %v of existing secret conflicts with %v", secretType(existing.Type), secretType(generated.Type))
+	}
+	if existing.Type == "" {
+		existing.Type = generated.Type
+	}
+
+	var err error
+	existing.Labels, err = mergeMetadata("label", existing.Labels, generated.Labels)
+	if err != nil {
+		return Secret{}, err
+	}
+	existing.Annotations, err = mergeMetadata("annotation", existing.Annotations, generated.Annotations)
+	if err != nil {
+		return Secret{}, err
+	}
+
+	// A key moves between data and stringData if the sources say so
+	data := make(kvMap)
+	for k, v := range existing.Data {
+		data[k] = v
+	}
+	stringData := make(kvMap)
+	for k, v := range existing.StringData {
+		stringData[k] = v
+	}
+	for k, v := range generated.Data {
+		data[k] = v
+		delete(stringData, k)
+	}
+	for k, v := range generated.StringData {
+		stringData[k] = v
+		delete(data, k)
+	}
+	existing.Data = data
+	existing.StringData = nil
+	if len(stringData) > 0 {
+		existing.StringData = stringData
+	}
+	return existing, nil
+}
+
+// secretType returns the type of a secret, which defaults to Opaque.
+func secretType(t string) string {
+	if t == "" {
+		return "Opaque"
+	}
+	return t
+}
+
+// mergeMetadata merges labels or annotations. A key with different values is
+// an error.
+func mergeMetadata(what string, existing kvMap, generated kvMap) (kvMap, error) {
+	if len(generated) == 0 {
+		return existing, nil
+	}
+	merged := make(kvMap)
+	for k, v := range existing {
+		merged[k] = v
+	}
+	for k, v := range generated {
+		if old, ok := merged[k]; ok && old != v {
+			return nil, fmt.Errorf("%v %v of existing secret is %v, conflicts with %v", what, k, old, v)
+		}
+		merged[k] = v
+	}
+	return merged, nil
+}
@@ -0,0 +1,206 @@
+// Copyright 2019 Go About B.V. and contributors
+// Licensed under the Apache License, Version 2.0.
+
+package generator
+
+import (
+	"io/ioutil"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/lithammer/dedent"
+)
+
+func Test_Transform(t *testing.T) {
+	type args struct {
+		fn       string
+		existing string
+		opts     Options
+	}
+	tests := []struct {
+		name    string
+		args    args
+		want    string
+		wantErr bool
+	}{
+		{
+			"Transform",
+			args{"testdata/generator.yaml", "testdata/existing-secret.yaml", Options{}},
+			strings.TrimLeft(dedent.Dedent(`
+				apiVersion: v1
+				kind: Secret
+				metadata:
+				  name: secret
+				  labels:
+				    app: my-app
+				data:
+				  file.txt: c2VjcmV0Cg==
+				  other.txt: b3RoZXIK
+				type: Opaque
+			`), "\n"),
+			false,
+		},
+		{
+			"OtherFields",
+			args{"testdata/generator.yaml", "testdata/existing-secret-fields.yaml", Options{}},
+			strings.TrimLeft(dedent.Dedent(`
+				apiVersion: v1
+				kind: Secret
+				metadata:
+				  name: secret
+				  labels:
+				    app: my-app
+				  finalizers:
+				  - example.com/finalizer
+				data:
+				  other.txt: b3RoZXIK
+				  file.txt: c2VjcmV0Cg==
+				type: Opaque
+				immutable: true
+			`), "\n"),
+			false,
+		},
+		{"NotSecret", args{"testdata/generator.yaml", "testdata/existing-configmap.yaml", Options{}}, "", true},
+		{"NotYAML", args{"testdata/generator.yaml", "testdata/notyaml.txt", Options{}}, "", true},
+		{"InvalidEnvs", args{"testdata/generator-invalidenv.yaml", "testdata/existing-secret.yaml", Options{}}, "", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			spec, _ := ioutil.ReadFile(tt.args.fn)
+			existing, _ := ioutil.ReadFile(tt.args.existing)
+			got, err := Transform(spec, existing, tt.args.opts)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("Transform() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if string(got) != tt.want {
+				t.Errorf("Transform() got = %v, want %v", string(got), tt.want)
+			}
+		})
+	}
+}
+
+func Test_transformSecret(t *testing.T) {
+	secret := func(meta ObjectMeta, data kvMap, secretType string) Secret {
+		return Secret{
+			TypeMeta:   TypeMeta{APIVersion: "v1", Kind: "Secret"},
+			ObjectMeta: meta,
+			Data:       data,
+			Type:       secretType,
+		}
+	}
+	type args struct {
+		existing  Secret
+		generated Secret
+	}
+	tests := []struct {
+		name    string
+		args    args
+		want    Secret
+		wantErr bool
+	}{
+		{
+			"Data",
+			args{
+				secret(ObjectMeta{Name: "secret"}, kvMap{"A": b64("old"), "B": b64("kept")}, ""),
+				secret(ObjectMeta{Name: "secret"}, kvMap{"A": b64("new"), "C": b64("added")}, ""),
+			},
+			secret(ObjectMeta{Name: "secret"}, kvMap{"A": b64("new"), "B": b64("kept"), "C": b64("added")}, ""),
+			false,
+		},
+		{
+			"StringData",
+			args{
+				Secret{
+					TypeMeta:   TypeMeta{APIVersion: "v1", Kind: "Secret"},
+					ObjectMeta: ObjectMeta{Name: "secret"},
+					Data:       kvMap{"A": b64("old"), "B": b64("old")},
+					StringData: kvMap{"C": "old"},
+				},
+				Secret{
+					TypeMeta:   TypeMeta{APIVersion: "v1", Kind: "Secret"},
+					ObjectMeta: ObjectMeta{Name: "secret"},
+					Data:       kvMap{"C": b64("new")},
+					StringData: kvMap{"A": "new"},
+				},
+			},
+			Secret{
+				TypeMeta:   TypeMeta{APIVersion: "v1", Kind: "Secret"},
+				ObjectMeta: ObjectMeta{Name: "secret"},
+				Data:       kvMap{"B": b64("old"), "C": b64("new")},
+				StringData: kvMap{"A": "new"},
+			},
+			false,
+		},
+		{
+			"Metadata",
+			args{
+				secret(ObjectMeta{Name: "secret", Labels: kvMap{"a": "1"}}, kvMap{}, "Opaque"),
+				secret(ObjectMeta{Name: "secret", Namespace: "ns", Labels: kvMap{"a": "1", "b": "2"}}, kvMap{}, ""),
+			},
+			secret(ObjectMeta{Name: "secret", Namespace: "ns", Labels: kvMap{"a": "1", "b": "2"}}, kvMap{}, "Opaque"),
+			false,
+		},
+		{
+			"OwnerReferences",
+			args{
+				secret(ObjectMeta{Name: "secret"}, kvMap{}, ""),
+				secret(ObjectMeta{Name: "secret", OwnerReferences: []OwnerReference{{APIVersion: "v1", Kind: "Pod", Name: "a", UID: "1"}}}, kvMap{}, ""),
+			},
+			secret(ObjectMeta{Name: "secret", OwnerReferences: []OwnerReference{{APIVersion: "v1", Kind: "Pod", Name: "a", UID: "1"}}}, kvMap{}, ""),
+			false,
+		},
+		{
+			"ConflictingOwnerReferences",
+			args{
+				secret(ObjectMeta{Name: "secret", OwnerReferences: []OwnerReference{{APIVersion: "v1", Kind: "Pod", Name: "b", UID: "2"}}}, kvMap{}, ""),
+				secret(ObjectMeta{Name: "secret", OwnerReferences: []OwnerReference{{APIVersion: "v1", Kind: "Pod", Name: "a", UID: "1"}}}, kvMap{}, ""),
+			},
+			Secret{},
+			true,
+		},
+		{
+			"ConflictingName",
+			args{secret(ObjectMeta{Name: "other"}, kvMap{}, ""), secret(ObjectMeta{Name: "secret"}, kvMap{}, "")},
+			Secret{},
+			true,
+		},
+		{
+			"ConflictingNamespace",
+			args{secret(ObjectMeta{Name: "secret", Namespace: "a"}, kvMap{}, ""), secret(ObjectMeta{Name: "secret", Namespace: "b"}, kvMap{}, "")},
+			Secret{},
+			true,
+		},
+		{
+			"ConflictingType",
+			args{secret(ObjectMeta{Name: "secret"}, kvMap{}, "kubernetes.io/tls"), secret(ObjectMeta{Name: "secret"}, kvMap{}, "")},
+			Secret{},
+			true,
+		},
+		{
+			"ConflictingLabel",
+			args{secret(ObjectMeta{Name: "secret", Labels: kvMap{"a": "1"}}, kvMap{}, ""), secret(ObjectMeta{Name: "secret", Labels: kvMap{"a": "2"}}, kvMap{}, "")},
+			Secret{},
+			true,
+		},
+		{
+			"ConflictingAnnotation",
+			args{secret(ObjectMeta{Name: "secret", Annotations: kvMap{"a": "1"}}, kvMap{}, ""), secret(ObjectMeta{Name: "secret", Annotations: kvMap{"a": "2"}}, kvMap{}, "")},
+			Secret{},
+			true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := transformSecret(tt.args.existing, tt.args.generated)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("transformSecret() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("transformSecret() got = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,238 @@
+// Copyright 2019 Go About B.V. and contributors
+// Licensed under the Apache License, Version 2.0.
+
+package generator
+
+import (
+	"crypto/tls"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"sort"
+
+	"github.com/pkg/errors"
+	"golang.org/x/crypto/ssh"
+)
+
+const dockerConfigJSONType = "kubernetes.io/dockerconfigjson"
+const dockerConfigJSONKey = ".dockerconfigjson"
+
+// Keys from which the generator assembles the .dockerconfigjson of a
+// registry secret
+const (
+	dockerRegistryKey = "registry"
+	dockerUsernameKey = "username"
+	dockerPasswordKey = "password"
+	dockerEmailKey    = "email"
+)
+
+const tlsType = "kubernetes.io/tls"
+const tlsCertKey = "tls.crt"
+const tlsKeyKey = "tls.key"
+
+const sshAuthType = "kubernetes.io/ssh-auth"
+const sshPrivateKeyKey = "ssh-privatekey"
+const sshKnownHostsKey = "known_hosts"
+
+const basicAuthType = "kubernetes.io/basic-auth"
+const basicAuthUsernameKey = "username"
+const basicAuthPasswordKey = "password"
+
+// dockerConfigEntry is the entry of a registry in a .dockerconfigjson.
+type dockerConfigEntry struct {
+	Username string `json:"username"`
+	Password string `json:"password"`
+	Email    string `json:"email,omitempty"`
+	Auth     string `json:"auth"`
+}
+
+// assembleSecretData builds the keys that the secret type requires from
+// simpler keys in the sources, so that users do not have to write them
+// by hand.
+func assembleSecretData(secretType string, data kvMap) error {
+	switch secretType {
+	case dockerConfigJSONType:
+		return assembleDockerConfigJSON(data)
+	}
+	return nil
+}
+
+// assembleDockerConfigJSON replaces the registry, username, password and
+// email keys by a .dockerconfigjson key for the registry, unless data
+// already has one.
+func assembleDockerConfigJSON(data kvMap) error {
+	_, hasConfig := data[dockerConfigJSONKey]
+	_, hasRegistry := data[dockerRegistryKey]
+	if hasConfig {
+		if hasRegistry {
+			return fmt.Errorf("key %v conflicts with key %v", dockerRegistryKey, dockerConfigJSONKey)
+		}
+		return nil
+	}
+	for _, k := range []string{dockerRegistryKey, dockerUsernameKey, dockerPasswordKey} {
+		if _, ok := data[k]; !ok {
+			return fmt.Errorf("secret of type %v requires key %v, or keys %v, %v and %v", dockerConfigJSONType, dockerConfigJSONKey, dockerRegistryKey, dockerUsernameKey, dockerPasswordKey)
+		}
+	}
+	username, password := data[dockerUsernameKey], data[dockerPasswordKey]
+	config := map[string]map[string]dockerConfigEntry{
+		"auths": {
+			data[dockerRegistryKey]: {
+				Username: username,
+				Password: password,
+				Email:    data[dockerEmailKey],
+				Auth:     base64.StdEncoding.EncodeToString([]byte(username + ":" + password)),
+			},
+		},
+	}
+	encoded, err := json.Marshal(config)
+	if err != nil {
+		return err
+	}
+	for _, k := range []string{dockerRegistryKey, dockerUsernameKey, dockerPasswordKey, dockerEmailKey} {
+		delete(data, k)
+	}
+	data[dockerConfigJSONKey] = string(encoded)
+	return nil
+}
+
+// typedSources returns the file sources for the fields of the input that are
+// specific to a secret type.
+func typedSources(input SopsSecretGenerator) ([]Source, error) {
+	tlsFileSources, err := tlsSources(input)
+	if err != nil {
+		return nil, err
+	}
+	sshFileSources, err := sshAuthSources(input)
+	if err != nil {
+		return nil, err
+	}
+	basicAuthFileSources, err := basicAuthSources(input)
+	if err != nil {
+		return nil, err
+	}
+	return append(append(tlsFileSources, sshFileSources...), basicAuthFileSources...), nil
+}
+
+// tlsSources returns the file sources for the certFile and keyFile of the
+// input, which are only allowed for TLS secrets.
+func tlsSources(input SopsSecretGenerator) ([]Source, error) {
+	if input.CertFile == "" && input.KeyFile == "" {
+		return nil, nil
+	}
+	if input.Type != tlsType {
+		return nil, fmt.Errorf("certFile and keyFile require type %v", tlsType)
+	}
+	if input.CertFile == "" || input.KeyFile == "" {
+		return nil, errors.New("certFile and keyFile must be set together")
+	}
+	return []Source{
+		{Path: tlsCertKey + "=" + input.CertFile},
+		{Path: tlsKeyKey + "=" + input.KeyFile},
+	}, nil
+}
+
+// validateTLS checks that a TLS secret has a certificate and a private key
+// that belong together, which ingress controllers otherwise only find out
+// when they load them.
+func validateTLS(data kvMap) error {
+	for _, k := range []string{tlsCertKey, tlsKeyKey} {
+		if _, ok := data[k]; !ok {
+			return fmt.Errorf("secret of type %v requires key %v", tlsType, k)
+		}
+	}
+	_, err := tls.X509KeyPair([]byte(data[tlsCertKey]), []byte(data[tlsKeyKey]))
+	return errors.Wrapf(err, "keys %v and %v", tlsCertKey, tlsKeyKey)
+}
+
+// sshAuthSources returns the file sources for the sshPrivateKeyFile and
+// knownHostsFile of the input, which are only allowed for SSH secrets.
+func sshAuthSources(input SopsSecretGenerator) ([]Source, error) {
+	if input.SSHPrivateKeyFile == "" && input.KnownHostsFile == "" {
+		return nil, nil
+	}
+	if input.Type != sshAuthType {
+		return nil, fmt.Errorf("sshPrivateKeyFile and knownHostsFile require type %v", sshAuthType)
+	}
+	if input.SSHPrivateKeyFile == "" {
+		return nil, errors.New("knownHostsFile requires sshPrivateKeyFile")
+	}
+	sources := []Source{{Path: sshPrivateKeyKey + "=" + input.SSHPrivateKeyFile}}
+	if input.KnownHostsFile != "" {
+		sources = append(sources, Source{Path: sshKnownHostsKey + "=" + input.KnownHostsFile})
+	}
+	return sources, nil
+}
+
+// validateSSHAuth checks that an SSH secret has a private key that can be
+// parsed, in PKCS #1, PKCS #8, SEC 1 or OpenSSH format.
+func validateSSHAuth(data kvMap) error {
+	key, ok := data[sshPrivateKeyKey]
+	if !ok {
+		return fmt.Errorf("secret of type %v requires key %v", sshAuthType, sshPrivateKeyKey)
+	}
+	// An encrypted key is valid even though it cannot be parsed without
+	// its passphrase.
+	_, err := ssh.ParseRawPrivateKey([]byte(key))
+	if _, ok := err.(*ssh.PassphraseMissingError); ok {
+		return nil
+	}
+	return errors.Wrapf(err, "value for key %v", sshPrivateKeyKey)
+}
+
+// basicAuthSources returns the file sources for the usernameFile and
+// passwordFile of the input, which are only allowed for basic
+// authentication secrets.
+func basicAuthSources(input SopsSecretGenerator) ([]Source, error) {
+	if input.UsernameFile == "" && input.PasswordFile == "" {
+		return nil, nil
+	}
+	if input.Type != basicAuthType {
+		return nil, fmt.Errorf("usernameFile and passwordFile require type %v", basicAuthType)
+	}
+	var sources []Source
+	if input.UsernameFile != "" {
+		sources = append(sources, Source{Path: basicAuthUsernameKey + "=" + input.UsernameFile})
+	}
+	if input.PasswordFile != "" {
+		sources = append(sources, Source{Path: basicAuthPasswordKey + "=" + input.PasswordFile})
+	}
+	return sources, nil
+}
+
+// validateBasicAuth checks that a basic authentication secret has a username
+// and a password. Kubernetes accepts either alone, but a credential without
+// the other half is almost always a mistake in the sources.
+func validateBasicAuth(data kvMap) error {
+	for _, k := range []string{basicAuthUsernameKey, basicAuthPasswordKey} {
+		if _, ok := data[k]; !ok {
+			return fmt.Errorf("secret of type %v requires key %v", basicAuthType, k)
+		}
+		if data[k] == "" {
+			return fmt.Errorf("value for key %v is empty", k)
+		}
+	}
+	return nil
+}
+
+// reconcileKeys updates the order of the keys after keys of data were
+// replaced: keys that are gone are dropped, and new keys are appended in
+// sorted order.
+func reconcileKeys(keys []string, data kvMap) []string {
+	seen := make(map[string]bool)
+	var reconciled []string
+	for _, k := range keys {
+		if _, ok := data[k]; ok {
+			reconciled = append(reconciled, k)
+			seen[k] = true
+		}
+	}
+	var added []string
+	for k := range data {
+		if !seen[k] {
+			added = append(added, k)
+		}
+	}
+	sort.Strings(added)
+	return append(reconciled, added...)
+}
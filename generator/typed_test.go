@@ -0,0 +1,294 @@
+// Copyright 2019 Go About B.V. and contributors
+// Licensed under the Apache License, Version 2.0.
+
+package generator
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"encoding/pem"
+	"io/ioutil"
+	"reflect"
+	"testing"
+)
+
+func Test_assembleDockerConfigJSON(t *testing.T) {
+	tests := []struct {
+		name    string
+		data    kvMap
+		want    kvMap
+		wantErr bool
+	}{
+		{
+			"Assemble",
+			kvMap{"registry": "registry.example.com", "username": "user", "password": "secret", "other": "value"},
+			kvMap{
+				".dockerconfigjson": `{"auths":{"registry.example.com":{"username":"user","password":"secret","auth":"dXNlcjpzZWNyZXQ="}}}`,
+				"other":             "value",
+			},
+			false,
+		},
+		{
+			"Email",
+			kvMap{"registry": "registry.example.com", "username": "user", "password": "secret", "email": "user@example.com"},
+			kvMap{
+				".dockerconfigjson": `{"auths":{"registry.example.com":{"username":"user","password":"secret","email":"user@example.com","auth":"dXNlcjpzZWNyZXQ="}}}`,
+			},
+			false,
+		},
+		{"Existing", kvMap{".dockerconfigjson": "{}"}, kvMap{".dockerconfigjson": "{}"}, false},
+		{"Conflict", kvMap{".dockerconfigjson": "{}", "registry": "registry.example.com"}, nil, true},
+		{"MissingPassword", kvMap{"registry": "registry.example.com", "username": "user"}, nil, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := assembleDockerConfigJSON(tt.data)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("assembleDockerConfigJSON() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if !tt.wantErr && !reflect.DeepEqual(tt.data, tt.want) {
+				t.Errorf("assembleDockerConfigJSON() got = %v, want %v", tt.data, tt.want)
+			}
+		})
+	}
+}
+
+func Test_reconcileKeys(t *testing.T) {
+	keys := []string{"username", "other", "password", "registry"}
+	data := kvMap{"other": "value", ".dockerconfigjson": "{}"}
+	want := []string{"other", ".dockerconfigjson"}
+	if got := reconcileKeys(keys, data); !reflect.DeepEqual(got, want) {
+		t.Errorf("reconcileKeys() = %v, want %v", got, want)
+	}
+}
+
+func Test_tlsSources(t *testing.T) {
+	tests := []struct {
+		name    string
+		input   SopsSecretGenerator
+		want    []Source
+		wantErr bool
+	}{
+		{"None", SopsSecretGenerator{Type: tlsType}, nil, false},
+		{
+			"CertAndKey",
+			SopsSecretGenerator{Type: tlsType, CertFile: "tls.crt", KeyFile: "secret.key"},
+			[]Source{{Path: "tls.crt=tls.crt"}, {Path: "tls.key=secret.key"}},
+			false,
+		},
+		{"MissingKey", SopsSecretGenerator{Type: tlsType, CertFile: "tls.crt"}, nil, true},
+		{"WrongType", SopsSecretGenerator{CertFile: "tls.crt", KeyFile: "tls.key"}, nil, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := tlsSources(tt.input)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("tlsSources() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("tlsSources() got = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func Test_sshAuthSources(t *testing.T) {
+	tests := []struct {
+		name    string
+		input   SopsSecretGenerator
+		want    []Source
+		wantErr bool
+	}{
+		{"None", SopsSecretGenerator{Type: sshAuthType}, nil, false},
+		{
+			"PrivateKey",
+			SopsSecretGenerator{Type: sshAuthType, SSHPrivateKeyFile: "id_ed25519"},
+			[]Source{{Path: "ssh-privatekey=id_ed25519"}},
+			false,
+		},
+		{
+			"KnownHosts",
+			SopsSecretGenerator{Type: sshAuthType, SSHPrivateKeyFile: "id_ed25519", KnownHostsFile: "hosts"},
+			[]Source{{Path: "ssh-privatekey=id_ed25519"}, {Path: "known_hosts=hosts"}},
+			false,
+		},
+		{"OnlyKnownHosts", SopsSecretGenerator{Type: sshAuthType, KnownHostsFile: "hosts"}, nil, true},
+		{"WrongType", SopsSecretGenerator{Type: tlsType, SSHPrivateKeyFile: "id_ed25519"}, nil, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := sshAuthSources(tt.input)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("sshAuthSources() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("sshAuthSources() got = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func Test_validateSSHAuth(t *testing.T) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sec1, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	pkcs8, err := x509.MarshalPKCS8PrivateKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	encode := func(blockType string, b []byte) string {
+		return string(pem.EncodeToMemory(&pem.Block{Type: blockType, Bytes: b}))
+	}
+	openSSH, err := ioutil.ReadFile("testdata/id_ed25519")
+	if err != nil {
+		t.Fatal(err)
+	}
+	encrypted, err := ioutil.ReadFile("testdata/id_ecdsa-passphrase")
+	if err != nil {
+		t.Fatal(err)
+	}
+	block, _ := pem.Decode(openSSH)
+	truncated := encode(block.Type, block.Bytes[:len(block.Bytes)/2])
+
+	tests := []struct {
+		name    string
+		data    kvMap
+		wantErr bool
+	}{
+		{"SEC1", kvMap{sshPrivateKeyKey: encode("EC PRIVATE KEY", sec1)}, false},
+		{"PKCS8", kvMap{sshPrivateKeyKey: encode("PRIVATE KEY", pkcs8)}, false},
+		{"OpenSSH", kvMap{sshPrivateKeyKey: string(openSSH)}, false},
+		{"Encrypted", kvMap{sshPrivateKeyKey: string(encrypted)}, false},
+		{"TruncatedOpenSSH", kvMap{sshPrivateKeyKey: truncated}, true},
+		{"InvalidOpenSSH", kvMap{sshPrivateKeyKey: encode("OPENSSH PRIVATE KEY", []byte("garbage"))}, true},
+		{"WrongBlock", kvMap{sshPrivateKeyKey: encode("RSA PRIVATE KEY", sec1)}, true},
+		{"PublicKey", kvMap{sshPrivateKeyKey: encode("PUBLIC KEY", sec1)}, true},
+		{"NotPEM", kvMap{sshPrivateKeyKey: "secret"}, true},
+		{"Missing", kvMap{sshKnownHostsKey: "hosts"}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := validateSSHAuth(tt.data); (err != nil) != tt.wantErr {
+				t.Errorf("validateSSHAuth() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+
+	input := SopsSecretGenerator{
+		Type:              sshAuthType,
+		SSHPrivateKeyFile: "testdata/ssh-privatekey",
+		KnownHostsFile:    "testdata/known_hosts",
+	}
+	data, _, err := generateData(context.Background(), input, nil, Options{})
+	if err != nil {
+		t.Fatalf("generateData() error = %v", err)
+	}
+	if data[sshPrivateKeyKey] == "" || data[sshKnownHostsKey] == "" {
+		t.Errorf("generateData() got keys %v, want %v and %v", dataKeys(data), sshPrivateKeyKey, sshKnownHostsKey)
+	}
+}
+
+func Test_basicAuthSources(t *testing.T) {
+	tests := []struct {
+		name    string
+		input   SopsSecretGenerator
+		want    []Source
+		wantErr bool
+	}{
+		{"None", SopsSecretGenerator{Type: basicAuthType}, nil, false},
+		{
+			"Both",
+			SopsSecretGenerator{Type: basicAuthType, UsernameFile: "user.txt", PasswordFile: "pass.txt"},
+			[]Source{{Path: "username=user.txt"}, {Path: "password=pass.txt"}},
+			false,
+		},
+		{
+			"OnlyPassword",
+			SopsSecretGenerator{Type: basicAuthType, PasswordFile: "pass.txt"},
+			[]Source{{Path: "password=pass.txt"}},
+			false,
+		},
+		{"WrongType", SopsSecretGenerator{UsernameFile: "user.txt", PasswordFile: "pass.txt"}, nil, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := basicAuthSources(tt.input)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("basicAuthSources() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("basicAuthSources() got = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func Test_validateBasicAuth(t *testing.T) {
+	tests := []struct {
+		name    string
+		data    kvMap
+		wantErr bool
+	}{
+		{"Valid", kvMap{"username": "admin", "password": "secret"}, false},
+		{"MissingUsername", kvMap{"password": "secret"}, true},
+		{"MissingPassword", kvMap{"username": "admin"}, true},
+		{"EmptyPassword", kvMap{"username": "admin", "password": ""}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := validateBasicAuth(tt.data); (err != nil) != tt.wantErr {
+				t.Errorf("validateBasicAuth() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+
+	input := SopsSecretGenerator{Type: basicAuthType, UsernameFile: "testdata/file.txt", PasswordFile: "testdata/file2.txt"}
+	data, _, err := generateData(context.Background(), input, nil, Options{})
+	if err != nil {
+		t.Fatalf("generateData() error = %v", err)
+	}
+	if data[basicAuthUsernameKey] == "" || data[basicAuthPasswordKey] == "" {
+		t.Errorf("generateData() got keys %v, want %v and %v", dataKeys(data), basicAuthUsernameKey, basicAuthPasswordKey)
+	}
+}
+
+func Test_validateTLS(t *testing.T) {
+	tests := []struct {
+		name     string
+		certFile string
+		keyFile  string
+		wantErr  bool
+	}{
+		{"Pair", "testdata/tls.crt", "testdata/tls.key", false},
+		{"Mismatch", "testdata/tls.crt", "testdata/tls-other.key", true},
+		{"NotPEM", "testdata/file.txt", "testdata/tls.key", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			input := SopsSecretGenerator{Type: tlsType, CertFile: tt.certFile, KeyFile: tt.keyFile}
+			data, _, err := generateData(context.Background(), input, nil, Options{})
+			if (err != nil) != tt.wantErr {
+				t.Errorf("generateData() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if !tt.wantErr && (data[tlsCertKey] == "" || data[tlsKeyKey] == "") {
+				t.Errorf("generateData() got keys %v, want %v and %v", dataKeys(data), tlsCertKey, tlsKeyKey)
+			}
+		})
+	}
+	if err := validateTLS(kvMap{tlsCertKey: "cert"}); err == nil {
+		t.Errorf("validateTLS() error = nil, want missing key error")
+	}
+}
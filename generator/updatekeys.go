@@ -0,0 +1,144 @@
+// Copyright 2019 Go About B.V. and contributors
+// Licensed under the Apache License, Version 2.0.
+
+package generator
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// sopsCommand is the sops binary that updates the keys of sources.
+var sopsCommand = "sops"
+
+// UpdateKeys reads a SopsSecretGenerator spec and runs sops updatekeys on its
+// sops-encrypted local sources, so that they are encrypted to the keys of
+// the matching creation rule in .sops.yaml, such as the key of a new team
+// member. With opts.RotateDataKey, sops also replaces the data key of every
+// source. Sops runs with the sops settings of the spec, and every source is
+// updated once, even if several specs use it. The errors of all sources are
+// reported. Vault, remote and plain sources are skipped.
+func UpdateKeys(spec []byte, opts Options) error {
+	return UpdateKeysContext(context.Background(), spec, opts)
+}
+
+// UpdateKeysContext is like UpdateKeys, but aborts sops when ctx is done.
+func UpdateKeysContext(ctx context.Context, spec []byte, opts Options) error {
+	docs, err := splitDocuments(spec)
+	if err != nil {
+		return withClass(ClassSpec, err)
+	}
+	done := make(map[string]bool)
+	var errs []error
+	for _, doc := range docs {
+		input, err := readInput(doc, opts)
+		if err != nil {
+			return err
+		}
+		inputs, err := expandSecrets(input)
+		if err != nil {
+			return withClass(ClassSpec, err)
+		}
+		for _, input := range inputs {
+			errs = append(errs, updateKeysInput(ctx, input, done, opts))
+		}
+	}
+	return combineErrors(errs...)
+}
+
+// updateKeysInput updates the keys of the sources of input that are not in
+// done, and adds them to it.
+func updateKeysInput(ctx context.Context, input SopsSecretGenerator, done map[string]bool, opts Options) error {
+	restore, err := input.Sops.withDefaults(opts).apply()
+	if err != nil {
+		return withClass(ClassSpec, err)
+	}
+	defer restore()
+	opts = input.Sops.decryptOptions(opts)
+
+	sources, err := encryptedSources(input)
+	if err != nil {
+		return withClass(ClassSpec, err)
+	}
+	var errs []error
+	for _, source := range sources {
+		if !isLocalPath(source.Path) || done[filepath.Clean(source.Path)] {
+			continue
+		}
+		done[filepath.Clean(source.Path)] = true
+		err := updateSourceKeys(ctx, source, input.Sops.ConfigPath, opts)
+		if err != nil {
+			errs = append(errs, withClass(ClassSource, errors.Wrapf(err, "source %v", source.Path)))
+		}
+	}
+	return combineErrors(errs...)
+}
+
+// updateSourceKeys runs sops updatekeys on a source, and sops --rotate if the
+// data key is rotated too, with the sops configuration file config if set.
+// Sops is only told the format of sources with a format option; it finds
+// that of others from their extension.
+func updateSourceKeys(ctx context.Context, source Source, config string, opts Options) error {
+	var formatArgs []string
+	if source.Format != "" {
+		format, err := source.format(source.Path)
+		if err != nil {
+			return err
+		}
+		formatArgs = []string{"--input-type", sopsFormat(format)}
+	}
+	args := append([]string{"updatekeys", "--yes"}, formatArgs...)
+	err := runSops(ctx, config, opts, append(args, source.Path)...)
+	if err != nil {
+		return err
+	}
+	if !opts.RotateDataKey {
+		return nil
+	}
+	args = []string{"--rotate", "--in-place"}
+	if len(formatArgs) > 0 {
+		args = append(args, append(formatArgs, "--output-type", formatArgs[1])...)
+	}
+	return runSops(ctx, config, opts, append(args, source.Path)...)
+}
+
+// runSops runs sops with args, reporting its standard error on failure.
+// Its standard input is empty, so that a prompt cannot block. If config is
+// set, sops uses it as its configuration file. Sops gets the AWS profile and
+// region of opts, if set, in its environment.
+func runSops(ctx context.Context, config string, opts Options, args ...string) error {
+	cmdArgs := args
+	if config != "" {
+		cmdArgs = append([]string{"--config", config}, args...)
+	}
+	cmd := exec.CommandContext(ctx, sopsCommand, cmdArgs...)
+	if opts.AWSProfile != "" || opts.AWSRegion != "" {
+		cmd.Env = os.Environ()
+		if opts.AWSProfile != "" {
+			cmd.Env = append(cmd.Env, "AWS_PROFILE="+opts.AWSProfile)
+		}
+		if opts.AWSRegion != "" {
+			cmd.Env = append(cmd.Env, "AWS_REGION="+opts.AWSRegion)
+		}
+	}
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	err := cmd.Run()
+	if ctx.Err() != nil {
+		return ctx.Err()
+	}
+	if err != nil {
+		if msg := strings.TrimSpace(stderr.String()); msg != "" {
+			return fmt.Errorf("sops %v: %v", args[0], msg)
+		}
+		return errors.Wrapf(err, "sops %v", args[0])
+	}
+	return nil
+}
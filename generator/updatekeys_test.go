@@ -0,0 +1,140 @@
+// Copyright 2019 Go About B.V. and contributors
+// Licensed under the Apache License, Version 2.0.
+
+package generator
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func Test_updateKeysInput(t *testing.T) {
+	dir, err := ioutil.TempDir("", "generator-updatekeys-test-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	// The fake sops logs its arguments, and fails for files named fail.*
+	log := filepath.Join(dir, "sops.log")
+	script := "#!/bin/sh\necho \"$@\" >> " + log + "\ncase \"$*\" in *fail.*) echo 'could not decrypt data key' >&2; exit 1;; esac\n"
+	err = ioutil.WriteFile(filepath.Join(dir, "sops"), []byte(script), 0755)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sopsCommand = filepath.Join(dir, "sops")
+	defer func() { sopsCommand = "sops" }()
+
+	tests := []struct {
+		name    string
+		input   SopsSecretGenerator
+		rotate  bool
+		want    []string
+		wantErr bool
+	}{
+		{
+			"Sources",
+			SopsSecretGenerator{
+				EnvSources: []Source{
+					{Path: "testdata/vars.env"},
+					{Path: "testdata/plain.env", Plain: true},
+					{Path: "testdata/vars.env"},
+				},
+				FileSources: []Source{
+					{Path: "secret=testdata/file.txt"},
+					{Path: "config=testdata/config.enc", Format: "yaml"},
+					{Path: "vault://kv/app#password"},
+					{Path: "missing=testdata/missing.txt", Optional: true},
+				},
+			},
+			false,
+			[]string{
+				"updatekeys --yes testdata/vars.env",
+				"updatekeys --yes testdata/file.txt",
+				"updatekeys --yes --input-type yaml testdata/config.enc",
+			},
+			false,
+		},
+		{
+			"Rotate",
+			SopsSecretGenerator{
+				FileSources: []Source{
+					{Path: "secret=testdata/file.txt"},
+					{Path: "config=testdata/config.enc", Format: "yaml"},
+				},
+			},
+			true,
+			[]string{
+				"updatekeys --yes testdata/file.txt",
+				"--rotate --in-place testdata/file.txt",
+				"updatekeys --yes --input-type yaml testdata/config.enc",
+				"--rotate --in-place --input-type yaml --output-type yaml testdata/config.enc",
+			},
+			false,
+		},
+		{
+			"ConfigPath",
+			SopsSecretGenerator{
+				EnvSources: sources("testdata/vars.env"),
+				Sops:       SopsConfig{ConfigPath: "testdata/sourcedir/.sops.yaml"},
+			},
+			true,
+			[]string{
+				"--config testdata/sourcedir/.sops.yaml updatekeys --yes testdata/vars.env",
+				"--config testdata/sourcedir/.sops.yaml --rotate --in-place testdata/vars.env",
+			},
+			false,
+		},
+		{
+			"Fail",
+			SopsSecretGenerator{EnvSources: sources("testdata/fail.env", "testdata/vars.env")},
+			false,
+			[]string{
+				"updatekeys --yes testdata/fail.env",
+				"updatekeys --yes testdata/vars.env",
+			},
+			true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_ = os.Remove(log)
+			err := updateKeysInput(context.Background(), tt.input, make(map[string]bool), Options{RotateDataKey: tt.rotate})
+			if (err != nil) != tt.wantErr {
+				t.Errorf("updateKeysInput() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			content, err := ioutil.ReadFile(log)
+			if err != nil {
+				t.Fatal(err)
+			}
+			got := strings.Split(strings.TrimSpace(string(content)), "\n")
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("updateKeysInput() ran sops %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func Test_runSops(t *testing.T) {
+	dir, err := ioutil.TempDir("", "generator-runsops-test-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	// The fake sops fails with the AWS settings of its environment
+	err = ioutil.WriteFile(filepath.Join(dir, "sops"), []byte("#!/bin/sh\necho \"$AWS_PROFILE $AWS_REGION\" >&2\nexit 1\n"), 0755)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sopsCommand = filepath.Join(dir, "sops")
+	defer func() { sopsCommand = "sops" }()
+
+	err = runSops(context.Background(), "", Options{AWSProfile: "prod", AWSRegion: "eu-west-1"}, "updatekeys")
+	if want := "sops updatekeys: prod eu-west-1"; err == nil || err.Error() != want {
+		t.Errorf("runSops() error = %v, want %v", err, want)
+	}
+}
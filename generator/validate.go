@@ -0,0 +1,21 @@
+// Copyright 2019 Go About B.V. and contributors
+// Licensed under the Apache License, Version 2.0.
+
+package generator
+
+import "context"
+
+// Validate reads a SopsSecretGenerator spec, resolves and decrypts all of its
+// sources and checks the Secrets that it generates, without returning them.
+// It reports the errors of all sources, as with AllErrors.
+func Validate(spec []byte, opts Options) error {
+	return ValidateContext(context.Background(), spec, opts)
+}
+
+// ValidateContext is like Validate, but aborts decryption when ctx is done.
+func ValidateContext(ctx context.Context, spec []byte, opts Options) error {
+	opts.AllErrors = true
+	opts.Summary = nil
+	_, err := GenerateContext(ctx, spec, opts)
+	return err
+}
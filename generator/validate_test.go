@@ -0,0 +1,54 @@
+// Copyright 2019 Go About B.V. and contributors
+// Licensed under the Apache License, Version 2.0.
+
+package generator
+
+import (
+	"io/ioutil"
+	"strings"
+	"testing"
+)
+
+func TestValidate(t *testing.T) {
+	tests := []struct {
+		name    string
+		spec    string
+		wantErr bool
+	}{
+		{"Valid", "testdata/generator.yaml", false},
+		{"InvalidEnvs", "testdata/generator-invalidenv.yaml", true},
+		{"WrongKind", "testdata/generator-wrongkind.yaml", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			spec, err := ioutil.ReadFile(tt.spec)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if err := Validate(spec, Options{}); (err != nil) != tt.wantErr {
+				t.Errorf("Validate() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestValidate_AllErrors(t *testing.T) {
+	spec := []byte(`apiVersion: goabout.com/v1beta1
+kind: SopsSecretGenerator
+metadata:
+  name: secret
+files:
+  - testdata/missing.txt
+  - testdata/file.txt
+  - testdata/missing2.txt
+`)
+	err := Validate(spec, Options{})
+	if err == nil {
+		t.Fatal("Validate() error = nil, want an error")
+	}
+	for _, fn := range []string{"testdata/missing.txt", "testdata/missing2.txt"} {
+		if !strings.Contains(err.Error(), fn) {
+			t.Errorf("Validate() error = %v, want an error for %v", err, fn)
+		}
+	}
+}
@@ -0,0 +1,189 @@
+// Copyright 2019 Go About B.V. and contributors
+// Licensed under the Apache License, Version 2.0.
+
+package generator
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// vaultScheme is the prefix of sources that are read from Vault KV instead
+// of sops-encrypted files.
+const vaultScheme = "vault://"
+
+// isVaultPath returns whether a source path refers to Vault.
+func isVaultPath(source string) bool {
+	return strings.HasPrefix(source, vaultScheme)
+}
+
+// splitVaultPath splits a Vault source into the API path of the secret and
+// the field after '#', if any.
+func splitVaultPath(source string) (secretPath string, field string) {
+	secretPath = strings.TrimPrefix(source, vaultScheme)
+	if i := strings.LastIndex(secretPath, "#"); i >= 0 {
+		secretPath, field = secretPath[:i], secretPath[i+1:]
+	}
+	return strings.Trim(secretPath, "/"), field
+}
+
+// readVault reads the key/values of a Vault KV secret. The path is that of the
+// API, so it includes "data/" for version 2 of the KV engine.
+func readVault(ctx context.Context, source string) (map[string]interface{}, error) {
+	secretPath, field := splitVaultPath(source)
+	if field != "" {
+		return nil, errors.New("env sources from Vault cannot select a field")
+	}
+	return readVaultSecret(ctx, secretPath)
+}
+
+// readVaultField reads one field of a Vault KV secret, which must be a
+// string.
+func readVaultField(ctx context.Context, source string) ([]byte, error) {
+	secretPath, field := splitVaultPath(source)
+	if field == "" {
+		return nil, errors.New("file sources from Vault must select a field with #FIELD")
+	}
+	d, err := readVaultSecret(ctx, secretPath)
+	if err != nil {
+		return nil, err
+	}
+	value, ok := d[field]
+	if !ok {
+		return nil, fmt.Errorf("field %v not found", field)
+	}
+	s, ok := value.(string)
+	if !ok {
+		return nil, fmt.Errorf("field %v must be a string", field)
+	}
+	return []byte(s), nil
+}
+
+func readVaultSecret(ctx context.Context, secretPath string) (map[string]interface{}, error) {
+	addr := os.Getenv("VAULT_ADDR")
+	if addr == "" {
+		return nil, errors.New("VAULT_ADDR must be set to read from Vault")
+	}
+	token, err := vaultToken()
+	if err != nil {
+		return nil, err
+	}
+
+	req, err := http.NewRequest("GET", strings.TrimRight(addr, "/")+"/v1/"+secretPath, nil)
+	if err != nil {
+		return nil, err
+	}
+	req = req.WithContext(ctx)
+	req.Header.Set("X-Vault-Token", token)
+	if namespace := os.Getenv("VAULT_NAMESPACE"); namespace != "" {
+		req.Header.Set("X-Vault-Namespace", namespace)
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	var body struct {
+		Data   map[string]interface{} `json:"data"`
+		Errors []string               `json:"errors"`
+	}
+	decoder := json.NewDecoder(resp.Body)
+	decoder.UseNumber()
+	err = decoder.Decode(&body)
+	if resp.StatusCode == http.StatusNotFound {
+		return nil, fmt.Errorf("secret %v not found in Vault", secretPath)
+	}
+	if resp.StatusCode != http.StatusOK {
+		if len(body.Errors) > 0 {
+			return nil, fmt.Errorf("secret %v: Vault returned %v: %v", secretPath, resp.Status, strings.Join(body.Errors, ", "))
+		}
+		return nil, fmt.Errorf("secret %v: Vault returned %v", secretPath, resp.Status)
+	}
+	if err != nil {
+		return nil, errors.Wrap(err, "Vault response")
+	}
+	return vaultData(body.Data), nil
+}
+
+// vaultData returns the key/values of a secret, unwrapping the data and
+// metadata of version 2 of the KV engine.
+func vaultData(d map[string]interface{}) map[string]interface{} {
+	inner, ok := d["data"].(map[string]interface{})
+	if _, hasMetadata := d["metadata"].(map[string]interface{}); ok && hasMetadata && len(d) == 2 {
+		return inner
+	}
+	return d
+}
+
+// defaultVaultAppRolePath is the path at which the AppRole auth method is
+// mounted, unless the configuration sets another.
+const defaultVaultAppRolePath = "approle"
+
+// vaultAppRoleLogin logs in to the AppRole auth method mounted at mount and
+// returns the client token.
+func vaultAppRoleLogin(addr string, namespace string, mount string, roleID string, secretID string) (string, error) {
+	credentials, err := json.Marshal(map[string]string{"role_id": roleID, "secret_id": secretID})
+	if err != nil {
+		return "", err
+	}
+	url := strings.TrimRight(addr, "/") + "/v1/auth/" + strings.Trim(mount, "/") + "/login"
+	req, err := http.NewRequest("POST", url, bytes.NewReader(credentials))
+	if err != nil {
+		return "", err
+	}
+	if namespace != "" {
+		req.Header.Set("X-Vault-Namespace", namespace)
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+
+	var body struct {
+		Auth struct {
+			ClientToken string `json:"client_token"`
+		} `json:"auth"`
+		Errors []string `json:"errors"`
+	}
+	err = json.NewDecoder(resp.Body).Decode(&body)
+	if resp.StatusCode != http.StatusOK {
+		if len(body.Errors) > 0 {
+			return "", fmt.Errorf("AppRole login: Vault returned %v: %v", resp.Status, strings.Join(body.Errors, ", "))
+		}
+		return "", fmt.Errorf("AppRole login: Vault returned %v", resp.Status)
+	}
+	if err != nil {
+		return "", errors.Wrap(err, "Vault response")
+	}
+	if body.Auth.ClientToken == "" {
+		return "", errors.New("AppRole login: Vault returned no token")
+	}
+	return body.Auth.ClientToken, nil
+}
+
+// vaultToken returns the token from VAULT_TOKEN, or the token file that the
+// Vault CLI writes on login.
+func vaultToken() (string, error) {
+	if token := os.Getenv("VAULT_TOKEN"); token != "" {
+		return token, nil
+	}
+	home, err := os.UserHomeDir()
+	if err == nil {
+		token, err := ioutil.ReadFile(filepath.Join(home, ".vault-token"))
+		if err == nil {
+			return strings.TrimSpace(string(token)), nil
+		}
+	}
+	return "", errors.New("VAULT_TOKEN must be set or ~/.vault-token exist to read from Vault")
+}
@@ -0,0 +1,98 @@
+// Copyright 2019 Go About B.V. and contributors
+// Licensed under the Apache License, Version 2.0.
+
+package generator
+
+import (
+	"context"
+
+	"github.com/pkg/errors"
+)
+
+// Verify reads a SopsSecretGenerator spec and checks the integrity of its
+// sops-encrypted sources: that their sops metadata is complete, and that
+// their message authentication code matches, which it does not for files
+// that were edited by hand or damaged. The sources are decrypted to check
+// the MAC, but their plaintext is not parsed or returned. The errors of all
+// sources are reported. Vault and plain sources are skipped.
+func Verify(spec []byte, opts Options) error {
+	return VerifyContext(context.Background(), spec, opts)
+}
+
+// VerifyContext is like Verify, but aborts decryption when ctx is done.
+func VerifyContext(ctx context.Context, spec []byte, opts Options) error {
+	docs, err := splitDocuments(spec)
+	if err != nil {
+		return withClass(ClassSpec, err)
+	}
+	var errs []error
+	for _, doc := range docs {
+		input, err := readInput(doc, opts)
+		if err != nil {
+			return err
+		}
+		inputs, err := expandSecrets(input)
+		if err != nil {
+			return withClass(ClassSpec, err)
+		}
+		for _, input := range inputs {
+			errs = append(errs, verifyInput(ctx, input, opts))
+		}
+	}
+	return combineErrors(errs...)
+}
+
+func verifyInput(ctx context.Context, input SopsSecretGenerator, opts Options) error {
+	restore, err := input.Sops.withDefaults(opts).apply()
+	if err != nil {
+		return withClass(ClassSpec, err)
+	}
+	defer restore()
+	opts = input.Sops.decryptOptions(opts)
+	opts.IgnoreMAC = false
+
+	sources, err := encryptedSources(input)
+	if err != nil {
+		return withClass(ClassSpec, err)
+	}
+	var errs []error
+	for _, source := range sources {
+		if isVaultPath(source.Path) {
+			continue
+		}
+		err := verifySource(ctx, source, opts)
+		if err != nil {
+			errs = append(errs, withClass(ClassSource, errors.Wrapf(err, "source %v", source.Path)))
+		}
+	}
+	return combineErrors(errs...)
+}
+
+// verifySource checks the sops metadata and the MAC of a source, discarding
+// the decrypted content.
+func verifySource(ctx context.Context, source Source, opts Options) error {
+	format, err := source.format(source.Path)
+	if err != nil {
+		return err
+	}
+	content, err := readSource(ctx, source.Path, opts)
+	if err != nil {
+		return err
+	}
+	err = verifyChecksum(content, source.Checksum)
+	if err != nil {
+		return err
+	}
+	tree, err := newSopsStore(format).LoadEncryptedFile(content)
+	if err != nil {
+		return errors.Wrap(err, "sops metadata")
+	}
+	switch {
+	case tree.Metadata.MessageAuthenticationCode == "":
+		return errors.New("sops metadata has no MAC")
+	case tree.Metadata.LastModified.IsZero():
+		return errors.New("sops metadata has no lastmodified time")
+	}
+	_, err = decrypt(ctx, content, sopsFormat(format), opts)
+	return err
+}
@@ -0,0 +1,37 @@
+// Copyright 2019 Go About B.V. and contributors
+// Licensed under the Apache License, Version 2.0.
+
+package generator
+
+import "testing"
+
+func TestVerify(t *testing.T) {
+	tests := []struct {
+		name    string
+		files   string
+		wantErr bool
+	}{
+		{"Valid", "[testdata/file.txt]", false},
+		{"BadMAC", "[testdata/file-badmac.txt]", true},
+		{"Missing", "[testdata/missing.txt]", true},
+		{"OptionalMissing", "[{path: testdata/missing.txt, optional: true}]", false},
+		{"Plain", "[{path: testdata/plain.txt, plain: true}]", false},
+		{"NotEncrypted", "[testdata/plain.txt]", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			spec := []byte("apiVersion: goabout.com/v1beta1\nkind: SopsSecretGenerator\nmetadata:\n  name: secret\nfiles: " + tt.files + "\n")
+			err := Verify(spec, Options{})
+			if (err != nil) != tt.wantErr {
+				t.Errorf("Verify() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestVerify_IgnoreMAC(t *testing.T) {
+	spec := []byte("apiVersion: goabout.com/v1beta1\nkind: SopsSecretGenerator\nmetadata:\n  name: secret\nfiles: [testdata/file-badmac.txt]\n")
+	if err := Verify(spec, Options{IgnoreMAC: true}); err == nil {
+		t.Errorf("Verify() with IgnoreMAC error = nil, want a MAC error")
+	}
+}
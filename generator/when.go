@@ -0,0 +1,76 @@
+// Copyright 2019 Go About B.V. and contributors
+// Licensed under the Apache License, Version 2.0.
+
+package generator
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"text/template"
+
+	"github.com/pkg/errors"
+)
+
+// conditionData is available to the when conditions of sources.
+type conditionData struct {
+	// Env contains the environment variables
+	Env map[string]string
+}
+
+// includedSources returns the sources whose when condition is true, or that
+// have none.
+func includedSources(sources []Source) ([]Source, error) {
+	var data *conditionData
+	var included []Source
+	for _, source := range sources {
+		if source.When == "" {
+			included = append(included, source)
+			continue
+		}
+		if data == nil {
+			data = &conditionData{Env: environ()}
+		}
+		include, err := evaluateCondition(source.When, data)
+		if err != nil {
+			return nil, errors.Wrapf(err, "source %v", source.Path)
+		}
+		if include {
+			included = append(included, source)
+		}
+	}
+	return included, nil
+}
+
+// evaluateCondition executes a when template, which must result in true or
+// false.
+func evaluateCondition(condition string, data *conditionData) (bool, error) {
+	tmpl, err := template.New("when").Option("missingkey=zero").Parse(condition)
+	if err != nil {
+		return false, errors.Wrap(err, "invalid when condition")
+	}
+	var buf bytes.Buffer
+	err = tmpl.Execute(&buf, data)
+	if err != nil {
+		return false, errors.Wrap(err, "invalid when condition")
+	}
+	result, err := strconv.ParseBool(strings.TrimSpace(buf.String()))
+	if err != nil {
+		return false, fmt.Errorf("when condition must result in true or false, not %q", buf.String())
+	}
+	return result, nil
+}
+
+// environ returns the environment variables as a map.
+func environ() map[string]string {
+	env := make(map[string]string)
+	for _, kv := range os.Environ() {
+		parts := strings.SplitN(kv, "=", 2)
+		if len(parts) == 2 {
+			env[parts[0]] = parts[1]
+		}
+	}
+	return env
+}
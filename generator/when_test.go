@@ -0,0 +1,71 @@
+// Copyright 2019 Go About B.V. and contributors
+// Licensed under the Apache License, Version 2.0.
+
+package generator
+
+import (
+	"os"
+	"reflect"
+	"testing"
+)
+
+func Test_includedSources(t *testing.T) {
+	_ = os.Setenv("SOPSSECRETGENERATOR_TEST_ENVIRONMENT", "prod")
+	defer os.Unsetenv("SOPSSECRETGENERATOR_TEST_ENVIRONMENT")
+
+	prod := Source{Path: "prod.env", When: `{{ eq .Env.SOPSSECRETGENERATOR_TEST_ENVIRONMENT "prod" }}`}
+	dev := Source{Path: "dev.env", When: `{{ eq .Env.SOPSSECRETGENERATOR_TEST_ENVIRONMENT "dev" }}`}
+	tests := []struct {
+		name    string
+		sources []Source
+		want    []Source
+		wantErr bool
+	}{
+		{"NoConditions", sources("a.env", "b.env"), sources("a.env", "b.env"), false},
+		{"Conditions", []Source{{Path: "a.env"}, prod, dev}, []Source{{Path: "a.env"}, prod}, false},
+		{"Skipped", []Source{dev}, nil, false},
+		{"InvalidTemplate", []Source{{Path: "a.env", When: "{{ eq .Env.X"}}, nil, true},
+		{"NotBoolean", []Source{{Path: "a.env", When: "{{ .Env.SOPSSECRETGENERATOR_TEST_ENVIRONMENT }}"}}, nil, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := includedSources(tt.sources)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("includedSources() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("includedSources() got = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func Test_evaluateCondition(t *testing.T) {
+	data := &conditionData{Env: map[string]string{"ENVIRONMENT": "prod"}}
+	tests := []struct {
+		name      string
+		condition string
+		want      bool
+		wantErr   bool
+	}{
+		{"True", `{{ eq .Env.ENVIRONMENT "prod" }}`, true, false},
+		{"False", `{{ ne .Env.ENVIRONMENT "prod" }}`, false, false},
+		{"Missing", `{{ eq .Env.MISSING "" }}`, true, false},
+		{"Literal", "true", true, false},
+		{"Empty", `{{ .Env.MISSING }}`, false, true},
+		{"Invalid", `{{ eq }}`, false, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := evaluateCondition(tt.condition, data)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("evaluateCondition() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if got != tt.want {
+				t.Errorf("evaluateCondition() got = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,86 @@
+// Copyright 2019 Go About B.V. and contributors
+// Licensed under the Apache License, Version 2.0.
+
+package generator
+
+import (
+	"bytes"
+	"encoding/xml"
+	"io"
+	"strconv"
+	"strings"
+)
+
+type xmlElement struct {
+	name     string
+	attrs    []xml.Attr
+	text     strings.Builder
+	children []*xmlElement
+}
+
+// parseXMLContent flattens an XML document into keys made of the element
+// path, such as config.database.host. Repeated elements are indexed, as in
+// config.server.0. If attributes is set, attributes are included as
+// path@name keys. Mixed content and namespaces are handled best-effort:
+// text of elements with children is ignored and namespaces are dropped.
+func parseXMLContent(content []byte, data kvMap, attributes bool) error {
+	var root *xmlElement
+	var stack []*xmlElement
+	decoder := xml.NewDecoder(bytes.NewReader(content))
+	for {
+		token, err := decoder.Token()
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			return err
+		}
+		switch t := token.(type) {
+		case xml.StartElement:
+			el := &xmlElement{name: t.Name.Local, attrs: t.Attr}
+			if len(stack) == 0 {
+				root = el
+			} else {
+				parent := stack[len(stack)-1]
+				parent.children = append(parent.children, el)
+			}
+			stack = append(stack, el)
+		case xml.EndElement:
+			stack = stack[:len(stack)-1]
+		case xml.CharData:
+			if len(stack) > 0 {
+				stack[len(stack)-1].text.Write(t)
+			}
+		}
+	}
+	if root == nil {
+		return nil
+	}
+	flattenXMLElement(root, root.name, data, attributes)
+	return nil
+}
+
+func flattenXMLElement(el *xmlElement, path string, data kvMap, attributes bool) {
+	if attributes {
+		for _, attr := range el.attrs {
+			data[path+"@"+attr.Name.Local] = attr.Value
+		}
+	}
+	if len(el.children) == 0 {
+		data[path] = strings.TrimSpace(el.text.String())
+		return
+	}
+
+	counts := make(map[string]int)
+	for _, child := range el.children {
+		counts[child.name]++
+	}
+	indexes := make(map[string]int)
+	for _, child := range el.children {
+		childPath := path + "." + child.name
+		if counts[child.name] > 1 {
+			childPath += "." + strconv.Itoa(indexes[child.name])
+			indexes[child.name]++
+		}
+		flattenXMLElement(child, childPath, data, attributes)
+	}
+}
@@ -0,0 +1,45 @@
+// Copyright 2019 Go About B.V. and contributors
+// Licensed under the Apache License, Version 2.0.
+
+package generator
+
+import (
+	"reflect"
+	"testing"
+)
+
+func Test_parseXMLContent(t *testing.T) {
+	type args struct {
+		content    []byte
+		attributes bool
+	}
+	tests := []struct {
+		name    string
+		args    args
+		want    kvMap
+		wantErr bool
+	}{
+		{"Elements", args{b("<config><db><host>localhost</host><port> 5432 </port></db></config>"), false}, kvMap{"config.db.host": "localhost", "config.db.port": "5432"}, false},
+		{"Repeated", args{b("<config><server>a</server><server>b</server><name>c</name></config>"), false}, kvMap{"config.server.0": "a", "config.server.1": "b", "config.name": "c"}, false},
+		{"NestedRepeated", args{b("<c><s><h>a</h></s><s><h>b</h></s></c>"), false}, kvMap{"c.s.0.h": "a", "c.s.1.h": "b"}, false},
+		{"Attributes", args{b(`<config><user name="admin">secret</user></config>`), true}, kvMap{"config.user": "secret", "config.user@name": "admin"}, false},
+		{"IgnoreAttributes", args{b(`<config><user name="admin">secret</user></config>`), false}, kvMap{"config.user": "secret"}, false},
+		{"Namespace", args{b(`<c xmlns:x="urn:x"><x:key>val</x:key></c>`), false}, kvMap{"c.key": "val"}, false},
+		{"Declaration", args{b("<?xml version=\"1.0\"?>\n<!-- comment -->\n<key>val</key>\n"), false}, kvMap{"key": "val"}, false},
+		{"Empty", args{b(""), false}, kvMap{}, false},
+		{"Invalid", args{b("<config><key>val</config>"), false}, kvMap{}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := make(kvMap)
+			err := parseXMLContent(tt.args.content, got, tt.args.attributes)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("parseXMLContent() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if !tt.wantErr && !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("parseXMLContent() got = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,143 @@
+// Copyright 2019 Go About B.V. and contributors
+// Licensed under the Apache License, Version 2.0.
+
+package generator
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"sync/atomic"
+
+	"gopkg.in/yaml.v2"
+)
+
+// yamlMapping is a YAML mapping whose keys are the text they are written
+// with, such as NO or 1, instead of the booleans and numbers they resolve to.
+// A key that is defined more than once keeps its first position and its last
+// value, as in a map. The values are decoded like yamlValue.
+type yamlMapping yaml.MapSlice
+
+func (m *yamlMapping) UnmarshalYAML(unmarshal func(interface{}) error) error {
+	var items yaml.MapSlice
+	err := unmarshal(&items)
+	if err != nil {
+		return err
+	}
+	var keys map[yamlKey]yamlValue
+	err = unmarshal(&keys)
+	if err != nil {
+		return err
+	}
+
+	// The keys by the value they resolve to, in document order, to find the
+	// text of the key of every item
+	byValue := make(map[string][]yamlKey)
+	for k := range keys {
+		v := resolvedKey(k.resolved)
+		byValue[v] = append(byValue[v], k)
+	}
+	for _, ks := range byValue {
+		sort.Slice(ks, func(i, j int) bool { return ks[i].seq < ks[j].seq })
+	}
+
+	*m = make(yamlMapping, 0, len(keys))
+	byText := make(map[string]int)
+	for _, item := range items {
+		v := resolvedKey(item.Key)
+		ks := byValue[v]
+		if len(ks) == 0 {
+			// Null keys are not numbered, so that a second one has no key
+			// of its own; the map of keys has its last value
+			continue
+		}
+		byValue[v] = ks[1:]
+		if i, ok := byText[ks[0].text]; ok {
+			(*m)[i].Value = keys[ks[0]].value
+			continue
+		}
+		byText[ks[0].text] = len(*m)
+		*m = append(*m, yaml.MapItem{Key: ks[0].text, Value: keys[ks[0]].value})
+	}
+	return nil
+}
+
+// yamlKey is a YAML mapping key, with its text and the value it resolves to.
+// Null keys have no text.
+type yamlKey struct {
+	text     string
+	resolved interface{}
+	seq      uint64
+}
+
+// yamlKeySeq numbers the decoded keys. The keys of a mapping are decoded in
+// document order, so their numbers order keys that resolve to the same
+// value, such as 1 and 01.
+var yamlKeySeq uint64
+
+func (k *yamlKey) UnmarshalYAML(unmarshal func(interface{}) error) error {
+	err := unmarshal(&k.text)
+	if err != nil {
+		return err
+	}
+	k.seq = atomic.AddUint64(&yamlKeySeq, 1)
+	return unmarshal(&k.resolved)
+}
+
+// resolvedKey identifies the value of a key, including its type, so that the
+// key 1 differs from the key "1".
+func resolvedKey(v interface{}) string {
+	return fmt.Sprintf("%T %v", v, v)
+}
+
+// yamlValue is a decoded YAML value. Strings are strings, numbers and
+// booleans are a yamlScalar, mappings are a yaml.MapSlice like yamlMapping,
+// and sequences are an []interface{} of values.
+type yamlValue struct {
+	value interface{}
+}
+
+func (v *yamlValue) UnmarshalYAML(unmarshal func(interface{}) error) error {
+	var resolved interface{}
+	err := unmarshal(&resolved)
+	if err != nil {
+		return err
+	}
+	switch resolved.(type) {
+	case string:
+		v.value = resolved
+	case map[interface{}]interface{}:
+		var m yamlMapping
+		err = unmarshal(&m)
+		v.value = yaml.MapSlice(m)
+	case []interface{}:
+		var items []yamlValue
+		err = unmarshal(&items)
+		values := make([]interface{}, len(items))
+		for i, item := range items {
+			values[i] = item.value
+		}
+		v.value = values
+	default:
+		var text string
+		err = unmarshal(&text)
+		v.value = yamlScalar{text, resolved}
+	}
+	return err
+}
+
+// yamlScalar is a YAML number or boolean with the text it is written with,
+// so that 1.10, 01234, yes and 1e3 are not changed to 1.1, 668, true and
+// 1000. It is serialized as the value it resolves to.
+type yamlScalar struct {
+	text  string
+	value interface{}
+}
+
+func (s yamlScalar) MarshalJSON() ([]byte, error) {
+	return json.Marshal(s.value)
+}
+
+func (s yamlScalar) MarshalYAML() (interface{}, error) {
+	return s.value, nil
+}
@@ -13,7 +13,8 @@ require (
 	github.com/Azure/go-autorest/autorest/azure/auth v0.4.0 // indirect
 	github.com/Azure/go-autorest/autorest/to v0.3.0 // indirect
 	github.com/Azure/go-autorest/autorest/validation v0.2.0 // indirect
-	github.com/aws/aws-sdk-go v1.25.32 // indirect
+	github.com/BurntSushi/toml v1.2.1
+	github.com/aws/aws-sdk-go v1.25.32
 	github.com/golang/groupcache v0.0.0-20191027212112-611e8accdfc9 // indirect
 	github.com/howeyc/gopass v0.0.0-20190910152052-7cb4b85ec19c // indirect
 	github.com/konsorten/go-windows-terminal-sequences v1.0.2 // indirect
@@ -25,13 +26,13 @@ require (
 	github.com/smartystreets/goconvey v0.0.0-20190731233626-505e41936337 // indirect
 	go.mozilla.org/sops v0.0.0-20190912205235-14a22d7a7060
 	go.opencensus.io v0.22.2 // indirect
-	golang.org/x/crypto v0.0.0-20191111213947-16651526fdb4 // indirect
-	golang.org/x/net v0.0.0-20191109021931-daa7c04131f5 // indirect
-	golang.org/x/sys v0.0.0-20191110163157-d32e6e3b99c4 // indirect
-	google.golang.org/api v0.13.0 // indirect
+	golang.org/x/crypto v0.0.0-20211117183948-ae814b36b871
+	golang.org/x/net v0.0.0-20211112202133-69e39bad7dc2 // indirect
+	golang.org/x/sys v0.0.0-20210615035016-665e8c7367d1 // indirect
+	google.golang.org/api v0.13.0
 	google.golang.org/appengine v1.6.5 // indirect
 	google.golang.org/genproto v0.0.0-20191108220845-16a3f7862a1a // indirect
-	google.golang.org/grpc v1.25.1 // indirect
-	gopkg.in/ini.v1 v1.51.0 // indirect
+	google.golang.org/grpc v1.25.1
+	gopkg.in/ini.v1 v1.51.0
 	gopkg.in/yaml.v2 v2.2.5
 )